@@ -1,16 +1,58 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"cli-navidrome-helper/internal/app"
+	"cli-navidrome-helper/internal/config"
+	"cli-navidrome-helper/internal/version"
 )
 
+// errVersion is returned by parseFlags when --version was given.
+var errVersion = errors.New("version requested")
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		fmt.Println(version.Get())
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "promote" {
+		opts, err := parsePromoteFlags(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if err := app.Promote(opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		opts, err := parseInspectFlags(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if err := app.Inspect(opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	opts, err := parseFlags(os.Args[1:])
+	if errors.Is(err, errVersion) {
+		fmt.Println(version.Get())
+		return
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
@@ -18,6 +60,9 @@ func main() {
 
 	if err := app.Run(opts); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, app.ErrTimeout) {
+			os.Exit(3)
+		}
 		os.Exit(1)
 	}
 }
@@ -27,37 +72,198 @@ func parseFlags(args []string) (app.Options, error) {
 	fs.SetOutput(os.Stderr)
 
 	artist := fs.String("artist", "", "Artist folder name to group tracks (required)")
-	url := fs.String("url", "", "Pixeldrain download URL or ID (required)")
+	canonicalize := fs.Bool("canonicalize-artist", false, "Use MusicBrainz's canonical spelling of the artist for the folder name (prompts when ambiguous)")
+	var urls stringList
+	fs.Var(&urls, "url", "Pixeldrain download URL or ID, or a direct link to a .zip file (required; repeat to merge several archives into one artist)")
+	envFile := fs.String("env-file", "", "Load settings from this dotenv file instead of .env in the working directory")
 	tmpDir := fs.String("tmp-dir", "", "Temporary directory override")
 	keepTemp := fs.Bool("keep-temp", false, "Keep downloaded and extracted files instead of cleanup")
+	keepTempOnFailure := fs.Bool("keep-temp-on-failure", false, "Keep downloaded and extracted files only when the import fails, and print where they are")
+	noLock := fs.Bool("no-lock", false, "Do not take the lock that stops overlapping imports from running at once")
+	lockFile := fs.String("lock-file", "", "Lock file that serializes imports (default nd-import.lock in the temp directory)")
+	reuseTemp := fs.String("reuse-temp", "", "Prune and move a previously kept extract directory instead of downloading (--url not needed)")
+	resumeTemp := fs.String("resume-temp", "", "Resume an interrupted run in its kept temp folder (nd-import-*): reuse a complete download and skip entries already extracted")
 	dryRun := fs.Bool("dry-run", false, "Validate and plan actions without writing files")
+	diff := fs.Bool("diff", false, "Download and extract, then report each file as NEW, SAME or CHANGED against the library without writing (implies --dry-run)")
+	strictDryRun := fs.Bool("strict-dry-run", false, "Download and extract, run the prune and collision checks without writing, and exit 1 if the plan has collisions, prunes every file or leaves no audio (implies --dry-run)")
+	noCache := fs.Bool("no-cache", false, "Always query the Pixeldrain info/list API instead of reusing answers from the last few minutes of this process")
+	listPreview := fs.Bool("list", false, "Print the files of each Pixeldrain list URL with their indices, without downloading anything")
+	retryPartial := fs.String("retry-partial", "", "Re-fetch only the list files recorded in this retry file (written when some files of a list failed) into the same destination, or re-run the failed lines of a --batch")
+	listItem := fs.String("list-item", "", "For a Pixeldrain list URL, import only the file with this index (as shown by --list) or name")
+	validate := fs.Bool("validate", false, "Resolve each URL and check it is a downloadable zip (info API or HEAD), without downloading or writing anything")
+	insecure := fs.Bool("insecure-skip-verify", false, "UNSAFE: skip TLS certificate verification for Pixeldrain downloads and davs:// libraries (e.g. a self-signed mirror)")
+	apiBase := fs.String("pixeldrain-api-base", "", "Base URL of a self-hosted or mirror Pixeldrain API, e.g. https://pd.example.com/api (env PIXELDRAIN_API_BASE)")
+	caCert := fs.String("ca-cert", "", "PEM file with extra CA certificates to trust for Pixeldrain downloads and davs:// libraries")
+	timeout := fs.Duration("timeout", 0, "Abort an import that takes longer than this, e.g. 30m (0 disables; exit code 3)")
+	maxRateWait := fs.Duration("max-rate-limit-wait", app.DefaultMaxRateLimitWait, "Longest Retry-After to wait out when a download is rate limited (HTTP 429)")
+	maxHostConns := fs.Int("max-host-connections", 0, "Allow at most this many requests in flight to any one host, shared by all imports of the process (0 = no limit)")
+	hostDelay := fs.Duration("host-request-delay", 0, "Wait at least this long between the starts of two requests to the same host, e.g. 2s (0 disables)")
+	pauseHold := fs.Duration("pause-hold", app.DefaultPauseHold, "How long a download paused with SIGUSR1 keeps its connection open before closing it and resuming with a Range request after SIGUSR2")
+	unneededFile := fs.String("unneeded-file", "", "File of extra UNNEEDED_FILES doublestar patterns, one per line (# comments and blank lines ignored)")
+	pruneDupeExt := fs.Bool("prune-dupe-extensions", false, "Drop tracks that also exist in a more preferred format in the same folder")
+	preferFormat := fs.String("prefer-format", "flac,mp3", "Comma-separated format priority used by --prune-dupe-extensions, best first")
+	minBitrate := fs.Int("min-bitrate", 0, "Drop MP3 audio whose bitrate is below this many kbps, e.g. 256; other formats are kept and logged (0 disables)")
+	minSampleRate := fs.Int("min-sample-rate", 0, "Drop MP3 and FLAC audio whose sample rate is below this many Hz, e.g. 44100; other formats are kept and logged (0 disables)")
+	dropLossy := fs.Bool("drop-lossy-if-lossless", false, "Drop lossy audio from folders that also hold lossless audio (FLAC, WAV, ...)")
+	var only stringList
+	fs.Var(&only, "only", "Import only files matching this doublestar pattern, e.g. \"**/Disc 1/**\" (repeatable)")
+	var extractOnly stringList
+	fs.Var(&extractOnly, "extract-only", "Extract only archive entries matching this doublestar pattern, skipping the rest without reading them, e.g. \"**/*.flac\" (repeatable)")
+	trimPrefix := fs.Bool("trim-common-prefix", false, "Strip a prefix shared by every track in a folder, e.g. \"Album - 01 - Title.mp3\" -> \"01 - Title.mp3\"")
+	requireAudio := fs.Bool("require-audio", false, "Abort if no audio file (.mp3, .flac, .m4a, .ogg, .wav, .opus, ...) remains after extraction and pruning")
+	dedupeLibrary := fs.Bool("dedupe-across-library", false, "Report extracted tracks that already exist anywhere in the library (index cached for 24h)")
+	skipLibraryDupes := fs.Bool("skip-library-dupes", false, "Like --dedupe-across-library, but also leave those tracks out of the import")
+	classify := fs.Bool("classify", false, "Sort files into audio/, artwork/, docs/ and misc/ folders by extension (env CLASSIFY_EXTENSIONS adds ext=category pairs)")
+	normalizeDiscs := fs.Bool("normalize-discs", false, "Rename disc folders like CD1, cd 2 or Disc_03 to \"Disc N\"")
+	normalizeYear := fs.Bool("normalize-year", false, "Rename album folders like \"Album [2019]\" or \"2019 - Album\" to \"(2019) Album\"")
+	verifyTag := fs.Bool("verify-artist-tag", false, "Warn when the artist tags of sampled tracks do not match --artist")
+	strict := fs.Bool("strict", false, "Abort instead of warning when --verify-artist-tag finds a mismatch or --artist looks like a URL or Pixeldrain ID")
+	stripExt := fs.Bool("strip-extensions", false, "Rename files like song.mp3.1 or track.flac.download by dropping junk trailing extensions")
+	junkExt := fs.String("junk-extensions", "download,crdownload,part,partial,tmp,#", "Comma-separated extensions removed by --strip-extensions (# matches any number)")
+	dirMode := fs.String("dir-mode", "", "Octal permissions for created directories, e.g. 775 (default 755, env DIR_MODE)")
+	fileMode := fs.String("file-mode", "", "Octal permissions for created files, e.g. 664 (default: archive entry mode, env FILE_MODE)")
+	preserveModes := fs.Bool("preserve-modes", false, "UNSAFE: keep archive entry modes verbatim, including setuid/setgid/sticky and group/other write bits (dropped by default)")
+	owner := fs.String("owner", "", "Chown created library paths to uid:gid (env OWNER)")
+	rollback := fs.Bool("rollback-on-error", false, "Remove files and folders created by this run if moving into the library fails")
+	hardlink := fs.Bool("hardlink", false, "Hardlink extracted files into the library instead of copying (falls back to copying across filesystems)")
+	quietCollision := fs.String("quiet-collision", "", "Skip files that already exist in the library, logging each one (sizes, hash check) as a JSON line to this file")
+	overwriteWithinRun := fs.Bool("allow-overwrite-within-run", false, "When two archives of one run contain the same path, let the later one overwrite the earlier copy")
+	onCollision := fs.String("on-collision", app.CollisionAbort, "What to do when a file already exists in the library: abort, or keep-larger (skip identical files, otherwise keep the larger copy)")
+	subpath := fs.String("subpath", "", "Import below the artist folder, e.g. \"Live/2019\" (relative, no ..)")
+	stage := fs.Bool("stage", false, "Import into STAGING_PATH instead of the live library (see the promote command)")
+	dest := fs.String("dest", "", "Import into this directory (relative to the working directory) instead of NAVIDROME_MUSIC_PATH, e.g. to try the tool out; the env var is then not required")
+	normalizeExt := fs.Bool("normalize-audio-ext", false, "Lowercase audio file extensions during the move, e.g. .FLAC -> .flac")
+	sniff := fs.Bool("sniff", false, "Detect the type of files with unknown extensions from their content for --classify, --require-audio and pruning (keeps misnamed audio)")
+	cleanWhitespace := fs.Bool("clean-whitespace", false, "Collapse whitespace runs in moved folder and file names to single spaces and trim leading/trailing whitespace")
+	lowercaseExt := fs.Bool("lowercase-ext", false, "Lowercase the extension of every moved file, not just audio")
+	targetFS := fs.String("target-fs", "", "Check imported file and folder names against this filesystem before the move: ext4, exfat, ntfs or apfs (reserved characters, length, reserved names)")
+	fixTargetNames := fs.Bool("fix-target-names", false, "With --target-fs, rename names the filesystem cannot store instead of refusing the import")
+	maxNameLen := fs.Int("max-filename-length", 255, "Truncate file and folder names longer than this many bytes (0 disables)")
+	maxEntries := fs.Int("max-entries", app.DefaultMaxEntries, "Refuse archives with more entries than this before extracting")
+	recurseArchives := fs.Bool("recurse-archives", false, "Extract zips found inside the downloaded archive in place (up to 3 levels deep)")
+	streamExtract := fs.Bool("stream-extract", false, "Write archive entries straight into the library instead of extracting to a temp dir first (falls back when pruning or renaming needs the extracted tree)")
+	filenameEnc := fs.String("filename-encoding", app.FilenameEncodingAuto, "Encoding of zip entry names not marked as UTF-8: auto (CP437 when not valid UTF-8), utf-8, cp437 or shift-jis")
+	allowFormats := fs.String("allow-formats", "", "Comma-separated archive formats to accept, e.g. zip; others are rejected (default: all supported)")
+	onDupeEntry := fs.String("on-dupe-entry", app.DupeEntryRename, "What to do when an archive repeats an entry path: rename (add a suffix) or fail")
+	pruneSmaller := fs.String("prune-smaller-than", "", "Prune files smaller than this size, e.g. 1KB (0-byte placeholders, stub text files)")
+	pruneLarger := fs.String("prune-larger-than", "", "Prune non-audio files larger than this size, e.g. 200MB (audio is never pruned by size)")
+	minFree := fs.String("min-free-space", "", "Abort before the move if it would leave less than this free on the library volume, e.g. 10GB (env MIN_FREE_SPACE)")
+	pruneReport := fs.Bool("prune-report", false, "List the files each UNNEEDED_FILES pattern would remove, then stop without deleting or moving")
+	var pruneKeep stringList
+	fs.Var(&pruneKeep, "prune-keep", "Never prune files matching this doublestar pattern, even if UNNEEDED_FILES matches them, e.g. lyrics.txt (repeatable)")
+	respectCue := fs.Bool("respect-cue", false, "Never prune audio referenced by a kept .cue sheet; warn about missing references")
+	pruneOrder := fs.String("prune-order", strings.Join(app.DefaultPruneOrder, ","), "Rank of the prune rule groups keep (--prune-keep), except (--sniff, --respect-cue) and unneeded (UNNEEDED_FILES, size limits); a protection wins only when ranked before unneeded")
+	pruneDebug := fs.Bool("prune-debug", false, "Log, for every file, which prune rule removed or kept it")
+	pruneCascade := fs.Bool("prune-cascade", false, "Remove folders left empty by pruning, up to the archive root")
+	coverURL := fs.String("cover-url", "", "Download this image (JPEG, PNG or GIF) and save it as cover.jpg in the imported album folder")
+	replayGain := fs.Bool("replaygain", false, "After the move, write ReplayGain track/album tags per album folder with rsgain or loudgain (skipped with a warning if neither is installed)")
+	writeNFO := fs.Bool("write-nfo", false, "Write a Kodi album.nfo (title and track list) into each imported album folder without one")
+	summaryJSONFile := fs.String("summary-json-file", "", "Write a JSON summary of the import (result, error, stats) to this file when it finishes, also on failure; after --batch, the per-entry results")
+	tree := fs.Bool("tree", false, "After the import, print the files it added as a directory tree with sizes")
+	reportFile := fs.String("report-file", "", "Append a JSON line describing each import (success or failure) to this file")
+	caseInsensitive := fs.Bool("case-insensitive", false, "Treat destination names as case-insensitive when checking collisions (auto-detected when possible)")
+	sizeUnitsFlag := fs.String("size-units", "", "Print sizes in binary (KiB, MiB) or decimal (KB, MB) units (default binary, env SIZE_UNITS)")
+	importID := fs.String("import-id", "", "Tag every log line, JSON event, report and summary of this run with this ID (default: random); batch entries and watch jobs add -<n>")
+	jsonLines := fs.String("json-lines", "", "Stream newline-delimited JSON progress events to stdout, stderr or a file path")
+	batch := fs.String("batch", "", "File with one \"<artist> <url>\" import per line (replaces --artist/--url)")
+	stateFile := fs.String("state-file", "", "Batch state file recording completed lines (default <batch>.state)")
+	resume := fs.Bool("resume", false, "Skip batch lines already recorded as completed in the state file")
+	summaryTable := fs.Bool("summary-table", false, "After a --batch, print a table of each import's result, files moved, bytes and duration")
+	summaryJSON := fs.Bool("json", false, "Print the --summary-table as a JSON array")
+	watch := fs.String("watch", "", "Run as a daemon importing JSON job files dropped into this directory (replaces --artist/--url)")
+	watchInterval := fs.Duration("watch-interval", app.DefaultWatchInterval, "How often --watch checks for new job files")
+	printConfig := fs.Bool("print-config", false, "Print the effective configuration (env, --env-file and flags; secrets masked), then exit without importing")
+	showVersion := fs.Bool("version", false, "Print the build version, commit and Go version, then exit")
 
 	fs.Usage = func() {
 		fmt.Fprintf(fs.Output(), "Usage:\n")
-		fmt.Fprintf(fs.Output(), "  %s --artist <name> --url <pixeldrain-url> [options]\n", os.Args[0])
-		fmt.Fprintf(fs.Output(), "  %s \"<artist>\" \"<pixeldrain-url>\" [options]\n\n", os.Args[0])
-		fmt.Fprintln(fs.Output(), "Environment: NAVIDROME_MUSIC_PATH is required; UNNEEDED_FILES and PIXELDRAIN_TOKEN are optional.")
+		fmt.Fprintf(fs.Output(), "  %s --artist <name> --url <pixeldrain-url> [--url <pixeldrain-url>...] [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  %s \"<artist>\" \"<pixeldrain-url>\" [\"<pixeldrain-url>\"...] [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  %s --batch <file> [--resume] [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  %s --watch <dir> [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  %s promote --artist <name> [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  %s inspect --path <dir> [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  %s version\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Environment: NAVIDROME_MUSIC_PATH is required unless --dest is given; UNNEEDED_FILES, UNNEEDED_FILES_FILE, PIXELDRAIN_TOKEN and STAGING_PATH are optional.")
 		fs.PrintDefaults()
 	}
 
 	if err := fs.Parse(args); err != nil {
 		return app.Options{}, err
 	}
+	if *showVersion {
+		return app.Options{}, errVersion
+	}
 
-	// Support positional args: <artist> <url>
+	// Support positional args: <artist> <url> [<url>...]
 	positional := fs.Args()
 	if strings.TrimSpace(*artist) == "" && len(positional) >= 1 {
 		*artist = positional[0]
 	}
-	if strings.TrimSpace(*url) == "" && len(positional) >= 2 {
-		*url = positional[1]
+	if len(urls) == 0 && len(positional) >= 2 {
+		for _, u := range positional[1:] {
+			if strings.HasPrefix(u, "-") {
+				return app.Options{}, fmt.Errorf("flag %s must come before positional arguments", u)
+			}
+			urls.Set(u)
+		}
+	}
+
+	batchFile := strings.TrimSpace(*batch)
+	if batchFile == "" && (*resume || strings.TrimSpace(*stateFile) != "") {
+		return app.Options{}, fmt.Errorf("--resume and --state-file require --batch")
+	}
+	if batchFile == "" && *summaryTable {
+		return app.Options{}, fmt.Errorf("--summary-table requires --batch")
+	}
+	if *summaryJSON && !*summaryTable {
+		return app.Options{}, fmt.Errorf("--json requires --summary-table")
+	}
+	if jl := strings.TrimSpace(*jsonLines); *summaryJSON && (jl == "stdout" || jl == "-") {
+		return app.Options{}, fmt.Errorf("--json prints to stdout; send --json-lines to stderr or a file")
+	}
+	if (*listPreview || strings.TrimSpace(*listItem) != "") && (batchFile != "" || strings.TrimSpace(*watch) != "") {
+		return app.Options{}, fmt.Errorf("--list and --list-item apply to --url, not --batch or --watch")
+	}
+
+	watchDir := strings.TrimSpace(*watch)
+	if watchDir != "" {
+		switch {
+		case batchFile != "":
+			return app.Options{}, fmt.Errorf("--watch cannot be combined with --batch")
+		case strings.TrimSpace(*reuseTemp) != "":
+			return app.Options{}, fmt.Errorf("--watch cannot be combined with --reuse-temp")
+		case strings.TrimSpace(*artist) != "" || len(urls) > 0:
+			return app.Options{}, fmt.Errorf("--watch takes the artist and url from each job file; drop --artist/--url")
+		}
+		if info, err := os.Stat(watchDir); err != nil || !info.IsDir() {
+			return app.Options{}, fmt.Errorf("--watch %q is not a directory", watchDir)
+		}
+	}
+	if *maxEntries <= 0 {
+		return app.Options{}, fmt.Errorf("--max-entries must be positive")
+	}
+	if *watchInterval <= 0 {
+		return app.Options{}, fmt.Errorf("--watch-interval must be positive")
+	}
+
+	retryFile := strings.TrimSpace(*retryPartial)
+	if retryFile != "" {
+		switch {
+		case batchFile != "" || watchDir != "":
+			return app.Options{}, fmt.Errorf("--retry-partial cannot be combined with --batch or --watch")
+		case strings.TrimSpace(*reuseTemp) != "":
+			return app.Options{}, fmt.Errorf("--retry-partial cannot be combined with --reuse-temp")
+		case len(urls) > 0:
+			return app.Options{}, fmt.Errorf("--retry-partial takes its files from the retry file; drop --url")
+		}
 	}
 
 	var missing []string
-	if strings.TrimSpace(*artist) == "" {
+	if !*printConfig && !*listPreview && batchFile == "" && watchDir == "" && retryFile == "" && strings.TrimSpace(*artist) == "" {
 		missing = append(missing, "--artist")
 	}
-	if strings.TrimSpace(*url) == "" {
+	if !*printConfig && batchFile == "" && watchDir == "" && retryFile == "" && strings.TrimSpace(*reuseTemp) == "" && len(urls) == 0 {
 		missing = append(missing, "--url")
 	}
 	if len(missing) > 0 {
@@ -65,11 +271,481 @@ func parseFlags(args []string) (app.Options, error) {
 		return app.Options{}, fmt.Errorf("missing required flag(s): %s", strings.Join(missing, ", "))
 	}
 
+	dirPerm, err := parseModeFlag("--dir-mode", *dirMode)
+	if err != nil {
+		return app.Options{}, err
+	}
+	filePerm, err := parseModeFlag("--file-mode", *fileMode)
+	if err != nil {
+		return app.Options{}, err
+	}
+
+	var ownerOpt *config.Owner
+	if strings.TrimSpace(*owner) != "" {
+		o, err := config.ParseOwner(*owner)
+		if err != nil {
+			return app.Options{}, fmt.Errorf("--owner: %w", err)
+		}
+		ownerOpt = &o
+	}
+
+	if *maxNameLen < 0 || (*maxNameLen > 0 && *maxNameLen < 32) {
+		return app.Options{}, fmt.Errorf("--max-filename-length must be 0 (disabled) or at least 32, got %d", *maxNameLen)
+	}
+
+	if *timeout < 0 {
+		return app.Options{}, fmt.Errorf("--timeout must not be negative")
+	}
+	if *maxRateWait < 0 {
+		return app.Options{}, fmt.Errorf("--max-rate-limit-wait must not be negative")
+	}
+	if *maxHostConns < 0 || *hostDelay < 0 {
+		return app.Options{}, fmt.Errorf("--max-host-connections and --host-request-delay must not be negative")
+	}
+	if *pauseHold < 0 {
+		return app.Options{}, fmt.Errorf("--pause-hold must not be negative")
+	}
+
+	lockPath := strings.TrimSpace(*lockFile)
+	if lockPath != "" {
+		if *noLock {
+			return app.Options{}, fmt.Errorf("--lock-file cannot be combined with --no-lock")
+		}
+		abs, err := filepath.Abs(lockPath)
+		if err != nil {
+			return app.Options{}, fmt.Errorf("--lock-file: %w", err)
+		}
+		lockPath = abs
+	}
+
+	var pixeldrainAPIBase string
+	if strings.TrimSpace(*apiBase) != "" {
+		var err error
+		if pixeldrainAPIBase, err = config.ParseAPIBase(*apiBase); err != nil {
+			return app.Options{}, fmt.Errorf("--pixeldrain-api-base: %w", err)
+		}
+	}
+	caPath := strings.TrimSpace(*caCert)
+	if caPath != "" {
+		if *insecure {
+			return app.Options{}, fmt.Errorf("--ca-cert cannot be combined with --insecure-skip-verify")
+		}
+		abs, err := filepath.Abs(caPath)
+		if err != nil {
+			return app.Options{}, fmt.Errorf("--ca-cert: %w", err)
+		}
+		caPath = abs
+	}
+
+	cover := strings.TrimSpace(*coverURL)
+	if cover != "" {
+		if batchFile != "" || watchDir != "" {
+			return app.Options{}, fmt.Errorf("--cover-url applies to a single import; use the cover_url job option with --watch")
+		}
+		if u, err := url.Parse(cover); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return app.Options{}, fmt.Errorf("--cover-url must be an http(s) URL, got %q", cover)
+		}
+	}
+
+	order, err := app.ParsePruneOrder(*pruneOrder)
+	if err != nil {
+		return app.Options{}, fmt.Errorf("--prune-order: %w", err)
+	}
+
+	unneededPath := strings.TrimSpace(*unneededFile)
+	if unneededPath != "" {
+		abs, err := filepath.Abs(unneededPath)
+		if err != nil {
+			return app.Options{}, fmt.Errorf("--unneeded-file: %w", err)
+		}
+		unneededPath = abs
+	}
+
+	dupeEntry := strings.ToLower(strings.TrimSpace(*onDupeEntry))
+	if dupeEntry != app.DupeEntryRename && dupeEntry != app.DupeEntryFail {
+		return app.Options{}, fmt.Errorf("--on-dupe-entry must be %q or %q, got %q", app.DupeEntryRename, app.DupeEntryFail, *onDupeEntry)
+	}
+
+	collision := strings.ToLower(strings.TrimSpace(*onCollision))
+	if collision != app.CollisionAbort && collision != app.CollisionKeepLarger {
+		return app.Options{}, fmt.Errorf("--on-collision must be %q or %q, got %q", app.CollisionAbort, app.CollisionKeepLarger, *onCollision)
+	}
+	if collision == app.CollisionKeepLarger && strings.TrimSpace(*quietCollision) != "" {
+		return app.Options{}, fmt.Errorf("--on-collision keep-larger cannot be combined with --quiet-collision")
+	}
+
+	nameEncoding, ok := app.ParseFilenameEncoding(*filenameEnc)
+	if !ok {
+		return app.Options{}, fmt.Errorf("--filename-encoding must be auto, utf-8, cp437 or shift-jis, got %q", *filenameEnc)
+	}
+
+	var target string
+	if strings.TrimSpace(*targetFS) != "" {
+		if target, ok = app.ParseTargetFS(*targetFS); !ok {
+			return app.Options{}, fmt.Errorf("--target-fs must be ext4, exfat, ntfs or apfs, got %q", *targetFS)
+		}
+	} else if *fixTargetNames {
+		return app.Options{}, fmt.Errorf("--fix-target-names requires --target-fs")
+	}
+
+	allowed := parseFormats(*allowFormats)
+	for _, f := range allowed {
+		if !app.IsArchiveFormat(f) {
+			return app.Options{}, fmt.Errorf("--allow-formats: unknown format %q (known: %s)", f, strings.Join(app.ArchiveFormats(), ", "))
+		}
+	}
+
+	if *diff && (*validate || *pruneReport) {
+		return app.Options{}, fmt.Errorf("--diff cannot be combined with --validate or --prune-report")
+	}
+	if *strictDryRun && (*diff || *validate || *pruneReport || *listPreview) {
+		return app.Options{}, fmt.Errorf("--strict-dry-run cannot be combined with --diff, --validate, --prune-report or --list")
+	}
+
+	reuseDir := strings.TrimSpace(*reuseTemp)
+	if reuseDir != "" {
+		if batchFile != "" {
+			return app.Options{}, fmt.Errorf("--reuse-temp cannot be combined with --batch")
+		}
+		if *validate {
+			return app.Options{}, fmt.Errorf("--reuse-temp cannot be combined with --validate")
+		}
+		if *streamExtract {
+			return app.Options{}, fmt.Errorf("--reuse-temp cannot be combined with --stream-extract")
+		}
+		abs, err := filepath.Abs(reuseDir)
+		if err != nil {
+			return app.Options{}, fmt.Errorf("--reuse-temp: %w", err)
+		}
+		reuseDir = abs
+	}
+
+	destDir := strings.TrimSpace(*dest)
+	if destDir != "" {
+		if *stage {
+			return app.Options{}, fmt.Errorf("--dest cannot be combined with --stage")
+		}
+		abs, err := filepath.Abs(destDir)
+		if err != nil {
+			return app.Options{}, fmt.Errorf("--dest: %w", err)
+		}
+		destDir = abs
+	}
+
+	if id := strings.TrimSpace(*importID); id != "" && !app.ValidImportID(id) {
+		return app.Options{}, fmt.Errorf("--import-id must be 1-64 letters, digits, '.', '_' or '-', got %q", *importID)
+	}
+
+	resumeDir := strings.TrimSpace(*resumeTemp)
+	if resumeDir != "" {
+		switch {
+		case reuseDir != "":
+			return app.Options{}, fmt.Errorf("--resume-temp cannot be combined with --reuse-temp")
+		case batchFile != "" || watchDir != "":
+			return app.Options{}, fmt.Errorf("--resume-temp cannot be combined with --batch or --watch")
+		}
+		abs, err := filepath.Abs(resumeDir)
+		if err != nil {
+			return app.Options{}, fmt.Errorf("--resume-temp: %w", err)
+		}
+		resumeDir = abs
+	}
+
+	var units config.SizeUnits
+	if strings.TrimSpace(*sizeUnitsFlag) != "" {
+		units, err = config.ParseSizeUnits(*sizeUnitsFlag)
+		if err != nil {
+			return app.Options{}, fmt.Errorf("--size-units: %w", err)
+		}
+	}
+
+	var smallerThan, largerThan, minFreeSpace int64
+	for _, f := range []struct {
+		name, raw string
+		dest      *int64
+	}{
+		{"--prune-smaller-than", *pruneSmaller, &smallerThan},
+		{"--prune-larger-than", *pruneLarger, &largerThan},
+		{"--min-free-space", *minFree, &minFreeSpace},
+	} {
+		if strings.TrimSpace(f.raw) == "" {
+			continue
+		}
+		if *f.dest, err = config.ParseSize(f.raw); err != nil {
+			return app.Options{}, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	if smallerThan > 0 && largerThan > 0 && largerThan <= smallerThan {
+		return app.Options{}, fmt.Errorf("--prune-larger-than must be greater than --prune-smaller-than")
+	}
+
+	if *minBitrate < 0 || *minSampleRate < 0 {
+		return app.Options{}, fmt.Errorf("--min-bitrate and --min-sample-rate must not be negative")
+	}
+
+	formats := parseFormats(*preferFormat)
+	if *pruneDupeExt && len(formats) == 0 {
+		return app.Options{}, fmt.Errorf("--prefer-format must list at least one format when --prune-dupe-extensions is set")
+	}
+	junk := parseFormats(*junkExt)
+	if *stripExt && len(junk) == 0 {
+		return app.Options{}, fmt.Errorf("--junk-extensions must list at least one extension when --strip-extensions is set")
+	}
+
 	return app.Options{
-		Artist:   strings.TrimSpace(*artist),
-		URL:      strings.TrimSpace(*url),
-		TmpDir:   strings.TrimSpace(*tmpDir),
-		KeepTemp: *keepTemp,
-		DryRun:   *dryRun,
+		Artist:          strings.TrimSpace(*artist),
+		URLs:            urls,
+		EnvFile:         strings.TrimSpace(*envFile),
+		TmpDir:          strings.TrimSpace(*tmpDir),
+		KeepTemp:        *keepTemp,
+		NoLock:          *noLock,
+		LockFile:        lockPath,
+		DryRun:          *dryRun || *diff || *strictDryRun,
+		Validate:        *validate,
+		ListPreview:     *listPreview,
+		ListItem:        strings.TrimSpace(*listItem),
+		RetryPartial:    retryFile,
+		Diff:            *diff,
+		StrictDryRun:    *strictDryRun,
+		CaseInsensitive: *caseInsensitive,
+		Stage:           *stage,
+		Dest:            destDir,
+		Subpath:         *subpath,
+		DirMode:         dirPerm,
+		FileMode:        filePerm,
+		PreserveModes:   *preserveModes,
+		Owner:           ownerOpt,
+		RollbackOnError: *rollback,
+		Hardlink:        *hardlink,
+		QuietCollision:  strings.TrimSpace(*quietCollision),
+		OnCollision:     collision,
+		ReuseTemp:       reuseDir,
+		ResumeTemp:      resumeDir,
+
+		AllowOverwriteWithinRun: *overwriteWithinRun,
+		KeepTempOnFailure:       *keepTempOnFailure,
+
+		NoCache:            *noCache,
+		InsecureSkipVerify: *insecure,
+		CACert:             caPath,
+		PixeldrainAPIBase:  pixeldrainAPIBase,
+		MaxRateLimitWait:   *maxRateWait,
+		MaxHostConnections: *maxHostConns,
+		HostRequestDelay:   *hostDelay,
+		PauseHold:          *pauseHold,
+		Timeout:            *timeout,
+
+		MaxFilenameLength: *maxNameLen,
+		NormalizeAudioExt: *normalizeExt,
+		LowercaseExt:      *lowercaseExt,
+		CleanWhitespace:   *cleanWhitespace,
+		TargetFS:          target,
+		FixTargetNames:    *fixTargetNames,
+		Sniff:             *sniff,
+		OnDupeEntry:       dupeEntry,
+		AllowFormats:      allowed,
+		FilenameEncoding:  nameEncoding,
+		RecurseArchives:   *recurseArchives,
+		StreamExtract:     *streamExtract,
+		MaxEntries:        *maxEntries,
+		MinFreeSpace:      minFreeSpace,
+
+		CanonicalizeArtist: *canonicalize,
+
+		PruneDupeExtensions: *pruneDupeExt,
+		PreferFormats:       formats,
+		MinBitrate:          *minBitrate,
+		MinSampleRate:       *minSampleRate,
+		DropLossyIfLossless: *dropLossy,
+		Only:                only,
+		ExtractOnly:         extractOnly,
+		NormalizeDiscs:      *normalizeDiscs,
+		NormalizeYear:       *normalizeYear,
+		TrimCommonPrefix:    *trimPrefix,
+		Classify:            *classify,
+		DedupeLibrary:       *dedupeLibrary,
+		SkipLibraryDupes:    *skipLibraryDupes,
+		RequireAudio:        *requireAudio,
+		VerifyArtistTag:     *verifyTag,
+		Strict:              *strict,
+		StripExtensions:     *stripExt,
+		JunkExtensions:      junk,
+		RespectCue:          *respectCue,
+		PruneCascade:        *pruneCascade,
+		PruneSmallerThan:    smallerThan,
+		PruneLargerThan:     largerThan,
+		PruneReport:         *pruneReport,
+		PruneKeep:           pruneKeep,
+		PruneOrder:          order,
+		PruneDebug:          *pruneDebug,
+		UnneededFile:        unneededPath,
+		WriteNFO:            *writeNFO,
+		ReplayGain:          *replayGain,
+		CoverURL:            cover,
+
+		ReportFile:      strings.TrimSpace(*reportFile),
+		SummaryJSONFile: strings.TrimSpace(*summaryJSONFile),
+		Tree:            *tree,
+
+		BatchFile:    batchFile,
+		StateFile:    strings.TrimSpace(*stateFile),
+		Resume:       *resume,
+		SummaryTable: *summaryTable,
+		SummaryJSON:  *summaryJSON,
+
+		WatchDir:      watchDir,
+		WatchInterval: *watchInterval,
+
+		SizeUnits: units,
+		JSONLines: strings.TrimSpace(*jsonLines),
+		ImportID:  strings.TrimSpace(*importID),
+
+		PrintConfig: *printConfig,
 	}, nil
 }
+
+func parsePromoteFlags(args []string) (app.Options, error) {
+	fs := flag.NewFlagSet("nd-import promote", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	artist := fs.String("artist", "", "Staged artist folder to promote (required)")
+	dryRun := fs.Bool("dry-run", false, "Validate and plan actions without writing files")
+	caseInsensitive := fs.Bool("case-insensitive", false, "Treat destination names as case-insensitive when checking collisions (auto-detected when possible)")
+	rollback := fs.Bool("rollback-on-error", false, "Remove files and folders created by this run if the move fails")
+	envFile := fs.String("env-file", "", "Load settings from this dotenv file instead of .env in the working directory")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s promote --artist <name> [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  %s promote \"<artist>\" [options]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Moves ${STAGING_PATH}/<artist> into ${NAVIDROME_MUSIC_PATH}/<artist>; aborts on collisions.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return app.Options{}, err
+	}
+	if strings.TrimSpace(*artist) == "" && fs.NArg() >= 1 {
+		*artist = fs.Arg(0)
+	}
+	if strings.TrimSpace(*artist) == "" {
+		fs.Usage()
+		return app.Options{}, fmt.Errorf("missing required flag(s): --artist")
+	}
+
+	return app.Options{
+		Artist:          strings.TrimSpace(*artist),
+		DryRun:          *dryRun,
+		CaseInsensitive: *caseInsensitive,
+		RollbackOnError: *rollback,
+		EnvFile:         strings.TrimSpace(*envFile),
+	}, nil
+}
+
+// stringList collects a repeatable string flag, ignoring blank values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	if v = strings.TrimSpace(v); v != "" {
+		*l = append(*l, v)
+	}
+	return nil
+}
+
+func parseInspectFlags(args []string) (app.Options, error) {
+	fs := flag.NewFlagSet("nd-import inspect", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	path := fs.String("path", "", "Local folder to inspect, e.g. an existing artist folder (required)")
+	pruneSmaller := fs.String("prune-smaller-than", "", "Also report files smaller than this size, e.g. 1KB")
+	pruneLarger := fs.String("prune-larger-than", "", "Also report non-audio files larger than this size, e.g. 200MB")
+	var pruneKeep stringList
+	fs.Var(&pruneKeep, "prune-keep", "Never report files matching this doublestar pattern as prunable (repeatable)")
+	pruneOrder := fs.String("prune-order", strings.Join(app.DefaultPruneOrder, ","), "Rank of the prune rule groups keep, except and unneeded, as for imports")
+	pruneDebug := fs.Bool("prune-debug", false, "Log, for every file, which prune rule removed or kept it")
+	respectCue := fs.Bool("respect-cue", false, "Do not report audio referenced by a kept .cue sheet")
+	sizeUnitsFlag := fs.String("size-units", "", "Print sizes in binary (KiB, MiB) or decimal (KB, MB) units (default binary, env SIZE_UNITS)")
+	envFile := fs.String("env-file", "", "Load settings from this dotenv file instead of .env in the working directory")
+	unneededFile := fs.String("unneeded-file", "", "File of extra UNNEEDED_FILES doublestar patterns, one per line (# comments and blank lines ignored)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n")
+		fmt.Fprintf(fs.Output(), "  %s inspect --path <dir> [options]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "  %s inspect <dir> [options]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Prints the per-extension breakdown and total size of <dir> and which files UNNEEDED_FILES and the prune options would remove. Nothing is changed.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return app.Options{}, err
+	}
+	if strings.TrimSpace(*path) == "" && fs.NArg() >= 1 {
+		*path = fs.Arg(0)
+	}
+	if strings.TrimSpace(*path) == "" {
+		fs.Usage()
+		return app.Options{}, fmt.Errorf("missing required flag(s): --path")
+	}
+
+	opts := app.Options{
+		InspectPath:  strings.TrimSpace(*path),
+		PruneKeep:    pruneKeep,
+		PruneDebug:   *pruneDebug,
+		RespectCue:   *respectCue,
+		EnvFile:      strings.TrimSpace(*envFile),
+		UnneededFile: strings.TrimSpace(*unneededFile),
+	}
+	var err error
+	for _, f := range []struct {
+		name, raw string
+		dest      *int64
+	}{
+		{"--prune-smaller-than", *pruneSmaller, &opts.PruneSmallerThan},
+		{"--prune-larger-than", *pruneLarger, &opts.PruneLargerThan},
+	} {
+		if strings.TrimSpace(f.raw) == "" {
+			continue
+		}
+		if *f.dest, err = config.ParseSize(f.raw); err != nil {
+			return app.Options{}, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	if opts.PruneOrder, err = app.ParsePruneOrder(*pruneOrder); err != nil {
+		return app.Options{}, fmt.Errorf("--prune-order: %w", err)
+	}
+	if strings.TrimSpace(*sizeUnitsFlag) != "" {
+		if opts.SizeUnits, err = config.ParseSizeUnits(*sizeUnitsFlag); err != nil {
+			return app.Options{}, fmt.Errorf("--size-units: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// parseModeFlag parses an optional octal permission flag; empty means unset.
+func parseModeFlag(name, raw string) (os.FileMode, error) {
+	if strings.TrimSpace(raw) == "" {
+		return 0, nil
+	}
+	mode, err := config.ParseMode(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return mode, nil
+}
+
+// parseFormats splits a comma-separated extension list, normalizing entries
+// to lowercase without a leading dot.
+func parseFormats(raw string) []string {
+	var formats []string
+	for _, part := range strings.Split(raw, ",") {
+		f := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(part), "."))
+		if f != "" {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
@@ -4,4 +4,8 @@ go 1.22.2
 
 require github.com/joho/godotenv v1.5.1
 
-require github.com/bmatcuk/doublestar/v4 v4.9.1 // indirect
+require github.com/bmatcuk/doublestar/v4 v4.9.1
+
+require golang.org/x/crypto v0.31.0
+
+require golang.org/x/sys v0.28.0 // indirect
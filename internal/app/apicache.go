@@ -0,0 +1,48 @@
+package app
+
+import (
+	"sync"
+	"time"
+)
+
+// apiCacheTTL bounds how long Pixeldrain info and list responses are reused.
+// It is short: the cache only saves repeat lookups within one process (a
+// batch, a watch daemon, a dry-run estimate followed by the import).
+const apiCacheTTL = 5 * time.Minute
+
+// apiCache holds successful metadata responses keyed by request URL, so
+// entries from different API hosts never mix. Errors are not cached.
+type apiCache struct {
+	mu      sync.Mutex
+	entries map[string]apiCacheEntry
+}
+
+type apiCacheEntry struct {
+	value  any
+	stored time.Time
+}
+
+var metadataCache = &apiCache{}
+
+func (c *apiCache) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(e.stored) > apiCacheTTL {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *apiCache) put(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]apiCacheEntry)
+	}
+	c.entries[key] = apiCacheEntry{value: value, stored: time.Now()}
+}
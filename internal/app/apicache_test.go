@@ -0,0 +1,48 @@
+package app
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFetchFileInfoCached(t *testing.T) {
+	var hits int
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"name":"album.zip","size":42,"mime_type":"application/zip"}`)
+	})
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	for i := 0; i < 2; i++ {
+		if info, err := r.fetchFileInfo("cached1"); err != nil || info.Size != 42 {
+			t.Fatalf("fetchFileInfo = %+v, %v", info, err)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("expected the second lookup to be cached, got %d requests", hits)
+	}
+
+	r.opts.NoCache = true
+	if _, err := r.fetchFileInfo("cached1"); err != nil {
+		t.Fatal(err)
+	}
+	if hits != 2 {
+		t.Fatalf("--no-cache should bypass the cache, got %d requests", hits)
+	}
+}
+
+func TestAPICacheExpires(t *testing.T) {
+	c := &apiCache{}
+	c.put("k", 1)
+	if v, ok := c.get("k"); !ok || v.(int) != 1 {
+		t.Fatalf("get = %v, %t; want fresh entry", v, ok)
+	}
+	c.entries["k"] = apiCacheEntry{value: 1, stored: time.Now().Add(-apiCacheTTL - time.Second)}
+	if _, ok := c.get("k"); ok {
+		t.Fatalf("expired entry was returned")
+	}
+}
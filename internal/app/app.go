@@ -1,22 +1,450 @@
 package app
 
-import "cli-navidrome-helper/internal/config"
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
 
 // Options captures user-supplied CLI parameters before config/env enrichment.
 type Options struct {
-	Artist   string
-	URL      string
+	Artist string
+	// URLs lists one or more Pixeldrain URLs or IDs; all archives are merged
+	// into the same artist folder.
+	URLs []string
+	// EnvFile is loaded instead of .env in the working directory.
+	EnvFile  string
 	TmpDir   string
 	KeepTemp bool
 	DryRun   bool
+	// KeepTempOnFailure keeps the run's temp files only when the import
+	// fails; successful runs clean up as usual.
+	KeepTempOnFailure bool
+	// NoLock skips the lock that serializes concurrent imports; LockFile
+	// overrides its path (default nd-import.lock in the temp base).
+	NoLock   bool
+	LockFile string
+	// Validate resolves each URL and checks that it is downloadable as a
+	// zip (info API or HEAD request), then stops without downloading the
+	// archive or writing anything.
+	Validate bool
+	// ListPreview prints the files of each Pixeldrain list URL with their
+	// indices and stops without downloading anything. ListItem imports only
+	// the list file it selects, by 1-based index or by name.
+	ListPreview bool
+	ListItem    string
+	// RetryPartial names a retry file written after some files of a list
+	// failed; only those files are fetched, into the artist and subpath it
+	// records unless Artist or Subpath are set. A retry file written by a
+	// batch re-runs its failed lines as a batch instead.
+	RetryPartial string
+	// Diff downloads and extracts like a normal run, then reports each file
+	// as NEW, SAME or CHANGED against the library instead of moving it.
+	// It implies DryRun.
+	Diff bool
+	// StrictDryRun fails a dry run whose plan would hit a collision with
+	// existing files (even ones --quiet-collision or --on-collision would
+	// handle), prune everything, or leave no audio. It implies DryRun.
+	StrictDryRun    bool
+	CaseInsensitive bool
+	// Stage imports into STAGING_PATH instead of the live library.
+	Stage bool
+	// Dest, when set, is an absolute directory used as the library root
+	// instead of NAVIDROME_MUSIC_PATH, which then need not be set. Meant
+	// for trying the tool out without touching the real library.
+	Dest string
+	// Subpath places the import below the artist folder, e.g. "Live/2019".
+	// Each segment is validated like the artist name; no traversal.
+	Subpath string
+	// DirMode and FileMode override DIR_MODE/FILE_MODE; zero defers to them.
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	// PreserveModes keeps archive entry modes as recorded, including
+	// setuid/setgid/sticky and group/other write, which are otherwise
+	// dropped. It has no effect when a file mode is configured.
+	PreserveModes bool
+	// Owner overrides OWNER for paths created in the library.
+	Owner *config.Owner
+	// QuietCollision, when set, names a file that receives one JSON line per
+	// extracted file whose destination already exists; those files are
+	// skipped instead of aborting the import.
+	QuietCollision string
+	// OnCollision picks how file collisions are resolved: CollisionAbort
+	// (the default) or CollisionKeepLarger.
+	OnCollision string
+	// AllowOverwriteWithinRun lets a later archive of a multi-URL run
+	// overwrite a path an earlier one already extracted, instead of
+	// applying OnCollision.
+	AllowOverwriteWithinRun bool
+	// Hardlink links extracted files into the library instead of copying
+	// them, falling back to a copy when linking fails.
+	Hardlink bool
+	// RollbackOnError removes everything a failed move created.
+	RollbackOnError bool
+	// ReuseTemp points at a previously kept extract directory; download and
+	// extraction are skipped and URL is not required.
+	ReuseTemp string
+	// ResumeTemp points at the kept temp root (nd-import-*) of an
+	// interrupted run. It becomes this run's temp root: a complete zip
+	// download in it is reused, and extraction skips entries whose file
+	// already exists with the entry's uncompressed size.
+	ResumeTemp string
+	// MaxFilenameLength truncates path components longer than this many
+	// bytes, keeping the extension and adding a hash suffix; 0 disables it.
+	MaxFilenameLength int
+	// NormalizeAudioExt lowercases audio file extensions (".FLAC" ->
+	// ".flac") as files are moved; LowercaseExt does so for every file.
+	NormalizeAudioExt bool
+	LowercaseExt      bool
+	// CleanWhitespace collapses whitespace runs in moved folder and file
+	// names to single spaces and trims them, keeping the extension.
+	CleanWhitespace bool
+	// TargetFS checks every imported name against the rules of this
+	// filesystem (TargetFSExt4, TargetFSExFAT, TargetFSNTFS or
+	// TargetFSAPFS) before the move; empty disables the check.
+	// FixTargetNames rewrites offending names instead of failing.
+	TargetFS       string
+	FixTargetNames bool
+	// Sniff judges files with an unknown extension by their content
+	// (http.DetectContentType plus audio signatures) for --classify,
+	// --require-audio and pruning, which then keeps misnamed audio.
+	Sniff bool
+	// PixeldrainAPIBase overrides PIXELDRAIN_API_BASE, the Pixeldrain API
+	// base URL used for a self-hosted or mirror instance.
+	PixeldrainAPIBase string
+	// NoCache disables reuse of recent Pixeldrain info/list responses
+	// within the process.
+	NoCache bool
+	// InsecureSkipVerify disables TLS certificate verification and CACert
+	// adds a PEM CA bundle to the trusted roots. Both apply only to
+	// Pixeldrain and WebDAV requests.
+	InsecureSkipVerify bool
+	CACert             string
+	// Timeout cancels an import (download, extraction and move) that runs
+	// longer than this; zero means no limit. Applies per import in a batch.
+	Timeout time.Duration
+	// MaxRateLimitWait caps how long a single 429 Retry-After is honoured
+	// before the download fails; zero uses DefaultMaxRateLimitWait.
+	MaxRateLimitWait time.Duration
+	// MaxHostConnections caps the requests in flight to any one host across
+	// the whole process, and HostRequestDelay is the least time between the
+	// starts of two requests to the same host. Zero disables each.
+	MaxHostConnections int
+	HostRequestDelay   time.Duration
+	// PauseHold is how long a download paused with SIGUSR1 keeps its
+	// connection open; a longer pause closes it and resumes with a Range
+	// request after SIGUSR2. Zero uses DefaultPauseHold.
+	PauseHold time.Duration
+	// OnDupeEntry decides what happens when an archive holds two entries
+	// with the same path: DupeEntryRename (the default) or DupeEntryFail.
+	OnDupeEntry string
+	// StreamExtract writes archive entries straight to their library path
+	// instead of extracting to a temp dir and copying. Imports that need
+	// the extracted tree (several archives, most prune and rename options,
+	// a remote library) fall back to the staged extract dir.
+	StreamExtract bool
+	// RecurseArchives extracts zips found inside the downloaded archive into
+	// sibling folders named after them, up to maxNestedArchiveDepth levels.
+	RecurseArchives bool
+	// MaxEntries refuses archives with more entries than this before
+	// anything is extracted (DefaultMaxEntries when zero).
+	MaxEntries int
+	// MinFreeSpace overrides MIN_FREE_SPACE: the bytes that must remain
+	// free on the library volume after the move; zero defers to it.
+	MinFreeSpace int64
+	// FilenameEncoding decodes zip entry names not flagged as UTF-8:
+	// FilenameEncodingAuto (the default; CP437 for invalid UTF-8),
+	// FilenameEncodingUTF8, FilenameEncodingCP437 or FilenameEncodingShiftJIS.
+	FilenameEncoding string
+	// AllowFormats restricts which detected archive formats (FormatZip,
+	// FormatTar, ...) are extracted; empty allows every supported format.
+	AllowFormats []string
+	// CanonicalizeArtist looks the artist up on MusicBrainz and uses its
+	// canonical spelling for the destination folder.
+	CanonicalizeArtist bool
+
+	// PruneDupeExtensions drops same-named tracks in less preferred formats;
+	// PreferFormats lists extensions (without dot, lowercase) best first.
+	PruneDupeExtensions bool
+	PreferFormats       []string
+	// MinBitrate (kbps) drops lossy audio below it and MinSampleRate (Hz)
+	// any audio below it; DropLossyIfLossless drops lossy audio from folders
+	// that also hold lossless audio. Zero/false disables each.
+	MinBitrate          int
+	MinSampleRate       int
+	DropLossyIfLossless bool
+	// StripExtensions renames files such as "song.mp3.1" by dropping
+	// trailing JunkExtensions (without dot, lowercase; "#" is any number)
+	// when the result is an audio file name.
+	StripExtensions bool
+	JunkExtensions  []string
+	// Only, when set, limits the import to files matching at least one of
+	// these doublestar patterns (anchored like UNNEEDED_FILES).
+	Only []string
+	// ExtractOnly, when set, extracts only the archive entries matching at
+	// least one of these doublestar patterns (anchored like UNNEEDED_FILES);
+	// the others are never read. Nested archives are extracted in full.
+	ExtractOnly []string
+	// RequireAudio aborts the import when no audio file remains after the
+	// prune.
+	RequireAudio bool
+	// NormalizeDiscs renames disc folders such as "CD1" or "cd 2" to
+	// "Disc N" before the move.
+	NormalizeDiscs bool
+	// NormalizeYear renames folders whose name carries a year, such as
+	// "Album [2019]" or "2019 - Album", to "(2019) Album" before the move.
+	NormalizeYear bool
+	// TrimCommonPrefix strips a prefix shared by every track of a leaf
+	// folder, e.g. "Album - 01 - Title.mp3" -> "01 - Title.mp3".
+	TrimCommonPrefix bool
+	// DedupeLibrary reports extracted tracks that already exist anywhere in
+	// the live library (same name, size and SHA-256); SkipLibraryDupes also
+	// leaves them out of the import.
+	DedupeLibrary    bool
+	SkipLibraryDupes bool
+	// Classify moves each file into an audio/, artwork/, docs/ or misc/
+	// folder next to it, by extension (see CLASSIFY_EXTENSIONS).
+	Classify bool
+	// VerifyArtistTag compares the artist tags of a few sampled tracks with
+	// the destination artist and warns on mismatch; Strict aborts instead,
+	// as it does for an Artist that looks like a URL or Pixeldrain ID.
+	VerifyArtistTag bool
+	Strict          bool
+
+	// UnneededFile names a file of extra UNNEEDED_FILES patterns, one per
+	// line, added to those from the environment (see config.ReadPatternFile).
+	UnneededFile string
+
+	// PruneSmallerThan removes files below this many bytes during the prune;
+	// PruneLargerThan removes non-audio files above it. Zero disables each.
+	PruneSmallerThan int64
+	PruneLargerThan  int64
+	// PruneReport lists what UNNEEDED_FILES would remove, grouped by
+	// pattern, and stops before deleting or moving anything.
+	PruneReport bool
+	// PruneKeep lists patterns (anchored like UNNEEDED_FILES) whose matches
+	// are never pruned, even when an unneeded pattern or size limit selects
+	// them or their folder, unless PruneOrder ranks them after unneeded.
+	PruneKeep []string
+	// PruneOrder ranks the rule groups PruneKeep, PruneUnneeded and
+	// PruneExcept; a protection only overrides a prune match when ranked
+	// before unneeded. Nil means DefaultPruneOrder.
+	PruneOrder []string
+	// PruneDebug logs, per file, the rule that decided whether it is pruned.
+	PruneDebug bool
+	// PruneCascade removes folders left empty once pruned files are gone,
+	// up to the extract root.
+	PruneCascade bool
+	// RespectCue keeps audio referenced by kept .cue sheets even when it
+	// matches UNNEEDED_FILES.
+	RespectCue bool
+
+	// WriteNFO writes a Kodi album.nfo into each imported album folder that
+	// does not already have an .nfo file.
+	WriteNFO bool
+	// ReplayGain scans the imported FLAC/MP3 files per album folder with
+	// rsgain or loudgain after the move and writes gain tags.
+	ReplayGain bool
+
+	// CoverURL is an image downloaded before the move and saved as
+	// cover.jpg in the imported album folder (or the destination when the
+	// import holds several albums); PNG and GIF are converted to JPEG.
+	CoverURL string
+
+	// ReportFile, when set, receives one JSON line per import describing
+	// its outcome, whether it succeeded or not.
+	ReportFile string
+	// SummaryJSONFile, when set, is replaced with a JSON object describing
+	// the import once it finishes, successfully or not; after a batch it
+	// holds the array of per-entry results instead.
+	SummaryJSONFile string
+	// Tree prints the files this import added as an indented directory tree
+	// with sizes after the summary. Replaced and pre-existing files are left
+	// out.
+	Tree bool
+
+	// BatchFile lists one "<artist> <url>" import per line; Artist and URL
+	// are ignored when it is set. Completed lines are recorded in StateFile
+	// (default BatchFile + ".state") and skipped on re-runs with Resume.
+	BatchFile string
+	StateFile string
+	Resume    bool
+	// SummaryTable prints a table of every batch entry's result, files,
+	// bytes and duration once the batch finishes; SummaryJSON prints it as
+	// a JSON array instead, alone on stdout, with logs moved to stderr.
+	SummaryTable bool
+	SummaryJSON  bool
+
+	// WatchDir runs a daemon that imports *.json job files dropped into
+	// this directory, one at a time, moving each to done/ or failed/.
+	// Other options act as defaults that a job may override. WatchInterval
+	// is the polling period (DefaultWatchInterval when zero).
+	WatchDir      string
+	WatchInterval time.Duration
+
+	// InspectPath is the local folder examined by the inspect command.
+	InspectPath string
+
+	// SizeUnits overrides SIZE_UNITS for printed byte counts; empty defers
+	// to it (binary KiB/MiB by default).
+	SizeUnits config.SizeUnits
+
+	// ImportID tags every log line, event, report record and summary of
+	// the run; Run generates a random one when it is empty. Batch entries
+	// and watch jobs append "-<n>" to it.
+	ImportID string
+
+	// PrintConfig makes Run print the loaded Config and these Options,
+	// secrets masked, to stdout and return without importing.
+	PrintConfig bool
+
+	// JSONLines streams newline-delimited JSON progress events to "stdout",
+	// "stderr" or a file path. Human logs move to stderr when it is "stdout".
+	JSONLines string
 }
 
+// ErrTimeout marks an import cancelled because --timeout expired.
+var ErrTimeout = errors.New("import timed out")
+
+// Values accepted by Options.OnCollision.
+const (
+	CollisionAbort      = "abort"
+	CollisionKeepLarger = "keep-larger"
+)
+
+// Values accepted by Options.OnDupeEntry.
+const (
+	DupeEntryRename = "rename"
+	DupeEntryFail   = "fail"
+)
+
 // Run is the entry point for the import workflow.
 func Run(opts Options) error {
-	cfg, err := config.Load()
+	if opts.PrintConfig {
+		cfg, err := loadConfig(opts)
+		if err != nil {
+			return err
+		}
+		return printConfig(os.Stdout, cfg, opts)
+	}
+	if opts.ImportID == "" {
+		opts.ImportID = newImportID()
+	}
+	// The caller prints the returned error; the prefix ties that last line
+	// to the run's other log lines.
+	if err := run(opts); err != nil {
+		return fmt.Errorf("%s%w", logPrefix(opts), err)
+	}
+	return nil
+}
+
+// run imports what opts describe once the run has its import ID.
+func run(opts Options) error {
+	watchPauseSignals(log.New(consoleFor(opts), logPrefix(opts), log.LstdFlags))
+
+	started := time.Now()
+	events, closer, err := openEventStream(opts.JSONLines)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		events.emit("done", opts.Artist, opts.ImportID, map[string]any{"result": "failure", "error": err.Error()})
+		return finishImport(started, opts, nil, err)
+	}
+	usePixeldrainAPI(cfg, opts)
+	if opts.RetryPartial != "" {
+		// A retry file from a failed batch re-runs its lines as a batch;
+		// an unreadable one is reported by the import below.
+		if entries, err := retryBatchEntries(opts.RetryPartial); err == nil && len(entries) > 0 {
+			statePath := opts.StateFile
+			if statePath == "" {
+				statePath = opts.RetryPartial + ".state"
+			}
+			return runBatchEntries(cfg, opts, events, entries, statePath)
+		}
+	}
+	if opts.BatchFile != "" {
+		return runBatch(cfg, opts, events)
+	}
+	if opts.WatchDir != "" {
+		return runWatch(cfg, opts, events)
+	}
+	return importOne(cfg, opts, events)
+}
+
+// loadConfig loads the environment settings for opts, honouring --dest
+// and adding the patterns of --unneeded-file. --list never touches the
+// library, so it does not need NAVIDROME_MUSIC_PATH.
+func loadConfig(opts Options) (config.Config, error) {
+	var cfg config.Config
+	var err error
+	if opts.ListPreview {
+		cfg, err = config.LoadSettings(opts.EnvFile)
+	} else {
+		cfg, err = config.LoadWithLibrary(opts.EnvFile, opts.Dest)
+	}
+	if err != nil || opts.UnneededFile == "" {
+		return cfg, err
+	}
+	patterns, err := config.ReadPatternFile(opts.UnneededFile)
+	if err != nil {
+		return cfg, fmt.Errorf("--unneeded-file: %w", err)
+	}
+	cfg.UnneededPatterns = append(cfg.UnneededPatterns, patterns...)
+	return cfg, nil
+}
+
+// importOne runs a single import and records its outcome in the report file.
+func importOne(cfg config.Config, opts Options, events *eventStream) error {
+	started := time.Now()
+	r := newRunner(cfg, opts)
+	r.events = events
+	return finishImport(started, opts, r, r.Execute())
+}
+
+func finishImport(started time.Time, opts Options, r *runner, err error) error {
+	if opts.ReportFile == "" && opts.SummaryJSONFile == "" {
+		return err
+	}
+	rec := newReportRecord(started, opts, r, err)
+	if opts.ReportFile != "" {
+		if reportErr := appendReport(opts.ReportFile, rec); reportErr != nil {
+			err = errors.Join(err, reportErr)
+		}
+	}
+	if opts.SummaryJSONFile != "" {
+		if summaryErr := writeSummaryFile(opts.SummaryJSONFile, rec); summaryErr != nil {
+			err = errors.Join(err, summaryErr)
+		}
+	}
+	return err
+}
+
+// Promote moves a staged artist folder from STAGING_PATH into the live
+// library, applying the same collision checks as an import. Only Artist,
+// DryRun, CaseInsensitive and RollbackOnError are consulted.
+func Promote(opts Options) error {
+	cfg, err := config.Load(opts.EnvFile)
 	if err != nil {
 		return err
 	}
+	return newRunner(cfg, opts).Promote()
+}
 
-	return newRunner(cfg, opts).Execute()
+// Inspect prints the extension breakdown of opts.InspectPath and what the
+// prune rules would remove from it, without changing anything. Only
+// InspectPath, the prune options and SizeUnits are consulted.
+func Inspect(opts Options) error {
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	return newRunner(cfg, opts).Inspect()
 }
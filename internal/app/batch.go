@@ -0,0 +1,239 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// batchEntry is one import parsed from a batch file.
+type batchEntry struct {
+	Line   int
+	Artist string
+	URL    string
+}
+
+// key identifies an entry in the batch state independently of its line number,
+// so reordering the batch file does not lose track of completed imports.
+// Credentials embedded in the URL are left out of the state file.
+func (e batchEntry) key() string {
+	return e.Artist + "\t" + redactURL(e.URL)
+}
+
+// parseBatchFile reads "<artist> <url>" lines. The URL is the last
+// whitespace-separated field, so artist names may contain spaces. Blank lines
+// and lines starting with # are ignored.
+func parseBatchFile(path string) ([]batchEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open batch file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []batchEntry
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexAny(line, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("batch file %s line %d: expected \"<artist> <url>\"", path, n)
+		}
+		artist := strings.TrimSpace(line[:i])
+		rawURL := strings.TrimSpace(line[i+1:])
+		if artist == "" || rawURL == "" {
+			return nil, fmt.Errorf("batch file %s line %d: expected \"<artist> <url>\"", path, n)
+		}
+		entries = append(entries, batchEntry{Line: n, Artist: artist, URL: rawURL})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read batch file: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("batch file %s has no imports", path)
+	}
+	return entries, nil
+}
+
+// batchState persists which batch entries completed successfully.
+type batchState struct {
+	path      string
+	Completed map[string]time.Time `json:"completed"`
+}
+
+func loadBatchState(path string) (*batchState, error) {
+	st := &batchState{path: path, Completed: make(map[string]time.Time)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, fmt.Errorf("read batch state: %w", err)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("parse batch state %s: %w", path, err)
+	}
+	if st.Completed == nil {
+		st.Completed = make(map[string]time.Time)
+	}
+	return st, nil
+}
+
+func (st *batchState) done(e batchEntry) bool {
+	_, ok := st.Completed[e.key()]
+	return ok
+}
+
+// markDone records e as completed and rewrites the state file atomically so
+// an interruption never leaves it half-written.
+func (st *batchState) markDone(e batchEntry) error {
+	st.Completed[e.key()] = time.Now().UTC()
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode batch state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(st.path), ".nd-import-state-*")
+	if err != nil {
+		return fmt.Errorf("write batch state: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write batch state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write batch state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), st.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write batch state: %w", err)
+	}
+	return nil
+}
+
+// runBatch imports every entry of opts.BatchFile in order, continuing past
+// failures. Successful imports, other than dry runs and --validate checks,
+// are recorded in the state file.
+func runBatch(cfg config.Config, opts Options, events *eventStream) error {
+	entries, err := parseBatchFile(opts.BatchFile)
+	if err != nil {
+		return err
+	}
+	statePath := opts.StateFile
+	if statePath == "" {
+		statePath = opts.BatchFile + ".state"
+	}
+	return runBatchEntries(cfg, opts, events, entries, statePath)
+}
+
+// runBatchEntries is runBatch for parsed entries. Failed imports are
+// written to a retry file for --retry-partial, except lines that already
+// wrote one of their own for failed list files.
+func runBatchEntries(cfg config.Config, opts Options, events *eventStream, entries []batchEntry, statePath string) error {
+	logger := log.New(consoleFor(opts), logPrefix(opts), log.LstdFlags)
+	state, err := loadBatchState(statePath)
+	if err != nil {
+		return err
+	}
+
+	var succeeded, failed, skipped int
+	var estimated int64
+	var unknownSize int
+	var rows []batchRow
+	var retry []partialBatchEntry
+	for i, e := range entries {
+		if opts.Resume && state.done(e) {
+			logger.Printf("[batch %d/%d] skipping %q (line %d): already completed", i+1, len(entries), e.Artist, e.Line)
+			skipped++
+			rows = append(rows, batchRow{Line: e.Line, Artist: e.Artist, Result: batchSkip})
+			continue
+		}
+		logger.Printf("[batch %d/%d] %q <- %s (line %d)", i+1, len(entries), e.Artist, redactURL(e.URL), e.Line)
+
+		entryOpts := opts
+		entryOpts.Artist = e.Artist
+		entryOpts.URLs = []string{e.URL}
+		entryOpts.RetryPartial = ""
+		entryOpts.SummaryJSONFile = ""
+		entryOpts.ImportID = subImportID(opts.ImportID, i+1)
+
+		started := time.Now()
+		r := newRunner(cfg, entryOpts)
+		r.events = events
+		err := finishImport(started, entryOpts, r, r.Execute())
+		rows = append(rows, newBatchRow(e, r, err))
+		if err != nil {
+			logger.Printf("[batch %d/%d] failed: %v", i+1, len(entries), err)
+			failed++
+			if r.partial == nil && !opts.DryRun && !opts.Validate {
+				retry = append(retry, partialBatchEntry{Line: e.Line, Artist: e.Artist, URL: e.URL, Error: err.Error()})
+			}
+			continue
+		}
+		succeeded++
+
+		// Validation downloads nothing, so the line still needs importing.
+		if opts.Validate {
+			continue
+		}
+		if opts.DryRun {
+			if r.stats.estimatedBytes < 0 {
+				unknownSize++
+			} else {
+				estimated += r.stats.estimatedBytes
+			}
+			continue
+		}
+		if err := state.markDone(e); err != nil {
+			return err
+		}
+	}
+
+	logger.Printf("Batch complete: %d succeeded, %d failed, %d skipped", succeeded, failed, skipped)
+	if opts.SummaryTable {
+		out := consoleFor(opts)
+		if opts.SummaryJSON {
+			out = os.Stdout
+		}
+		if err := writeBatchSummary(out, rows, opts.SummaryJSON, sizeUnits(cfg, opts)); err != nil {
+			return err
+		}
+	}
+	if opts.SummaryJSONFile != "" {
+		if rows == nil {
+			rows = []batchRow{}
+		}
+		if err := writeSummaryFile(opts.SummaryJSONFile, rows); err != nil {
+			return err
+		}
+	}
+	if opts.DryRun {
+		if unknownSize > 0 {
+			logger.Printf("dry-run: estimated total download %s (%d import(s) of unknown size)", humanBytes(estimated, sizeUnits(cfg, opts)), unknownSize)
+		} else {
+			logger.Printf("dry-run: estimated total download %s", humanBytes(estimated, sizeUnits(cfg, opts)))
+		}
+	}
+	if failed > 0 {
+		err := fmt.Errorf("batch: %d of %d import(s) failed", failed, len(entries))
+		if len(retry) == 0 {
+			return err
+		}
+		path, werr := writeRetryFile(opts.TmpDir, &partialRetry{Batch: retry})
+		if werr != nil {
+			return fmt.Errorf("%w (%v)", err, werr)
+		}
+		return fmt.Errorf("%w; re-run the failed line(s) with --retry-partial %s", err, path)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseBatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.txt")
+	content := "# artist url\n\nThe Artist https://pixeldrain.com/u/abc123\nSolo\txyz789\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := parseBatchFile(path)
+	if err != nil {
+		t.Fatalf("parseBatchFile returned error: %v", err)
+	}
+	want := []batchEntry{
+		{Line: 3, Artist: "The Artist", URL: "https://pixeldrain.com/u/abc123"},
+		{Line: 4, Artist: "Solo", URL: "xyz789"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Fatalf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.txt")
+	if err := os.WriteFile(bad, []byte("onlyonefield\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseBatchFile(bad); err == nil {
+		t.Fatalf("expected error for line without url")
+	}
+}
+
+func TestRunBatchResume(t *testing.T) {
+	var downloads atomic.Int32
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		downloads.Add(1)
+		id := strings.TrimPrefix(req.URL.Path, "/file/")
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, map[string]string{id + "/track.flac": "audio"}))
+	})
+
+	dir := t.TempDir()
+	library := filepath.Join(dir, "library")
+	if err := os.MkdirAll(library, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	batch := filepath.Join(dir, "batch.txt")
+	if err := os.WriteFile(batch, []byte("Artist One aaa111\nArtist Two bbb222\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{NavidromeMusicPath: library}
+	opts := Options{BatchFile: batch, TmpDir: dir}
+	if err := runBatch(cfg, opts, nil); err != nil {
+		t.Fatalf("runBatch returned error: %v", err)
+	}
+	if got := downloads.Load(); got != 2 {
+		t.Fatalf("expected 2 downloads, got %d", got)
+	}
+
+	state, err := loadBatchState(batch + ".state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Completed) != 2 {
+		t.Fatalf("expected 2 completed entries in state, got %d", len(state.Completed))
+	}
+
+	// Reordering the batch file must not lose track of completed entries.
+	if err := os.WriteFile(batch, []byte("Artist Two bbb222\nArtist One aaa111\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts.Resume = true
+	if err := runBatch(cfg, opts, nil); err != nil {
+		t.Fatalf("resumed runBatch returned error: %v", err)
+	}
+	if got := downloads.Load(); got != 2 {
+		t.Fatalf("resume should skip completed entries, got %d downloads", got)
+	}
+}
+
+func TestExecuteMultipleURLs(t *testing.T) {
+	archives := map[string]map[string]string{
+		"disc1": {"Album/01.flac": "one"},
+		"disc2": {"Album/02.flac": "two"},
+		"clash": {"Album/01.flac": "other"},
+	}
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		files, ok := archives[strings.TrimPrefix(req.URL.Path, "/file/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, files))
+	})
+
+	library := t.TempDir()
+	r := newRunner(config.Config{NavidromeMusicPath: library}, Options{Artist: "Artist", URLs: []string{"disc1", "disc2"}, TmpDir: t.TempDir()})
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	for _, name := range []string{"01.flac", "02.flac"} {
+		if _, err := os.Stat(filepath.Join(library, "Artist", "Album", name)); err != nil {
+			t.Fatalf("expected %s from combined archives: %v", name, err)
+		}
+	}
+	if r.stats.movedFiles != 2 || r.stats.extractedEntries != 2 {
+		t.Fatalf("stats not aggregated: moved=%d extracted=%d", r.stats.movedFiles, r.stats.extractedEntries)
+	}
+
+	r = newRunner(config.Config{NavidromeMusicPath: t.TempDir()}, Options{Artist: "Artist", URLs: []string{"disc1", "clash"}, TmpDir: t.TempDir()})
+	if err := r.Execute(); err == nil || !strings.Contains(err.Error(), "archive collision") {
+		t.Fatalf("expected archive collision error, got %v", err)
+	}
+}
+
+func TestExecuteWithinRunCollisions(t *testing.T) {
+	archives := map[string]map[string]string{
+		"disc1": {"Album/01.flac": "one", "Album/02.flac": "two"},
+		"again": {"Album/01.flac": "one"},
+		"clash": {"Album/01.flac": "longer", "Album/02.flac": "2"},
+	}
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		files, ok := archives[strings.TrimPrefix(req.URL.Path, "/file/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, files))
+	})
+
+	cases := []struct {
+		name     string
+		opts     Options
+		urls     []string
+		one, two string
+	}{
+		{"keep-larger", Options{OnCollision: CollisionKeepLarger}, []string{"disc1", "again", "clash"}, "longer", "two"},
+		{"overwrite", Options{AllowOverwriteWithinRun: true}, []string{"disc1", "clash"}, "longer", "2"},
+	}
+	for _, tc := range cases {
+		library := t.TempDir()
+		opts := tc.opts
+		opts.Artist, opts.URLs, opts.TmpDir = "Artist", tc.urls, t.TempDir()
+		var logs bytes.Buffer
+		r := newRunner(config.Config{NavidromeMusicPath: library}, opts)
+		r.log = log.New(&logs, "", 0)
+		if err := r.Execute(); err != nil {
+			t.Fatalf("%s: Execute returned error: %v", tc.name, err)
+		}
+		for file, want := range map[string]string{"01.flac": tc.one, "02.flac": tc.two} {
+			got, err := os.ReadFile(filepath.Join(library, "Artist", "Album", file))
+			if err != nil || string(got) != want {
+				t.Fatalf("%s: %s = %q (err %v), want %q", tc.name, file, got, err, want)
+			}
+		}
+		if !strings.Contains(logs.String(), "within-run collision") {
+			t.Fatalf("%s: within-run collisions not reported:\n%s", tc.name, logs.String())
+		}
+	}
+}
+
+func TestRunBatchSummaryJSONStdout(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, map[string]string{"Album/track.flac": "audio"}))
+	})
+
+	dir := t.TempDir()
+	library := filepath.Join(dir, "library")
+	if err := os.MkdirAll(library, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	batch := filepath.Join(dir, "batch.txt")
+	if err := os.WriteFile(batch, []byte("Artist One aaa111\nArtist Two bbb222\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+	oldOut, oldErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	err = runBatch(config.Config{NavidromeMusicPath: library}, Options{BatchFile: batch, TmpDir: dir, SummaryTable: true, SummaryJSON: true}, nil)
+	os.Stdout, os.Stderr = oldOut, oldErr
+	if err != nil {
+		t.Fatalf("runBatch returned error: %v", err)
+	}
+
+	out, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []batchRow
+	if err := json.Unmarshal(out, &rows); err != nil {
+		t.Fatalf("stdout is not a JSON array: %v\n%s", err, out)
+	}
+	if len(rows) != 2 || rows[0].Result != batchOK || rows[1].Result != batchOK {
+		t.Fatalf("decoded summary = %+v", rows)
+	}
+	logs, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(logs), "Batch complete: 2 succeeded") {
+		t.Fatalf("batch log not on stderr:\n%s", logs)
+	}
+}
+
+func TestWriteBatchSummary(t *testing.T) {
+	rows := []batchRow{
+		{Line: 1, Artist: "Daft Punk", Result: batchOK, Files: 12, Bytes: 3 << 20, DurationMS: 4200},
+		{Line: 2, Artist: "Air", Result: batchSkip},
+		{Line: 3, Artist: "Justice", Result: batchFail, Error: "boom", DurationMS: 300},
+	}
+
+	var table bytes.Buffer
+	if err := writeBatchSummary(&table, rows, false, config.BinaryUnits); err != nil {
+		t.Fatalf("writeBatchSummary returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(table.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected header, 3 rows and totals, got:\n%s", table.String())
+	}
+	col := strings.Index(lines[0], "RESULT")
+	for _, line := range lines[1:4] {
+		if !strings.HasPrefix(line[col:], "ok") && !strings.HasPrefix(line[col:], "skip") && !strings.HasPrefix(line[col:], "fail") {
+			t.Fatalf("result column misaligned:\n%s", table.String())
+		}
+	}
+	if !strings.Contains(lines[4], "TOTAL (1 ok, 1 skip, 1 fail)") || !strings.Contains(lines[4], "12") || !strings.Contains(lines[4], "4.5s") {
+		t.Fatalf("unexpected totals line %q", lines[4])
+	}
+
+	var out bytes.Buffer
+	if err := writeBatchSummary(&out, rows, true, config.BinaryUnits); err != nil {
+		t.Fatalf("writeBatchSummary returned error: %v", err)
+	}
+	var decoded []batchRow
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("summary is not a JSON array: %v\n%s", err, out.String())
+	}
+	if len(decoded) != 3 || decoded[2] != rows[2] {
+		t.Fatalf("decoded summary = %+v", decoded)
+	}
+}
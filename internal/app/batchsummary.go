@@ -0,0 +1,78 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// Results of a batch summary row.
+const (
+	batchOK   = "ok"
+	batchSkip = "skip"
+	batchFail = "fail"
+)
+
+// batchRow is one line of the --summary-table printed after a batch.
+type batchRow struct {
+	Line       int    `json:"line"`
+	ImportID   string `json:"import_id,omitempty"`
+	Artist     string `json:"artist"`
+	Result     string `json:"result"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// newBatchRow summarizes an executed batch entry; r holds its stats.
+func newBatchRow(e batchEntry, r *runner, err error) batchRow {
+	row := batchRow{Line: e.Line, Artist: e.Artist, Result: batchOK}
+	if err != nil {
+		row.Result = batchFail
+		row.Error = err.Error()
+	}
+	if r != nil {
+		row.ImportID = r.opts.ImportID
+		row.Files = r.stats.movedFiles
+		for _, es := range r.stats.extensions {
+			row.Bytes += es.bytes
+		}
+		row.DurationMS = r.stats.total.Milliseconds()
+	}
+	return row
+}
+
+// writeBatchSummary prints rows as an aligned table with a totals line, or
+// as a JSON array when asJSON is set.
+func writeBatchSummary(w io.Writer, rows []batchRow, asJSON bool, units config.SizeUnits) error {
+	if asJSON {
+		if rows == nil {
+			rows = []batchRow{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ARTIST\tRESULT\tFILES\tBYTES\tDURATION")
+	var files int
+	var bytes, millis int64
+	counts := make(map[string]int)
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", row.Artist, row.Result, row.Files, humanBytes(row.Bytes, units),
+			roundDuration(time.Duration(row.DurationMS)*time.Millisecond))
+		files += row.Files
+		bytes += row.Bytes
+		millis += row.DurationMS
+		counts[row.Result]++
+	}
+	fmt.Fprintf(tw, "TOTAL (%d ok, %d skip, %d fail)\t\t%d\t%s\t%s\n", counts[batchOK], counts[batchSkip], counts[batchFail],
+		files, humanBytes(bytes, units), roundDuration(time.Duration(millis)*time.Millisecond))
+	return tw.Flush()
+}
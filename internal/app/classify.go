@@ -0,0 +1,100 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Categories used by --classify; unknown extensions go to categoryMisc.
+const (
+	categoryAudio   = "audio"
+	categoryArtwork = "artwork"
+	categoryDocs    = "docs"
+	categoryMisc    = "misc"
+)
+
+// classifyExtensions is the built-in extension-to-category map for
+// --classify. Cue sheets and playlists stay with the audio they reference.
+var classifyExtensions = map[string]string{
+	".cue": categoryAudio, ".m3u": categoryAudio, ".m3u8": categoryAudio,
+	".jpg": categoryArtwork, ".jpeg": categoryArtwork, ".png": categoryArtwork, ".gif": categoryArtwork,
+	".bmp": categoryArtwork, ".webp": categoryArtwork, ".tif": categoryArtwork, ".tiff": categoryArtwork,
+	".pdf": categoryDocs, ".txt": categoryDocs, ".nfo": categoryDocs, ".log": categoryDocs,
+	".md5": categoryDocs, ".sfv": categoryDocs, ".accurip": categoryDocs, ".rtf": categoryDocs,
+}
+
+// category returns the --classify folder for a file name: CLASSIFY_EXTENSIONS
+// first, then the built-in map and the audio extensions, else categoryMisc.
+func (r *runner) category(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if c, ok := r.cfg.ClassifyExtensions[ext]; ok {
+		return c
+	}
+	if audioExtensions[ext] {
+		return categoryAudio
+	}
+	if c, ok := classifyExtensions[ext]; ok {
+		return c
+	}
+	return categoryMisc
+}
+
+// classifyRel moves a file one level down into its category folder
+// ("Album/01.flac" -> "Album/audio/01.flac") for --classify. Files whose
+// folder already carries the category name stay where they are.
+func (r *runner) classifyRel(rel string) string {
+	return classifyAs(rel, r.category(filepath.Base(rel)))
+}
+
+// classifyAs places rel in the category folder c, as classifyRel does.
+func classifyAs(rel, c string) string {
+	dir, name := filepath.Split(rel)
+	if strings.EqualFold(filepath.Base(dir), c) {
+		return rel
+	}
+	return filepath.Join(dir, c, name)
+}
+
+// logClassification reports how many extracted files --classify sends to
+// each category folder. With --sniff, files of unknown type are sniffed
+// here, so the move places them by content.
+func (r *runner) logClassification(extractDir string) error {
+	if !r.opts.Classify {
+		return nil
+	}
+	counts := make(map[string]int)
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			return nil
+		}
+		c, err := r.sniffCategory(extractDir, path)
+		if err != nil {
+			return err
+		}
+		if c == "" {
+			c = r.category(d.Name())
+		}
+		counts[c]++
+		return nil
+	})
+	if err != nil || len(counts) == 0 {
+		return err
+	}
+	categories := make([]string, 0, len(counts))
+	for c := range counts {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	parts := make([]string, len(categories))
+	for i, c := range categories {
+		parts[i] = fmt.Sprintf("%s %d", c, counts[c])
+	}
+	r.log.Printf("Classifying files into category folders: %s", strings.Join(parts, ", "))
+	return nil
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyRel(t *testing.T) {
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.cfg.ClassifyExtensions = map[string]string{".mkv": "video", ".txt": "notes"}
+	tests := map[string]string{
+		"Album/01.flac":          "Album/audio/01.flac",
+		"Album/album.cue":        "Album/audio/album.cue",
+		"Album/Cover.JPG":        "Album/artwork/Cover.JPG",
+		"Album/booklet.pdf":      "Album/docs/booklet.pdf",
+		"Album/readme.txt":       "Album/notes/readme.txt",
+		"Album/live.mkv":         "Album/video/live.mkv",
+		"Album/setup.exe":        "Album/misc/setup.exe",
+		"Album/Artwork/back.png": "Album/Artwork/back.png",
+		"loose.mp3":              "audio/loose.mp3",
+	}
+	for in, want := range tests {
+		if got := r.classifyRel(filepath.FromSlash(in)); got != filepath.FromSlash(want) {
+			t.Fatalf("classifyRel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMoveIntoLibraryClassifies(t *testing.T) {
+	extract := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "Artist")
+	for _, name := range []string{"Album/01.flac", "Album/booklet.pdf", "Album/cover.jpg", "Album/video.mp4"} {
+		path := filepath.Join(extract, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.Classify = true
+	if err := r.moveIntoLibrary(extract, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	for _, name := range []string{"Album/audio/01.flac", "Album/docs/booklet.pdf", "Album/artwork/cover.jpg", "Album/misc/video.mp4"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// collisionRecord is one line of the --quiet-collision report.
+type collisionRecord struct {
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	SourceSize   int64  `json:"source_size"`
+	TargetSize   int64  `json:"target_size"`
+	HashesDiffer bool   `json:"hashes_differ"`
+}
+
+// resolveRunCollision handles rel arriving again from archive after an
+// earlier archive of the same run already extracted it into destDir. With
+// --allow-overwrite-within-run the later copy wins; with --on-collision
+// keep-larger an identical copy is skipped and otherwise the larger one is
+// kept; by default the run aborts. It reports whether the new copy should
+// overwrite the earlier one. Decisions are logged and emitted as collision
+// events marked within_run, apart from collisions with the library.
+func (r *runner) resolveRunCollision(destDir, rel, archive, earlier string, size int64, crc uint32) (bool, error) {
+	name, earlierName := filepath.Base(archive), filepath.Base(earlier)
+	r.runCollisions++
+	if !r.opts.AllowOverwriteWithinRun && r.opts.OnCollision != CollisionKeepLarger {
+		return false, fmt.Errorf("archive collision: %q from %s also exists in %s (use --on-collision keep-larger or --allow-overwrite-within-run)", rel, name, earlierName)
+	}
+	earlierPath := filepath.Join(destDir, rel)
+	info, err := r.workFS().Stat(earlierPath)
+	if err != nil {
+		return false, err
+	}
+
+	var action string
+	switch {
+	case r.opts.AllowOverwriteWithinRun:
+		action = "replace"
+		r.log.Printf("within-run collision: %q from %s overwrites the copy from %s", rel, name, earlierName)
+	case size == info.Size():
+		earlierCRC, err := fileCRC32(r.workFS(), earlierPath)
+		if err != nil {
+			return false, err
+		}
+		if earlierCRC == crc {
+			action = "skip-identical"
+			r.log.Printf("within-run collision: %q from %s is identical to the copy from %s; skipping", rel, name, earlierName)
+			break
+		}
+		fallthrough
+	case size < info.Size():
+		action = "keep-existing"
+		r.log.Printf("within-run collision: keeping %q from %s (%s) over %s (%s)", rel, earlierName, humanBytes(info.Size(), r.stats.units), name, humanBytes(size, r.stats.units))
+	default:
+		action = "replace"
+		r.log.Printf("within-run collision: replacing %q from %s (%s) with larger copy from %s (%s)", rel, earlierName, humanBytes(info.Size(), r.stats.units), name, humanBytes(size, r.stats.units))
+	}
+	r.emit("collision", map[string]any{"source": archive, "target": earlierPath, "source_size": size, "target_size": info.Size(), "action": action, "within_run": true})
+	return action == "replace", nil
+}
+
+// checkStrictCollisions fails a --strict-dry-run whose plan collides with
+// files already in the library or between archives of the run, even when
+// --quiet-collision, --on-collision or --allow-overwrite-within-run would
+// resolve them. Each collision has been logged already.
+func (r *runner) checkStrictCollisions() error {
+	library := len(r.collisionSkipped) + len(r.collisionReplace)
+	if library == 0 && r.runCollisions == 0 {
+		r.log.Printf("strict-dry-run: no collisions, and audio is left after pruning")
+		return nil
+	}
+	return fmt.Errorf("--strict-dry-run: plan has %d collision(s) with existing library files and %d between archives (see above)", library, r.runCollisions)
+}
+
+// fileCRC32 returns the IEEE CRC-32 of the file at path, the checksum zip
+// entries carry.
+func fileCRC32(fsys FS, path string) (uint32, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// skipCollisions implements --quiet-collision: extracted files whose
+// destination already exists as a file are recorded in the report and left
+// out of the move, so the existing copy is kept and the rest of the import
+// proceeds. File-vs-directory conflicts still abort in ensureNoCollisions.
+func (r *runner) skipCollisions(srcRoot, destRoot string) error {
+	if r.opts.QuietCollision == "" {
+		return nil
+	}
+
+	existing, err := r.existingFiles(destRoot)
+	if err != nil {
+		return err
+	}
+
+	var records []collisionRecord
+	err = r.workFS().WalkDir(srcRoot, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, skip := r.collisionSkipped[path]; skip {
+			return nil
+		}
+		rel, err := filepath.Rel(srcRoot, path)
+		if err != nil {
+			return err
+		}
+		target, ok := existing[r.collisionKey(r.destRel(rel, false))]
+		if !ok {
+			return nil
+		}
+		rec, err := compareCollision(r.workFS(), path, r.library(), target)
+		if err != nil {
+			return err
+		}
+		records = append(records, rec)
+		if r.collisionSkipped == nil {
+			r.collisionSkipped = make(map[string]struct{})
+		}
+		r.collisionSkipped[path] = struct{}{}
+		return nil
+	})
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	if r.opts.DryRun {
+		for _, rec := range records {
+			r.log.Printf("dry-run: would skip %s (exists at %s, hashes differ: %t)", rec.Source, rec.Target, rec.HashesDiffer)
+		}
+		return nil
+	}
+	if err := appendCollisions(r.opts.QuietCollision, records); err != nil {
+		return err
+	}
+	r.log.Printf("Skipped %d colliding file(s); details in %s", len(records), r.opts.QuietCollision)
+	return nil
+}
+
+// resolveCollisions implements --on-collision keep-larger. Each extracted
+// file whose destination already exists is compared with it: identical
+// files are skipped, otherwise the larger of the two is kept. A larger
+// source is queued in collisionReplace and overwrites the existing file
+// during the move; a smaller or equal-sized one is skipped. Every decision
+// is logged and emitted as a collision event.
+func (r *runner) resolveCollisions(srcRoot, destRoot string) error {
+	if r.opts.OnCollision != CollisionKeepLarger {
+		return nil
+	}
+	existing, err := r.existingFiles(destRoot)
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if r.opts.DryRun {
+		prefix = "dry-run: "
+	}
+	var replaced, kept int
+	err = r.workFS().WalkDir(srcRoot, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, skip := r.collisionSkipped[path]; skip {
+			return nil
+		}
+		rel, err := filepath.Rel(srcRoot, path)
+		if err != nil {
+			return err
+		}
+		target, ok := existing[r.collisionKey(r.destRel(rel, false))]
+		if !ok {
+			return nil
+		}
+		rec, err := compareCollision(r.workFS(), path, r.library(), target)
+		if err != nil {
+			return err
+		}
+
+		var action string
+		switch {
+		case !rec.HashesDiffer:
+			action = "skip-identical"
+			r.log.Printf("%scollision: skipping %s, identical to %s", prefix, path, target)
+		case rec.SourceSize > rec.TargetSize:
+			action = "replace"
+			r.log.Printf("%scollision: replacing %s (%s) with larger %s (%s)", prefix, target, humanBytes(rec.TargetSize, r.stats.units), path, humanBytes(rec.SourceSize, r.stats.units))
+		default:
+			action = "keep-existing"
+			r.log.Printf("%scollision: keeping existing %s (%s) over %s (%s)", prefix, target, humanBytes(rec.TargetSize, r.stats.units), path, humanBytes(rec.SourceSize, r.stats.units))
+		}
+		r.emit("collision", map[string]any{"source": path, "target": target, "source_size": rec.SourceSize, "target_size": rec.TargetSize, "action": action})
+
+		if action == "replace" {
+			if r.collisionReplace == nil {
+				r.collisionReplace = make(map[string]string)
+			}
+			r.collisionReplace[path] = target
+			replaced++
+			return nil
+		}
+		if r.collisionSkipped == nil {
+			r.collisionSkipped = make(map[string]struct{})
+		}
+		r.collisionSkipped[path] = struct{}{}
+		kept++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if replaced+kept > 0 && !r.opts.DryRun {
+		r.log.Printf("Resolved collisions: %d existing file(s) replaced, %d kept", replaced, kept)
+	}
+	return nil
+}
+
+// resolveNameClashes applies --on-collision to extracted files that renames
+// such as --clean-whitespace or --normalize-audio-ext map onto one
+// destination, or whose destinations differ only in case on a
+// case-insensitive library. By default the import aborts; with keep-larger
+// an identical copy is skipped and otherwise the larger file is moved and
+// the other left out, like a collision with the library. Folders mapped
+// together are merged. Every decision is logged and emitted as a collision
+// event.
+func (r *runner) resolveNameClashes(srcRoot, destRoot string) error {
+	prefix := ""
+	if r.opts.DryRun {
+		prefix = "dry-run: "
+	}
+	type source struct{ path, rel string }
+	kept := make(map[string]source) // collisionKey -> source moved there
+	return r.workFS().WalkDir(srcRoot, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		rel, err := filepath.Rel(srcRoot, path)
+		if err != nil {
+			return err
+		}
+		rel = r.destRel(rel, false)
+		key := r.collisionKey(rel)
+		first, ok := kept[key]
+		if !ok {
+			kept[key] = source{path, rel}
+			return nil
+		}
+		other, target := first.path, filepath.Join(destRoot, rel)
+		if r.opts.OnCollision != CollisionKeepLarger {
+			if first.rel != rel {
+				return fmt.Errorf("destination conflict: %s and %s differ only in case (use --on-collision keep-larger)", filepath.Join(destRoot, first.rel), target)
+			}
+			return fmt.Errorf("destination conflict: %s and %s would both be written to %s (use --on-collision keep-larger)", other, path, target)
+		}
+		rec, err := compareCollision(r.workFS(), path, r.workFS(), other)
+		if err != nil {
+			return err
+		}
+
+		loser := path
+		var action string
+		switch {
+		case !rec.HashesDiffer:
+			action = "skip-identical"
+			r.log.Printf("%scollision: skipping %s, identical to %s (both map to %s)", prefix, path, other, target)
+		case rec.SourceSize > rec.TargetSize:
+			action = "replace"
+			loser = other
+			kept[key] = source{path, rel}
+			r.log.Printf("%scollision: writing larger %s (%s) to %s instead of %s (%s)", prefix, path, humanBytes(rec.SourceSize, r.stats.units), target, other, humanBytes(rec.TargetSize, r.stats.units))
+		default:
+			action = "keep-existing"
+			r.log.Printf("%scollision: writing %s (%s) to %s instead of %s (%s)", prefix, other, humanBytes(rec.TargetSize, r.stats.units), target, path, humanBytes(rec.SourceSize, r.stats.units))
+		}
+		r.emit("collision", map[string]any{"source": path, "target": other, "source_size": rec.SourceSize, "target_size": rec.TargetSize, "action": action, "within_run": true})
+		if r.collisionSkipped == nil {
+			r.collisionSkipped = make(map[string]struct{})
+		}
+		r.collisionSkipped[loser] = struct{}{}
+		return nil
+	})
+}
+
+// replaceFile overwrites target with src by copying next to it and renaming
+// over it, so a failed copy leaves the existing file intact. The existing
+// file is renamed to a backup first and recorded in collisionBackups, so
+// --rollback-on-error can restore it if the move fails later on.
+func (r *runner) replaceFile(src, target string, mode os.FileMode) error {
+	dir, base := filepath.Dir(target), filepath.Base(target)
+	tmp := filepath.Join(dir, "."+base+".nd-import")
+	if err := r.copyFile(src, tmp, mode); err != nil {
+		r.library().Remove(tmp)
+		return err
+	}
+	backup := filepath.Join(dir, "."+base+".nd-import-backup")
+	if err := r.library().Rename(target, backup); err != nil {
+		r.library().Remove(tmp)
+		return err
+	}
+	if err := r.library().Rename(tmp, target); err != nil {
+		r.library().Rename(backup, target)
+		r.library().Remove(tmp)
+		return err
+	}
+	if r.collisionBackups == nil {
+		r.collisionBackups = make(map[string]string)
+	}
+	r.collisionBackups[target] = backup
+	return nil
+}
+
+// dropCollisionBackups removes the backups of replaced files once they are
+// no longer needed.
+func (r *runner) dropCollisionBackups() {
+	for target, backup := range r.collisionBackups {
+		if err := r.library().Remove(backup); err != nil && !os.IsNotExist(err) {
+			r.log.Printf("warning: could not remove the backup of %s: %v", target, err)
+		}
+	}
+	r.collisionBackups = nil
+}
+
+// existingFiles indexes the files under destRoot by collisionKey. A missing
+// destRoot yields an empty index.
+func (r *runner) existingFiles(destRoot string) (map[string]string, error) {
+	existing := make(map[string]string)
+	err := r.library().WalkDir(destRoot, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if path == destRoot && os.IsNotExist(walkErr) {
+				return filepath.SkipDir
+			}
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(destRoot, path)
+		if err != nil {
+			return err
+		}
+		existing[r.collisionKey(rel)] = path
+		return nil
+	})
+	return existing, err
+}
+
+func (r *runner) collisionKey(rel string) string {
+	if r.caseInsensitive {
+		return foldPath(rel)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// compareCollision sizes source on srcFS and target on dstFS and hashes
+// them when the sizes match.
+func compareCollision(srcFS FS, source string, dstFS FS, target string) (collisionRecord, error) {
+	rec := collisionRecord{Source: source, Target: target}
+	srcInfo, err := srcFS.Stat(source)
+	if err != nil {
+		return rec, err
+	}
+	dstInfo, err := dstFS.Stat(target)
+	if err != nil {
+		return rec, err
+	}
+	rec.SourceSize, rec.TargetSize = srcInfo.Size(), dstInfo.Size()
+	if rec.SourceSize != rec.TargetSize {
+		rec.HashesDiffer = true
+		return rec, nil
+	}
+
+	srcSum, err := fileSHA256(srcFS, source)
+	if err != nil {
+		return rec, err
+	}
+	dstSum, err := fileSHA256(dstFS, target)
+	if err != nil {
+		return rec, err
+	}
+	rec.HashesDiffer = !bytes.Equal(srcSum, dstSum)
+	return rec, nil
+}
+
+func fileSHA256(fsys FS, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("hash %q: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// appendCollisions writes one JSON line per collision to path.
+func appendCollisions(path string, records []collisionRecord) error {
+	f, err := openAppend(path)
+	if err != nil {
+		return fmt.Errorf("open collision report %q: %w", path, err)
+	}
+	enc := json.NewEncoder(f)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return fmt.Errorf("write collision report %q: %w", path, err)
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuietCollisionSkipsExisting(t *testing.T) {
+	extract := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "Artist")
+	files := map[string]string{
+		filepath.Join(extract, "Album", "01.flac"): "new",
+		filepath.Join(extract, "Album", "02.flac"): "same",
+		filepath.Join(extract, "Album", "03.flac"): "fresh",
+		filepath.Join(dest, "Album", "01.flac"):    "old",
+		filepath.Join(dest, "Album", "02.flac"):    "same",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "collisions.jsonl")
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.QuietCollision = reportPath
+	if err := r.moveIntoLibrary(extract, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+
+	for name, want := range map[string]string{"01.flac": "old", "02.flac": "same", "03.flac": "fresh"} {
+		got, err := os.ReadFile(filepath.Join(dest, "Album", name))
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q (err %v), want %q", name, got, err, want)
+		}
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("read collision report: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 collision lines, got %d:\n%s", len(lines), data)
+	}
+	differ := make(map[string]bool)
+	for _, line := range lines {
+		var rec collisionRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		differ[filepath.Base(rec.Source)] = rec.HashesDiffer
+	}
+	if !differ["01.flac"] || differ["02.flac"] {
+		t.Fatalf("unexpected hashes_differ values: %v", differ)
+	}
+}
+
+func TestKeepLargerResolvesCollisions(t *testing.T) {
+	extract := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "Artist")
+	files := map[string]string{
+		filepath.Join(extract, "Album", "01.flac"): "larger",
+		filepath.Join(extract, "Album", "02.flac"): "tiny",
+		filepath.Join(extract, "Album", "03.flac"): "same",
+		filepath.Join(extract, "Album", "04.flac"): "fresh",
+		filepath.Join(dest, "Album", "01.flac"):    "old",
+		filepath.Join(dest, "Album", "02.flac"):    "the original",
+		filepath.Join(dest, "Album", "03.flac"):    "same",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.OnCollision = CollisionKeepLarger
+	if err := r.moveIntoLibrary(extract, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+
+	want := map[string]string{"01.flac": "larger", "02.flac": "the original", "03.flac": "same", "04.flac": "fresh"}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dest, "Album", name))
+		if err != nil || string(got) != content {
+			t.Fatalf("%s = %q (err %v), want %q", name, got, err, content)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(dest, "Album"))
+	if err != nil || len(entries) != len(want) {
+		t.Fatalf("expected only %d files in the album, got %v (err %v)", len(want), entries, err)
+	}
+	if r.stats.movedFiles != 2 {
+		t.Fatalf("movedFiles = %d, want 2 (one replaced, one new)", r.stats.movedFiles)
+	}
+}
+
+func TestKeepLargerDryRunChangesNothing(t *testing.T) {
+	extract := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "Artist")
+	if err := os.MkdirAll(filepath.Join(extract, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dest, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(extract, "Album", "01.flac"), []byte("larger"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "Album", "01.flac"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	r := &runner{log: log.New(&out, "", 0)}
+	r.opts.OnCollision = CollisionKeepLarger
+	r.opts.DryRun = true
+	if err := r.moveIntoLibrary(extract, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "Album", "01.flac")); string(got) != "old" {
+		t.Fatalf("dry run modified the library: %q", got)
+	}
+	if !strings.Contains(out.String(), "dry-run: collision: replacing") {
+		t.Fatalf("expected a dry-run replace decision in the log:\n%s", out.String())
+	}
+}
+
+func TestKeepLargerRollbackRestoresReplaced(t *testing.T) {
+	extract := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "Artist")
+	if err := os.MkdirAll(filepath.Join(extract, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dest, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(extract, "Album", "01.flac"), []byte("larger"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "Album", "01.flac"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A dangling symlink passes the collision check but fails to copy,
+	// after 01.flac was replaced.
+	if err := os.Symlink(filepath.Join(extract, "missing"), filepath.Join(extract, "Album", "02.flac")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.OnCollision = CollisionKeepLarger
+	r.opts.RollbackOnError = true
+	if err := r.moveIntoLibrary(extract, dest); err == nil {
+		t.Fatalf("expected move failure")
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "Album", "01.flac")); err != nil || string(got) != "old" {
+		t.Fatalf("01.flac = %q (err %v), want the original restored", got, err)
+	}
+	if names := dirNames(t, filepath.Join(dest, "Album")); strings.Join(names, ",") != "01.flac" {
+		t.Fatalf("album holds %v after rollback, want only 01.flac", names)
+	}
+}
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Values accepted by Options.TargetFS.
+const (
+	TargetFSExt4  = "ext4"
+	TargetFSExFAT = "exfat"
+	TargetFSNTFS  = "ntfs"
+	TargetFSAPFS  = "apfs"
+)
+
+// ParseTargetFS normalizes a --target-fs value.
+func ParseTargetFS(raw string) (string, bool) {
+	switch fs := strings.ToLower(strings.TrimSpace(raw)); fs {
+	case TargetFSExt4, TargetFSExFAT, TargetFSNTFS, TargetFSAPFS:
+		return fs, true
+	}
+	return "", false
+}
+
+// fsRules are the naming restrictions of a --target-fs filesystem.
+type fsRules struct {
+	// reserved holds the characters a name may not contain; control
+	// characters are rejected too when controls is set.
+	reserved string
+	controls bool
+	// utf16 measures the 255 limit in UTF-16 code units instead of bytes.
+	utf16 bool
+	// windows rejects the DOS device names (CON, NUL, COM1, ...) and names
+	// ending in a dot or space, which Windows and the Linux exfat driver
+	// cannot round-trip.
+	windows bool
+	// caseInsensitive makes "a.flac" and "A.flac" the same file.
+	caseInsensitive bool
+}
+
+// maxTargetName is the name length limit of every supported filesystem.
+const maxTargetName = 255
+
+var targetFSRules = map[string]fsRules{
+	TargetFSExt4:  {reserved: "\x00"},
+	TargetFSExFAT: {reserved: `"*:<>?\|`, controls: true, utf16: true, windows: true, caseInsensitive: true},
+	TargetFSNTFS:  {reserved: `"*:<>?\|`, controls: true, utf16: true, windows: true, caseInsensitive: true},
+	// APFS stores ':' but Finder shows it as '/', so it is treated as
+	// reserved.
+	TargetFSAPFS: {reserved: ":\x00", caseInsensitive: true},
+}
+
+func (f fsRules) badChar(c rune) bool {
+	return strings.ContainsRune(f.reserved, c) || (f.controls && c < 0x20)
+}
+
+func (f fsRules) length(name string) int {
+	if f.utf16 {
+		return len(utf16.Encode([]rune(name)))
+	}
+	return len(name)
+}
+
+// windowsDeviceName reports whether name is a DOS device name, with or
+// without an extension ("NUL", "com1.txt").
+func windowsDeviceName(name string) bool {
+	stem, _, _ := strings.Cut(name, ".")
+	switch stem = strings.ToUpper(strings.TrimRight(stem, " ")); stem {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	return len(stem) == 4 && (strings.HasPrefix(stem, "COM") || strings.HasPrefix(stem, "LPT")) && stem[3] >= '1' && stem[3] <= '9'
+}
+
+// problems lists why name cannot be stored, or nil when it can.
+func (f fsRules) problems(name string) []string {
+	var out []string
+	var bad []string
+	seen := make(map[rune]bool)
+	for _, c := range name {
+		if f.badChar(c) && !seen[c] {
+			seen[c] = true
+			bad = append(bad, fmt.Sprintf("%q", c))
+		}
+	}
+	if len(bad) > 0 {
+		out = append(out, "contains "+strings.Join(bad, ", "))
+	}
+	if n := f.length(name); n > maxTargetName {
+		unit := "bytes"
+		if f.utf16 {
+			unit = "UTF-16 units"
+		}
+		out = append(out, fmt.Sprintf("is %d %s long (limit %d)", n, unit, maxTargetName))
+	}
+	if f.windows {
+		if windowsDeviceName(name) {
+			out = append(out, "is a reserved device name")
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			out = append(out, "ends with a dot or space")
+		}
+	}
+	return out
+}
+
+// fit rewrites name so it can be stored: reserved characters become "_",
+// trailing dots and spaces are dropped, device names get a "_" appended to
+// their stem and overlong names are shortened like --max-filename-length.
+func (f fsRules) fit(name string) string {
+	fixed := strings.Map(func(c rune) rune {
+		if f.badChar(c) {
+			return '_'
+		}
+		return c
+	}, name)
+	if f.windows {
+		if fixed = strings.TrimRight(fixed, " ."); fixed == "" {
+			fixed = "_"
+		}
+		if windowsDeviceName(fixed) {
+			stem, ext, _ := strings.Cut(fixed, ".")
+			fixed = stem + "_"
+			if ext != "" {
+				fixed += "." + ext
+			}
+		}
+	}
+	// A name of at most 255 bytes never exceeds 255 UTF-16 units.
+	if f.length(fixed) > maxTargetName {
+		fixed = shortenName(fixed, maxTargetName)
+	}
+	return fixed
+}
+
+func (r *runner) targetFS() (fsRules, bool) {
+	rules, ok := targetFSRules[r.opts.TargetFS]
+	return rules, ok
+}
+
+// fitTargetFS implements --fix-target-names: every component of rel is
+// rewritten to fit --target-fs, each change logged once per run.
+func (r *runner) fitTargetFS(rel string) string {
+	rules, ok := r.targetFS()
+	if !ok || !r.opts.FixTargetNames {
+		return rel
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		fixed := rules.fit(part)
+		if fixed == part {
+			continue
+		}
+		if _, ok := r.targetFitted[part]; !ok {
+			if r.targetFitted == nil {
+				r.targetFitted = make(map[string]string)
+			}
+			r.targetFitted[part] = fixed
+			r.log.Printf("Renamed for %s: %q -> %q", r.opts.TargetFS, part, fixed)
+		}
+		parts[i] = fixed
+	}
+	return filepath.Join(parts...)
+}
+
+// checkTargetFS implements --target-fs: the artist folder, --subpath and
+// every imported name, as it will be written, are checked against the
+// target filesystem's rules. Each violation is logged. A dry run only
+// warns (--strict-dry-run fails); an import refuses to start, so the move
+// never stops halfway with a write error. With --fix-target-names the
+// names were already rewritten by destRel and nothing is left to report.
+func (r *runner) checkTargetFS(extractDir string) error {
+	rules, ok := r.targetFS()
+	if !ok {
+		return nil
+	}
+	rels := []string{filepath.Join(r.artistDir, r.subpath)}
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || path == extractDir {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		rels = append(rels, r.destRel(rel, d.IsDir()))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.reportTargetFS(rules, rels)
+}
+
+// reportTargetFS logs every component of rels that rules reject and fails
+// unless this is a plain dry run.
+func (r *runner) reportTargetFS(rules fsRules, rels []string) error {
+	violations := make(map[string][]string)
+	for _, rel := range rels {
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			if _, done := violations[part]; done || part == "" {
+				continue
+			}
+			if p := rules.problems(part); p != nil {
+				violations[part] = p
+			}
+		}
+	}
+	if len(violations) == 0 {
+		r.log.Printf("All names fit %s", r.opts.TargetFS)
+		return nil
+	}
+
+	names := make([]string, 0, len(violations))
+	for name := range violations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.log.Printf("target-fs: %q %s", name, strings.Join(violations[name], "; "))
+	}
+	err := fmt.Errorf("%d name(s) cannot be stored on %s (see above); rename them or use --fix-target-names", len(names), r.opts.TargetFS)
+	if r.opts.DryRun && !r.opts.StrictDryRun {
+		r.log.Printf("warning: %v", err)
+		return nil
+	}
+	return err
+}
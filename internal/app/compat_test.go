@@ -0,0 +1,86 @@
+package app
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestTargetFSRules(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".flac" // 405 bytes, 205 UTF-16 units
+	cases := []struct {
+		fs, name string
+		problems int
+		fixed    string
+	}{
+		{TargetFSExt4, "What? Live: 1999.flac", 0, "What? Live: 1999.flac"},
+		{TargetFSExFAT, "What? Live: 1999.flac", 1, "What_ Live_ 1999.flac"},
+		{TargetFSNTFS, "Album...", 1, "Album"},
+		{TargetFSNTFS, "con.txt", 1, "con_.txt"},
+		{TargetFSNTFS, "Conan.txt", 0, "Conan.txt"},
+		{TargetFSAPFS, "Side A: Intro.mp3", 1, "Side A_ Intro.mp3"},
+		{TargetFSExFAT, long, 0, long},
+		{TargetFSExt4, long, 1, shortenName(long, maxTargetName)},
+	}
+	for _, tc := range cases {
+		rules := targetFSRules[tc.fs]
+		if got := rules.problems(tc.name); len(got) != tc.problems {
+			t.Errorf("%s problems(%q) = %q, want %d", tc.fs, tc.name, got, tc.problems)
+		}
+		if got := rules.fit(tc.name); got != tc.fixed {
+			t.Errorf("%s fit(%q) = %q, want %q", tc.fs, tc.name, got, tc.fixed)
+		}
+		if got := rules.fit(tc.name); rules.problems(got) != nil {
+			t.Errorf("%s fit(%q) = %q still has problems %q", tc.fs, tc.name, got, rules.problems(got))
+		}
+	}
+}
+
+func TestExecuteTargetFS(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/file/abc123" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, map[string]string{"Live: 1999/01 Why?.flac": "a", "Live: 1999/02 Intro.flac": "b"}))
+	})
+	run := func(opts Options) (string, error) {
+		library := t.TempDir()
+		opts.Artist, opts.URLs, opts.TmpDir, opts.TargetFS = "Artist", []string{"abc123"}, t.TempDir(), TargetFSExFAT
+		r := &runner{
+			cfg:  config.Config{NavidromeMusicPath: library},
+			opts: opts,
+			log:  log.New(io.Discard, "", 0),
+		}
+		return library, r.Execute()
+	}
+
+	library, err := run(Options{})
+	if err == nil || !strings.Contains(err.Error(), "2 name(s) cannot be stored on exfat") {
+		t.Fatalf("Execute error = %v, want the exfat violations", err)
+	}
+	if entries, _ := os.ReadDir(library); len(entries) != 0 {
+		t.Fatalf("library has %d entries after a refused import, want none", len(entries))
+	}
+
+	if _, err := run(Options{DryRun: true, StrictDryRun: true}); err == nil {
+		t.Fatalf("--strict-dry-run passed despite exfat violations")
+	}
+
+	library, err = run(Options{FixTargetNames: true})
+	if err != nil {
+		t.Fatalf("Execute with --fix-target-names returned error: %v", err)
+	}
+	for _, rel := range []string{"Artist/Live_ 1999/01 Why_.flac", "Artist/Live_ 1999/02 Intro.flac"} {
+		if _, err := os.Stat(filepath.Join(library, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("%s not imported: %v", rel, err)
+		}
+	}
+}
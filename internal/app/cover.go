@@ -0,0 +1,128 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders for the formats --cover-url converts
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	coverName = "cover.jpg"
+	// maxCoverSize bounds the --cover-url download.
+	maxCoverSize = 32 << 20
+	coverTimeout = 2 * time.Minute
+)
+
+// fetchCover downloads --cover-url and returns it as JPEG data. JPEGs are
+// kept byte for byte; PNG and GIF are re-encoded. Anything that does not
+// decode as one of those is rejected, so an HTML error page never ends up
+// as cover art.
+func (r *runner) fetchCover() ([]byte, error) {
+	client, err := r.apiClient(hostDownload, coverTimeout)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.get(r.opts.CoverURL, "image/jpeg, image/png;q=0.9, image/*;q=0.8", "")
+	if err != nil {
+		return nil, fmt.Errorf("--cover-url: download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("--cover-url: status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCoverSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("--cover-url: download failed: %w", err)
+	}
+	if len(data) > maxCoverSize {
+		return nil, fmt.Errorf("--cover-url: image larger than %s", humanBytes(maxCoverSize, r.stats.units))
+	}
+
+	cover, format, err := coverJPEG(data)
+	if err != nil {
+		return nil, fmt.Errorf("--cover-url: %w", err)
+	}
+	if format != "jpeg" {
+		r.log.Printf("Converted cover image from %s to JPEG", strings.ToUpper(format))
+	}
+	return cover, nil
+}
+
+// coverJPEG validates data as an image and returns it as JPEG, along with
+// the format it was decoded from.
+func coverJPEG(data []byte) ([]byte, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("not a supported image (JPEG, PNG or GIF; detected %s): %w", http.DetectContentType(data), err)
+	}
+	if format == "jpeg" {
+		return data, format, nil
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, format, fmt.Errorf("convert %s to JPEG: %w", format, err)
+	}
+	return buf.Bytes(), format, nil
+}
+
+// coverFolder picks where --cover-url goes, relative to the destination:
+// the album folder when every imported album lives under one top-level
+// folder (a multi-disc album included), otherwise the destination itself.
+func (r *runner) coverFolder(extractDir string) (string, error) {
+	folders, err := r.albumFolders(extractDir)
+	if err != nil {
+		return "", fmt.Errorf("find album folders: %w", err)
+	}
+	album := ""
+	for i, rel := range folders {
+		top := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+		if i > 0 && top != album {
+			return "", nil
+		}
+		album = top
+	}
+	return album, nil
+}
+
+// writeCover saves cover as cover.jpg in the imported album folder (see
+// coverFolder), leaving an existing cover.jpg alone.
+func (r *runner) writeCover(extractDir, dest string, cover []byte) error {
+	rel, err := r.coverFolder(extractDir)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dest, rel, coverName)
+	if r.opts.DryRun {
+		r.log.Printf("dry-run: would write %s from --cover-url", path)
+		return nil
+	}
+	if _, err := r.library().Stat(path); err == nil {
+		r.log.Printf("Skipping --cover-url: %s already exists", path)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("stat %q: %w", path, err)
+	}
+
+	f, err := r.createFile(r.library(), path, 0)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", path, err)
+	}
+	if _, err := f.Write(cover); err != nil {
+		f.Close()
+		return fmt.Errorf("write %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write %q: %w", path, err)
+	}
+	r.log.Printf("Wrote cover art to %s", path)
+	return r.chownCreated([]string{path})
+}
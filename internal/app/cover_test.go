@@ -0,0 +1,107 @@
+package app
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func pngBytes(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.RGBA{R: 200, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCoverJPEG(t *testing.T) {
+	data, format, err := coverJPEG(pngBytes(t))
+	if err != nil || format != "png" {
+		t.Fatalf("coverJPEG(png) = %q, %v", format, err)
+	}
+	if _, got, err := image.Decode(bytes.NewReader(data)); err != nil || got != "jpeg" {
+		t.Fatalf("converted cover decodes as %q, %v; want jpeg", got, err)
+	}
+	if _, _, err := coverJPEG([]byte("<html>not found</html>")); err == nil || !strings.Contains(err.Error(), "text/html") {
+		t.Fatalf("coverJPEG(html) error = %v, want one naming the detected type", err)
+	}
+}
+
+func TestExecuteCoverURL(t *testing.T) {
+	cover := pngBytes(t)
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/cover.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(cover)
+		case "/file/one":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write(zipBytes(t, map[string]string{"Album/Disc 1/01.flac": "a", "Album/Disc 2/01.flac": "b"}))
+		case "/file/two":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write(zipBytes(t, map[string]string{"First/01.flac": "a", "Second/01.flac": "b"}))
+		case "/file/three":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write(zipBytes(t, map[string]string{" Album  (2019)/01.flac": "a"}))
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	cases := []struct {
+		id, want string
+		opts     Options
+	}{
+		{id: "one", want: "Artist/Album/cover.jpg"},
+		{id: "two", want: "Artist/cover.jpg"},
+		// The cover follows the album folder's rename.
+		{id: "three", want: "Artist/Album (2019)/cover.jpg", opts: Options{CleanWhitespace: true}},
+	}
+	for _, tc := range cases {
+		id, want := tc.id, tc.want
+		library := t.TempDir()
+		opts := tc.opts
+		opts.Artist, opts.URLs, opts.CoverURL, opts.TmpDir = "Artist", []string{id}, pixeldrainAPI+"/cover.png", t.TempDir()
+		r := &runner{
+			cfg:  config.Config{NavidromeMusicPath: library},
+			opts: opts,
+			log:  log.New(io.Discard, "", 0),
+		}
+		if err := r.Execute(); err != nil {
+			t.Fatalf("%s: Execute returned error: %v", id, err)
+		}
+		data, err := os.ReadFile(filepath.Join(library, filepath.FromSlash(want)))
+		if err != nil {
+			t.Fatalf("%s: cover not written to %s: %v", id, want, err)
+		}
+		if _, format, err := image.Decode(bytes.NewReader(data)); err != nil || format != "jpeg" {
+			t.Fatalf("%s: cover decodes as %q, %v; want jpeg", id, format, err)
+		}
+	}
+
+	library := t.TempDir()
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library},
+		opts: Options{Artist: "Artist", URLs: []string{"one"}, CoverURL: pixeldrainAPI + "/missing.png", TmpDir: t.TempDir()},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.Execute(); err == nil || !strings.Contains(err.Error(), "--cover-url") {
+		t.Fatalf("Execute error = %v, want a --cover-url failure", err)
+	}
+	if _, err := os.Stat(filepath.Join(library, "Artist")); !os.IsNotExist(err) {
+		t.Fatalf("failed cover download still imported the archive (err=%v)", err)
+	}
+}
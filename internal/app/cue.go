@@ -0,0 +1,111 @@
+package app
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseCueFiles returns the file names referenced by FILE commands in a cue sheet.
+func parseCueFiles(cuePath string) ([]string, error) {
+	f, err := os.Open(cuePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if len(line) < 5 || !strings.EqualFold(line[:5], "FILE ") {
+			continue
+		}
+		rest := strings.TrimSpace(line[5:])
+		var name string
+		if strings.HasPrefix(rest, `"`) {
+			if end := strings.Index(rest[1:], `"`); end >= 0 {
+				name = rest[1 : end+1]
+			}
+		} else if fields := strings.Fields(rest); len(fields) > 0 {
+			name = fields[0]
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
+
+// resolveCueReference maps a cue FILE name to a path next to the cue sheet,
+// accepting backslash separators and falling back to a case-insensitive
+// match within the directory. ok is false when nothing matches.
+func resolveCueReference(cuePath, name string) (string, bool) {
+	path := filepath.Join(filepath.Dir(cuePath), filepath.FromSlash(strings.ReplaceAll(name, "\\", "/")))
+	if _, err := os.Lstat(path); err == nil {
+		return path, true
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return path, false
+	}
+	base := filepath.Base(path)
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), base) {
+			return filepath.Join(filepath.Dir(path), e.Name()), true
+		}
+	}
+	return path, false
+}
+
+// protectCueReferences removes audio referenced by kept cue sheets from the
+// prune set, and warns about references that are missing or sit inside a
+// pruned directory.
+func (r *runner) protectCueReferences(extractDir string, remove map[string]struct{}) error {
+	pruned := func(path string) bool {
+		for p := path; p != extractDir && p != filepath.Dir(p); p = filepath.Dir(p) {
+			if _, ok := remove[p]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var cues []string
+	err := filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".cue") && !pruned(path) {
+			cues = append(cues, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, cue := range cues {
+		names, err := parseCueFiles(cue)
+		if err != nil {
+			r.log.Printf("warning: could not read cue sheet %s: %v", cue, err)
+			continue
+		}
+		for _, name := range names {
+			ref, ok := resolveCueReference(cue, name)
+			switch {
+			case !ok:
+				r.log.Printf("warning: %s references missing file %q", cue, name)
+			case pruned(filepath.Dir(ref)):
+				r.log.Printf("warning: %s references %s, but its folder is pruned", cue, ref)
+			default:
+				if _, ok := remove[ref]; ok {
+					delete(remove, ref)
+					r.log.Printf("Keeping %s: referenced by %s", ref, filepath.Base(cue))
+				}
+			}
+		}
+	}
+	return nil
+}
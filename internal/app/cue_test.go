@@ -0,0 +1,62 @@
+package app
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestParseCueFiles(t *testing.T) {
+	cue := filepath.Join(t.TempDir(), "album.cue")
+	content := "\ufeffREM GENRE Rock\r\nFILE \"Album Image.wav\" WAVE\r\n  TRACK 01 AUDIO\r\nfile disc2.flac WAVE\r\n"
+	if err := os.WriteFile(cue, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := parseCueFiles(cue)
+	if err != nil {
+		t.Fatalf("parseCueFiles returned error: %v", err)
+	}
+	if len(names) != 2 || names[0] != "Album Image.wav" || names[1] != "disc2.flac" {
+		t.Fatalf("parseCueFiles = %q", names)
+	}
+}
+
+func TestPruneExtractedRespectCue(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"Album/album.cue":  "FILE \"album.wav\" WAVE\nFILE \"gone.wav\" WAVE\n",
+		"Album/album.wav":  "audio",
+		"Album/other.wav":  "audio",
+		"Album/album.flac": "audio",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		cfg:  config.Config{UnneededPatterns: []string{"*.wav"}},
+		opts: Options{RespectCue: true},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.pruneExtracted(root); err != nil {
+		t.Fatalf("pruneExtracted returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "Album", "album.wav")); err != nil {
+		t.Fatalf("cue-referenced audio should be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Album", "other.wav")); !os.IsNotExist(err) {
+		t.Fatalf("unreferenced wav should be pruned, got err=%v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Statuses reported by --diff for each extracted file.
+const (
+	diffNew     = "NEW"
+	diffSame    = "SAME"
+	diffChanged = "CHANGED"
+)
+
+// diffLibrary implements --diff: every file that would be moved is compared
+// with the library copy at its destination and logged as NEW (missing),
+// SAME (same size and SHA-256) or CHANGED, followed by a summary. Nothing is
+// written.
+func (r *runner) diffLibrary(extractDir, dest string) error {
+	counts := make(map[string]int)
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			return nil
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		rel = r.destRel(rel, false)
+		status, err := r.diffFile(path, filepath.Join(dest, rel))
+		if err != nil {
+			return fmt.Errorf("diff %q: %w", rel, err)
+		}
+		counts[status]++
+		r.log.Printf("diff: %-7s %s", status, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.log.Printf("Diff against %s: %d new, %d same, %d changed; nothing was written", dest, counts[diffNew], counts[diffSame], counts[diffChanged])
+	return nil
+}
+
+// diffFile classifies the extracted file src against target in the library.
+func (r *runner) diffFile(src, target string) (string, error) {
+	dstInfo, err := r.library().Stat(target)
+	if os.IsNotExist(err) {
+		return diffNew, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if dstInfo.IsDir() {
+		return diffChanged, nil
+	}
+	srcInfo, err := r.workFS().Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if srcInfo.Size() != dstInfo.Size() {
+		return diffChanged, nil
+	}
+
+	srcSum, err := r.hashFS(r.workFS(), src)
+	if err != nil {
+		return "", err
+	}
+	dstSum, err := r.hashFS(r.library(), target)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(srcSum, dstSum) {
+		return diffChanged, nil
+	}
+	return diffSame, nil
+}
+
+// hashFS returns the SHA-256 of path read through fsys.
+func (r *runner) hashFS(fsys FS, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxReader{r.context(), f}); err != nil {
+		return nil, fmt.Errorf("hash %q: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
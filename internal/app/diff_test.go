@@ -0,0 +1,53 @@
+package app
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestExecuteDiff(t *testing.T) {
+	kept := t.TempDir()
+	library := t.TempDir()
+	files := map[string]string{
+		filepath.Join(kept, "Album", "01.flac"):              "same",
+		filepath.Join(kept, "Album", "02.flac"):              "new take",
+		filepath.Join(kept, "Album", "03.flac"):              "fresh",
+		filepath.Join(kept, "Album", "notes.txt"):            "pruned",
+		filepath.Join(library, "Artist", "Album", "01.flac"): "same",
+		filepath.Join(library, "Artist", "Album", "02.flac"): "old take",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out strings.Builder
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library, UnneededPatterns: []string{"*.txt"}},
+		opts: Options{Artist: "Artist", ReuseTemp: kept, DryRun: true, Diff: true},
+		log:  log.New(&out, "", 0),
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	for _, want := range []string{"SAME    Album/01.flac", "CHANGED Album/02.flac", "NEW     Album/03.flac", "1 new, 1 same, 1 changed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("diff output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "diff: NEW     Album/notes.txt") {
+		t.Fatalf("pruned file should not be diffed:\n%s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(library, "Artist", "Album", "03.flac")); !os.IsNotExist(err) {
+		t.Fatalf("--diff must not write to the library, got err=%v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// minFreeSpace returns the reserve to keep free on the library volume:
+// --min-free-space wins over MIN_FREE_SPACE; zero disables the check.
+func (r *runner) minFreeSpace() int64 {
+	if r.opts.MinFreeSpace > 0 {
+		return r.opts.MinFreeSpace
+	}
+	return r.cfg.MinFreeSpace
+}
+
+// checkFreeSpace aborts the import when copying extractDir into dest would
+// leave less than the configured reserve free on dest's volume. Only
+// local libraries can be measured; remote ones are skipped with a warning.
+func (r *runner) checkFreeSpace(extractDir, dest string) error {
+	reserve := r.minFreeSpace()
+	if reserve <= 0 {
+		return nil
+	}
+	if _, local := r.library().(osFS); !local {
+		r.log.Printf("warning: --min-free-space cannot be checked on an sftp://, s3:// or davs:// library; skipping")
+		return nil
+	}
+
+	var need int64
+	err := filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			return nil
+		}
+		if _, skip := r.collisionSkipped[path]; skip {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		need += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.checkFreeSpaceFor(need, dest)
+}
+
+// checkFreeSpaceFor is checkFreeSpace for need bytes about to be written
+// to a local dest.
+func (r *runner) checkFreeSpaceFor(need int64, dest string) error {
+	reserve := r.minFreeSpace()
+	if reserve <= 0 {
+		return nil
+	}
+
+	// dest may not exist yet; measure the nearest existing ancestor.
+	target := dest
+	for {
+		if _, err := os.Stat(target); err == nil || filepath.Dir(target) == target {
+			break
+		}
+		target = filepath.Dir(target)
+	}
+	free, err := freeSpace(target)
+	if errors.Is(err, errors.ErrUnsupported) {
+		r.log.Printf("warning: --min-free-space is not supported on this platform; skipping")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check free space on %s: %w", target, err)
+	}
+
+	units := r.stats.units
+	if free-need < reserve {
+		return fmt.Errorf("not enough free space on %s: moving %s would leave %s, below the %s reserve (--min-free-space)",
+			target, humanBytes(need, units), humanBytes(max(free-need, 0), units), humanBytes(reserve, units))
+	}
+	r.log.Printf("Free space on %s: %s, %s after the move (reserve %s)", target, humanBytes(free, units), humanBytes(free-need, units), humanBytes(reserve, units))
+	return nil
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestMoveIntoLibraryMinFreeSpace(t *testing.T) {
+	if _, err := freeSpace(t.TempDir()); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("free space is not measurable on this platform")
+	}
+
+	extractDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(extractDir, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(extractDir, "Album", "01.flac"), []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	library := t.TempDir()
+	dest := filepath.Join(library, "Artist")
+
+	r := &runner{
+		cfg: config.Config{NavidromeMusicPath: library, MinFreeSpace: 1 << 62},
+		log: log.New(io.Discard, "", 0),
+	}
+	err := r.moveIntoLibrary(extractDir, dest)
+	if err == nil || !strings.Contains(err.Error(), "not enough free space") {
+		t.Fatalf("expected free space error, got %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatalf("destination created despite the free space check: %v", err)
+	}
+
+	// --min-free-space takes precedence over MIN_FREE_SPACE.
+	r.opts.MinFreeSpace = 1
+	if err := r.moveIntoLibrary(extractDir, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Album", "01.flac")); err != nil {
+		t.Fatalf("expected moved file: %v", err)
+	}
+}
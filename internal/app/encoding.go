@@ -0,0 +1,120 @@
+package app
+
+import (
+	"archive/zip"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Values accepted by Options.FilenameEncoding. FilenameEncodingAuto (the
+// default) decodes zip entry names that are not valid UTF-8 as CP437, the
+// zip format's legacy encoding; the others force an encoding for every
+// entry not flagged as UTF-8.
+const (
+	FilenameEncodingAuto     = "auto"
+	FilenameEncodingUTF8     = "utf-8"
+	FilenameEncodingCP437    = "cp437"
+	FilenameEncodingShiftJIS = "shift-jis"
+)
+
+// ParseFilenameEncoding normalizes a --filename-encoding value, accepting
+// common aliases (utf8, ibm437, sjis, cp932, ...). ok is false for
+// encodings that cannot be decoded.
+func ParseFilenameEncoding(raw string) (name string, ok bool) {
+	switch strings.ReplaceAll(strings.ToLower(strings.TrimSpace(raw)), "_", "-") {
+	case "", "auto":
+		return FilenameEncodingAuto, true
+	case "utf-8", "utf8":
+		return FilenameEncodingUTF8, true
+	case "cp437", "ibm437", "437":
+		return FilenameEncodingCP437, true
+	case "shift-jis", "shiftjis", "sjis", "cp932", "windows-31j":
+		return FilenameEncodingShiftJIS, true
+	}
+	return "", false
+}
+
+// cp437High holds the characters of CP437 bytes 0x80-0xFF.
+const cp437High = "ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ "
+
+var cp437Runes = []rune(cp437High)
+
+func decodeCP437(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x80 {
+			b.WriteByte(c)
+		} else {
+			b.WriteRune(cp437Runes[c-0x80])
+		}
+	}
+	return b.String()
+}
+
+//go:generate go run gen_cp932.go
+
+var (
+	cp932Once  sync.Once
+	cp932Table [256][]rune
+)
+
+// decodeShiftJIS decodes CP932, the Windows flavour of Shift-JIS. Bytes
+// that do not form a valid character become U+FFFD.
+func decodeShiftJIS(s string) string {
+	cp932Once.Do(func() {
+		for lead, row := range cp932Rows {
+			if row != "" {
+				cp932Table[lead] = []rune(row)
+			}
+		}
+	})
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+		case c >= 0xa1 && c <= 0xdf: // half-width katakana
+			b.WriteRune(0xff61 + rune(c-0xa1))
+		case cp932Table[c] != nil && i+1 < len(s) && s[i+1] >= 0x40 && s[i+1] <= 0xfc && s[i+1] != 0x7f:
+			t := int(s[i+1]) - 0x40
+			if s[i+1] > 0x7f {
+				t--
+			}
+			b.WriteRune(cp932Table[c][t])
+			i++
+		default:
+			b.WriteRune(utf8.RuneError)
+		}
+	}
+	return b.String()
+}
+
+// entryName returns the UTF-8 name of zip entry f, decoding legacy
+// encodings as configured by --filename-encoding and dropping a leading
+// byte order mark. decoded reports whether the raw name was re-encoded.
+func (r *runner) entryName(f *zip.File) (name string, decoded bool) {
+	name = f.Name
+	if f.NonUTF8 {
+		switch r.filenameEncoding() {
+		case FilenameEncodingAuto:
+			if !utf8.ValidString(name) {
+				name = decodeCP437(name)
+			}
+		case FilenameEncodingCP437:
+			name = decodeCP437(name)
+		case FilenameEncodingShiftJIS:
+			name = decodeShiftJIS(name)
+		}
+	}
+	return strings.TrimPrefix(name, "\ufeff"), name != f.Name
+}
+
+func (r *runner) filenameEncoding() string {
+	if r.opts.FilenameEncoding == "" {
+		return FilenameEncodingAuto
+	}
+	return r.opts.FilenameEncoding
+}
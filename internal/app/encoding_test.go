@@ -0,0 +1,74 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeShiftJIS(t *testing.T) {
+	tests := map[string]string{
+		"\x95\\\x8e\xa6":             "表示", // trail byte 0x5c is not a path separator here
+		"\x83A\x83\x8b\x83o\x83\x80": "アルバム",
+		"\xb1\xd9\xca\xde\xd1":       "ｱﾙﾊﾞﾑ",
+		"Disc 1/\x8cQ\x90\xc2.flac":  "Disc 1/群青.flac",
+		"bad\x81":                    "bad�",
+	}
+	for in, want := range tests {
+		if got := decodeShiftJIS(in); got != want {
+			t.Fatalf("decodeShiftJIS(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := decodeCP437("Caf\x82 \x9c"); got != "Café £" {
+		t.Fatalf("decodeCP437 = %q, want %q", got, "Café £")
+	}
+}
+
+func TestExtractArchiveFilenameEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, h := range []*zip.FileHeader{
+		{Name: "Caf\x82/01.flac", NonUTF8: true},
+		{Name: "\x93\x8c\x8b\x9e/02.flac", NonUTF8: true},
+		{Name: "\ufeffÜber/03.flac"},
+	} {
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("audio"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "legacy.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		encoding string
+		want     []string
+	}{
+		// Auto decodes invalid UTF-8 as CP437, mangling the Shift-JIS name
+		// into readable (if wrong) characters rather than raw bytes.
+		{"", []string{"Café/01.flac", "ôîï₧/02.flac", "Über/03.flac"}},
+		{FilenameEncodingShiftJIS, []string{"東京/02.flac", "Über/03.flac"}},
+	}
+	for _, tt := range tests {
+		dest := t.TempDir()
+		r := &runner{log: log.New(io.Discard, "", 0), opts: Options{FilenameEncoding: tt.encoding}}
+		if err := r.extractArchive(archive, dest, map[string]string{}); err != nil {
+			t.Fatalf("%q: extractArchive returned error: %v", tt.encoding, err)
+		}
+		for _, name := range tt.want {
+			if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name))); err != nil {
+				t.Fatalf("%q: expected %s: %v", tt.encoding, name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// eventStream writes newline-delimited JSON progress events for UIs
+// (--json-lines). A nil *eventStream discards events.
+type eventStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// openEventStream resolves the --json-lines destination: "stdout", "stderr"
+// or a file path (appended to). An empty dest disables the stream.
+func openEventStream(dest string) (*eventStream, io.Closer, error) {
+	switch dest {
+	case "":
+		return nil, io.NopCloser(nil), nil
+	case "stdout", "-":
+		return &eventStream{enc: json.NewEncoder(os.Stdout)}, io.NopCloser(nil), nil
+	case "stderr":
+		return &eventStream{enc: json.NewEncoder(os.Stderr)}, io.NopCloser(nil), nil
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open json-lines stream %q: %w", dest, err)
+	}
+	return &eventStream{enc: json.NewEncoder(f)}, f, nil
+}
+
+// emit writes one event. Write errors are ignored so a closed pipe on the UI
+// side never aborts an import.
+func (s *eventStream) emit(event, artist, importID string, fields map[string]any) {
+	if s == nil {
+		return
+	}
+	rec := make(map[string]any, len(fields)+4)
+	for k, v := range fields {
+		rec[k] = v
+	}
+	rec["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	rec["event"] = event
+	rec["artist"] = artist
+	if importID != "" {
+		rec["import_id"] = importID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(rec)
+}
+
+func (r *runner) emit(event string, fields map[string]any) {
+	r.events.emit(event, r.opts.Artist, r.opts.ImportID, fields)
+}
+
+func (r *runner) console() io.Writer {
+	return consoleFor(r.opts)
+}
+
+// consoleFor is where human-readable logs and the progress line go. When the
+// event stream or the --json batch summary uses stdout, they move to stderr
+// to keep it parseable.
+func consoleFor(opts Options) io.Writer {
+	if opts.JSONLines == "stdout" || opts.JSONLines == "-" || opts.SummaryJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
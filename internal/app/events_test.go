@@ -0,0 +1,62 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestExecuteEmitsEvents(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, map[string]string{"Album/01.flac": "audio", "Album/02.flac": "audio"}))
+	})
+
+	library := t.TempDir()
+	var buf bytes.Buffer
+	r := newRunner(config.Config{NavidromeMusicPath: library}, Options{Artist: "Artist", URLs: []string{"abc123"}, TmpDir: t.TempDir(), ImportID: "run42"})
+	r.events = &eventStream{enc: json.NewEncoder(&buf)}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(library, "Artist", "Album", "01.flac")); err != nil {
+		t.Fatalf("expected imported file: %v", err)
+	}
+
+	var names []string
+	var last map[string]any
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var ev map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("invalid event %q: %v", scanner.Text(), err)
+		}
+		if ev["artist"] != "Artist" || ev["import_id"] != "run42" {
+			t.Fatalf("event missing artist or import_id: %v", ev)
+		}
+		name := ev["event"].(string)
+		if len(names) == 0 || names[len(names)-1] != name {
+			names = append(names, name)
+		}
+		last = ev
+	}
+
+	want := []string{"resolved", "download-start", "download-progress", "extract", "prune", "move-progress", "done"}
+	if len(names) != len(want) {
+		t.Fatalf("events = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("events = %v, want %v", names, want)
+		}
+	}
+	if last["result"] != "success" {
+		t.Fatalf("done event result = %v, want success", last["result"])
+	}
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Archive formats recognised by detectArchiveFormat; values accepted by
+// Options.AllowFormats. Only FormatZip can be extracted so far.
+const (
+	FormatZip    = "zip"
+	FormatTar    = "tar"
+	FormatGzip   = "gzip"
+	FormatRar    = "rar"
+	FormatSevenZ = "7z"
+)
+
+// archiveFormats lists every recognised format in detection order, each
+// with the leading bytes (at offset) that identify it.
+var archiveFormats = []struct {
+	name   string
+	offset int
+	magic  []byte
+}{
+	{FormatZip, 0, []byte("PK\x03\x04")},
+	{FormatZip, 0, []byte("PK\x05\x06")}, // empty archive
+	{FormatGzip, 0, []byte{0x1f, 0x8b}},
+	{FormatRar, 0, []byte("Rar!\x1a\x07")},
+	{FormatSevenZ, 0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+	{FormatTar, 257, []byte("ustar")},
+}
+
+// formatExtensions is the file extension each format is saved under.
+var formatExtensions = map[string]string{
+	FormatZip:    ".zip",
+	FormatTar:    ".tar",
+	FormatGzip:   ".gz",
+	FormatRar:    ".rar",
+	FormatSevenZ: ".7z",
+}
+
+// extractableFormats are the formats extractArchive can unpack.
+var extractableFormats = []string{FormatZip}
+
+// IsArchiveFormat reports whether name is a recognised archive format.
+func IsArchiveFormat(name string) bool {
+	return slices.Contains(ArchiveFormats(), name)
+}
+
+// ArchiveFormats returns the names of all recognised archive formats.
+func ArchiveFormats() []string {
+	var names []string
+	for _, f := range archiveFormats {
+		if !slices.Contains(names, f.name) {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// detectArchiveFormat sniffs the format of the archive at path from its
+// leading bytes. It returns "" when the format is not recognised.
+func detectArchiveFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+	for _, af := range archiveFormats {
+		end := af.offset + len(af.magic)
+		if end <= len(head) && bytes.Equal(head[af.offset:end], af.magic) {
+			return af.name, nil
+		}
+	}
+	return "", nil
+}
+
+// checkArchiveFormat rejects archives whose detected format is excluded by
+// --allow-formats or cannot be extracted. Unrecognised formats pass and
+// fail later with the zip reader's own error.
+func (r *runner) checkArchiveFormat(archivePath string) error {
+	format, err := detectArchiveFormat(archivePath)
+	if err != nil {
+		return fmt.Errorf("detect archive format: %w", err)
+	}
+	if format == "" {
+		return nil
+	}
+	if allowed := r.opts.AllowFormats; len(allowed) > 0 && !slices.Contains(allowed, format) {
+		return fmt.Errorf("archive %s is %s, which --allow-formats does not permit (allowed: %s)", filepath.Base(archivePath), format, strings.Join(allowed, ", "))
+	}
+	if !slices.Contains(extractableFormats, format) {
+		return fmt.Errorf("archive %s is %s; only %s archives can be extracted", filepath.Base(archivePath), format, strings.Join(extractableFormats, ", "))
+	}
+	return nil
+}
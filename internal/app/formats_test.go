@@ -0,0 +1,107 @@
+package app
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestZip(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("Album/01.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("audio"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func writeTestTar(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	if err := tw.WriteHeader(&tar.Header{Name: "Album/01.flac", Mode: 0o644, Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("audio"))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestDetectArchiveFormat(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]func(path string){
+		"a.zip":  func(p string) { writeTestZip(t, p) },
+		"a.tar":  func(p string) { writeTestTar(t, p) },
+		"a.gz":   func(p string) { os.WriteFile(p, []byte{0x1f, 0x8b, 8, 0}, 0o644) },
+		"a.rar":  func(p string) { os.WriteFile(p, []byte("Rar!\x1a\x07\x01\x00"), 0o644) },
+		"a.7z":   func(p string) { os.WriteFile(p, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0, 4}, 0o644) },
+		"a.html": func(p string) { os.WriteFile(p, []byte("<html></html>"), 0o644) },
+	}
+	want := map[string]string{
+		"a.zip": FormatZip, "a.tar": FormatTar, "a.gz": FormatGzip,
+		"a.rar": FormatRar, "a.7z": FormatSevenZ, "a.html": "",
+	}
+	for name, write := range files {
+		path := filepath.Join(dir, name)
+		write(path)
+		got, err := detectArchiveFormat(path)
+		if err != nil {
+			t.Fatalf("detectArchiveFormat(%s): %v", name, err)
+		}
+		if got != want[name] {
+			t.Fatalf("detectArchiveFormat(%s) = %q, want %q", name, got, want[name])
+		}
+	}
+}
+
+func TestExtractArchiveAllowFormats(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "album.zip")
+	writeTestZip(t, zipPath)
+	tarPath := filepath.Join(dir, "album.zip.tar")
+	writeTestTar(t, tarPath)
+
+	tests := []struct {
+		archive string
+		allow   []string
+		wantErr string
+	}{
+		{zipPath, nil, ""},
+		{zipPath, []string{FormatZip}, ""},
+		{zipPath, []string{FormatTar}, "--allow-formats does not permit"},
+		{tarPath, nil, "only zip archives can be extracted"},
+		{tarPath, []string{FormatZip}, "--allow-formats does not permit"},
+	}
+	for _, tt := range tests {
+		r := &runner{log: log.New(io.Discard, "", 0), opts: Options{AllowFormats: tt.allow}}
+		err := r.extractArchive(tt.archive, t.TempDir(), map[string]string{})
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s with %v: %v", filepath.Base(tt.archive), tt.allow, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Fatalf("%s with %v: error = %v, want %q", filepath.Base(tt.archive), tt.allow, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is the filesystem the runner works on. Extraction, pruning, collision
+// checks, copying, ownership and rollback go through it, so tests can swap
+// in an in-memory implementation and the library can live on another host.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	// Lstat is Stat without following a final symlink; filesystems
+	// without symlinks implement it as Stat.
+	Lstat(name string) (fs.FileInfo, error)
+	MkdirAll(name string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Lchown(name string, uid, gid int) error
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+	Open(name string) (io.ReadCloser, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+// osFS is the local disk.
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)       { return os.Lstat(name) }
+func (osFS) MkdirAll(name string, perm os.FileMode) error { return os.MkdirAll(name, perm) }
+func (osFS) Chmod(name string, mode os.FileMode) error    { return os.Chmod(name, mode) }
+func (osFS) Lchown(name string, uid, gid int) error       { return os.Lchown(name, uid, gid) }
+func (osFS) Open(name string) (io.ReadCloser, error)      { return os.Open(name) }
+func (osFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+func (osFS) WalkDir(root string, fn fs.WalkDirFunc) error { return filepath.WalkDir(root, fn) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+func (osFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+// workFS returns the filesystem holding temp and extract dirs: the
+// runner's FS, defaulting to the local disk.
+func (r *runner) workFS() FS {
+	if r.fsys == nil {
+		return osFS{}
+	}
+	return r.fsys
+}
+
+// library returns the filesystem imports are written to: the remote host,
+// bucket or WebDAV server for an sftp://, s3:// or davs://
+// NAVIDROME_MUSIC_PATH (unless staging locally), otherwise workFS.
+func (r *runner) library() FS {
+	switch {
+	case r.opts.Stage:
+	case r.cfg.Remote != nil:
+		return r.sftpLibrary()
+	case r.cfg.Bucket != nil:
+		return r.bucketFS()
+	case r.cfg.DAV != nil:
+		return r.davFS()
+	}
+	return r.workFS()
+}
+
+// remoteLibrary reports whether imports are written over SFTP, to a bucket
+// or over WebDAV.
+func (r *runner) remoteLibrary() bool {
+	switch r.library().(type) {
+	case *sftpFS, *s3FS, *davFS:
+		return true
+	}
+	return false
+}
+
+// walkEntry is one listed path for replayWalk.
+type walkEntry struct {
+	path string
+	info fs.FileInfo
+}
+
+// replayWalk calls fn for root and then for entries in lexical order,
+// honouring filepath.SkipDir like filepath.WalkDir. It serves filesystems
+// that list a whole tree in one request.
+func replayWalk(root string, rootInfo fs.FileInfo, entries []walkEntry, fn fs.WalkDirFunc) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+	if err := fn(root, fs.FileInfoToDirEntry(rootInfo), nil); err != nil {
+		return skipDirOK(err)
+	}
+	var skipped []string
+	for _, e := range entries {
+		skip := false
+		for _, dir := range skipped {
+			if strings.HasPrefix(e.path, dir+"/") {
+				skip = true
+				break
+			}
+		}
+		if skip {
+			continue
+		}
+		if err := fn(e.path, fs.FileInfoToDirEntry(e.info), nil); err != nil {
+			if err == filepath.SkipDir && e.info.IsDir() {
+				skipped = append(skipped, e.path)
+				continue
+			}
+			return skipDirOK(err)
+		}
+	}
+	return nil
+}
+
+// readDirNames lists the names directly inside dir.
+func readDirNames(fsys FS, dir string) ([]string, error) {
+	var names []string
+	err := fsys.WalkDir(dir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || path == dir {
+			return walkErr
+		}
+		names = append(names, d.Name())
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return names, err
+}
+
+// skipDirOK treats filepath.SkipDir returned for the root as a clean stop.
+func skipDirOK(err error) error {
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// remoteInfo is the little the host reports about an entry: its kind.
+type remoteInfo struct {
+	name string
+	dir  bool
+	size int64
+}
+
+func (i remoteInfo) Name() string       { return i.name }
+func (i remoteInfo) Size() int64        { return i.size }
+func (i remoteInfo) ModTime() time.Time { return time.Time{} }
+func (i remoteInfo) IsDir() bool        { return i.dir }
+func (i remoteInfo) Sys() any           { return nil }
+func (i remoteInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
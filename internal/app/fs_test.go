@@ -0,0 +1,340 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// memFS is an in-memory FS. fail injects an error for "op path" keys (e.g.
+// "mkdir /music/Artist"), and quota, when positive, caps the bytes written
+// before Create's writers report ENOSPC.
+type memFS struct {
+	entries map[string]*memEntry
+	fail    map[string]error
+	quota   int64
+	used    int64
+}
+
+type memEntry struct {
+	data  []byte
+	mode  fs.FileMode
+	dir   bool
+	mtime time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{
+		entries: map[string]*memEntry{"/": {dir: true, mode: fs.ModeDir | 0o755}},
+		fail:    make(map[string]error),
+	}
+}
+
+func (m *memFS) injected(op, name string) error {
+	if err := m.fail[op+" "+name]; err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// writeFile seeds name with data, creating parents.
+func (m *memFS) writeFile(t *testing.T, name, data string) {
+	t.Helper()
+	if err := m.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	m.entries[name] = &memEntry{data: []byte(data), mode: 0o644}
+}
+
+func (m *memFS) Lstat(name string) (fs.FileInfo, error) { return m.Stat(name) }
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	if err := m.injected("stat", name); err != nil {
+		return nil, err
+	}
+	e, ok := m.entries[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memInfo{name: filepath.Base(name), e: e}, nil
+}
+
+func (m *memFS) MkdirAll(name string, perm os.FileMode) error {
+	if err := m.injected("mkdir", name); err != nil {
+		return err
+	}
+	for p := filepath.Clean(name); ; p = filepath.Dir(p) {
+		if e, ok := m.entries[p]; ok {
+			if !e.dir {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+			}
+		} else {
+			m.entries[p] = &memEntry{dir: true, mode: fs.ModeDir | perm}
+		}
+		if filepath.Dir(p) == p {
+			return nil
+		}
+	}
+}
+
+func (m *memFS) Chmod(name string, mode os.FileMode) error {
+	e, ok := m.entries[name]
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+	e.mode = e.mode.Type() | mode
+	return nil
+}
+
+func (m *memFS) Chtimes(name string, _, mtime time.Time) error {
+	e, ok := m.entries[name]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrNotExist}
+	}
+	e.mtime = mtime
+	return nil
+}
+
+func (m *memFS) Lchown(name string, uid, gid int) error { return m.injected("chown", name) }
+
+func (m *memFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	if err := m.injected("create", name); err != nil {
+		return nil, err
+	}
+	if parent, ok := m.entries[filepath.Dir(name)]; !ok || !parent.dir {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrNotExist}
+	}
+	e := &memEntry{mode: perm}
+	m.entries[name] = e
+	return &memWriter{m: m, e: e, name: name}, nil
+}
+
+type memWriter struct {
+	m    *memFS
+	e    *memEntry
+	name string
+}
+
+func (w *memWriter) Write(b []byte) (int, error) {
+	if w.m.quota > 0 && w.m.used+int64(len(b)) > w.m.quota {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: syscall.ENOSPC}
+	}
+	w.m.used += int64(len(b))
+	w.e.data = append(w.e.data, b...)
+	return len(b), nil
+}
+
+func (w *memWriter) Close() error { return nil }
+
+func (m *memFS) Open(name string) (io.ReadCloser, error) {
+	e, ok := m.entries[name]
+	if !ok || e.dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(e.data)), nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	if _, ok := m.entries[oldpath]; !ok {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrNotExist}
+	}
+	moved := make(map[string]*memEntry)
+	for p, e := range m.entries {
+		if p == oldpath || strings.HasPrefix(p, oldpath+"/") {
+			delete(m.entries, p)
+			moved[newpath+strings.TrimPrefix(p, oldpath)] = e
+		}
+	}
+	for p, e := range moved {
+		m.entries[p] = e
+	}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	if err := m.injected("remove", name); err != nil {
+		return err
+	}
+	if _, ok := m.entries[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for p := range m.entries {
+		if strings.HasPrefix(p, name+"/") {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	delete(m.entries, name)
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	for p := range m.entries {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(m.entries, p)
+		}
+	}
+	return nil
+}
+
+func (m *memFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := m.Stat(root)
+	if err != nil {
+		return skipDirOK(fn(root, nil, err))
+	}
+	if !info.IsDir() {
+		return skipDirOK(fn(root, fs.FileInfoToDirEntry(info), nil))
+	}
+	var entries []walkEntry
+	for p, e := range m.entries {
+		if strings.HasPrefix(p, root+"/") {
+			entries = append(entries, walkEntry{path: p, info: memInfo{name: filepath.Base(p), e: e}})
+		}
+	}
+	return replayWalk(root, info, entries, fn)
+}
+
+type memInfo struct {
+	name string
+	e    *memEntry
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.e.data)) }
+func (i memInfo) Mode() fs.FileMode  { return i.e.mode }
+func (i memInfo) ModTime() time.Time { return i.e.mtime }
+func (i memInfo) IsDir() bool        { return i.e.dir }
+func (i memInfo) Sys() any           { return nil }
+
+// memRunner returns a runner working entirely on a fresh memFS holding an
+// extracted album under /extract and an empty /music library.
+func memRunner(t *testing.T) (*runner, *memFS) {
+	mem := newMemFS()
+	mem.writeFile(t, "/extract/Album/01 Intro.flac", "0123456789")
+	mem.writeFile(t, "/extract/Album/02 Outro.flac", "0123456789")
+	if err := mem.MkdirAll("/music", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return &runner{fsys: mem, log: log.New(io.Discard, "", 0)}, mem
+}
+
+func TestMoveIntoLibraryMemFS(t *testing.T) {
+	r, mem := memRunner(t)
+	if err := r.moveIntoLibrary("/extract", "/music/Artist"); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	for _, name := range []string{"01 Intro.flac", "02 Outro.flac"} {
+		e, ok := mem.entries["/music/Artist/Album/"+name]
+		if !ok || string(e.data) != "0123456789" {
+			t.Fatalf("%s not copied into the library", name)
+		}
+	}
+	if r.stats.movedFiles != 2 {
+		t.Fatalf("movedFiles = %d, want 2", r.stats.movedFiles)
+	}
+}
+
+func TestMoveIntoLibraryDiskFull(t *testing.T) {
+	r, mem := memRunner(t)
+	r.opts.RollbackOnError = true
+	mem.quota = 15
+
+	err := r.moveIntoLibrary("/extract", "/music/Artist")
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected ENOSPC, got %v", err)
+	}
+	if _, err := mem.Stat("/music/Artist"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("rollback should remove /music/Artist, got err=%v", err)
+	}
+	if _, err := mem.Stat("/music"); err != nil {
+		t.Fatalf("pre-existing library root removed: %v", err)
+	}
+}
+
+func TestMoveIntoLibraryPermissionDenied(t *testing.T) {
+	r, mem := memRunner(t)
+	mem.fail["mkdir /music/Artist"] = fs.ErrPermission
+
+	err := r.moveIntoLibrary("/extract", "/music/Artist")
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), "create destination") {
+		t.Fatalf("expected permission error creating the destination, got %v", err)
+	}
+}
+
+func TestMoveIntoLibraryCollisionMemFS(t *testing.T) {
+	r, mem := memRunner(t)
+	mem.writeFile(t, "/music/Artist/Album/02 Outro.flac", "existing")
+
+	err := r.moveIntoLibrary("/extract", "/music/Artist")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected collision error, got %v", err)
+	}
+	if _, ok := mem.entries["/music/Artist/Album/01 Intro.flac"]; ok {
+		t.Fatalf("nothing should be copied when a collision is found")
+	}
+	if got := string(mem.entries["/music/Artist/Album/02 Outro.flac"].data); got != "existing" {
+		t.Fatalf("existing file overwritten: %q", got)
+	}
+}
+
+func TestMoveIntoLibraryKeepLargerMemFS(t *testing.T) {
+	r, mem := memRunner(t)
+	r.opts.OnCollision = CollisionKeepLarger
+	mem.writeFile(t, "/music/Artist/Album/01 Intro.flac", "012")
+	mem.writeFile(t, "/music/Artist/Album/02 Outro.flac", "0123456789abc")
+
+	if err := r.moveIntoLibrary("/extract", "/music/Artist"); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	if got := string(mem.entries["/music/Artist/Album/01 Intro.flac"].data); got != "0123456789" {
+		t.Fatalf("smaller library file not replaced: %q", got)
+	}
+	if got := string(mem.entries["/music/Artist/Album/02 Outro.flac"].data); got != "0123456789abc" {
+		t.Fatalf("larger library file replaced: %q", got)
+	}
+}
+
+func TestSelectOnlyMemFS(t *testing.T) {
+	r, mem := memRunner(t)
+	mem.writeFile(t, "/extract/Scans/front.jpg", "img")
+	r.opts.Only = []string{"*.flac"}
+
+	if err := r.selectOnly("/extract"); err != nil {
+		t.Fatalf("selectOnly returned error: %v", err)
+	}
+	for _, name := range []string{"/extract/Scans/front.jpg", "/extract/Scans"} {
+		if _, ok := mem.entries[name]; ok {
+			t.Fatalf("%s should be removed from the memFS", name)
+		}
+	}
+	if _, ok := mem.entries["/extract/Album/01 Intro.flac"]; !ok {
+		t.Fatalf("matched file removed")
+	}
+}
+
+func TestRemoteLibraryRejectsLocalOnlyFlags(t *testing.T) {
+	r := &runner{
+		cfg:  config.Config{Remote: &config.Remote{Host: "nas"}},
+		opts: Options{Artist: "Artist", URLs: []string{"https://pixeldrain.com/u/abc"}, WriteNFO: true},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.validateInputs(); err == nil || !strings.Contains(err.Error(), "--write-nfo") {
+		t.Fatalf("expected --write-nfo to be rejected, got %v", err)
+	}
+
+	// Staging writes locally, so the flag is fine there.
+	r.cfg.StagingPath = t.TempDir()
+	r.opts.Stage = true
+	if err := r.validateInputs(); err != nil {
+		t.Fatalf("validateInputs with --stage returned error: %v", err)
+	}
+}
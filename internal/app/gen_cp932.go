@@ -0,0 +1,147 @@
+//go:build ignore
+
+// gen_cp932 writes cp932_table.go from Microsoft's CP932 mapping table as
+// published by the Unicode Consortium:
+//
+//	https://www.unicode.org/Public/MAPPINGS/VENDORS/MICSFT/WINDOWS/CP932.TXT
+//
+// Run it with go generate in this directory; -in reads a local copy
+// instead of downloading it. The table leaves out the user-defined area
+// (lead bytes 0xF0-0xF9), which Windows maps to the private use area from
+// U+E000 on, so the generator adds it.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const sourceURL = "https://www.unicode.org/Public/MAPPINGS/VENDORS/MICSFT/WINDOWS/CP932.TXT"
+
+func main() {
+	in := flag.String("in", "", "local copy of CP932.TXT (default: download "+sourceURL+")")
+	out := flag.String("out", "cp932_table.go", "file to write")
+	flag.Parse()
+
+	src, err := open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer src.Close()
+
+	// rows[lead][i] is the character of trail byte 0x40+i, skipping 0x7F.
+	var rows [256][]rune
+	row := func(lead int) []rune {
+		if rows[lead] == nil {
+			rows[lead] = []rune(strings.Repeat(string(utf8.RuneError), 188))
+		}
+		return rows[lead]
+	}
+	set := func(code int, r rune) {
+		lead, trail := code>>8, code&0xff
+		i := trail - 0x40
+		if trail > 0x7f {
+			i--
+		}
+		row(lead)[i] = r
+	}
+
+	sc := bufio.NewScanner(src)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue // comment or unmapped byte
+		}
+		code, err1 := strconv.ParseInt(fields[0], 0, 32)
+		r, err2 := strconv.ParseInt(fields[1], 0, 32)
+		if err1 != nil || err2 != nil {
+			log.Fatalf("bad line %q", sc.Text())
+		}
+		if code > 0xff {
+			set(int(code), rune(r))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	// User-defined characters: 0xF040-0xF9FC map to U+E000-U+E757 in order.
+	next := rune(0xe000)
+	for lead := 0xf0; lead <= 0xf9; lead++ {
+		for trail := 0x40; trail <= 0xfc; trail++ {
+			if trail != 0x7f {
+				set(lead<<8|trail, next)
+				next++
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`// Code generated by gen_cp932.go from the Microsoft CP932 mapping table; DO NOT EDIT.
+
+package app
+
+// cp932Rows maps each Shift-JIS lead byte to the characters of its 188
+// trail bytes (0x40-0x7E, then 0x80-0xFC); U+FFFD marks unassigned codes.
+var cp932Rows = [256]string{
+`)
+	for lead, chars := range rows {
+		if chars == nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "\t0x%02x: %s,\n", lead, quote(chars))
+	}
+	buf.WriteString("}\n")
+
+	src2, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src2, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// open returns the mapping table at path, or downloads it when path is
+// empty.
+func open(path string) (io.ReadCloser, error) {
+	if path != "" {
+		return os.Open(path)
+	}
+	resp, err := http.Get(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", sourceURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// quote renders chars as a Go string literal, escaping U+FFFD, quotes and
+// every character that is not printable so the table stays readable.
+func quote(chars []rune) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range chars {
+		if r == utf8.RuneError || r == '"' || r == '\\' || !strconv.IsPrint(r) {
+			fmt.Fprintf(&b, `\u%04x`, r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimiter enforces --max-host-connections and --host-request-delay for
+// every request the process sends, so concurrent imports share one budget
+// per host. A connection slot is held until the response body is closed,
+// which for a download means until it has been written to disk.
+type hostLimiter struct {
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	active int
+	// next is the earliest start time of the next request.
+	next time.Time
+	// freed is closed, then replaced, whenever a slot is released.
+	freed chan struct{}
+}
+
+var hostLimits = &hostLimiter{}
+
+// acquire waits until host has fewer than maxConns requests in flight
+// (maxConns <= 0 means no cap) and at least delay has passed since the
+// previous request to it started. The returned release must be called
+// once the request is done; calling it again is harmless.
+func (l *hostLimiter) acquire(ctx context.Context, host string, maxConns int, delay time.Duration) (func(), error) {
+	host = strings.ToLower(host)
+	for {
+		l.mu.Lock()
+		h := l.state(host)
+		if maxConns > 0 && h.active >= maxConns {
+			freed := h.freed
+			l.mu.Unlock()
+			select {
+			case <-freed:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		h.active++
+		var wait time.Duration
+		if delay > 0 {
+			// Reserve a start time so concurrent callers queue up delay
+			// apart instead of all waking at once.
+			now := time.Now()
+			start := h.next
+			if start.Before(now) {
+				start = now
+			}
+			h.next = start.Add(delay)
+			wait = start.Sub(now)
+		}
+		l.mu.Unlock()
+
+		release := sync.OnceFunc(func() { l.release(host) })
+		if wait > 0 {
+			if err := sleep(ctx, wait); err != nil {
+				release()
+				return nil, err
+			}
+		}
+		return release, nil
+	}
+}
+
+func (l *hostLimiter) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := l.state(host)
+	h.active--
+	close(h.freed)
+	h.freed = make(chan struct{})
+}
+
+// state returns host's entry, creating it; l.mu must be held.
+func (l *hostLimiter) state(host string) *hostState {
+	if l.hosts == nil {
+		l.hosts = make(map[string]*hostState)
+	}
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostState{freed: make(chan struct{})}
+		l.hosts[host] = h
+	}
+	return h
+}
+
+// releaseOnClose hands a connection slot back once the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterConnections(t *testing.T) {
+	l := &hostLimiter{}
+	ctx := context.Background()
+	release, err := l.acquire(ctx, "pixeldrain.com", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		second, err := l.acquire(ctx, "PIXELDRAIN.com", 1, 0)
+		if err == nil {
+			second()
+		}
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("second request to the same host started while the first was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Other hosts have their own budget.
+	other, err := l.acquire(ctx, "musicbrainz.org", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+
+	release()
+	release() // a second release must not free another slot
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("second request did not start after the first released its slot")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	hold, _ := l.acquire(ctx, "pixeldrain.com", 1, 0)
+	defer hold()
+	cancel()
+	if _, err := l.acquire(cancelled, "pixeldrain.com", 1, 0); err == nil {
+		t.Fatalf("expected a cancelled wait for a slot to fail")
+	}
+}
+
+func TestHostLimiterDelay(t *testing.T) {
+	var waits []time.Duration
+	origSleep := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = origSleep })
+
+	l := &hostLimiter{}
+	for i := 0; i < 3; i++ {
+		release, err := l.acquire(context.Background(), "pixeldrain.com", 0, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if len(waits) != 2 || waits[0] < 59*time.Second || waits[1] < 119*time.Second {
+		t.Fatalf("waits = %v, want requests spaced a minute apart", waits)
+	}
+}
+
+func TestAPIClientReleasesHostSlot(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		if n > peak.Load() {
+			peak.Store(n)
+		}
+		io.WriteString(w, `{"name":"album.zip","size":1}`)
+	})
+
+	r := &runner{log: log.New(io.Discard, "", 0), opts: Options{MaxHostConnections: 1, NoCache: true}}
+	for i := 0; i < 3; i++ {
+		done := make(chan error, 1)
+		go func() {
+			_, err := r.fetchFileInfo("abc123")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("fetchFileInfo returned error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("request %d blocked: an earlier one kept its host slot", i+1)
+		}
+	}
+	if peak.Load() != 1 {
+		t.Fatalf("peak concurrent requests = %d, want 1", peak.Load())
+	}
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli-navidrome-helper/internal/version"
+)
+
+const (
+	// maxRetries bounds how often one request is retried, whatever the cause.
+	maxRetries = 3
+	// retryBackoff is the first wait after a 5xx response or network error;
+	// it doubles with each further attempt.
+	retryBackoff = time.Second
+	// defaultRateLimitWait applies when a 429 carries no usable Retry-After.
+	defaultRateLimitWait = 30 * time.Second
+	// DefaultMaxRateLimitWait is the longest single Retry-After honoured
+	// unless Options.MaxRateLimitWait says otherwise.
+	DefaultMaxRateLimitWait = 5 * time.Minute
+)
+
+// userAgent identifies the tool to every service; MusicBrainz rejects
+// anonymous clients.
+func userAgent() string {
+	return "nd-import/" + version.Get().Version + " (https://github.com/caesariodito/cli-navidrome-helper)"
+}
+
+// sleep pauses between attempts, returning early with the context's error
+// when it is cancelled; tests replace it.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// apiHost says who an apiClient talks to, which decides the credentials
+// and trust settings its requests carry.
+type apiHost int
+
+const (
+	// hostPixeldrain gets the bearer token and the custom trust settings.
+	hostPixeldrain apiHost = iota
+	// hostDownload is another resolver's file host: custom trust settings,
+	// but never the Pixeldrain token.
+	hostDownload
+	// hostMusicBrainz always uses the default TLS verification.
+	hostMusicBrainz
+)
+
+// apiClient sends the HTTP requests of a run: archive downloads and the
+// Pixeldrain and MusicBrainz APIs. Every request carries the user agent;
+// authentication depends on the host (see send).
+// Transient failures are retried: 429 after Retry-After (bounded by
+// --max-rate-limit-wait), 5xx responses and network errors with
+// exponential backoff. Each attempt waits for the per-host limits, see
+// hostLimiter.
+type apiClient struct {
+	r    *runner
+	http *http.Client
+	host apiHost
+}
+
+// apiClient returns a client for host. A zero timeout means none, as for
+// streaming downloads.
+func (r *runner) apiClient(host apiHost, timeout time.Duration) (*apiClient, error) {
+	if host == hostMusicBrainz {
+		return &apiClient{r: r, http: &http.Client{Timeout: timeout}, host: host}, nil
+	}
+	client, err := r.pixeldrainClient(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &apiClient{r: r, http: client, host: host}, nil
+}
+
+// get fetches rawURL with the given Accept header. fileID names the
+// request in rate-limit events and may be empty.
+func (c *apiClient) get(rawURL, accept, fileID string) (*http.Response, error) {
+	return c.send(http.MethodGet, rawURL, accept, fileID)
+}
+
+// head is get without the body.
+func (c *apiClient) head(rawURL, accept, fileID string) (*http.Response, error) {
+	return c.send(http.MethodHead, rawURL, accept, fileID)
+}
+
+// send builds and sends one request. Pixeldrain requests carry the bearer
+// token; requests to other hosts use basic auth when the URL embeds
+// user:password.
+func (c *apiClient) send(method, rawURL, accept, fileID string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.r.context(), method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	// The Pixeldrain token is never sent to other hosts. Credentials
+	// embedded in a mirror URL become basic auth and are dropped from the
+	// URL, so they cannot leak into logged request errors.
+	switch {
+	case c.host == hostPixeldrain && c.r.cfg.PixeldrainToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.r.cfg.PixeldrainToken)
+	case req.URL.User != nil:
+		password, _ := req.URL.User.Password()
+		req.SetBasicAuth(req.URL.User.Username(), password)
+		req.URL.User = nil
+	}
+	return c.do(req, fileID)
+}
+
+// do sends req, retrying transient failures up to maxRetries times. A 429
+// whose Retry-After exceeds the configured maximum, or the last failed
+// response, is returned for the caller to report.
+func (c *apiClient) do(req *http.Request, fileID string) (*http.Response, error) {
+	maxWait := c.r.opts.MaxRateLimitWait
+	if maxWait <= 0 {
+		maxWait = DefaultMaxRateLimitWait
+	}
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := c.limitedDo(req)
+		if attempt > maxRetries || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			wait, backoff = backoff, backoff*2
+			c.r.log.Printf("Request to %s failed (%v); retrying in %s (%d/%d)", req.URL.Host, err, wait, attempt, maxRetries)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			var ok bool
+			if wait, ok = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); !ok {
+				wait = defaultRateLimitWait
+			}
+			if wait > maxWait {
+				c.r.log.Printf("Rate limited by %s; Retry-After %s exceeds --max-rate-limit-wait %s", req.URL.Host, wait, maxWait)
+				return resp, nil
+			}
+			resp.Body.Close()
+			c.r.log.Printf("Rate limited by %s; waiting %s before retrying (%d/%d)", req.URL.Host, wait, attempt, maxRetries)
+			c.r.emit("rate-limited", map[string]any{"file_id": fileID, "wait_ms": wait.Milliseconds(), "attempt": attempt})
+		default:
+			resp.Body.Close()
+			wait, backoff = backoff, backoff*2
+			c.r.log.Printf("%s returned %s; retrying in %s (%d/%d)", req.URL.Host, resp.Status, wait, attempt, maxRetries)
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// limitedDo sends req once, within the per-host limits of
+// --max-host-connections and --host-request-delay.
+func (c *apiClient) limitedDo(req *http.Request) (*http.Response, error) {
+	maxConns, delay := c.r.opts.MaxHostConnections, c.r.opts.HostRequestDelay
+	if maxConns <= 0 && delay <= 0 {
+		return c.http.Do(req)
+	}
+	release, err := hostLimits.acquire(req.Context(), req.URL.Host, maxConns, delay)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = releaseOnClose{resp.Body, release}
+	return resp, nil
+}
+
+// maxRedirects matches the net/http default redirect limit.
+const maxRedirects = 10
+
+// stripAuthOnRedirect is the CheckRedirect policy of download and
+// Pixeldrain clients: redirects are followed, but the Authorization header
+// (bearer token or a mirror's basic auth) is dropped once the target host
+// differs from the original request's, e.g. for a signed CDN URL. net/http
+// itself still forwards it to subdomains and other ports of the same host.
+func stripAuthOnRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// retryable reports whether a response or error is worth another attempt.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// parseRetryAfter reads a Retry-After value given either as delay seconds
+// or as an HTTP date. Dates in the past yield a zero wait.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := at.Sub(now); wait > 0 {
+		return wait.Round(time.Second), true
+	}
+	return 0, true
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+// importIDPattern limits --import-id to characters that survive log
+// shippers and shell greps unquoted.
+var importIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ValidImportID reports whether id is acceptable as --import-id.
+func ValidImportID(id string) bool {
+	return importIDPattern.MatchString(id)
+}
+
+// newImportID returns a short random ID, e.g. "3f9c01ab", for a run
+// started without --import-id.
+func newImportID() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// subImportID derives the ID of the n-th import of a batch or watch run,
+// e.g. "3f9c01ab-2", so its lines share the run's prefix when grepped.
+func subImportID(id string, n int) string {
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d", id, n)
+}
+
+// logPrefix is the prefix of every human log line: the tool name and,
+// when set, the import ID.
+func logPrefix(opts Options) string {
+	if opts.ImportID == "" {
+		return "nd-import: "
+	}
+	return "nd-import: [" + opts.ImportID + "] "
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportID(t *testing.T) {
+	a, b := newImportID(), newImportID()
+	if len(a) != 8 || !ValidImportID(a) || a == b {
+		t.Fatalf("newImportID = %q, %q; want distinct 8-character IDs", a, b)
+	}
+	for id, want := range map[string]bool{
+		"run-2026.10_16":        true,
+		"":                      false,
+		"has space":             false,
+		"a/b":                   false,
+		strings.Repeat("x", 65): false,
+	} {
+		if got := ValidImportID(id); got != want {
+			t.Fatalf("ValidImportID(%q) = %v, want %v", id, got, want)
+		}
+	}
+	if got := subImportID("run42", 3); got != "run42-3" {
+		t.Fatalf("subImportID = %q, want run42-3", got)
+	}
+}
+
+func TestLogPrefix(t *testing.T) {
+	if got := logPrefix(Options{ImportID: "run42"}); got != "nd-import: [run42] " {
+		t.Fatalf("logPrefix = %q, want the import ID in it", got)
+	}
+	if got := logPrefix(Options{}); got != "nd-import: " {
+		t.Fatalf("logPrefix without ID = %q", got)
+	}
+}
+
+func TestRunErrorCarriesImportID(t *testing.T) {
+	t.Setenv("NAVIDROME_MUSIC_PATH", "relative/music")
+	err := Run(Options{Artist: "Artist", URLs: []string{"abc123"}, ImportID: "run42", EnvFile: "missing.env"})
+	if err == nil || !strings.HasPrefix(err.Error(), "nd-import: [run42] ") {
+		t.Fatalf("Run error = %v, want it prefixed with the import ID", err)
+	}
+}
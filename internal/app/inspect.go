@@ -0,0 +1,50 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Inspect reports on an existing local folder without importing anything:
+// file count and total size, the per-extension breakdown an import prints,
+// and what UNNEEDED_FILES and the prune options would remove from it.
+func (r *runner) Inspect() error {
+	dir, err := filepath.Abs(r.opts.InspectPath)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("inspect %q: %w", r.opts.InspectPath, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("inspect %q: not a directory", r.opts.InspectPath)
+	}
+
+	var files int
+	var total int64
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		total += info.Size()
+		r.stats.recordExtension(path, info.Size())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.log.Printf("Inspected %s: %d file(s), %s", dir, files, humanBytes(total, r.stats.units))
+	if files == 0 {
+		return nil
+	}
+	r.log.Printf("By extension: %s", r.stats.extensionSummary())
+	return r.reportPrune(dir)
+}
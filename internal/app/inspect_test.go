@@ -0,0 +1,61 @@
+package app
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Album/01.flac":   "audio one",
+		"Album/02.flac":   "audio two",
+		"Album/notes.txt": "notes",
+		"Album/cover.jpg": "jpg",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	r := &runner{
+		cfg:  config.Config{UnneededPatterns: []string{"*.txt"}},
+		opts: Options{InspectPath: dir},
+		log:  log.New(&out, "", 0),
+	}
+	if err := r.Inspect(); err != nil {
+		t.Fatalf("Inspect returned error: %v", err)
+	}
+	for _, want := range []string{
+		"4 file(s)",
+		"2 .flac (18 B)",
+		`"*.txt" matches 1 file(s)`,
+		"Album/notes.txt",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Fatalf("inspect changed %s: %v", name, err)
+		}
+	}
+
+	r.opts.InspectPath = filepath.Join(dir, "Album", "01.flac")
+	if err := r.Inspect(); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected not-a-directory error, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// protectKept takes entries matching a --prune-keep pattern out of the
+// prune set. Patterns follow the same anchoring rules as UNNEEDED_FILES.
+// A kept entry inside a pruned directory splits that directory: its other
+// children are still pruned, so only the kept path survives.
+func (r *runner) protectKept(extractDir string, plan *prunePlan) error {
+	if len(r.opts.PruneKeep) == 0 {
+		return nil
+	}
+
+	var kept []string
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || path == extractDir {
+			return walkErr
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range r.opts.PruneKeep {
+			ok, err := matchPrunePattern(pattern, filepath.ToSlash(rel))
+			if err != nil {
+				return fmt.Errorf("invalid --prune-keep pattern %q: %w", pattern, err)
+			}
+			if ok {
+				kept = append(kept, path)
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range kept {
+		protected, err := plan.protect(r.workFS(), extractDir, path)
+		if err != nil {
+			return err
+		}
+		if protected {
+			r.log.Printf("Keeping %s: matches --prune-keep", path)
+		}
+	}
+	return nil
+}
+
+// protect removes path, and everything below it, from the prune set. Pruned
+// ancestors of path, listed on fsys, are replaced by their children, down to
+// path itself. It reports whether anything was going to be pruned.
+func (p *prunePlan) protect(fsys FS, extractDir, path string) (bool, error) {
+	var chain []string
+	for a := path; a != extractDir && a != filepath.Dir(a); a = filepath.Dir(a) {
+		chain = append([]string{a}, chain...)
+	}
+
+	protected := false
+	for _, a := range chain {
+		if _, pruned := p.remove[a]; !pruned {
+			continue
+		}
+		protected = true
+		pattern := p.matchedBy[a]
+		delete(p.remove, a)
+		delete(p.matchedBy, a)
+		if a == path {
+			continue
+		}
+		names, err := readDirNames(fsys, a)
+		if err != nil {
+			return false, err
+		}
+		for _, name := range names {
+			child := filepath.Join(a, name)
+			p.remove[child] = struct{}{}
+			p.matchedBy[child] = pattern
+		}
+	}
+
+	// Drop anything pruned below a kept directory.
+	for rm := range p.remove {
+		if strings.HasPrefix(rm, path+string(filepath.Separator)) {
+			delete(p.remove, rm)
+			delete(p.matchedBy, rm)
+			protected = true
+		}
+	}
+	return protected, nil
+}
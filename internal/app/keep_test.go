@@ -0,0 +1,54 @@
+package app
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestPruneExtractedKeepPatterns(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"01 Song.flac",
+		"lyrics.txt",
+		"notes.txt",
+		"Extras/booklet.pdf",
+		"Extras/Scans/front.jpg",
+		"Extras/readme.txt",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		cfg:  config.Config{UnneededPatterns: []string{"*.txt", "Extras"}},
+		opts: Options{PruneKeep: []string{"lyrics.txt", "**/Scans"}},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.pruneExtracted(root); err != nil {
+		t.Fatalf("pruneExtracted returned error: %v", err)
+	}
+
+	for name, want := range map[string]bool{
+		"01 Song.flac":           true,
+		"lyrics.txt":             true, // matches *.txt and a keep pattern
+		"notes.txt":              false,
+		"Extras/Scans/front.jpg": true, // kept folder inside a pruned one
+		"Extras/booklet.pdf":     false,
+		"Extras/readme.txt":      false,
+	} {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)))
+		if exists := err == nil; exists != want {
+			t.Fatalf("%s exists = %v, want %v", name, exists, want)
+		}
+	}
+}
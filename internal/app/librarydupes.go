@@ -0,0 +1,287 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// libraryIndexTTL is how long a cached library index is reused before the
+// library is walked again.
+const libraryIndexTTL = 24 * time.Hour
+
+// maxLibraryIndexFiles bounds the index; larger libraries are indexed
+// partially, with a warning.
+const maxLibraryIndexFiles = 2_000_000
+
+// libraryIndex lists the audio files of the live library by name and size,
+// cached between runs (--dedupe-across-library).
+type libraryIndex struct {
+	Root  string         `json:"root"`
+	Built time.Time      `json:"built"`
+	Files []indexedTrack `json:"files"`
+
+	path  string              // cache file
+	byKey map[string][]string // indexKey -> library-relative paths
+}
+
+type indexedTrack struct {
+	Path string `json:"path"` // relative to Root, slash-separated
+	Size int64  `json:"size"`
+}
+
+// indexKey matches tracks by lowercased file name and size.
+func indexKey(name string, size int64) string {
+	return fmt.Sprintf("%s\x00%d", strings.ToLower(name), size)
+}
+
+func (idx *libraryIndex) add(rel string, size int64) {
+	rel = filepath.ToSlash(rel)
+	idx.Files = append(idx.Files, indexedTrack{Path: rel, Size: size})
+	key := indexKey(filepath.Base(rel), size)
+	idx.byKey[key] = append(idx.byKey[key], rel)
+}
+
+// libraryIndexPath is the cache file for the library at root, in the user
+// cache directory (the temp base when there is none).
+func (r *runner) libraryIndexPath(root string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = r.tmpBase()
+		if dir == "" {
+			dir = os.TempDir()
+		}
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, "nd-import", "library-index-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadLibraryIndex returns the cached index of root when it is younger than
+// libraryIndexTTL, otherwise walks the library and caches a fresh one.
+func (r *runner) loadLibraryIndex(root string) (*libraryIndex, error) {
+	path := r.libraryIndexPath(root)
+	if data, err := os.ReadFile(path); err == nil {
+		var cached libraryIndex
+		if json.Unmarshal(data, &cached) == nil && cached.Root == root && time.Since(cached.Built) < libraryIndexTTL {
+			idx := &libraryIndex{Root: root, Built: cached.Built, path: path, byKey: make(map[string][]string)}
+			for _, f := range cached.Files {
+				idx.add(f.Path, f.Size)
+			}
+			r.log.Printf("Using library index from %s (%d tracks)", cached.Built.Local().Format(time.DateTime), len(idx.Files))
+			return idx, nil
+		}
+	}
+
+	r.log.Printf("Indexing library %s for duplicate tracks", root)
+	idx := &libraryIndex{Root: root, Built: time.Now().UTC(), path: path, byKey: make(map[string][]string)}
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			// Unreadable folders are left out rather than failing the import.
+			if d != nil && d.IsDir() && p != root {
+				return filepath.SkipDir
+			}
+			return walkErr
+		}
+		if err := r.context().Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || !isAudio(d.Name()) {
+			return nil
+		}
+		if len(idx.Files) >= maxLibraryIndexFiles {
+			r.log.Printf("warning: library has more than %d tracks; indexing only the first ones", maxLibraryIndexFiles)
+			return filepath.SkipAll
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		idx.add(rel, info.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index library: %w", err)
+	}
+	if err := idx.save(); err != nil {
+		r.log.Printf("warning: cannot cache library index: %v", err)
+	}
+	return idx, nil
+}
+
+func (idx *libraryIndex) save() error {
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// scanLibraryDupes reports extracted tracks whose exact content already
+// exists elsewhere in the live library: candidates share the file name and
+// size and are confirmed by SHA-256. With --skip-library-dupes they are left
+// out of the import. Files at their own destination path are left to the
+// collision checks.
+func (r *runner) scanLibraryDupes(extractDir string) error {
+	if !r.opts.DedupeLibrary && !r.opts.SkipLibraryDupes {
+		return nil
+	}
+	if r.cfg.Remote != nil || r.cfg.Bucket != nil || r.cfg.DAV != nil {
+		r.log.Printf("warning: --dedupe-across-library cannot index an sftp://, s3:// or davs:// library; skipping")
+		return nil
+	}
+	root := r.cfg.NavidromeMusicPath
+	idx, err := r.loadLibraryIndex(root)
+	if err != nil {
+		return err
+	}
+	r.libIndex = idx
+	destRel, err := filepath.Rel(root, r.destinationPath())
+	if err != nil || r.opts.Stage {
+		destRel = ""
+	}
+
+	var fileCount int
+	var dupes []string
+	err = filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fileCount++
+		if !isAudio(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		own := ""
+		if destRel != "" {
+			own = filepath.ToSlash(filepath.Join(destRel, r.destRel(rel, false)))
+		}
+		match, err := r.libraryMatch(idx, path, info.Size(), own)
+		if err != nil || match == "" {
+			return err
+		}
+		r.log.Printf("Library duplicate: %s already exists as %s", filepath.ToSlash(rel), match)
+		dupes = append(dupes, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(dupes) == 0 {
+		r.log.Printf("No extracted track exists elsewhere in the library")
+		return nil
+	}
+	r.log.Printf("%d track(s) already exist elsewhere in the library", len(dupes))
+	if !r.opts.SkipLibraryDupes {
+		return nil
+	}
+	if fileCount-len(dupes) <= 0 {
+		return fmt.Errorf("every extracted file already exists in the library; nothing to import")
+	}
+	sort.Strings(dupes)
+	if err := r.removePruned(dupes); err != nil {
+		return err
+	}
+	r.log.Printf("Skipped %d library duplicate(s)", len(dupes))
+	return nil
+}
+
+// libraryMatch returns the library path of a track with the same name, size
+// and SHA-256 as the extracted file at path, ignoring own (its destination),
+// or "" when there is none. Index entries whose file is gone are ignored.
+func (r *runner) libraryMatch(idx *libraryIndex, path string, size int64, own string) (string, error) {
+	candidates := idx.byKey[indexKey(filepath.Base(path), size)]
+	var sum []byte
+	for _, rel := range candidates {
+		if rel == own {
+			continue
+		}
+		if sum == nil {
+			var err error
+			if sum, err = fileSHA256(r.workFS(), path); err != nil {
+				return "", err
+			}
+		}
+		other, err := fileSHA256(r.library(), filepath.Join(idx.Root, filepath.FromSlash(rel)))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return "", err
+		}
+		if bytes.Equal(sum, other) {
+			return rel, nil
+		}
+	}
+	return "", nil
+}
+
+// indexImported adds the audio files this run moved into the live library
+// to the cached index, so the next run finds them without a rebuild.
+func (r *runner) indexImported(extractDir string) {
+	if r.libIndex == nil || r.opts.DryRun || r.opts.Stage {
+		return
+	}
+	destRel, err := filepath.Rel(r.libIndex.Root, r.destinationPath())
+	if err != nil {
+		return
+	}
+	err = filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() || !isAudio(d.Name()) {
+			return walkErr
+		}
+		if _, skip := r.collisionSkipped[path]; skip {
+			return nil
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		r.libIndex.add(filepath.Join(destRel, r.destRel(rel, false)), info.Size())
+		return nil
+	})
+	if err == nil {
+		err = r.libIndex.save()
+	}
+	if err != nil {
+		r.log.Printf("warning: cannot update library index: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestScanLibraryDupes(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	library := t.TempDir()
+	extract := t.TempDir()
+	write := func(root, name, content string) {
+		t.Helper()
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(library, "The Artist/Album/01 Intro.flac", "intro")
+	write(library, "Other/Album/02 Song.flac", "other") // same name and size, other content
+	write(extract, "Album/01 Intro.flac", "intro")
+	write(extract, "Album/02 Song.flac", "songs")
+	write(extract, "Album/03 New.flac", "new")
+
+	var logs bytes.Buffer
+	r := &runner{
+		cfg:       config.Config{NavidromeMusicPath: library},
+		opts:      Options{SkipLibraryDupes: true},
+		log:       log.New(&logs, "", 0),
+		artistDir: "Artist",
+	}
+	if err := r.scanLibraryDupes(extract); err != nil {
+		t.Fatalf("scanLibraryDupes returned error: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Album/01 Intro.flac already exists as The Artist/Album/01 Intro.flac") {
+		t.Fatalf("duplicate not reported:\n%s", logs.String())
+	}
+	if _, err := os.Stat(filepath.Join(extract, "Album", "01 Intro.flac")); !os.IsNotExist(err) {
+		t.Fatalf("library duplicate should be skipped, got err=%v", err)
+	}
+	for _, name := range []string{"02 Song.flac", "03 New.flac"} {
+		if _, err := os.Stat(filepath.Join(extract, "Album", name)); err != nil {
+			t.Fatalf("%s should be kept: %v", name, err)
+		}
+	}
+
+	// The import's tracks are added to the cached index, which the next run
+	// reuses instead of walking the library.
+	r.indexImported(extract)
+	logs.Reset()
+	next := &runner{cfg: r.cfg, opts: Options{DedupeLibrary: true}, log: log.New(&logs, "", 0), artistDir: "Someone Else"}
+	if err := next.scanLibraryDupes(extract); err != nil {
+		t.Fatalf("scanLibraryDupes returned error: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Using library index") {
+		t.Fatalf("expected the cached index to be used:\n%s", logs.String())
+	}
+	if len(next.libIndex.byKey[indexKey("03 New.flac", 3)]) != 1 {
+		t.Fatalf("imported track missing from the cached index: %+v", next.libIndex.Files)
+	}
+
+	// Skipping every file aborts.
+	only := t.TempDir()
+	write(only, "01 Intro.flac", "intro")
+	r.opts.DryRun = true
+	if err := r.scanLibraryDupes(only); err == nil {
+		t.Fatalf("expected an error when every file is a library duplicate")
+	}
+}
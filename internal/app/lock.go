@@ -0,0 +1,74 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrImportInProgress is returned when another run holds the import lock.
+var ErrImportInProgress = errors.New("another import is in progress")
+
+// lockPath returns --lock-file, defaulting to nd-import.lock in the temp base.
+func (r *runner) lockPath() string {
+	if r.opts.LockFile != "" {
+		return r.opts.LockFile
+	}
+	base := r.tmpBase()
+	if base == "" {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, "nd-import.lock")
+}
+
+// acquireLock takes an exclusive lock on the lock file so overlapping runs
+// (e.g. a cron job firing while the previous import is still going) cannot
+// race on the temp base and library. The returned func releases it. With
+// --no-lock, or where file locking is unsupported, it is a no-op.
+func (r *runner) acquireLock() (func(), error) {
+	if r.opts.NoLock {
+		return func() {}, nil
+	}
+	path := r.lockPath()
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file %q: %w", path, err)
+	}
+	if err := lockFile(f); err != nil {
+		holder := lockHolder(f)
+		f.Close()
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			r.log.Printf("warning: file locking is not supported on this platform; concurrent imports are not prevented")
+			return func() {}, nil
+		case errors.Is(err, ErrImportInProgress):
+			if holder != "" {
+				return nil, fmt.Errorf("%w (lock %s held by pid %s; use --no-lock to override)", ErrImportInProgress, path, holder)
+			}
+			return nil, fmt.Errorf("%w (lock %s is held; use --no-lock to override)", ErrImportInProgress, path)
+		}
+		return nil, fmt.Errorf("lock %q: %w", path, err)
+	}
+
+	// Record our pid for the error message of a competing run.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// lockHolder returns the pid recorded in the lock file, if any.
+func lockHolder(f *os.File) string {
+	data, err := io.ReadAll(io.LimitReader(f, 32))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
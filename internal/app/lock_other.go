@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd)
+
+package app
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile is not implemented on this platform.
+func lockFile(*os.File) error {
+	return errors.ErrUnsupported
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireLockRejectsSecondRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nd-import.lock")
+	first := &runner{log: log.New(io.Discard, "", 0)}
+	first.opts.LockFile = path
+	release, err := first.acquireLock()
+	if err != nil {
+		t.Fatalf("first acquireLock returned error: %v", err)
+	}
+
+	second := &runner{log: log.New(io.Discard, "", 0)}
+	second.opts.LockFile = path
+	if _, err := second.acquireLock(); !errors.Is(err, ErrImportInProgress) {
+		t.Fatalf("second acquireLock error = %v, want ErrImportInProgress", err)
+	} else if !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+		t.Fatalf("error %q does not name the holder pid", err)
+	}
+
+	second.opts.NoLock = true
+	if _, err := second.acquireLock(); err != nil {
+		t.Fatalf("--no-lock acquireLock returned error: %v", err)
+	}
+	second.opts.NoLock = false
+
+	release()
+	releaseAgain, err := second.acquireLock()
+	if err != nil {
+		t.Fatalf("acquireLock after release returned error: %v", err)
+	}
+	releaseAgain()
+}
+
+func TestLockPathDefaultsToTempBase(t *testing.T) {
+	dir := t.TempDir()
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.TmpDir = dir
+	if got, want := r.lockPath(), filepath.Join(dir, "nd-import.lock"); got != want {
+		t.Fatalf("lockPath() = %q, want %q", got, want)
+	}
+	r.opts.LockFile = "/var/run/nd-import.lock"
+	if got := r.lockPath(); got != r.opts.LockFile {
+		t.Fatalf("lockPath() = %q, want --lock-file", got)
+	}
+}
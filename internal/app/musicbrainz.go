@@ -0,0 +1,128 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// musicBrainzAPI is the MusicBrainz web service root; tests point it at a local server.
+var musicBrainzAPI = "https://musicbrainz.org/ws/2"
+
+// minArtistScore is the MusicBrainz search score a candidate needs to be considered.
+const minArtistScore = 90
+
+type mbArtist struct {
+	Name           string `json:"name"`
+	Score          int    `json:"score"`
+	Disambiguation string `json:"disambiguation"`
+}
+
+func (r *runner) searchMusicBrainzArtists(name string) ([]mbArtist, error) {
+	q := url.Values{}
+	q.Set("query", fmt.Sprintf("artist:%q", name))
+	q.Set("fmt", "json")
+	q.Set("limit", "5")
+
+	client, err := r.apiClient(hostMusicBrainz, 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.get(musicBrainzAPI+"/artist/?"+q.Encode(), "application/json", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d %s", resp.StatusCode, resp.Status)
+	}
+
+	var body struct {
+		Artists []mbArtist `json:"artists"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return body.Artists, nil
+}
+
+// canonicalArtist looks name up on MusicBrainz and returns its canonical
+// spelling. A single confident match differing only in case is applied
+// directly; anything less certain is offered interactively when a terminal
+// is attached. In every other case name is returned unchanged.
+func (r *runner) canonicalArtist(name string) string {
+	artists, err := r.searchMusicBrainzArtists(name)
+	if err != nil {
+		r.log.Printf("warning: MusicBrainz lookup failed (%v); keeping artist %q", err, name)
+		return name
+	}
+
+	var caseMatches, others []string
+	seen := make(map[string]bool)
+	for _, a := range artists {
+		if a.Score < minArtistScore || a.Name == "" || seen[a.Name] {
+			continue
+		}
+		seen[a.Name] = true
+		if strings.EqualFold(a.Name, name) {
+			caseMatches = append(caseMatches, a.Name)
+		} else {
+			others = append(others, a.Name)
+		}
+	}
+
+	switch {
+	case len(caseMatches) == 1:
+		if caseMatches[0] != name {
+			r.log.Printf("MusicBrainz: using canonical artist name %q for %q", caseMatches[0], name)
+		}
+		return caseMatches[0]
+	case len(caseMatches) > 1:
+		return r.chooseArtist(name, caseMatches)
+	case len(others) > 0:
+		return r.chooseArtist(name, others)
+	}
+	r.log.Printf("MusicBrainz: no confident match for %q; keeping it as typed", name)
+	return name
+}
+
+// chooseArtist asks the user to pick among ambiguous candidates, keeping
+// name when there is no terminal or the answer is empty or invalid.
+func (r *runner) chooseArtist(name string, candidates []string) string {
+	if r.stdin == nil {
+		r.log.Printf("MusicBrainz: ambiguous match for %q (%s); keeping it as typed", name, strings.Join(candidates, ", "))
+		return name
+	}
+
+	out := r.console()
+	fmt.Fprintf(out, "MusicBrainz matches for %q:\n", name)
+	for i, c := range candidates {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, c)
+	}
+	fmt.Fprintf(out, "Choose 1-%d, or press Enter to keep %q: ", len(candidates), name)
+
+	line, _ := bufio.NewReader(r.stdin).ReadString('\n')
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || choice < 1 || choice > len(candidates) {
+		r.log.Printf("Keeping artist %q", name)
+		return name
+	}
+	r.log.Printf("MusicBrainz: using artist name %q", candidates[choice-1])
+	return candidates[choice-1]
+}
+
+// interactiveStdin returns os.Stdin when it is a terminal, otherwise nil.
+func interactiveStdin() io.Reader {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return os.Stdin
+}
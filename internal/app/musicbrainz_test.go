@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withMusicBrainz(t *testing.T, body string, status int) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("User-Agent"), "nd-import/") {
+			t.Errorf("missing nd-import User-Agent")
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	orig := musicBrainzAPI
+	musicBrainzAPI = srv.URL
+	t.Cleanup(func() { musicBrainzAPI = orig })
+
+	origSleep := sleep
+	sleep = func(context.Context, time.Duration) error { return nil }
+	t.Cleanup(func() { sleep = origSleep })
+}
+
+func TestCanonicalArtist(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		stdin  io.Reader
+		input  string
+		want   string
+	}{
+		{
+			name:   "case correction",
+			body:   `{"artists":[{"name":"Daft Punk","score":100},{"name":"Daft Punk Tribute","score":60}]}`,
+			status: http.StatusOK,
+			input:  "daft punk",
+			want:   "Daft Punk",
+		},
+		{
+			name:   "ambiguous without terminal keeps input",
+			body:   `{"artists":[{"name":"dEUS","score":100},{"name":"Deus","score":95}]}`,
+			status: http.StatusOK,
+			input:  "deus",
+			want:   "deus",
+		},
+		{
+			name:   "ambiguous with prompt",
+			body:   `{"artists":[{"name":"dEUS","score":100},{"name":"Deus","score":95}]}`,
+			status: http.StatusOK,
+			stdin:  strings.NewReader("1\n"),
+			input:  "deus",
+			want:   "dEUS",
+		},
+		{
+			name:   "no confident match",
+			body:   `{"artists":[{"name":"Somebody Else","score":40}]}`,
+			status: http.StatusOK,
+			input:  "obscure act",
+			want:   "obscure act",
+		},
+		{
+			name:   "api unavailable",
+			body:   `oops`,
+			status: http.StatusServiceUnavailable,
+			input:  "daft punk",
+			want:   "daft punk",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withMusicBrainz(t, tt.body, tt.status)
+			r := &runner{log: log.New(io.Discard, "", 0), stdin: tt.stdin}
+			if got := r.canonicalArtist(tt.input); got != tt.want {
+				t.Fatalf("canonicalArtist(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,471 @@
+package app
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxExtLen bounds what counts as an extension when shortening names, so a
+// dot deep inside a long title is not mistaken for one.
+const maxExtLen = 16
+
+// shortenPath applies shortenName to every component of a relative path,
+// logging each name it changes once per run.
+func (r *runner) shortenPath(rel string) string {
+	if r.opts.MaxFilenameLength <= 0 {
+		return rel
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		if len(part) <= r.opts.MaxFilenameLength {
+			continue
+		}
+		short, ok := r.shortened[part]
+		if !ok {
+			short = shortenName(part, r.opts.MaxFilenameLength)
+			if r.shortened == nil {
+				r.shortened = make(map[string]string)
+			}
+			r.shortened[part] = short
+			r.log.Printf("Truncated name longer than %d bytes: %q -> %q", r.opts.MaxFilenameLength, part, short)
+		}
+		parts[i] = short
+	}
+	return filepath.Join(parts...)
+}
+
+// destRel maps a path relative to the extract dir to its path relative to
+// the destination: whitespace is cleaned, names are fitted to --target-fs
+// and shortened and, for files, extensions normalized and, with
+// --classify, a category folder inserted.
+func (r *runner) destRel(rel string, isDir bool) string {
+	src := rel
+	rel = r.cleanWhitespace(rel, isDir)
+	rel = r.fitTargetFS(rel)
+	rel = r.shortenPath(rel)
+	if !isDir {
+		rel = r.normalizeExt(rel)
+		if r.opts.Classify {
+			if c := r.sniffed[src]; c != "" {
+				rel = classifyAs(rel, c)
+			} else {
+				rel = r.classifyRel(rel)
+			}
+		}
+	}
+	return rel
+}
+
+// cleanWhitespace implements --clean-whitespace: every component of rel has
+// its whitespace runs collapsed to one space and is trimmed, a file's
+// extension staying attached to the trimmed stem ("01  Song .flac" ->
+// "01 Song.flac"). Each change is logged once per run.
+func (r *runner) cleanWhitespace(rel string, isDir bool) string {
+	if !r.opts.CleanWhitespace {
+		return rel
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		ext := ""
+		if i == len(parts)-1 && !isDir {
+			if e := filepath.Ext(part); len(e) > 1 && len(e) <= maxExtLen && isAlnum(e[1:]) {
+				ext = e
+			}
+		}
+		clean := strings.Join(strings.Fields(strings.TrimSuffix(part, ext)), " ")
+		if clean == "" {
+			continue
+		}
+		clean += ext
+		if clean == part {
+			continue
+		}
+		if _, ok := r.spaceCleaned[part]; !ok {
+			if r.spaceCleaned == nil {
+				r.spaceCleaned = make(map[string]string)
+			}
+			r.spaceCleaned[part] = clean
+			r.log.Printf("Cleaned whitespace: %q -> %q", part, clean)
+		}
+		parts[i] = clean
+	}
+	return filepath.Join(parts...)
+}
+
+// normalizeExt lowercases the extension of a file path for
+// --normalize-audio-ext (audio files) or --lowercase-ext (any file), logging
+// each change once per run. Only alphanumeric extensions count, so a dot
+// inside a title ("01. Intro") is left alone.
+func (r *runner) normalizeExt(rel string) string {
+	ext := filepath.Ext(rel)
+	lower := strings.ToLower(ext)
+	if ext == lower || len(ext) > maxExtLen || !isAlnum(ext[1:]) {
+		return rel
+	}
+	if !r.opts.LowercaseExt && !(r.opts.NormalizeAudioExt && isAudio(rel)) {
+		return rel
+	}
+	normalized := strings.TrimSuffix(rel, ext) + lower
+	if _, ok := r.extNormalized[rel]; !ok {
+		if r.extNormalized == nil {
+			r.extNormalized = make(map[string]string)
+		}
+		r.extNormalized[rel] = normalized
+		r.log.Printf("Normalized extension: %s -> %s", rel, normalized)
+	}
+	return normalized
+}
+
+func isAlnum(s string) bool {
+	for _, c := range s {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// shortenName truncates name to at most max bytes, keeping its extension and
+// appending a short hash of the original so truncated siblings stay unique.
+// Truncation never splits a UTF-8 sequence.
+func shortenName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	sum := sha1.Sum([]byte(name))
+	suffix := "~" + hex.EncodeToString(sum[:4])
+
+	ext := filepath.Ext(name)
+	if len(ext) > maxExtLen || len(ext)+len(suffix) >= max {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+
+	budget := max - len(ext) - len(suffix)
+	if budget < 0 {
+		budget = 0
+	}
+	if len(stem) > budget {
+		stem = stem[:budget]
+		for len(stem) > 0 && !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+	}
+	stem = strings.TrimRight(stem, " .")
+
+	short := stem + suffix + ext
+	if len(short) > max {
+		short = short[:max]
+	}
+	return short
+}
+
+// stripJunkName removes trailing junk extensions from name, e.g.
+// "song.mp3.1" or "track.flac.download". Each entry in junk is an extension
+// without the dot; "#" matches any run of digits. ok is false when nothing
+// was stripped or the result is not an audio file.
+func stripJunkName(name string, junk []string) (string, bool) {
+	stripped := name
+	for {
+		ext := strings.ToLower(filepath.Ext(stripped))
+		if ext == "" || !isJunkExtension(ext[1:], junk) {
+			break
+		}
+		stripped = strings.TrimSuffix(stripped, filepath.Ext(stripped))
+	}
+	if stripped == name || !isAudio(stripped) {
+		return name, false
+	}
+	return stripped, true
+}
+
+func isJunkExtension(ext string, junk []string) bool {
+	for _, j := range junk {
+		if j == ext || (j == "#" && ext != "" && strings.Trim(ext, "0123456789") == "") {
+			return true
+		}
+	}
+	return false
+}
+
+// stripJunkExtensions renames files in extractDir whose names end in junk
+// extensions (--strip-extensions) before pruning and the move. A rename that
+// would leave a non-audio name or clash with an existing file is skipped
+// with a warning.
+func (r *runner) stripJunkExtensions(extractDir string) error {
+	if !r.opts.StripExtensions {
+		return nil
+	}
+	var renamed int
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		name := d.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext == "" || !isJunkExtension(ext[1:], r.opts.JunkExtensions) {
+			return nil
+		}
+		clean, ok := stripJunkName(name, r.opts.JunkExtensions)
+		if !ok {
+			r.log.Printf("warning: not renaming %s: stripping junk extensions would not leave an audio file name", path)
+			return nil
+		}
+		target := filepath.Join(filepath.Dir(path), clean)
+		if _, err := r.workFS().Lstat(target); err == nil {
+			r.log.Printf("warning: not renaming %s: %s already exists", path, clean)
+			return nil
+		}
+		if r.opts.DryRun {
+			r.log.Printf("dry-run: would rename %s -> %s", path, clean)
+			return nil
+		}
+		if err := r.workFS().Rename(path, target); err != nil {
+			return fmt.Errorf("rename %q: %w", path, err)
+		}
+		r.log.Printf("Renamed %s -> %s", path, clean)
+		renamed++
+		return nil
+	})
+	if renamed > 0 {
+		r.log.Printf("Stripped junk extensions from %d file(s)", renamed)
+	}
+	return err
+}
+
+// discFolderPattern matches folder names that only label a disc, such as
+// "CD1", "cd 2", "Disc 03" or "disk_4".
+var discFolderPattern = regexp.MustCompile(`(?i)^(?:cd|disc|disk)[\s._-]*0*(\d{1,3})$`)
+
+// canonicalDiscName returns "Disc N" for a disc-labeled folder name; ok is
+// false for other names.
+func canonicalDiscName(name string) (string, bool) {
+	m := discFolderPattern.FindStringSubmatch(name)
+	if m == nil {
+		return name, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n == 0 {
+		return name, false
+	}
+	return fmt.Sprintf("Disc %d", n), true
+}
+
+// normalizeDiscFolders renames disc-labeled folders in extractDir to the
+// canonical "Disc N" form before the move (--normalize-discs). Renames that
+// would clash with a sibling are skipped with a warning.
+func (r *runner) normalizeDiscFolders(extractDir string) error {
+	if !r.opts.NormalizeDiscs {
+		return nil
+	}
+	return r.renameFolders(extractDir, "disc folder", canonicalDiscName)
+}
+
+// Year tokens recognised by canonicalYearName: a bracketed year anywhere,
+// or a bare year leading or trailing the name behind a separator.
+var (
+	bracketYearPattern  = regexp.MustCompile(`[(\[{]((?:19|20)\d{2})[)\]}]`)
+	leadingYearPattern  = regexp.MustCompile(`^((?:19|20)\d{2})\s*[-–._]\s*(\S.*)$`)
+	trailingYearPattern = regexp.MustCompile(`^(.*\S)\s*[-–]\s*((?:19|20)\d{2})$`)
+)
+
+// canonicalYearName moves the year of an album folder name to the front as
+// "(YYYY) Title": "Album (2019)", "Album [2019]", "2019 - Album" and
+// "Album - 2019" all become "(2019) Album". ok is false for names without
+// exactly one recognisable year or with nothing besides it.
+func canonicalYearName(name string) (string, bool) {
+	var year, rest string
+	if m := bracketYearPattern.FindAllStringSubmatchIndex(name, -1); len(m) > 1 {
+		return name, false
+	} else if len(m) == 1 {
+		year = name[m[0][2]:m[0][3]]
+		rest = name[:m[0][0]] + " " + name[m[0][1]:]
+	} else if m := leadingYearPattern.FindStringSubmatch(name); m != nil {
+		year, rest = m[1], m[2]
+	} else if m := trailingYearPattern.FindStringSubmatch(name); m != nil {
+		year, rest = m[2], m[1]
+	} else {
+		return name, false
+	}
+	rest = strings.Trim(strings.Join(strings.Fields(rest), " "), " -–_")
+	if rest == "" {
+		return name, false
+	}
+	return "(" + year + ") " + rest, true
+}
+
+// normalizeYearFolders renames folders in extractDir whose name carries a
+// year to the canonical "(YYYY) Title" form before the move
+// (--normalize-year). Folders without a detectable year are left alone.
+func (r *runner) normalizeYearFolders(extractDir string) error {
+	if !r.opts.NormalizeYear {
+		return nil
+	}
+	return r.renameFolders(extractDir, "album folder", canonicalYearName)
+}
+
+// renameFolders renames every folder below extractDir for which canonical
+// returns a different name, logging each rename as a kind. Renames that
+// would clash with a sibling are skipped with a warning.
+func (r *runner) renameFolders(extractDir, kind string, canonical func(string) (string, bool)) error {
+	var dirs []string
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr == nil && d.IsDir() && path != extractDir {
+			dirs = append(dirs, path)
+		}
+		return walkErr
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deepest first, so renaming a folder never invalidates a pending path.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := dirs[i]
+		name, ok := canonical(filepath.Base(path))
+		if !ok || name == filepath.Base(path) {
+			continue
+		}
+		target := filepath.Join(filepath.Dir(path), name)
+		if _, err := r.workFS().Lstat(target); err == nil && !strings.EqualFold(target, path) {
+			r.log.Printf("warning: not renaming %s: %s already exists", path, name)
+			continue
+		}
+		if r.opts.DryRun {
+			r.log.Printf("dry-run: would rename %s %s -> %s", kind, path, name)
+			continue
+		}
+		if err := r.workFS().Rename(path, target); err != nil {
+			return fmt.Errorf("rename %s %q: %w", kind, path, err)
+		}
+		r.log.Printf("Renamed %s %s -> %s", kind, path, name)
+	}
+	return nil
+}
+
+// trackPrefixSeparators may end a prefix removed by --trim-common-prefix.
+const trackPrefixSeparators = " -_."
+
+// commonTrackPrefix returns the leading text shared by all names that can be
+// removed whole: it is cut back to end on a separator, must contain more than
+// separators, and must leave every name a non-empty title. It returns "" when
+// fewer than two names are given or nothing qualifies.
+func commonTrackPrefix(names []string) string {
+	if len(names) < 2 {
+		return ""
+	}
+	prefix := names[0]
+	for _, name := range names[1:] {
+		i := 0
+		for i < len(prefix) && i < len(name) && prefix[i] == name[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	// Separators are ASCII, so cutting after one never splits a rune.
+	for prefix != "" && !strings.ContainsRune(trackPrefixSeparators, rune(prefix[len(prefix)-1])) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	if strings.Trim(prefix, trackPrefixSeparators) == "" {
+		return ""
+	}
+	for _, name := range names {
+		rest := name[len(prefix):]
+		if strings.Trim(strings.TrimSuffix(rest, filepath.Ext(rest)), trackPrefixSeparators) == "" {
+			return ""
+		}
+	}
+	return prefix
+}
+
+// trimCommonPrefixes strips a prefix shared by every track of a leaf folder
+// ("Album Name - 01 - Title.mp3" -> "01 - Title.mp3") for
+// --trim-common-prefix. Only audio files are renamed and only in folders
+// with at least two tracks; a folder where a trimmed name would clash with
+// another entry is left alone with a warning.
+func (r *runner) trimCommonPrefixes(extractDir string) error {
+	if !r.opts.TrimCommonPrefix {
+		return nil
+	}
+	entries := make(map[string][]string)
+	hasSubdir := make(map[string]bool)
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || path == extractDir {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if d.IsDir() {
+			hasSubdir[dir] = true
+		}
+		entries[dir] = append(entries[dir], d.Name())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dirs := make([]string, 0, len(entries))
+	for dir := range entries {
+		if !hasSubdir[dir] {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		var tracks []string
+		for _, name := range entries[dir] {
+			if isAudio(name) {
+				tracks = append(tracks, name)
+			}
+		}
+		prefix := commonTrackPrefix(tracks)
+		if prefix == "" {
+			continue
+		}
+
+		// Compare case-insensitively so the result is safe on any library.
+		taken := make(map[string]bool)
+		for _, name := range entries[dir] {
+			if !isAudio(name) {
+				taken[strings.ToLower(name)] = true
+			}
+		}
+		clash := ""
+		for _, name := range tracks {
+			trimmed := strings.ToLower(name[len(prefix):])
+			if taken[trimmed] {
+				clash = name[len(prefix):]
+				break
+			}
+			taken[trimmed] = true
+		}
+		if clash != "" {
+			r.log.Printf("warning: not trimming prefix %q in %s: %s would clash", prefix, dir, clash)
+			continue
+		}
+
+		if r.opts.DryRun {
+			r.log.Printf("dry-run: would trim common prefix %q from %d track(s) in %s", prefix, len(tracks), dir)
+			continue
+		}
+		for _, name := range tracks {
+			if err := r.workFS().Rename(filepath.Join(dir, name), filepath.Join(dir, name[len(prefix):])); err != nil {
+				return fmt.Errorf("trim prefix of %q: %w", filepath.Join(dir, name), err)
+			}
+		}
+		r.log.Printf("Trimmed common prefix %q from %d track(s) in %s", prefix, len(tracks), dir)
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestShortenName(t *testing.T) {
+	long := strings.Repeat("Very Long Title ", 20) + ".flac"
+	got := shortenName(long, 64)
+	if len(got) > 64 {
+		t.Fatalf("shortenName returned %d bytes, want <= 64", len(got))
+	}
+	if !strings.HasSuffix(got, ".flac") {
+		t.Fatalf("shortenName(%q) = %q, want .flac extension kept", long, got)
+	}
+	if other := shortenName(strings.Repeat("Very Long Title ", 21)+".flac", 64); other == got {
+		t.Fatalf("different long names truncated to the same result %q", got)
+	}
+
+	multibyte := strings.Repeat("日本語", 40) + ".mp3"
+	if got := shortenName(multibyte, 50); !utf8.ValidString(got) || len(got) > 50 {
+		t.Fatalf("shortenName produced invalid or oversized name %q", got)
+	}
+
+	if got := shortenName("short.flac", 64); got != "short.flac" {
+		t.Fatalf("short names must be unchanged, got %q", got)
+	}
+}
+
+func TestMoveIntoLibraryTruncatesLongNames(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "library")
+	long := strings.Repeat("x", 80) + ".flac"
+	if err := os.WriteFile(filepath.Join(src, long), []byte("music"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &runner{
+		cfg:  config.Config{},
+		opts: Options{MaxFilenameLength: 40},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.moveIntoLibrary(src, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != shortenName(long, 40) {
+		t.Fatalf("unexpected destination entries: %v", entries)
+	}
+}
+
+func TestStripJunkName(t *testing.T) {
+	junk := []string{"download", "part", "#"}
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"song.mp3.1", "song.mp3", true},
+		{"track.FLAC.download", "track.FLAC", true},
+		{"track.flac.12.part", "track.flac", true},
+		{"notes.txt.1", "notes.txt.1", false},
+		{"track.flac", "track.flac", false},
+		{"1999", "1999", false},
+	}
+	for _, tt := range tests {
+		got, ok := stripJunkName(tt.name, junk)
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("stripJunkName(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestStripJunkExtensions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp3.1", "b.flac.download", "b.flac.part", "c.txt.1"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.StripExtensions = true
+	r.opts.JunkExtensions = []string{"download", "part", "#"}
+	if err := r.stripJunkExtensions(dir); err != nil {
+		t.Fatalf("stripJunkExtensions returned error: %v", err)
+	}
+
+	for _, name := range []string{"a.mp3", "b.flac", "b.flac.part", "c.txt.1"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+	}
+	for _, name := range []string{"a.mp3.1", "b.flac.download"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be renamed, err=%v", name, err)
+		}
+	}
+}
+
+func TestCanonicalDiscName(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"CD1", "Disc 1", true},
+		{"cd 2", "Disc 2", true},
+		{"Disc_03", "Disc 3", true},
+		{"disk-10", "Disc 10", true},
+		{"Disc 1", "Disc 1", true},
+		{"CD0", "CD0", false},
+		{"Discography", "Discography", false},
+		{"CD1 Bonus", "CD1 Bonus", false},
+	}
+	for _, tt := range tests {
+		got, ok := canonicalDiscName(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("canonicalDiscName(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeDiscFolders(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"Album/CD1/01.flac", "Album/cd 2/01.flac", "Other/Disc 1/01.flac", "Other/CD1/02.flac", "Extras/01.flac"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.NormalizeDiscs = true
+	if err := r.normalizeDiscFolders(dir); err != nil {
+		t.Fatalf("normalizeDiscFolders returned error: %v", err)
+	}
+	for _, name := range []string{"Album/Disc 1/01.flac", "Album/Disc 2/01.flac", "Other/Disc 1/01.flac", "Other/CD1/02.flac", "Extras/01.flac"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+	}
+}
+
+func TestCanonicalYearName(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"Album (2019)", "(2019) Album", true},
+		{"Album [2019]", "(2019) Album", true},
+		{"2019 - Album", "(2019) Album", true},
+		{"2019. Album", "(2019) Album", true},
+		{"Album - 2019", "(2019) Album", true},
+		{"Album [2019] [FLAC]", "(2019) Album [FLAC]", true},
+		{"(2019) Album", "(2019) Album", true},
+		{"Album", "Album", false},
+		{"1999", "1999", false},
+		{"(2019)", "(2019)", false},
+		{"Album (1999) [2019 Remaster]", "(1999) Album [2019 Remaster]", true},
+		{"Album (1999) [2019]", "Album (1999) [2019]", false},
+		{"Track 1234", "Track 1234", false},
+	}
+	for _, tt := range tests {
+		got, ok := canonicalYearName(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("canonicalYearName(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeYearFolders(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"Album [2019]/01.flac", "2020 - Other/01.flac", "(2020) Other/02.flac", "Extras/01.flac"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.NormalizeYear = true
+	if err := r.normalizeYearFolders(dir); err != nil {
+		t.Fatalf("normalizeYearFolders returned error: %v", err)
+	}
+	for _, name := range []string{"(2019) Album/01.flac", "2020 - Other/01.flac", "(2020) Other/02.flac", "Extras/01.flac"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+	}
+}
+
+func TestCommonTrackPrefix(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"Album Name - 01 - Intro.mp3", "Album Name - 02 - Song.mp3"}, "Album Name - "},
+		{[]string{"Artist_Album_01.flac", "Artist_Album_02.flac"}, "Artist_Album_"},
+		{[]string{"01 - Intro.mp3", "02 - Song.mp3"}, ""},
+		{[]string{"Album - Intro.mp3", "Album - Outro.mp3", "Bonus.mp3"}, ""},
+		{[]string{"Album - .mp3", "Album - 2.mp3"}, ""},
+		{[]string{"Album - 01.mp3"}, ""},
+	}
+	for _, tt := range tests {
+		if got := commonTrackPrefix(tt.names); got != tt.want {
+			t.Fatalf("commonTrackPrefix(%q) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestTrimCommonPrefixes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"Album/Album - 01 - Intro.mp3", "Album/Album - 02 - Song.mp3", "Album/cover.jpg",
+		"Clash/X - a.flac", "Clash/X - A.flac",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.TrimCommonPrefix = true
+	if err := r.trimCommonPrefixes(dir); err != nil {
+		t.Fatalf("trimCommonPrefixes returned error: %v", err)
+	}
+	for _, name := range []string{"Album/01 - Intro.mp3", "Album/02 - Song.mp3", "Album/cover.jpg", "Clash/X - a.flac", "Clash/X - A.flac"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+	}
+}
+
+func TestNormalizeExt(t *testing.T) {
+	cases := []struct {
+		rel        string
+		audio, all bool
+		want       string
+	}{
+		{"Album/01 Song.FLAC", true, false, "Album/01 Song.flac"},
+		{"Album/02 Song.Mp3", true, false, "Album/02 Song.mp3"},
+		{"Album/Cover.JPG", true, false, "Album/Cover.JPG"},
+		{"Album/Cover.JPG", false, true, "Album/Cover.jpg"},
+		{"Album/01 Song.FLAC", false, false, "Album/01 Song.FLAC"},
+		{"Album/01. Intro", false, true, "Album/01. Intro"},
+		{"Album/song.flac", true, true, "Album/song.flac"},
+	}
+	for _, tc := range cases {
+		r := &runner{opts: Options{NormalizeAudioExt: tc.audio, LowercaseExt: tc.all}, log: log.New(io.Discard, "", 0)}
+		if got := r.normalizeExt(tc.rel); got != tc.want {
+			t.Fatalf("normalizeExt(%q, audio=%t, all=%t) = %q, want %q", tc.rel, tc.audio, tc.all, got, tc.want)
+		}
+	}
+}
+
+func TestMoveIntoLibraryNormalizesExtensions(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "Artist")
+	if err := os.WriteFile(filepath.Join(src, "01 Song.FLAC"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "Cover.JPG"), []byte("c"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &runner{opts: Options{NormalizeAudioExt: true}, log: log.New(io.Discard, "", 0)}
+	if err := r.moveIntoLibrary(src, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	names := dirNames(t, dest)
+	if strings.Join(names, ",") != "01 Song.flac,Cover.JPG" {
+		t.Fatalf("library holds %v, want [01 Song.flac Cover.JPG]", names)
+	}
+
+	// Two files that only differ in extension case now map to one name.
+	if err := os.WriteFile(filepath.Join(src, "01 Song.flac"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := r.moveIntoLibrary(src, filepath.Join(t.TempDir(), "Artist"))
+	if err == nil || !strings.Contains(err.Error(), "would both be written to") {
+		t.Fatalf("expected a conflict between 01 Song.FLAC and 01 Song.flac, got %v", err)
+	}
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestCleanWhitespace(t *testing.T) {
+	cases := []struct {
+		rel   string
+		isDir bool
+		want  string
+	}{
+		{"Album  Name /01\tSong .flac", false, "Album Name/01 Song.flac"},
+		{" Disc 1 ", true, "Disc 1"},
+		{"Album/01. Intro ", false, "Album/01. Intro"},
+		{"Album/   ", false, "Album/   "},
+		{"Album/01 Song.flac", false, "Album/01 Song.flac"},
+	}
+	for _, tc := range cases {
+		r := &runner{opts: Options{CleanWhitespace: true}, log: log.New(io.Discard, "", 0)}
+		if got := r.cleanWhitespace(filepath.FromSlash(tc.rel), tc.isDir); got != filepath.FromSlash(tc.want) {
+			t.Fatalf("cleanWhitespace(%q) = %q, want %q", tc.rel, got, tc.want)
+		}
+	}
+}
+
+func TestMoveIntoLibraryCleansWhitespace(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "Artist")
+	for _, name := range []string{"Album  One/01  Song.flac", "Album One /02 Song .flac"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("a"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{opts: Options{CleanWhitespace: true}, log: log.New(io.Discard, "", 0)}
+	if err := r.moveIntoLibrary(src, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	if names := dirNames(t, dest); strings.Join(names, ",") != "Album One" {
+		t.Fatalf("library holds %v, want the folders merged into [Album One]", names)
+	}
+	if names := dirNames(t, filepath.Join(dest, "Album One")); strings.Join(names, ",") != "01 Song.flac,02 Song.flac" {
+		t.Fatalf("Album One holds %v, want [01 Song.flac 02 Song.flac]", names)
+	}
+
+	// A file that cleans to an existing name in the same folder collides:
+	// the default policy aborts, keep-larger moves the larger file.
+	if err := os.WriteFile(filepath.Join(src, "Album One ", "02 Song.flac"), []byte("bigger"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := r.moveIntoLibrary(src, filepath.Join(t.TempDir(), "Artist"))
+	if err == nil || !strings.Contains(err.Error(), "would both be written to") || !strings.Contains(err.Error(), "--on-collision keep-larger") {
+		t.Fatalf("expected a conflict between 02 Song .flac and 02 Song.flac, got %v", err)
+	}
+
+	var logs bytes.Buffer
+	r = &runner{opts: Options{CleanWhitespace: true, OnCollision: CollisionKeepLarger}, log: log.New(&logs, "", 0)}
+	dest = filepath.Join(t.TempDir(), "Artist")
+	if err := r.moveIntoLibrary(src, dest); err != nil {
+		t.Fatalf("moveIntoLibrary with keep-larger returned error: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "Album One", "02 Song.flac")); err != nil || string(got) != "bigger" {
+		t.Fatalf("02 Song.flac = %q (err %v), want the larger copy", got, err)
+	}
+	want := "writing larger " + filepath.Join(src, "Album One ", "02 Song.flac")
+	if !strings.Contains(logs.String(), want) || !strings.Contains(logs.String(), "02 Song .flac") {
+		t.Fatalf("log does not report which copy won:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxNestedArchiveDepth bounds --recurse-archives: an archive nested deeper
+// than this inside the downloaded one aborts the import.
+const maxNestedArchiveDepth = 3
+
+// nestedArchiveExts are the file extensions checked for nested archives.
+var nestedArchiveExts = []string{".zip", ".tar", ".gz", ".tgz", ".rar", ".7z"}
+
+// extractNested implements --recurse-archives: every archive found under
+// dir is extracted in place into a sibling folder named after it (without
+// the extension) and then removed, recursing into that folder; with
+// --resume-temp an existing folder is completed instead. depth is
+// the nesting level of the archives in dir, starting at 1. Archives in
+// formats that cannot be extracted are left as they are, with a warning.
+func (r *runner) extractNested(dir string, depth int) error {
+	if !r.opts.RecurseArchives {
+		return nil
+	}
+
+	var archives []string
+	err := r.workFS().WalkDir(dir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if slices.Contains(nestedArchiveExts, strings.ToLower(filepath.Ext(path))) {
+			archives = append(archives, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(archives)
+
+	for _, archive := range archives {
+		format, err := detectArchiveFormat(archive)
+		if err != nil {
+			return fmt.Errorf("detect archive format: %w", err)
+		}
+		if !slices.Contains(extractableFormats, format) {
+			r.log.Printf("warning: leaving nested archive %s as-is (not a %s archive)", archive, strings.Join(extractableFormats, "/"))
+			continue
+		}
+		if depth > maxNestedArchiveDepth {
+			return fmt.Errorf("nested archive %s exceeds the maximum depth of %d", archive, maxNestedArchiveDepth)
+		}
+
+		target := strings.TrimSuffix(archive, filepath.Ext(archive))
+		if info, err := r.workFS().Stat(target); err == nil {
+			// A resumed run extracts again the nested archives an earlier
+			// run already unpacked and removed; the folder it left is
+			// completed like the outer extract dir.
+			if r.opts.ResumeTemp == "" || !info.IsDir() {
+				return fmt.Errorf("cannot extract nested archive %s: %s already exists", archive, target)
+			}
+			r.log.Printf("Resuming nested archive %s into %s", archive, target)
+		}
+		// --extract-only selects entries of the downloaded archive; a nested
+		// archive it let through is extracted in full.
+		if err := r.extractSelected(archive, target, make(map[string]string), nil); err != nil {
+			return fmt.Errorf("nested archive %s: %w", filepath.Base(archive), err)
+		}
+		if err := r.workFS().Remove(archive); err != nil {
+			return fmt.Errorf("remove nested archive %q: %w", archive, err)
+		}
+		r.log.Printf("Extracted nested archive %s", archive)
+		if err := r.extractNested(target, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractNested(t *testing.T) {
+	inner := zipBytes(t, map[string]string{"01.flac": "one", "Bonus.zip": string(zipBytes(t, map[string]string{"02.flac": "two"}))})
+	dir := t.TempDir()
+	for name, content := range map[string][]byte{
+		"Album One.ZIP":  inner,
+		"Extras/old.rar": []byte("Rar!\x1a\x07\x01\x00"),
+		"cover.jpg":      []byte("jpg"),
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logs bytes.Buffer
+	r := &runner{log: log.New(&logs, "", 0), opts: Options{RecurseArchives: true}}
+	if err := r.extractNested(dir, 1); err != nil {
+		t.Fatalf("extractNested returned error: %v", err)
+	}
+
+	for name, want := range map[string]bool{
+		"Album One/01.flac":       true,
+		"Album One/Bonus/02.flac": true,
+		"Album One.ZIP":           false,
+		"Album One/Bonus.zip":     false,
+		"Extras/old.rar":          true,
+		"cover.jpg":               true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if exists := err == nil; exists != want {
+			t.Fatalf("%s exists = %v, want %v", name, exists, want)
+		}
+	}
+	if !strings.Contains(logs.String(), "leaving nested archive") {
+		t.Fatalf("expected a warning for the rar archive:\n%s", logs.String())
+	}
+}
+
+func TestExtractNestedDepthLimit(t *testing.T) {
+	data := zipBytes(t, map[string]string{"deep.flac": "x"})
+	for i := 0; i < maxNestedArchiveDepth; i++ {
+		data = zipBytes(t, map[string]string{"level.zip": string(data)})
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bomb.zip"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0), opts: Options{RecurseArchives: true}}
+	err := r.extractNested(dir, 1)
+	if err == nil || !strings.Contains(err.Error(), "maximum depth") {
+		t.Fatalf("expected depth error, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// audioExtensions are the file types listed as tracks in album.nfo.
+var audioExtensions = map[string]bool{
+	".flac": true, ".mp3": true, ".m4a": true, ".aac": true, ".ogg": true,
+	".opus": true, ".wav": true, ".aiff": true, ".alac": true, ".wv": true, ".ape": true,
+}
+
+var (
+	nfoBracketYear  = regexp.MustCompile(`\s*[(\[]((?:19|20)\d{2})[)\]]`)
+	nfoLeadingYear  = regexp.MustCompile(`^((?:19|20)\d{2})\s*-\s*`)
+	nfoTrailingTags = regexp.MustCompile(`(\s*\[[^\]]*\])+\s*$`)
+	nfoTrackNumber  = regexp.MustCompile(`^\d{1,3}(\s*[-.]\s*|\s+|_)`)
+)
+
+// nfoAlbum is the minimal Kodi album.nfo document.
+type nfoAlbum struct {
+	XMLName xml.Name   `xml:"album"`
+	Title   string     `xml:"title"`
+	Artist  string     `xml:"artist"`
+	Year    string     `xml:"year,omitempty"`
+	Tracks  []nfoTrack `xml:"track"`
+}
+
+type nfoTrack struct {
+	Position int    `xml:"position"`
+	Title    string `xml:"title"`
+}
+
+func isAudio(name string) bool {
+	return audioExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// albumFolders returns the extracted leaf directories (no subdirectories)
+// that hold at least one audio file, relative to extractDir and renamed
+// the same way the move names them (see destRel). Loose tracks at the top level are not
+// treated as an album.
+func (r *runner) albumFolders(extractDir string) ([]string, error) {
+	var folders []string
+	err := filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !d.IsDir() || path == extractDir {
+			return nil
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		hasAudio := false
+		for _, e := range entries {
+			if e.IsDir() {
+				return nil
+			}
+			hasAudio = hasAudio || isAudio(e.Name())
+		}
+		if hasAudio {
+			rel, err := filepath.Rel(extractDir, path)
+			if err != nil {
+				return err
+			}
+			folders = append(folders, r.destRel(rel, true))
+		}
+		return nil
+	})
+	return folders, err
+}
+
+// writeNFOs writes album.nfo into every imported album folder under dest,
+// skipping folders that already contain an .nfo file.
+func (r *runner) writeNFOs(extractDir, dest string) error {
+	folders, err := r.albumFolders(extractDir)
+	if err != nil {
+		return fmt.Errorf("find album folders: %w", err)
+	}
+
+	var created []string
+	for _, rel := range folders {
+		dir := filepath.Join(dest, rel)
+		if r.opts.DryRun {
+			r.log.Printf("dry-run: would write %s", filepath.Join(dir, "album.nfo"))
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("read album folder %q: %w", dir, err)
+		}
+		var tracks []string
+		skip := false
+		for _, e := range entries {
+			switch {
+			case e.IsDir():
+			case strings.EqualFold(filepath.Ext(e.Name()), ".nfo"):
+				skip = true
+			case isAudio(e.Name()):
+				tracks = append(tracks, e.Name())
+			}
+		}
+		if skip {
+			r.log.Printf("Skipping nfo for %s: folder already has one", dir)
+			continue
+		}
+		sort.Strings(tracks)
+
+		path := filepath.Join(dir, "album.nfo")
+		if err := r.writeNFO(path, r.buildNFO(filepath.Base(rel), tracks)); err != nil {
+			return err
+		}
+		created = append(created, path)
+	}
+	if len(created) > 0 {
+		r.log.Printf("Wrote album.nfo in %d folder(s)", len(created))
+	}
+	return r.chownCreated(created)
+}
+
+// buildNFO infers the album title and year from the folder name, e.g.
+// "Artist - 2019 - Album [FLAC]" or "Album (2019)", and lists tracks in
+// file name order without leading track numbers.
+func (r *runner) buildNFO(folder string, tracks []string) nfoAlbum {
+	album := nfoAlbum{Artist: r.artistDir}
+
+	title := nfoTrailingTags.ReplaceAllString(folder, "")
+	if prefix := r.artistDir + " - "; len(title) > len(prefix) && strings.EqualFold(title[:len(prefix)], prefix) {
+		title = title[len(prefix):]
+	}
+	if m := nfoLeadingYear.FindStringSubmatch(title); m != nil {
+		album.Year = m[1]
+		title = title[len(m[0]):]
+	} else if m := nfoBracketYear.FindStringSubmatch(title); m != nil {
+		album.Year = m[1]
+		title = nfoBracketYear.ReplaceAllString(title, "")
+	}
+	album.Title = strings.TrimSpace(title)
+	if album.Title == "" {
+		album.Title = folder
+	}
+
+	for i, name := range tracks {
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		trackTitle := strings.TrimSpace(nfoTrackNumber.ReplaceAllString(stem, ""))
+		if trackTitle == "" {
+			trackTitle = stem
+		}
+		album.Tracks = append(album.Tracks, nfoTrack{Position: i + 1, Title: trackTitle})
+	}
+	return album
+}
+
+func (r *runner) writeNFO(path string, album nfoAlbum) error {
+	data, err := xml.MarshalIndent(album, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %q: %w", path, err)
+	}
+	f, err := r.createFile(r.library(), path, 0)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", path, err)
+	}
+	if _, err := f.Write(append([]byte(xml.Header), append(data, '\n')...)); err != nil {
+		f.Close()
+		return fmt.Errorf("write %q: %w", path, err)
+	}
+	return f.Close()
+}
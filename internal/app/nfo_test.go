@@ -0,0 +1,78 @@
+package app
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildNFO(t *testing.T) {
+	r := &runner{artistDir: "Daft Punk"}
+	tests := []struct {
+		folder, title, year string
+	}{
+		{"Daft Punk - 2001 - Discovery [FLAC]", "Discovery", "2001"},
+		{"Homework (1997)", "Homework", "1997"},
+		{"Alive 2007", "Alive 2007", ""},
+		{"[Bonus]", "[Bonus]", ""},
+	}
+	for _, tt := range tests {
+		got := r.buildNFO(tt.folder, nil)
+		if got.Title != tt.title || got.Year != tt.year {
+			t.Fatalf("buildNFO(%q) = %q/%q, want %q/%q", tt.folder, got.Title, got.Year, tt.title, tt.year)
+		}
+	}
+
+	album := r.buildNFO("Discovery", []string{"01 - One More Time.flac", "02. Aerodynamic.flac", "1999.mp3"})
+	want := []string{"One More Time", "Aerodynamic", "1999"}
+	for i, tr := range album.Tracks {
+		if tr.Position != i+1 || tr.Title != want[i] {
+			t.Fatalf("track %d = %+v, want %q", i, tr, want[i])
+		}
+	}
+}
+
+func TestWriteNFOs(t *testing.T) {
+	extract := t.TempDir()
+	dest := t.TempDir()
+	for _, root := range []string{extract, dest} {
+		for _, name := range []string{"Discovery/01 - One More Time.flac", "Discovery/cover.jpg", "Homework/01 - Daftendirekt.flac", "Homework/old.nfo", "Live/CD1/01.flac", "loose.mp3"} {
+			path := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0), artistDir: "Daft Punk"}
+	if err := r.writeNFOs(extract, dest); err != nil {
+		t.Fatalf("writeNFOs returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "Discovery", "album.nfo"))
+	if err != nil {
+		t.Fatalf("expected Discovery/album.nfo: %v", err)
+	}
+	for _, want := range []string{"<title>Discovery</title>", "<artist>Daft Punk</artist>", "<position>1</position>", "<title>One More Time</title>"} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("album.nfo missing %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "cover.jpg") {
+		t.Fatalf("album.nfo should only list audio files:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Live", "CD1", "album.nfo")); err != nil {
+		t.Fatalf("expected nfo in leaf folder Live/CD1: %v", err)
+	}
+	for _, name := range []string{"Homework/album.nfo", "Live/album.nfo", "album.nfo"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be written (err %v)", name, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// selectOnly drops every extracted file that matches none of the --only
+// patterns, then removes directories left empty. Patterns follow the same
+// anchoring rules as UNNEEDED_FILES. Unlike pruning, excluding almost
+// everything is expected; only a selection that matches nothing fails.
+func (r *runner) selectOnly(extractDir string) error {
+	if len(r.opts.Only) == 0 {
+		return nil
+	}
+
+	var drop []string
+	var kept int
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			return nil
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range r.opts.Only {
+			ok, err := matchPrunePattern(pattern, filepath.ToSlash(rel))
+			if err != nil {
+				return fmt.Errorf("invalid --only pattern %q: %w", pattern, err)
+			}
+			if ok {
+				kept++
+				return nil
+			}
+		}
+		drop = append(drop, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if kept == 0 {
+		return fmt.Errorf("--only %s matched no files", strings.Join(r.opts.Only, ", "))
+	}
+
+	sort.Strings(drop)
+	for _, path := range drop {
+		if r.opts.DryRun {
+			r.log.Printf("dry-run: would skip %s (not matched by --only)", path)
+			continue
+		}
+		if err := r.workFS().Remove(path); err != nil {
+			return fmt.Errorf("remove %q: %w", path, err)
+		}
+	}
+	r.log.Printf("Selected %d file(s) matching --only; skipped %d", kept, len(drop))
+	if r.opts.DryRun {
+		return nil
+	}
+	return removeEmptyDirs(r.workFS(), extractDir)
+}
+
+// removeEmptyDirs deletes directories under root on fsys that contain no
+// files, deepest first. root itself is kept.
+func removeEmptyDirs(fsys FS, root string) error {
+	var dirs []string
+	children := make(map[string]int)
+	err := fsys.WalkDir(root, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || path == root {
+			return walkErr
+		}
+		children[filepath.Dir(path)]++
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if children[dirs[i]] > 0 {
+			continue
+		}
+		if err := fsys.Remove(dirs[i]); err != nil {
+			return fmt.Errorf("remove empty directory %q: %w", dirs[i], err)
+		}
+		children[filepath.Dir(dirs[i])]--
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectOnly(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"Album/Disc 1/01.flac", "Album/Disc 1/cover.jpg", "Album/Disc 2/01.flac", "notes.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.Only = []string{"**/Disc 1/*.flac"}
+	if err := r.selectOnly(dir); err != nil {
+		t.Fatalf("selectOnly returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "Album/Disc 1/01.flac")); err != nil {
+		t.Fatalf("selected file missing: %v", err)
+	}
+	for _, name := range []string{"Album/Disc 1/cover.jpg", "Album/Disc 2", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, err=%v", name, err)
+		}
+	}
+
+	r.opts.Only = []string{"*.wav"}
+	if err := r.selectOnly(dir); err == nil {
+		t.Fatalf("expected error when --only matches nothing")
+	}
+}
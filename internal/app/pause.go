@@ -0,0 +1,206 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPauseHold is how long a paused download keeps its connection
+// open before dropping it (--pause-hold).
+const DefaultPauseHold = time.Minute
+
+// pauseSwitch is the process-wide download pause, toggled by SIGUSR1
+// (pause) and SIGUSR2 (resume), see watchPauseSignals.
+type pauseSwitch struct {
+	mu     sync.Mutex
+	paused bool
+	// resumed is closed when a pause ends.
+	resumed chan struct{}
+}
+
+var downloadPause = &pauseSwitch{}
+
+// set pauses or resumes downloads, reporting whether that changed anything.
+func (p *pauseSwitch) set(paused bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused == paused {
+		return false
+	}
+	p.paused = paused
+	if paused {
+		p.resumed = make(chan struct{})
+	} else {
+		close(p.resumed)
+	}
+	return true
+}
+
+// state reports whether downloads are paused and, if so, returns a
+// channel closed once they are resumed.
+func (p *pauseSwitch) state() (<-chan struct{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed, p.paused
+}
+
+var pauseSignalsOnce sync.Once
+
+// watchPauseSignals starts listening for the pause and resume signals, once
+// per process. It does nothing where they do not exist.
+func watchPauseSignals(logger *log.Logger) {
+	pauseSignalsOnce.Do(func() {
+		pause, resume, ok := pauseSignals()
+		if !ok {
+			return
+		}
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, pause, resume)
+		go func() {
+			for sig := range c {
+				switch {
+				case sig == pause && downloadPause.set(true):
+					logger.Printf("Downloads paused (%s); send %s to resume", pause, resume)
+				case sig == resume && downloadPause.set(false):
+					logger.Printf("Downloads resumed (%s)", resume)
+				}
+			}
+		}()
+	})
+}
+
+func (r *runner) pauseHold() time.Duration {
+	if r.opts.PauseHold > 0 {
+		return r.opts.PauseHold
+	}
+	return DefaultPauseHold
+}
+
+// copyDownload copies the body of resp to dst. While downloads are paused
+// it stops reading but keeps the connection open for up to --pause-hold;
+// a longer pause closes it, and once resumed the download continues where
+// it stopped with a Range request. A connection that fails right after a
+// pause is resumed the same way, once.
+func (r *runner) copyDownload(client *apiClient, resp *http.Response, dst io.Writer, fileID string) (int64, error) {
+	body := resp.Body
+	defer func() { body.Close() }()
+
+	var written int64
+	buf := make([]byte, 32<<10)
+	afterPause := false
+	for {
+		if resumed, paused := downloadPause.state(); paused {
+			if resp.ContentLength >= 0 && written >= resp.ContentLength {
+				return written, nil
+			}
+			held, err := r.holdPaused(resumed, body, fileID, written)
+			if err != nil {
+				return written, err
+			}
+			if !held {
+				if body, err = r.reopenDownload(client, resp, body, written, fileID); err != nil {
+					return written, err
+				}
+			}
+			afterPause = true
+		}
+
+		n, err := ctxReader{r.context(), body}.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+			afterPause = false
+		}
+		switch {
+		case err == io.EOF:
+			return written, nil
+		case err != nil && afterPause && r.context().Err() == nil:
+			r.log.Printf("Connection for %s lost during the pause (%v); reconnecting from byte %d", fileID, err, written)
+			if body, err = r.reopenDownload(client, resp, body, written, fileID); err != nil {
+				return written, err
+			}
+			afterPause = false
+		case err != nil:
+			return written, err
+		}
+	}
+}
+
+// holdPaused waits for downloads to be resumed. If that takes longer than
+// --pause-hold, body is closed to free the connection and false is
+// returned, so the caller reconnects.
+func (r *runner) holdPaused(resumed <-chan struct{}, body io.Closer, fileID string, written int64) (bool, error) {
+	ctx := r.context()
+	hold := r.pauseHold()
+	r.log.Printf("Download of %s paused at %s; holding the connection for up to %s", fileID, humanBytes(written, r.stats.units), hold)
+	timer := time.NewTimer(hold)
+	defer timer.Stop()
+	select {
+	case <-resumed:
+		r.log.Printf("Download of %s resumed", fileID)
+		return true, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-timer.C:
+	}
+
+	r.log.Printf("Download of %s paused for longer than %s; closing the connection until it is resumed", fileID, hold)
+	body.Close()
+	select {
+	case <-resumed:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// reopenDownload closes body, if still open, and requests the rest of
+// resp's download from byte offset on.
+func (r *runner) reopenDownload(client *apiClient, resp *http.Response, body io.Closer, offset int64, fileID string) (io.ReadCloser, error) {
+	body.Close()
+	r.log.Printf("Resuming download of %s from byte %d", fileID, offset)
+	next, err := client.resume(resp, offset, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("resume download after pause: %w", err)
+	}
+	return next.Body, nil
+}
+
+// resume re-sends the request that produced resp asking for the bytes from
+// offset on. The original request is cloned, so its credentials go only to
+// the host they were meant for and redirects are followed again. The
+// server must answer 206 with a matching Content-Range.
+func (c *apiClient) resume(resp *http.Response, offset int64, fileID string) (*http.Response, error) {
+	orig := resp.Request
+	for orig.Response != nil {
+		orig = orig.Response.Request
+	}
+	req := orig.Clone(c.r.context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	// If-Range makes a server whose file changed send it whole (200),
+	// which is rejected below instead of being spliced on.
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-Range", etag)
+	} else if modified := resp.Header.Get("Last-Modified"); modified != "" {
+		req.Header.Set("If-Range", modified)
+	}
+
+	next, err := c.do(req, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if next.StatusCode != http.StatusPartialContent || !strings.HasPrefix(next.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+		next.Body.Close()
+		return nil, fmt.Errorf("%s cannot resume at byte %d (status %s)", req.URL.Host, offset, next.Status)
+	}
+	return next, nil
+}
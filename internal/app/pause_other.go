@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package app
+
+import "os"
+
+// pauseSignals reports that this platform has no pause signals.
+func pauseSignals() (pause, resume os.Signal, ok bool) {
+	return nil, nil, false
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// servePausing serves archive, pausing downloads halfway through the first
+// response and resuming them after resumeAfter. Range requests are served
+// whole by http.ServeContent and counted in ranges.
+func servePausing(t *testing.T, archive []byte, resumeAfter time.Duration, ranges *atomic.Int32) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/file/abc123" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("ETag", `"v1"`)
+		if req.Header.Get("Range") != "" {
+			ranges.Add(1)
+			http.ServeContent(w, req, "album.zip", time.Time{}, bytes.NewReader(archive))
+			return
+		}
+
+		half := len(archive) / 2
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+		downloadPause.set(true)
+		time.AfterFunc(resumeAfter, func() { downloadPause.set(false) })
+		w.Write(archive[:half])
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(resumeAfter + 50*time.Millisecond):
+			w.Write(archive[half:])
+		case <-req.Context().Done():
+		}
+	})
+	t.Cleanup(func() { downloadPause.set(false) })
+}
+
+func TestDownloadPauseResume(t *testing.T) {
+	archive := zipBytes(t, map[string]string{"Album/01.flac": string(bytes.Repeat([]byte("audio"), 4096))})
+	cases := []struct {
+		name      string
+		hold      time.Duration
+		wantRange bool
+	}{
+		{name: "held", hold: time.Minute, wantRange: false},
+		{name: "reconnected", hold: 10 * time.Millisecond, wantRange: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ranges atomic.Int32
+			servePausing(t, archive, 100*time.Millisecond, &ranges)
+
+			library := t.TempDir()
+			r := &runner{
+				cfg:  config.Config{NavidromeMusicPath: library},
+				opts: Options{Artist: "Artist", URLs: []string{"abc123"}, TmpDir: t.TempDir(), PauseHold: tc.hold},
+				log:  log.New(io.Discard, "", 0),
+			}
+			if err := r.Execute(); err != nil {
+				t.Fatalf("Execute returned error: %v", err)
+			}
+			got, err := os.ReadFile(filepath.Join(library, "Artist", "Album", "01.flac"))
+			if err != nil || len(got) != 5*4096 {
+				t.Fatalf("imported track = %d bytes, %v; want %d bytes", len(got), err, 5*4096)
+			}
+			if (ranges.Load() > 0) != tc.wantRange {
+				t.Fatalf("range requests = %d, want any: %v", ranges.Load(), tc.wantRange)
+			}
+		})
+	}
+}
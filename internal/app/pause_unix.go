@@ -0,0 +1,13 @@
+//go:build linux || darwin || freebsd
+
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignals returns the signals that pause and resume downloads.
+func pauseSignals() (pause, resume os.Signal, ok bool) {
+	return syscall.SIGUSR1, syscall.SIGUSR2, true
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	defaultDirMode  os.FileMode = 0o755
+	defaultFileMode os.FileMode = 0o644
+)
+
+// dirMode returns the permission bits for directories the tool creates.
+// --dir-mode wins over DIR_MODE; explicit is false when neither is set.
+func (r *runner) dirMode() (mode os.FileMode, explicit bool) {
+	switch {
+	case r.opts.DirMode != 0:
+		return r.opts.DirMode, true
+	case r.cfg.DirMode != 0:
+		return r.cfg.DirMode, true
+	}
+	return defaultDirMode, false
+}
+
+// specialModeBits are the setuid, setgid and sticky bits.
+const specialModeBits = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// fileMode returns the permission bits for a created file whose source
+// (zip entry or extracted file) carries mode. Without --file-mode or
+// FILE_MODE the source mode is kept, falling back to 0644, minus the bits
+// safeFileMode drops unless --preserve-modes is set.
+func (r *runner) fileMode(mode os.FileMode) (os.FileMode, bool) {
+	switch {
+	case r.opts.FileMode != 0:
+		return r.opts.FileMode, true
+	case r.cfg.FileMode != 0:
+		return r.cfg.FileMode, true
+	}
+	if mode.Perm() == 0 {
+		return defaultFileMode, false
+	}
+	if r.opts.PreserveModes {
+		return mode & (os.ModePerm | specialModeBits), false
+	}
+	return safeFileMode(mode), false
+}
+
+// safeFileMode strips what a hostile archive could use against the library
+// from mode: setuid, setgid and sticky bits and group/other write. The
+// owner always keeps read and write.
+func safeFileMode(mode os.FileMode) os.FileMode {
+	return mode.Perm()&^0o022 | 0o600
+}
+
+// mkdirAll creates path and any missing parents on fsys, returning the
+// directories it created from the top down. When a directory mode is
+// configured, those directories are chmod'ed so the umask does not narrow
+// them; directories that already existed are left untouched.
+func (r *runner) mkdirAll(fsys FS, path string) ([]string, error) {
+	mode, explicit := r.dirMode()
+
+	var created []string
+	for p := path; ; p = filepath.Dir(p) {
+		if _, err := fsys.Stat(p); err == nil {
+			break
+		}
+		created = append([]string{p}, created...)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	if err := fsys.MkdirAll(path, mode); err != nil {
+		return nil, err
+	}
+	if explicit {
+		for _, dir := range created {
+			if err := fsys.Chmod(dir, mode); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return created, nil
+}
+
+// chownCreated hands paths created during a move to the configured owner.
+// Platforms without chown support log a warning instead of failing.
+func (r *runner) chownCreated(paths []string) error {
+	owner := r.opts.Owner
+	if owner == nil {
+		owner = r.cfg.Owner
+	}
+	if owner == nil || len(paths) == 0 {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		r.log.Printf("warning: --owner is not supported on %s; leaving ownership unchanged", runtime.GOOS)
+		return nil
+	}
+
+	fsys := r.library()
+	for _, path := range paths {
+		if err := fsys.Lchown(path, owner.UID, owner.GID); err != nil {
+			if errors.Is(err, errors.ErrUnsupported) {
+				r.log.Printf("warning: chown not supported for %s; leaving ownership unchanged", path)
+				return nil
+			}
+			return fmt.Errorf("chown %q to %s: %w", path, owner, err)
+		}
+	}
+	r.log.Printf("Set owner %s on %d created path(s)", owner, len(paths))
+	return nil
+}
+
+// createFile opens path on fsys for writing with the resolved file mode,
+// chmod'ing it when the mode was configured explicitly.
+func (r *runner) createFile(fsys FS, path string, srcMode os.FileMode) (io.WriteCloser, error) {
+	mode, explicit := r.fileMode(srcMode)
+	f, err := fsys.Create(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	if explicit {
+		if file, ok := f.(*os.File); ok {
+			if err := file.Chmod(mode); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestMoveIntoLibraryAppliesModes(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "library")
+
+	audio := filepath.Join(src, "Album", "song.flac")
+	if err := os.MkdirAll(filepath.Dir(audio), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(audio, []byte("music"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &runner{
+		cfg:  config.Config{DirMode: 0o700},
+		opts: Options{DirMode: 0o775, FileMode: 0o664},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.moveIntoLibrary(src, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+
+	for path, want := range map[string]os.FileMode{
+		dest:                         0o775,
+		filepath.Join(dest, "Album"): 0o775,
+		filepath.Join(dest, "Album", "song.flac"): 0o664,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Fatalf("%s mode = %o, want %o", path, got, want)
+		}
+	}
+}
+
+func TestFileModeDefaults(t *testing.T) {
+	r := &runner{}
+	if mode, explicit := r.fileMode(0); mode != defaultFileMode || explicit {
+		t.Fatalf("fileMode(0) = %o, %v; want %o, false", mode, explicit, defaultFileMode)
+	}
+	if mode, _ := r.fileMode(0o600); mode != 0o600 {
+		t.Fatalf("fileMode(0600) = %o, want entry mode kept", mode)
+	}
+	r.cfg.FileMode = 0o640
+	if mode, explicit := r.fileMode(0o600); mode != 0o640 || !explicit {
+		t.Fatalf("fileMode with FILE_MODE = %o, %v; want 640, true", mode, explicit)
+	}
+}
+
+func TestFileModeMasksUnsafeBits(t *testing.T) {
+	r := &runner{}
+	for src, want := range map[os.FileMode]os.FileMode{
+		0o755:                 0o755,
+		0o777:                 0o755,
+		0o666:                 0o644,
+		0o444:                 0o644,
+		0o755 | os.ModeSetuid: 0o755,
+		0o775 | os.ModeSetgid: 0o755,
+	} {
+		if got, _ := r.fileMode(src); got != want {
+			t.Fatalf("fileMode(%v) = %v, want %v", src, got, want)
+		}
+	}
+
+	r.opts.PreserveModes = true
+	if got, _ := r.fileMode(0o777 | os.ModeSetuid); got != 0o777|os.ModeSetuid {
+		t.Fatalf("fileMode with --preserve-modes = %v, want the entry mode kept", got)
+	}
+}
+
+func TestExtractArchiveDropsUnsafeModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permission bits are not supported on windows")
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	hdr := &zip.FileHeader{Name: "Album/run.sh", Method: zip.Store}
+	hdr.SetMode(0o777 | os.ModeSetuid)
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "#!/bin/sh\n")
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "hostile.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	var logs bytes.Buffer
+	r := &runner{log: log.New(&logs, "", 0)}
+	if err := r.extractArchive(archive, dest, map[string]string{}); err != nil {
+		t.Fatalf("extractArchive returned error: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dest, "Album", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&(os.ModeSetuid|0o022) != 0 {
+		t.Fatalf("extracted mode = %v, want setuid and group/other write dropped", info.Mode())
+	}
+	if !strings.Contains(logs.String(), "--preserve-modes") {
+		t.Fatalf("dropped bits not reported:\n%s", logs.String())
+	}
+
+	// Ordinary zips record 0666; dropping group/other write is not worth a warning.
+	plain := filepath.Join(t.TempDir(), "plain.zip")
+	if err := os.WriteFile(plain, zipBytes(t, map[string]string{"Album/track.flac": "audio"}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logs.Reset()
+	if err := r.extractArchive(plain, t.TempDir(), map[string]string{}); err != nil {
+		t.Fatalf("extractArchive returned error: %v", err)
+	}
+	if strings.Contains(logs.String(), "--preserve-modes") {
+		t.Fatalf("unexpected warning for a plain zip:\n%s", logs.String())
+	}
+}
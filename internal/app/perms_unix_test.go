@@ -0,0 +1,57 @@
+//go:build linux || darwin || freebsd
+
+package app
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestMoveIntoLibraryChownsCreatedPaths(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("chown to another user needs root")
+	}
+	src := t.TempDir()
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "library")
+	if err := os.MkdirAll(filepath.Join(src, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "Album", "song.flac"), []byte("music"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const uid, gid = 4321, 8765
+	r := &runner{
+		opts: Options{Owner: &config.Owner{UID: uid, GID: gid}},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.moveIntoLibrary(src, dest); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+
+	owner := func(path string) (uint32, uint32) {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := info.Sys().(*syscall.Stat_t)
+		return st.Uid, st.Gid
+	}
+	for _, rel := range []string{"", "Album", filepath.Join("Album", "song.flac")} {
+		path := filepath.Join(dest, rel)
+		if u, g := owner(path); u != uid || g != gid {
+			t.Errorf("%s owned by %d:%d, want %d:%d", path, u, g, uid, gid)
+		}
+	}
+	// Folders that already existed keep their owner.
+	if u, _ := owner(parent); u == uid {
+		t.Errorf("existing %s was chowned", parent)
+	}
+}
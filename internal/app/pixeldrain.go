@@ -0,0 +1,185 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// defaultPixeldrainAPI is the base URL of the public Pixeldrain API.
+const defaultPixeldrainAPI = "https://pixeldrain.com/api"
+
+// pixeldrainAPI is the base URL of the Pixeldrain API: defaultPixeldrainAPI
+// unless --pixeldrain-api-base or PIXELDRAIN_API_BASE name a mirror. Tests
+// point it at a local server.
+var pixeldrainAPI = defaultPixeldrainAPI
+
+// usePixeldrainAPI selects the API base for this process: the flag wins
+// over the env var; both empty keep the current base.
+func usePixeldrainAPI(cfg config.Config, opts Options) {
+	switch {
+	case opts.PixeldrainAPIBase != "":
+		pixeldrainAPI = opts.PixeldrainAPIBase
+	case cfg.PixeldrainAPIBase != "":
+		pixeldrainAPI = cfg.PixeldrainAPIBase
+	}
+}
+
+// pixeldrainAPIHost is the host of a custom API base, whose links the
+// Pixeldrain resolver also accepts, or "" for the public API.
+func pixeldrainAPIHost() string {
+	if pixeldrainAPI == defaultPixeldrainAPI {
+		return ""
+	}
+	u, err := url.Parse(pixeldrainAPI)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// pixeldrainInfo is the subset of /api/file/{id}/info the importer uses.
+type pixeldrainInfo struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type"`
+}
+
+func fileDownloadURL(id string) string {
+	return fmt.Sprintf("%s/file/%s?download", pixeldrainAPI, url.PathEscape(id))
+}
+
+func fileInfoURL(id string) string {
+	return fmt.Sprintf("%s/file/%s/info", pixeldrainAPI, url.PathEscape(id))
+}
+
+func listZipURL(id string) string {
+	return fmt.Sprintf("%s/list/%s/zip", pixeldrainAPI, url.PathEscape(id))
+}
+
+func listInfoURL(id string) string {
+	return fmt.Sprintf("%s/list/%s", pixeldrainAPI, url.PathEscape(id))
+}
+
+// pixeldrainClient returns an HTTP client for Pixeldrain and archive
+// downloads. Unlike the MusicBrainz client it honours --insecure-skip-verify
+// and --ca-cert, so custom trust settings never reach unrelated hosts.
+// Redirects to another host lose the Authorization header, see
+// stripAuthOnRedirect.
+func (r *runner) pixeldrainClient(timeout time.Duration) (*http.Client, error) {
+	client := &http.Client{Timeout: timeout, CheckRedirect: stripAuthOnRedirect}
+	transport, err := r.trustTransport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		client.Transport = transport
+	}
+	return client, nil
+}
+
+// trustTransport returns a transport applying --insecure-skip-verify and
+// --ca-cert, or nil when neither is set and the default transport applies.
+func (r *runner) trustTransport() (*http.Transport, error) {
+	if !r.opts.InsecureSkipVerify && r.opts.CACert == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: r.opts.InsecureSkipVerify}
+	if r.opts.CACert != "" {
+		pem, err := os.ReadFile(r.opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read --ca-cert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("--ca-cert %q contains no PEM certificates", r.opts.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// fetchFileInfo queries the Pixeldrain info API for a file's metadata,
+// reusing a recent answer unless --no-cache is set.
+func (r *runner) fetchFileInfo(fileID string) (pixeldrainInfo, error) {
+	var info pixeldrainInfo
+
+	infoURL := fileInfoURL(fileID)
+	if cached, ok := metadataCache.get(infoURL); ok && !r.opts.NoCache {
+		return cached.(pixeldrainInfo), nil
+	}
+	client, err := r.apiClient(hostPixeldrain, 30*time.Second)
+	if err != nil {
+		return info, err
+	}
+	resp, err := client.get(infoURL, "application/json", fileID)
+	if err != nil {
+		return info, fmt.Errorf("info request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return info, fmt.Errorf("info request failed: status %d %s: %s", resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&info); err != nil {
+		return info, fmt.Errorf("decode info response: %w", err)
+	}
+	metadataCache.put(infoURL, info)
+	return info, nil
+}
+
+// logDownloadHost logs the host a download comes from, noting a redirect
+// (e.g. to a CDN) away from the requested URL.
+func (r *runner) logDownloadHost(resp *http.Response, requested string) {
+	u, err := url.Parse(requested)
+	if err != nil {
+		return
+	}
+	if final := resp.Request.URL; !strings.EqualFold(final.Host, u.Host) {
+		r.log.Printf("Download endpoint: %s (redirected from %s)", final.Host, u.Host)
+		return
+	}
+	r.log.Printf("Download endpoint: %s", u.Host)
+}
+
+// estimateDownload adds the expected download size of one archive to the
+// dry-run estimate. When the info API is unavailable the total is marked
+// unknown (-1). A list counts the combined size of its files.
+func (r *runner) estimateDownload(src archiveSource) {
+	if src.list {
+		r.estimateListDownload(src.id)
+		return
+	}
+	fileID := src.id
+	info, err := r.fetchFileInfo(fileID)
+	if err != nil {
+		r.stats.estimatedBytes = -1
+		r.log.Printf("dry-run: download size unknown (%v)", err)
+		return
+	}
+	if r.stats.estimatedBytes >= 0 {
+		r.stats.estimatedBytes += info.Size
+	}
+	name := info.Name
+	if name == "" {
+		name = fileID
+	}
+	r.log.Printf("dry-run: would download %s (%s)", name, humanBytes(info.Size, r.stats.units))
+}
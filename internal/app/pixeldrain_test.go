@@ -0,0 +1,292 @@
+package app
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func withPixeldrainAPI(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	orig := pixeldrainAPI
+	pixeldrainAPI = srv.URL
+	t.Cleanup(func() { pixeldrainAPI = orig })
+}
+
+func TestEstimateDownload(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/file/abc123/info" {
+			http.NotFound(w, req)
+			return
+		}
+		if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want bearer token", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"name":"album.zip","size":1048576,"mime_type":"application/zip"}`)
+	})
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.cfg.PixeldrainToken = "secret"
+	r.estimateDownload(archiveSource{id: "abc123", pixeldrain: true})
+	if r.stats.estimatedBytes != 1048576 {
+		t.Fatalf("estimatedBytes = %d, want 1048576", r.stats.estimatedBytes)
+	}
+}
+
+func TestEstimateDownloadUnavailable(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "nope", http.StatusServiceUnavailable)
+	})
+	origSleep := sleep
+	sleep = func(context.Context, time.Duration) error { return nil }
+	t.Cleanup(func() { sleep = origSleep })
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.estimateDownload(archiveSource{id: "abc123", pixeldrain: true})
+	if r.stats.estimatedBytes != -1 {
+		t.Fatalf("estimatedBytes = %d, want -1 for unknown", r.stats.estimatedBytes)
+	}
+}
+
+func TestDryRunPlanIncludesEstimate(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/file/abc123/info":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"name":"album.zip","size":2048}`)
+		case "/file/abc123":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write(zipBytes(t, map[string]string{"Album/01.flac": "audio", "Album/info.txt": "text"}))
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	var logs strings.Builder
+	library := t.TempDir()
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library, UnneededPatterns: []string{"*.txt"}},
+		opts: Options{Artist: "Artist", URLs: []string{"abc123"}, TmpDir: t.TempDir(), DryRun: true},
+		log:  log.New(&logs, "", 0),
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	for _, want := range []string{"dry-run: would download album.zip (2.0 KiB)", "dry-run: would remove", "dry-run: would merge extracted files"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("dry-run plan lacks %q:\n%s", want, logs.String())
+		}
+	}
+	if entries, _ := os.ReadDir(library); len(entries) != 0 {
+		t.Fatalf("dry run wrote %d entries to the library", len(entries))
+	}
+}
+
+func TestPixeldrainClientTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		ok   bool
+	}{
+		{"strict", Options{}, false},
+		{"ca-cert", Options{CACert: caFile}, true},
+		{"insecure", Options{InsecureSkipVerify: true}, true},
+	}
+	for _, tt := range tests {
+		r := &runner{opts: tt.opts, log: log.New(io.Discard, "", 0)}
+		client, err := r.pixeldrainClient(5 * time.Second)
+		if err != nil {
+			t.Fatalf("%s: pixeldrainClient returned error: %v", tt.name, err)
+		}
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != tt.ok {
+			t.Fatalf("%s: GET error = %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+
+	r := &runner{opts: Options{CACert: filepath.Join(t.TempDir(), "missing.pem")}}
+	if _, err := r.pixeldrainClient(0); err == nil {
+		t.Fatalf("expected error for unreadable --ca-cert")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"Wed, 01 May 2024 12:00:45 GMT", 45 * time.Second, true},
+		{"Wed, 01 May 2024 11:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAPIClientRateLimited(t *testing.T) {
+	var waits []time.Duration
+	origSleep := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = origSleep })
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls <= 2 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := (&apiClient{r: r, http: http.DefaultClient}).do(req, "abc123")
+	if err != nil {
+		t.Fatalf("do returned error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Fatalf("status %d after %d calls, want 200 after 3", resp.StatusCode, calls)
+	}
+	if len(waits) != 2 || waits[0] != 7*time.Second {
+		t.Fatalf("waits = %v, want two 7s waits", waits)
+	}
+
+	// A Retry-After above the limit is not waited out.
+	calls, waits = 0, nil
+	r.opts.MaxRateLimitWait = 5 * time.Second
+	resp, err = (&apiClient{r: r, http: http.DefaultClient}).do(req, "abc123")
+	if err != nil {
+		t.Fatalf("do returned error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || len(waits) != 0 {
+		t.Fatalf("status %d with waits %v, want 429 without waiting", resp.StatusCode, waits)
+	}
+}
+
+func TestAPIClientRetriesServerErrors(t *testing.T) {
+	var waits []time.Duration
+	origSleep := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = origSleep })
+
+	calls := 0
+	var agent, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		agent, auth = req.Header.Get("User-Agent"), req.Header.Get("Authorization")
+		if calls <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+
+	r := &runner{log: log.New(io.Discard, "", 0), cfg: config.Config{PixeldrainToken: "secret"}}
+	client, err := r.apiClient(hostDownload, 0)
+	if err != nil {
+		t.Fatalf("apiClient: %v", err)
+	}
+	resp, err := client.get(srv.URL, "", "")
+	if err != nil {
+		t.Fatalf("get returned error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Fatalf("status %d after %d calls, want 200 after 3", resp.StatusCode, calls)
+	}
+	if len(waits) != 2 || waits[0] != time.Second || waits[1] != 2*time.Second {
+		t.Fatalf("waits = %v, want [1s 2s]", waits)
+	}
+	if !strings.HasPrefix(agent, "nd-import/") {
+		t.Fatalf("User-Agent = %q, want nd-import/...", agent)
+	}
+	if auth != "" {
+		t.Fatalf("Authorization = %q sent to a non-Pixeldrain host", auth)
+	}
+
+	// Persistent failures give up after maxRetries and return the response.
+	calls, waits = -100, nil
+	resp, err = client.get(srv.URL, "", "")
+	if err != nil {
+		t.Fatalf("get returned error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || len(waits) != maxRetries {
+		t.Fatalf("status %d with %d waits, want 502 after %d", resp.StatusCode, len(waits), maxRetries)
+	}
+}
+
+func TestDownloadLogsRedirectedHost(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, map[string]string{"Album/track.flac": "audio"}))
+	}))
+	t.Cleanup(cdn.Close)
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, cdn.URL+"/abc123", http.StatusFound)
+	})
+
+	var logs strings.Builder
+	r := &runner{opts: Options{TmpDir: t.TempDir()}, log: log.New(&logs, "", 0)}
+	src := archiveSource{id: "abc123", url: fileDownloadURL("abc123"), host: "Pixeldrain", pixeldrain: true}
+	if _, err := r.download(src, true); err != nil {
+		t.Fatalf("download returned error: %v", err)
+	}
+	want := fmt.Sprintf("Download endpoint: %s (redirected from %s)", strings.TrimPrefix(cdn.URL, "http://"), strings.TrimPrefix(pixeldrainAPI, "http://"))
+	if !strings.Contains(logs.String(), want) {
+		t.Fatalf("log lacks %q:\n%s", want, logs.String())
+	}
+}
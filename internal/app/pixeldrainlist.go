@@ -0,0 +1,316 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// pixeldrainList is the subset of /api/list/{id} the importer uses.
+type pixeldrainList struct {
+	Title string `json:"title"`
+	Files []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	} `json:"files"`
+}
+
+// fetchListInfo queries the Pixeldrain list API for the files of a list,
+// reusing a recent answer unless --no-cache is set.
+func (r *runner) fetchListInfo(listID string) (pixeldrainList, error) {
+	var list pixeldrainList
+
+	infoURL := listInfoURL(listID)
+	if cached, ok := metadataCache.get(infoURL); ok && !r.opts.NoCache {
+		return cached.(pixeldrainList), nil
+	}
+	client, err := r.apiClient(hostPixeldrain, 30*time.Second)
+	if err != nil {
+		return list, err
+	}
+	resp, err := client.get(infoURL, "application/json", listID)
+	if err != nil {
+		return list, fmt.Errorf("list request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return list, fmt.Errorf("list request failed: status %d %s: %s", resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&list); err != nil {
+		return list, fmt.Errorf("decode list response: %w", err)
+	}
+	if len(list.Files) == 0 {
+		return list, fmt.Errorf("Pixeldrain list %s is empty", listID)
+	}
+	metadataCache.put(infoURL, list)
+	return list, nil
+}
+
+// listSize returns the combined size of the files in list.
+func listSize(list pixeldrainList) int64 {
+	var total int64
+	for _, f := range list.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// estimateListDownload is estimateDownload for a Pixeldrain list.
+func (r *runner) estimateListDownload(listID string) {
+	list, err := r.fetchListInfo(listID)
+	if err != nil {
+		r.stats.estimatedBytes = -1
+		r.log.Printf("dry-run: download size unknown (%v)", err)
+		return
+	}
+	if r.opts.ListItem != "" {
+		i, err := selectListItem(list, r.opts.ListItem)
+		if err != nil {
+			r.stats.estimatedBytes = -1
+			r.log.Printf("dry-run: list %s: %v", listID, err)
+			return
+		}
+		f := list.Files[i]
+		if r.stats.estimatedBytes >= 0 {
+			r.stats.estimatedBytes += f.Size
+		}
+		r.log.Printf("dry-run: would download file %d of list %s, %q (%s)", i+1, listID, f.Name, humanBytes(f.Size, r.stats.units))
+		return
+	}
+	size := listSize(list)
+	if r.stats.estimatedBytes >= 0 {
+		r.stats.estimatedBytes += size
+	}
+	name := list.Title
+	if name == "" {
+		name = listID
+	}
+	r.log.Printf("dry-run: would download list %s as one zip (%d files, %s)", name, len(list.Files), humanBytes(size, r.stats.units))
+}
+
+// checkListOptions rejects --list and --list-item when none of the run's
+// URLs is a Pixeldrain list.
+func (r *runner) checkListOptions(sources []archiveSource) error {
+	if !r.opts.ListPreview && r.opts.ListItem == "" {
+		return nil
+	}
+	for _, src := range sources {
+		if src.list {
+			return nil
+		}
+	}
+	return fmt.Errorf("--list and --list-item need a Pixeldrain list URL (https://pixeldrain.com/l/<id>)")
+}
+
+// listOnly implements --list. It needs neither an artist nor the library:
+// the URLs are resolved and the lists among them printed.
+func (r *runner) listOnly() error {
+	start := time.Now()
+	sources, err := r.resolveSources()
+	if err != nil {
+		return err
+	}
+	if err := r.checkListOptions(sources); err != nil {
+		return err
+	}
+	err = r.previewLists(sources)
+	r.stats.recordPhase("resolve", start)
+	return err
+}
+
+// previewLists prints the files of each list URL with the 1-based
+// indices --list-item accepts. Nothing is downloaded.
+func (r *runner) previewLists(sources []archiveSource) error {
+	tw := tabwriter.NewWriter(r.console(), 0, 0, 2, ' ', 0)
+	for _, src := range sources {
+		if !src.list {
+			r.log.Printf("list: %s file %s is not a list; skipping", src.host, src.id)
+			continue
+		}
+		list, err := r.fetchListInfo(src.id)
+		if err != nil {
+			return err
+		}
+		title := list.Title
+		if title == "" {
+			title = src.id
+		}
+		fmt.Fprintf(tw, "List %s (%d files, %s)\n", title, len(list.Files), humanBytes(listSize(list), r.stats.units))
+		for i, f := range list.Files {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", i+1, f.Name, humanBytes(f.Size, r.stats.units))
+		}
+	}
+	return tw.Flush()
+}
+
+// selectListItem returns the index of the list file selector picks: a
+// 1-based position as printed by --list, otherwise the file with exactly
+// that name, otherwise the one file whose name contains it regardless of
+// case. No match or several matches are errors.
+func selectListItem(list pixeldrainList, selector string) (int, error) {
+	if n, err := strconv.Atoi(selector); err == nil {
+		if n < 1 || n > len(list.Files) {
+			return -1, fmt.Errorf("--list-item %d is out of range; the list has %d file(s)", n, len(list.Files))
+		}
+		return n - 1, nil
+	}
+	var matches []int
+	for i, f := range list.Files {
+		if f.Name == selector {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		lower := strings.ToLower(selector)
+		for i, f := range list.Files {
+			if strings.Contains(strings.ToLower(f.Name), lower) {
+				matches = append(matches, i)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return -1, fmt.Errorf("--list-item %q matches no file in the list (see --list)", selector)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = fmt.Sprintf("%d %q", m+1, list.Files[m].Name)
+	}
+	return -1, fmt.Errorf("--list-item %q is ambiguous; it matches %s", selector, strings.Join(names, ", "))
+}
+
+// fetchListItem downloads only the list file --list-item selects, placing or
+// extracting it like fetchListFiles does.
+func (r *runner) fetchListItem(src archiveSource, extractDir string, extractedFrom map[string]string) error {
+	list, err := r.fetchListInfo(src.id)
+	if err != nil {
+		return err
+	}
+	i, err := selectListItem(list, r.opts.ListItem)
+	if err != nil {
+		return fmt.Errorf("list %s: %w", src.id, err)
+	}
+	f := list.Files[i]
+	r.log.Printf("List %s: importing only file %d of %d, %q", src.id, i+1, len(list.Files), f.Name)
+	member := archiveSource{id: f.ID, url: fileDownloadURL(f.ID), host: src.host, pixeldrain: true, listID: src.id, member: f.Name}
+	if err := r.fetchListMember(member, f.Name, extractDir, extractedFrom); err != nil {
+		return fmt.Errorf("list %s file %q: %w", src.id, f.Name, err)
+	}
+	return nil
+}
+
+// listContentType reports whether a list download's Content-Type may be a
+// tarball, which some mirrors serve instead of a zip.
+func listContentType(contentType string) bool {
+	return strings.Contains(contentType, "tar") || strings.Contains(contentType, "gzip")
+}
+
+// checkListArchive sniffs a downloaded list archive by its leading bytes, so
+// the served format rather than the endpoint decides which extractor
+// applies. Formats extractArchive cannot unpack are rejected up front.
+func checkListArchive(src archiveSource, path string) error {
+	format, err := detectArchiveFormat(path)
+	if err != nil {
+		return fmt.Errorf("detect archive format: %w", err)
+	}
+	if format == "" {
+		return fmt.Errorf("list %s download from %s is not a recognised archive", src.id, src.host)
+	}
+	if !slices.Contains(extractableFormats, format) {
+		return fmt.Errorf("list %s was served by %s as a %s archive; only %s archives can be extracted", src.id, src.host, format, strings.Join(extractableFormats, ", "))
+	}
+	return nil
+}
+
+// fetchListFiles is the fallback when a list's zip endpoint fails: each
+// file of the list is downloaded on its own. Zips are extracted as usual;
+// any other file is placed at the top of extractDir under its list name.
+// A file that fails is recorded for --retry-partial and the rest are still
+// fetched; the list fails as a whole only when every file does.
+func (r *runner) fetchListFiles(src archiveSource, extractDir string, extractedFrom map[string]string) error {
+	list, err := r.fetchListInfo(src.id)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for i, f := range list.Files {
+		r.log.Printf("List %s: file %d of %d", src.id, i+1, len(list.Files))
+		member := archiveSource{id: f.ID, url: fileDownloadURL(f.ID), host: src.host, pixeldrain: true, listID: src.id, member: f.Name}
+		if err := r.fetchListMember(member, f.Name, extractDir, extractedFrom); err != nil {
+			err = fmt.Errorf("list %s file %q: %w", src.id, f.Name, err)
+			if r.context().Err() != nil {
+				return err
+			}
+			r.recordPartial(member, err)
+			failed++
+		}
+	}
+	if failed == len(list.Files) {
+		return fmt.Errorf("all %d file(s) of list %s failed", failed, src.id)
+	}
+	return nil
+}
+
+func (r *runner) fetchListMember(member archiveSource, name, extractDir string, extractedFrom map[string]string) (err error) {
+	start := time.Now()
+	path, err := r.download(member, false)
+	r.stats.recordPhase("download", start)
+	if path != "" {
+		defer func() { r.cleanupUnlessFailed(filepath.Dir(path), err) }()
+	}
+	if err != nil {
+		return err
+	}
+
+	if format, err := detectArchiveFormat(path); err != nil {
+		return err
+	} else if format == FormatZip {
+		start = time.Now()
+		err = r.extractArchive(path, extractDir, extractedFrom)
+		r.stats.recordPhase("extract", start)
+		return err
+	}
+
+	// List names are display names; anything path-like falls back to the ID.
+	rel := name
+	if rel == "" || rel == "." || rel == ".." || strings.ContainsAny(rel, `/\`) {
+		rel = member.id
+	}
+	rel = r.shortenPath(rel)
+	if other, ok := extractedFrom[rel]; ok {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		crc, err := fileCRC32(osFS{}, path)
+		if err != nil {
+			return err
+		}
+		overwrite, err := r.resolveRunCollision(extractDir, rel, name, other, info.Size(), crc)
+		if err != nil || !overwrite {
+			return err
+		}
+	}
+	target := filepath.Join(extractDir, rel)
+	if err := os.Rename(path, target); err != nil {
+		return fmt.Errorf("place %q: %w", rel, err)
+	}
+	if err := os.Chmod(target, 0o644); err != nil {
+		return err
+	}
+	extractedFrom[rel] = name
+	return nil
+}
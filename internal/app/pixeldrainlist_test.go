@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchListUsesZipEndpoint(t *testing.T) {
+	archive := zipBytes(t, map[string]string{"Album/01.flac": "one"})
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/list/list42/zip" {
+			t.Errorf("unexpected request %s", req.URL.Path)
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(archive)
+	})
+
+	extract := t.TempDir()
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.TmpDir = t.TempDir()
+	src := archiveSource{id: "list42", url: listZipURL("list42"), host: "Pixeldrain", pixeldrain: true, list: true}
+	if err := r.fetchInto(src, extract, make(map[string]string)); err != nil {
+		t.Fatalf("fetchInto returned error: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(extract, "Album", "01.flac")); err != nil || string(got) != "one" {
+		t.Fatalf("01.flac = %q (err %v), want extracted from the list zip", got, err)
+	}
+}
+
+func TestFetchListFallsBackToFiles(t *testing.T) {
+	origSleep := sleep
+	sleep = func(context.Context, time.Duration) error { return nil }
+	t.Cleanup(func() { sleep = origSleep })
+
+	archive := zipBytes(t, map[string]string{"Bonus/b.flac": "bonus"})
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/list/list42/zip":
+			http.Error(w, "zip unavailable", http.StatusInternalServerError)
+		case "/list/list42":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"title":"Album","files":[{"id":"f1","name":"01 Song.flac","size":4},{"id":"f2","name":"bonus.zip","size":100},{"id":"f3","name":"../evil","size":1}]}`)
+		case "/file/f1":
+			w.Header().Set("Content-Type", "audio/flac")
+			io.WriteString(w, "song")
+		case "/file/f2":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write(archive)
+		case "/file/f3":
+			io.WriteString(w, "x")
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	extract := t.TempDir()
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.TmpDir = t.TempDir()
+	src := archiveSource{id: "list42", url: listZipURL("list42"), host: "Pixeldrain", pixeldrain: true, list: true}
+	if err := r.fetchInto(src, extract, make(map[string]string)); err != nil {
+		t.Fatalf("fetchInto returned error: %v", err)
+	}
+	for rel, want := range map[string]string{"01 Song.flac": "song", "Bonus/b.flac": "bonus", "f3": "x"} {
+		got, err := os.ReadFile(filepath.Join(extract, rel))
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q (err %v), want %q", rel, got, err, want)
+		}
+	}
+}
+
+func TestFetchListSniffsServedFormat(t *testing.T) {
+	tarball := make([]byte, 1024)
+	copy(tarball, "Album/01.flac")
+	copy(tarball[257:], "ustar")
+	bodies := map[string][]byte{
+		"list42": zipBytes(t, map[string]string{"Album/01.flac": "one"}),
+		"list43": tarball,
+		"list44": []byte("<html>not an archive</html>"),
+	}
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		id := filepath.Base(filepath.Dir(req.URL.Path))
+		body, ok := bodies[id]
+		if !ok || filepath.Base(req.URL.Path) != "zip" {
+			http.NotFound(w, req)
+			return
+		}
+		// The mirror labels every download-all response as a tarball.
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Write(body)
+	})
+
+	cases := map[string]string{
+		"list42": "",
+		"list43": "served by Pixeldrain as a tar archive",
+		"list44": "not a recognised archive",
+	}
+	for id, wantErr := range cases {
+		extract := t.TempDir()
+		r := &runner{log: log.New(io.Discard, "", 0)}
+		r.opts.TmpDir = t.TempDir()
+		src := archiveSource{id: id, url: listZipURL(id), host: "Pixeldrain", pixeldrain: true, list: true}
+		err := r.fetchInto(src, extract, make(map[string]string))
+		if wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: fetchInto returned error: %v", id, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("%s: expected error containing %q, got %v", id, wantErr, err)
+		}
+	}
+}
+
+func TestSelectListItem(t *testing.T) {
+	var list pixeldrainList
+	if err := json.Unmarshal([]byte(`{"files":[{"name":"01 Intro.flac"},{"name":"02 Song.flac"},{"name":"02 Song (Live).flac"},{"name":"Bonus.zip"}]}`), &list); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]int{"1": 0, "4": 3, "02 Song.flac": 1, "bonus": 3, "intro": 0}
+	for selector, want := range cases {
+		got, err := selectListItem(list, selector)
+		if err != nil || got != want {
+			t.Fatalf("selectListItem(%q) = %d, %v; want %d", selector, got, err, want)
+		}
+	}
+	for selector, wantErr := range map[string]string{"0": "out of range", "5": "out of range", "missing": "matches no file", "song": "ambiguous"} {
+		if _, err := selectListItem(list, selector); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("selectListItem(%q) error = %v, want %q", selector, err, wantErr)
+		}
+	}
+}
+
+func TestFetchListItem(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/list/list42":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"title":"Album","files":[{"id":"f1","name":"01 Intro.flac","size":5},{"id":"f2","name":"02 Song.flac","size":4}]}`)
+		case "/file/f2":
+			io.WriteString(w, "song")
+		default:
+			t.Errorf("unexpected request %s", req.URL.Path)
+			http.NotFound(w, req)
+		}
+	})
+
+	extract := t.TempDir()
+	r := &runner{opts: Options{ListItem: "song"}, log: log.New(io.Discard, "", 0)}
+	r.opts.TmpDir = t.TempDir()
+	src := archiveSource{id: "list42", url: listZipURL("list42"), host: "Pixeldrain", pixeldrain: true, list: true}
+	if err := r.fetchInto(src, extract, make(map[string]string)); err != nil {
+		t.Fatalf("fetchInto returned error: %v", err)
+	}
+	if names := dirNames(t, extract); strings.Join(names, ",") != "02 Song.flac" {
+		t.Fatalf("extract dir holds %v, want only the selected file", names)
+	}
+}
+
+func TestListPreviewWithoutArtist(t *testing.T) {
+	var fetched bool
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/list/list42" {
+			t.Errorf("unexpected request %s", req.URL.Path)
+			http.NotFound(w, req)
+			return
+		}
+		fetched = true
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"title":"Album","files":[{"id":"f1","name":"01 Intro.flac","size":5}]}`)
+	})
+
+	// --list needs neither an artist nor a library.
+	r := &runner{opts: Options{URLs: []string{"https://pixeldrain.com/l/list42"}, ListPreview: true}, log: log.New(io.Discard, "", 0)}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	if !fetched {
+		t.Fatalf("--list did not fetch the list")
+	}
+}
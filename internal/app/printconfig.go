@@ -0,0 +1,88 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// secretFields name the Config fields printConfig masks; it only says
+// whether they are set.
+var secretFields = map[string]bool{
+	"PixeldrainToken": true,
+	"SecretAccessKey": true,
+	"SessionToken":    true,
+	"Password":        true,
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// printConfig writes the effective configuration and the parsed options
+// for --print-config, one "Name = value" line per field. It walks the
+// structs by reflection so settings added later show up without changes
+// here. Secrets are masked and credentials are stripped from URLs.
+func printConfig(w io.Writer, cfg config.Config, opts Options) error {
+	var b strings.Builder
+	b.WriteString("# Config (environment and --env-file)\n")
+	writeFields(&b, "", reflect.ValueOf(cfg))
+	b.WriteString("\n# Options (flags)\n")
+	writeFields(&b, "", reflect.ValueOf(opts))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeFields(b *strings.Builder, prefix string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, fv := prefix+f.Name, v.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				fmt.Fprintf(b, "%s = (none)\n", name)
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && !fv.Type().Implements(stringerType) {
+			writeFields(b, name+".", fv)
+			continue
+		}
+		fmt.Fprintf(b, "%s = %s\n", name, formatField(f.Name, fv))
+	}
+}
+
+func formatField(name string, v reflect.Value) string {
+	if secretFields[name] {
+		if v.IsZero() {
+			return "(not set)"
+		}
+		return "(set, masked)"
+	}
+	switch x := v.Interface().(type) {
+	case os.FileMode:
+		if x == 0 {
+			return "(default)"
+		}
+		return fmt.Sprintf("%#o", x)
+	case time.Duration:
+		return x.String()
+	case []string:
+		redacted := make([]string, len(x))
+		for i, s := range x {
+			redacted[i] = redactURL(s)
+		}
+		return fmt.Sprintf("%q", redacted)
+	}
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("%q", redactURL(v.String()))
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
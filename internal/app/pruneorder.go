@@ -0,0 +1,144 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rule groups of the prune pipeline, ranked by --prune-order.
+const (
+	// PruneKeep is --prune-keep.
+	PruneKeep = "keep"
+	// PruneUnneeded is UNNEEDED_FILES plus the size limits.
+	PruneUnneeded = "unneeded"
+	// PruneExcept covers the built-in exceptions: audio found by --sniff
+	// and files referenced by a kept cue sheet (--respect-cue).
+	PruneExcept = "except"
+)
+
+// DefaultPruneOrder lets every protection win over UNNEEDED_FILES.
+var DefaultPruneOrder = []string{PruneKeep, PruneExcept, PruneUnneeded}
+
+// ParsePruneOrder parses a --prune-order value, a comma-separated ranking
+// naming each of keep, unneeded and except exactly once.
+func ParsePruneOrder(raw string) ([]string, error) {
+	var order []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		group := strings.ToLower(strings.TrimSpace(part))
+		switch group {
+		case PruneKeep, PruneUnneeded, PruneExcept:
+		default:
+			return nil, fmt.Errorf("unknown rule group %q (want %s, %s or %s)", part, PruneKeep, PruneUnneeded, PruneExcept)
+		}
+		if seen[group] {
+			return nil, fmt.Errorf("%q listed twice", group)
+		}
+		seen[group] = true
+		order = append(order, group)
+	}
+	if len(order) != 3 {
+		return nil, fmt.Errorf("must rank all of %s, %s and %s, got %q", PruneKeep, PruneUnneeded, PruneExcept, raw)
+	}
+	return order, nil
+}
+
+func (r *runner) pruneOrder() []string {
+	if len(r.opts.PruneOrder) == 0 {
+		return DefaultPruneOrder
+	}
+	return r.opts.PruneOrder
+}
+
+// applyProtections runs the protection groups ranked before unneeded in
+// --prune-order, so that only they can take a path out of the prune set;
+// a group ranked after it never overrides an UNNEEDED_FILES or size match.
+// Each protected path is recorded in plan.keptBy for --prune-debug.
+func (r *runner) applyProtections(extractDir string, plan *prunePlan) error {
+	for _, group := range r.pruneOrder() {
+		var err error
+		switch group {
+		case PruneUnneeded:
+			return nil
+		case PruneKeep:
+			err = plan.recordKept("--prune-keep", func() error { return r.protectKept(extractDir, plan) })
+		case PruneExcept:
+			err = plan.recordKept("--sniff (content is audio)", func() error { return r.protectSniffedAudio(extractDir, plan) })
+			if err == nil && r.opts.RespectCue {
+				err = plan.recordKept("--respect-cue (referenced by a cue sheet)", func() error { return r.protectCueReferences(extractDir, plan.remove) })
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordKept runs protect and notes rule for every path it took out of
+// the prune set.
+func (p *prunePlan) recordKept(rule string, protect func() error) error {
+	before := make([]string, 0, len(p.remove))
+	for path := range p.remove {
+		before = append(before, path)
+	}
+	if err := protect(); err != nil {
+		return err
+	}
+	for _, path := range before {
+		if _, still := p.remove[path]; still {
+			continue
+		}
+		if p.keptBy == nil {
+			p.keptBy = make(map[string]string)
+		}
+		if _, ok := p.keptBy[path]; !ok {
+			p.keptBy[path] = rule
+		}
+	}
+	return nil
+}
+
+// logPruneDecisions implements --prune-debug: one line per file saying
+// which rule decided its fate, its own or that of a folder above it.
+func (r *runner) logPruneDecisions(extractDir string, plan *prunePlan) error {
+	r.log.Printf("prune-debug: order %s", strings.Join(r.pruneOrder(), ","))
+	return filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		r.log.Printf("prune-debug: %s: %s", filepath.ToSlash(rel), plan.decision(extractDir, path))
+		return nil
+	})
+}
+
+// decision describes why path is removed or kept by plan.
+func (p *prunePlan) decision(extractDir, path string) string {
+	for a := path; a != extractDir && a != filepath.Dir(a); a = filepath.Dir(a) {
+		if _, ok := p.remove[a]; ok {
+			return fmt.Sprintf("remove (%s)", describeMatch(p.matchedBy[a], a != path))
+		}
+	}
+	for a := path; a != extractDir && a != filepath.Dir(a); a = filepath.Dir(a) {
+		if rule, ok := p.keptBy[a]; ok {
+			return fmt.Sprintf("keep (%s wins over a prune rule)", rule)
+		}
+	}
+	return "keep (no prune rule matched)"
+}
+
+func describeMatch(rule string, viaFolder bool) string {
+	if !strings.HasPrefix(rule, "--") {
+		rule = fmt.Sprintf("UNNEEDED_FILES %q", rule)
+	}
+	if viaFolder {
+		return rule + " on a parent folder"
+	}
+	return rule
+}
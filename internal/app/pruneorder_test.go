@@ -0,0 +1,88 @@
+package app
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestParsePruneOrder(t *testing.T) {
+	got, err := ParsePruneOrder(" Unneeded, keep ,except")
+	if err != nil || strings.Join(got, ",") != "unneeded,keep,except" {
+		t.Fatalf("ParsePruneOrder = %v, %v", got, err)
+	}
+	for _, bad := range []string{"", "keep,unneeded", "keep,keep,unneeded", "keep,unneeded,except,keep", "keep,unneeded,other"} {
+		if _, err := ParsePruneOrder(bad); err == nil {
+			t.Fatalf("ParsePruneOrder(%q) expected error, got nil", bad)
+		}
+	}
+}
+
+func TestPlanPruneOrder(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"01 Song.flac", "lyrics.txt", "notes.txt", "Extras/Scans/front.jpg", "Extras/readme.txt"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		order []string
+		kept  string
+	}{
+		{nil, "01 Song.flac,Extras/Scans/front.jpg,lyrics.txt"},
+		{[]string{PruneUnneeded, PruneKeep, PruneExcept}, "01 Song.flac"},
+	}
+	for _, tt := range tests {
+		var logs bytes.Buffer
+		r := &runner{
+			cfg:  config.Config{UnneededPatterns: []string{"*.txt", "Extras"}},
+			opts: Options{PruneKeep: []string{"lyrics.txt", "**/Scans"}, PruneOrder: tt.order, PruneDebug: true},
+			log:  log.New(&logs, "", 0),
+		}
+		plan, err := r.planPrune(root)
+		if err != nil {
+			t.Fatalf("order %v: planPrune returned error: %v", tt.order, err)
+		}
+		var kept []string
+		for _, name := range []string{"01 Song.flac", "Extras/Scans/front.jpg", "Extras/readme.txt", "lyrics.txt", "notes.txt"} {
+			if strings.HasPrefix(plan.decision(root, filepath.Join(root, filepath.FromSlash(name))), "keep") {
+				kept = append(kept, name)
+			}
+		}
+		if got := strings.Join(kept, ","); got != tt.kept {
+			t.Fatalf("order %v: kept %q, want %q\n%s", tt.order, got, tt.kept, logs.String())
+		}
+	}
+
+	// The debug log names the rule that decided each file.
+	var logs bytes.Buffer
+	r := &runner{
+		cfg:  config.Config{UnneededPatterns: []string{"*.txt", "Extras"}},
+		opts: Options{PruneKeep: []string{"lyrics.txt"}, PruneDebug: true},
+		log:  log.New(&logs, "", 0),
+	}
+	if _, err := r.planPrune(root); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"prune-debug: order keep,except,unneeded",
+		"prune-debug: lyrics.txt: keep (--prune-keep wins over a prune rule)",
+		`prune-debug: notes.txt: remove (UNNEEDED_FILES "*.txt")`,
+		`prune-debug: Extras/Scans/front.jpg: remove (UNNEEDED_FILES "Extras" on a parent folder)`,
+		"prune-debug: 01 Song.flac: keep (no prune rule matched)",
+	} {
+		if !strings.Contains(logs.String(), want+"\n") {
+			t.Fatalf("debug log missing %q:\n%s", want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// audioQuality is what the quality filter knows about a track; zero fields
+// are unknown.
+type audioQuality struct {
+	bitrate    int // average kbps
+	sampleRate int // Hz
+}
+
+// losslessExtensions and lossyExtensions classify audio for
+// --drop-lossy-if-lossless. ".m4a" can hold either AAC or ALAC, so it is in
+// neither and never dropped as lossy.
+var (
+	losslessExtensions = map[string]bool{".flac": true, ".wav": true, ".aiff": true, ".alac": true, ".wv": true, ".ape": true}
+	lossyExtensions    = map[string]bool{".mp3": true, ".aac": true, ".ogg": true, ".opus": true}
+)
+
+// readAudioQuality reads the bitrate and sample rate of a FLAC (STREAMINFO)
+// or MP3 (first frame header, Xing/Info or VBRI for VBR) file. Other formats
+// yield a zero audioQuality.
+func readAudioQuality(path string) (audioQuality, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return audioQuality{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return audioQuality{}, err
+	}
+
+	head := make([]byte, maxTagBytes)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return audioQuality{}, err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return flacQuality(head[4:], info.Size()), nil
+	case strings.EqualFold(filepath.Ext(path), ".mp3"):
+		return mp3Quality(head, info.Size()), nil
+	}
+	return audioQuality{}, nil
+}
+
+// flacQuality reads sample rate and total samples from the STREAMINFO block,
+// which FLAC requires to come first, and derives the average bitrate.
+func flacQuality(data []byte, size int64) audioQuality {
+	if len(data) < 4+18 || data[0]&0x7f != 0 {
+		return audioQuality{}
+	}
+	// After min/max block and frame sizes: 20 bits sample rate, 3 bits
+	// channels, 5 bits bits-per-sample, 36 bits total samples.
+	packed := binary.BigEndian.Uint64(data[4+10 : 4+18])
+	q := audioQuality{sampleRate: int(packed >> 44)}
+	if samples := packed & (1<<36 - 1); samples > 0 && q.sampleRate > 0 {
+		seconds := float64(samples) / float64(q.sampleRate)
+		q.bitrate = int(float64(size) * 8 / seconds / 1000)
+	}
+	return q
+}
+
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}, // MPEG-1 Layer III
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},     // MPEG-2/2.5 Layer III
+	}
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3Frame is a decoded MPEG audio Layer III frame header.
+type mp3Frame struct {
+	mpeg1      bool
+	mono       bool
+	bitrate    int // kbps
+	sampleRate int
+	length     int // bytes, header included
+}
+
+// parseMP3Frame decodes the 4-byte frame header at the start of b.
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return mp3Frame{}, false
+	}
+	version := b[1] >> 3 & 3 // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+	layer := b[1] >> 1 & 3   // 1 = Layer III
+	brIndex, srIndex := b[2]>>4, b[2]>>2&3
+	if version == 1 || layer != 1 || srIndex == 3 {
+		return mp3Frame{}, false
+	}
+	fr := mp3Frame{mpeg1: version == 3, mono: b[3]>>6 == 3, sampleRate: mp3SampleRates[srIndex]}
+	table := 0
+	switch version {
+	case 2:
+		fr.sampleRate /= 2
+		table = 1
+	case 0:
+		fr.sampleRate /= 4
+		table = 1
+	}
+	fr.bitrate = mp3Bitrates[table][brIndex]
+	if fr.bitrate == 0 {
+		return mp3Frame{}, false
+	}
+	coefficient := 144
+	if !fr.mpeg1 {
+		coefficient = 72
+	}
+	fr.length = coefficient*fr.bitrate*1000/fr.sampleRate + int(b[2]>>1&1)
+	return fr, true
+}
+
+// mp3Quality finds the first frame after any ID3v2 tag, confirmed by the
+// frame that follows it. A Xing/Info or VBRI header in that frame gives the
+// frame count, from which the average bitrate of VBR files is derived;
+// otherwise the frame's own bitrate is used.
+func mp3Quality(data []byte, size int64) audioQuality {
+	start := 0
+	if len(data) >= 10 && bytes.HasPrefix(data, []byte("ID3")) {
+		start = 10 + int(syncsafe(data[6:10]))
+		if data[5]&0x10 != 0 {
+			start += 10 // footer
+		}
+	}
+	for i := start; i+4 <= len(data); i++ {
+		fr, ok := parseMP3Frame(data[i:])
+		if !ok {
+			continue
+		}
+		if next := i + fr.length; next+4 <= len(data) {
+			if _, ok := parseMP3Frame(data[next:]); !ok {
+				continue
+			}
+		}
+		q := audioQuality{bitrate: fr.bitrate, sampleRate: fr.sampleRate}
+		if frames := vbrFrames(data[i:], fr); frames > 0 {
+			samplesPerFrame := 1152
+			if !fr.mpeg1 {
+				samplesPerFrame = 576
+			}
+			seconds := float64(frames) * float64(samplesPerFrame) / float64(fr.sampleRate)
+			q.bitrate = int(float64(size-int64(i)) * 8 / seconds / 1000)
+		}
+		return q
+	}
+	return audioQuality{}
+}
+
+// vbrFrames returns the frame count of a Xing/Info or VBRI header in the
+// frame at the start of b, or 0.
+func vbrFrames(b []byte, fr mp3Frame) uint32 {
+	sideInfo := 32
+	switch {
+	case fr.mpeg1 && fr.mono, !fr.mpeg1 && !fr.mono:
+		sideInfo = 17
+	case !fr.mpeg1 && fr.mono:
+		sideInfo = 9
+	}
+	if x := b[min(len(b), 4+sideInfo):]; len(x) >= 12 && (bytes.HasPrefix(x, []byte("Xing")) || bytes.HasPrefix(x, []byte("Info"))) {
+		if binary.BigEndian.Uint32(x[4:8])&1 != 0 {
+			return binary.BigEndian.Uint32(x[8:12])
+		}
+		return 0
+	}
+	if v := b[min(len(b), 4+32):]; len(v) >= 18 && bytes.HasPrefix(v, []byte("VBRI")) {
+		return binary.BigEndian.Uint32(v[14:18])
+	}
+	return 0
+}
+
+// pruneLowQuality drops audio below --min-bitrate (lossy files only) or
+// --min-sample-rate, and with --drop-lossy-if-lossless the lossy audio of
+// any folder that also holds lossless audio. Files whose quality cannot be
+// read are kept and logged. Each drop is logged with its reason.
+func (r *runner) pruneLowQuality(extractDir string) error {
+	if r.opts.MinBitrate <= 0 && r.opts.MinSampleRate <= 0 && !r.opts.DropLossyIfLossless {
+		return nil
+	}
+
+	var fileCount int
+	var audio []string
+	hasLossless := make(map[string]bool)
+	err := filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fileCount++
+		if isAudio(d.Name()) {
+			audio = append(audio, path)
+			if losslessExtensions[strings.ToLower(filepath.Ext(path))] {
+				hasLossless[filepath.Dir(path)] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	for _, path := range audio {
+		reason, err := r.lowQualityReason(path, hasLossless[filepath.Dir(path)])
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			r.log.Printf("Low quality: dropping %s (%s)", path, reason)
+			removed = append(removed, path)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if fileCount-len(removed) <= 0 {
+		return fmt.Errorf("quality filter would remove all %d files; aborting", fileCount)
+	}
+	sort.Strings(removed)
+
+	if err := r.removePruned(removed); err != nil {
+		return err
+	}
+	r.log.Printf("Pruned %d low-quality audio file(s)", len(removed))
+	return nil
+}
+
+// lowQualityReason explains why the quality filter drops path, or returns ""
+// to keep it.
+func (r *runner) lowQualityReason(path string, lossless bool) (string, error) {
+	lossy := lossyExtensions[strings.ToLower(filepath.Ext(path))]
+	if r.opts.DropLossyIfLossless && lossy && lossless {
+		return "lossy, folder has lossless audio", nil
+	}
+	if r.opts.MinBitrate <= 0 && r.opts.MinSampleRate <= 0 {
+		return "", nil
+	}
+	q, err := readAudioQuality(path)
+	if err != nil {
+		return "", fmt.Errorf("read audio format of %q: %w", path, err)
+	}
+	if lossy && r.opts.MinBitrate > 0 && q.bitrate > 0 && q.bitrate < r.opts.MinBitrate {
+		return fmt.Sprintf("%d kbps < --min-bitrate %d", q.bitrate, r.opts.MinBitrate), nil
+	}
+	if r.opts.MinSampleRate > 0 && q.sampleRate > 0 && q.sampleRate < r.opts.MinSampleRate {
+		return fmt.Sprintf("%d Hz < --min-sample-rate %d", q.sampleRate, r.opts.MinSampleRate), nil
+	}
+	// Only MP3 and FLAC are read; say so rather than keep other formats
+	// silently.
+	var unknown []string
+	if r.opts.MinBitrate > 0 && q.bitrate == 0 && !losslessExtensions[strings.ToLower(filepath.Ext(path))] {
+		unknown = append(unknown, "bitrate")
+	}
+	if r.opts.MinSampleRate > 0 && q.sampleRate == 0 {
+		unknown = append(unknown, "sample rate")
+	}
+	if len(unknown) > 0 {
+		r.log.Printf("Quality unknown: keeping %s (%s not readable; only MP3 and FLAC are checked)", path, strings.Join(unknown, " and "))
+	}
+	return "", nil
+}
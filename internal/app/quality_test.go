@@ -0,0 +1,115 @@
+package app
+
+import (
+	"encoding/binary"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mp3Data returns n MPEG-1 Layer III stereo frames at 44.1 kHz with the given
+// bitrate index (9 = 128 kbps, 14 = 320 kbps).
+func mp3Data(brIndex byte, n int) []byte {
+	header := []byte{0xff, 0xfb, brIndex << 4, 0x00}
+	fr, _ := parseMP3Frame(header)
+	var data []byte
+	for i := 0; i < n; i++ {
+		frame := make([]byte, fr.length)
+		copy(frame, header)
+		data = append(data, frame...)
+	}
+	return data
+}
+
+// flacData returns a FLAC stream header with the given sample rate and total
+// samples, padded to size bytes.
+func flacData(sampleRate, samples uint64, size int) []byte {
+	data := append([]byte("fLaC"), 0x80, 0, 0, 34)
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint64(info[10:18], sampleRate<<44|1<<41|15<<36|samples)
+	data = append(data, info...)
+	return append(data, make([]byte, size-len(data))...)
+}
+
+func TestReadAudioQuality(t *testing.T) {
+	dir := t.TempDir()
+	vbr := mp3Data(14, 3)
+	// A Xing header in the first frame claiming 100 frames (about 2.6s).
+	copy(vbr[4+32:], append([]byte("Xing"), 0, 0, 0, 1, 0, 0, 0, 100))
+	files := map[string][]byte{
+		"cbr.mp3":   append([]byte("ID3\x03\x00\x00\x00\x00\x00\x05tag!!"), mp3Data(9, 3)...),
+		"vbr.mp3":   vbr,
+		"low.flac":  flacData(22050, 22050*10, 10*22050*2),
+		"other.m4a": []byte("ftypM4A "),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]audioQuality{
+		"cbr.mp3":   {bitrate: 128, sampleRate: 44100},
+		"vbr.mp3":   {bitrate: 9, sampleRate: 44100},
+		"low.flac":  {bitrate: 352, sampleRate: 22050},
+		"other.m4a": {},
+	}
+	for name, want := range cases {
+		got, err := readAudioQuality(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("readAudioQuality(%s) returned error: %v", name, err)
+		}
+		if got != want {
+			t.Fatalf("readAudioQuality(%s) = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestPruneLowQuality(t *testing.T) {
+	root := t.TempDir()
+	files := map[string][]byte{
+		"A/01.mp3":    mp3Data(9, 3),  // 128 kbps
+		"A/02.mp3":    mp3Data(14, 3), // 320 kbps
+		"B/01.flac":   flacData(44100, 44100, 1000),
+		"B/01.mp3":    mp3Data(14, 3),
+		"C/01.flac":   flacData(22050, 22050, 1000),
+		"C/notes.txt": []byte("text"),
+		"D/01.ogg":    []byte("OggS"),
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logs strings.Builder
+	r := &runner{
+		opts: Options{MinBitrate: 256, MinSampleRate: 44100, DropLossyIfLossless: true},
+		log:  log.New(&logs, "", 0),
+	}
+	if err := r.pruneLowQuality(root); err != nil {
+		t.Fatalf("pruneLowQuality returned error: %v", err)
+	}
+	if want := "Quality unknown: keeping " + filepath.Join(root, "D", "01.ogg") + " (bitrate and sample rate not readable"; !strings.Contains(logs.String(), want) {
+		t.Fatalf("log lacks %q:\n%s", want, logs.String())
+	}
+	for name := range files {
+		_, err := os.Stat(filepath.Join(root, name))
+		dropped := name == "A/01.mp3" || name == "B/01.mp3" || name == "C/01.flac"
+		if dropped != os.IsNotExist(err) {
+			t.Fatalf("%s: dropped=%v, stat err=%v", name, dropped, err)
+		}
+	}
+
+	// Dropping every remaining file aborts.
+	r.opts = Options{MinBitrate: 500}
+	if err := r.pruneLowQuality(filepath.Join(root, "A")); err == nil {
+		t.Fatalf("expected pruneLowQuality to abort when removing all files")
+	}
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// replayGainTools are the external scanners --replaygain looks for, in
+// order of preference, with the arguments that compute track and album
+// gain for one album and write the tags, and those for track gain only.
+var replayGainTools = []struct {
+	name  string
+	album []string
+	track []string
+}{
+	{"rsgain", []string{"custom", "--album", "--tagmode=i"}, []string{"custom", "--tagmode=i"}},
+	{"loudgain", []string{"-a", "-k", "-s", "e"}, []string{"-k", "-s", "e"}},
+}
+
+// lookPath and runTool are replaced in tests.
+var (
+	lookPath = exec.LookPath
+	runTool  = func(r *runner, name string, args ...string) ([]byte, error) {
+		return exec.CommandContext(r.context(), name, args...).CombinedOutput()
+	}
+)
+
+// replayGain runs --replaygain after the move: the FLAC and MP3 files
+// imported from extractDir are grouped by destination folder and each
+// folder is scanned as one album by rsgain or loudgain. Files that already
+// carry ReplayGain tags are left out; album gain is only written when the
+// scan covers every track of the folder, otherwise each file gets track gain
+// alone. A missing tool, a remote library, an unreadable file or a failing
+// scan only logs a warning; the import itself has succeeded.
+func (r *runner) replayGain(extractDir, dest string) error {
+	if _, local := r.library().(osFS); !local {
+		r.log.Printf("warning: --replaygain cannot scan an sftp://, s3:// or davs:// library; skipping")
+		return nil
+	}
+	tool, album, track := "", []string(nil), []string(nil)
+	for _, t := range replayGainTools {
+		if path, err := lookPath(t.name); err == nil {
+			tool, album, track = path, t.album, t.track
+			break
+		}
+	}
+	if tool == "" {
+		r.log.Printf("warning: --replaygain needs rsgain or loudgain on PATH; skipping")
+		return nil
+	}
+
+	albums := make(map[string][]string)
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, skip := r.collisionSkipped[path]; skip {
+			return nil
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			return nil
+		}
+		if ext := strings.ToLower(filepath.Ext(d.Name())); ext != ".flac" && ext != ".mp3" {
+			return nil
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, r.destRel(rel, false))
+		albums[filepath.Dir(target)] = append(albums[filepath.Dir(target)], target)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dirs := make([]string, 0, len(albums))
+	for dir := range albums {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if r.opts.DryRun {
+			r.log.Printf("dry-run: would scan ReplayGain for %d file(s) in %s with %s", len(albums[dir]), dir, filepath.Base(tool))
+			continue
+		}
+		var files []string
+		for _, path := range albums[dir] {
+			tagged, err := hasReplayGain(path)
+			if err != nil {
+				r.log.Printf("warning: ReplayGain: %v; skipping that file", err)
+				continue
+			}
+			if !tagged {
+				files = append(files, path)
+			}
+		}
+		if len(files) == 0 {
+			r.log.Printf("ReplayGain: %s already tagged; skipping", dir)
+			continue
+		}
+		args := album
+		if !wholeAlbum(dir, len(files)) {
+			// Album gain over part of an album would not match the tags
+			// of the other tracks.
+			args = track
+			r.log.Printf("ReplayGain: %s has tracks outside this scan; writing track gain only", dir)
+		}
+		if out, err := runTool(r, tool, append(append([]string(nil), args...), files...)...); err != nil {
+			r.log.Printf("warning: ReplayGain scan of %s failed: %v: %s", dir, err, strings.TrimSpace(string(out)))
+			continue
+		}
+		r.log.Printf("ReplayGain: tagged %d file(s) in %s", len(files), dir)
+	}
+	return nil
+}
+
+// wholeAlbum reports whether dir holds exactly n FLAC and MP3 files, i.e.
+// whether n files scanned there are the whole album.
+func wholeAlbum(dir string, n int) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	var audio int
+	for _, e := range entries {
+		if ext := strings.ToLower(filepath.Ext(e.Name())); !e.IsDir() && (ext == ".flac" || ext == ".mp3") {
+			audio++
+		}
+	}
+	return audio == n
+}
+
+// hasReplayGain reports whether the tag area at the start of an audio file
+// (ID3v2 TXXX frames, FLAC Vorbis comments) holds a track gain.
+func hasReplayGain(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, maxTagBytes)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("read %q: %w", path, err)
+	}
+	return bytes.Contains(bytes.ToUpper(head[:n]), []byte("REPLAYGAIN_TRACK_GAIN")), nil
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplayGainScansUntaggedFilesPerAlbum(t *testing.T) {
+	extract := t.TempDir()
+	dest := t.TempDir()
+	files := map[string]string{
+		"A/01.flac":   "fLaC plain",
+		"A/02.flac":   "fLaC replaygain_track_gain=-6.5 dB",
+		"A/cover.jpg": "img",
+		"B/01.mp3":    "ID3 plain",
+		"C/01.flac":   "fLaC REPLAYGAIN_TRACK_GAIN=-1 dB",
+	}
+	for name, content := range files {
+		for _, root := range []string{extract, dest} {
+			path := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	origLook, origRun := lookPath, runTool
+	t.Cleanup(func() { lookPath, runTool = origLook, origRun })
+	lookPath = func(name string) (string, error) {
+		if name == "loudgain" {
+			return "/usr/bin/loudgain", nil
+		}
+		return "", errors.New("not found")
+	}
+	var calls [][]string
+	runTool = func(_ *runner, name string, args ...string) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return nil, nil
+	}
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	if err := r.replayGain(extract, dest); err != nil {
+		t.Fatalf("replayGain returned error: %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected one scan each for A and B, got %v", calls)
+	}
+	got := strings.Join(calls[0], " ")
+	// A/02.flac is tagged already, so album gain over A/01.flac alone
+	// would be wrong.
+	want := "/usr/bin/loudgain -k -s e " + filepath.Join(dest, "A", "01.flac")
+	if got != want {
+		t.Fatalf("first scan = %q, want %q", got, want)
+	}
+	want = "/usr/bin/loudgain -a -k -s e " + filepath.Join(dest, "B", "01.mp3")
+	if got := strings.Join(calls[1], " "); got != want {
+		t.Fatalf("second scan = %q, want album gain %q", got, want)
+	}
+}
+
+func TestReplayGainSkipsUnreadableFiles(t *testing.T) {
+	extract := t.TempDir()
+	dest := t.TempDir()
+	for _, root := range []string{extract, dest} {
+		if err := os.MkdirAll(filepath.Join(root, "A"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "A", "01.flac"), []byte("fLaC plain"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A directory in the library where 02.flac should be cannot be read
+	// as one.
+	if err := os.WriteFile(filepath.Join(extract, "A", "02.flac"), []byte("fLaC plain"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dest, "A", "02.flac"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	origLook, origRun := lookPath, runTool
+	t.Cleanup(func() { lookPath, runTool = origLook, origRun })
+	lookPath = func(name string) (string, error) { return "/usr/bin/" + name, nil }
+	var calls [][]string
+	runTool = func(_ *runner, name string, args ...string) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return nil, nil
+	}
+
+	var out strings.Builder
+	r := &runner{log: log.New(&out, "", 0)}
+	if err := r.replayGain(extract, dest); err != nil {
+		t.Fatalf("replayGain returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "warning: ReplayGain:") {
+		t.Fatalf("expected a warning for the unreadable file, got %q", out.String())
+	}
+	if len(calls) != 1 || calls[0][len(calls[0])-1] != filepath.Join(dest, "A", "01.flac") {
+		t.Fatalf("expected a scan of A/01.flac alone, got %v", calls)
+	}
+}
+
+func TestReplayGainWithoutToolWarns(t *testing.T) {
+	origLook := lookPath
+	t.Cleanup(func() { lookPath = origLook })
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+
+	var out strings.Builder
+	r := &runner{log: log.New(&out, "", 0)}
+	if err := r.replayGain(t.TempDir(), t.TempDir()); err != nil {
+		t.Fatalf("replayGain returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "warning: --replaygain needs rsgain or loudgain") {
+		t.Fatalf("expected a missing-tool warning, got %q", out.String())
+	}
+}
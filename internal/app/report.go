@@ -0,0 +1,172 @@
+package app
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"cli-navidrome-helper/internal/version"
+)
+
+// reportRecord is one JSON line appended to --report-file per import.
+type reportRecord struct {
+	Timestamp   time.Time     `json:"timestamp"`
+	ImportID    string        `json:"import_id,omitempty"`
+	Artist      string        `json:"artist"`
+	URL         string        `json:"url"`
+	URLs        []string      `json:"urls,omitempty"`
+	Destination string        `json:"destination,omitempty"`
+	DryRun      bool          `json:"dry_run"`
+	Validate    bool          `json:"validate,omitempty"`
+	Result      string        `json:"result"`
+	Error       string        `json:"error,omitempty"`
+	Stats       *statsSummary `json:"stats,omitempty"`
+	Build       version.Info  `json:"build"`
+}
+
+// statsSummary is the serializable form of runStats.
+type statsSummary struct {
+	DownloadBytes    int64                       `json:"download_bytes"`
+	EstimatedBytes   int64                       `json:"estimated_download_bytes,omitempty"`
+	ExtractedEntries int                         `json:"extracted_entries"`
+	Pruned           int                         `json:"pruned"`
+	MovedFiles       int                         `json:"moved_files"`
+	Extensions       map[string]extensionSummary `json:"extensions,omitempty"`
+	// PhaseMillis maps phase names (resolve, download, extract, prune, move)
+	// to their wall-clock duration.
+	PhaseMillis        map[string]int64 `json:"phase_ms,omitempty"`
+	TotalMillis        int64            `json:"total_ms,omitempty"`
+	DownloadThroughput int64            `json:"download_bytes_per_sec,omitempty"`
+}
+
+type extensionSummary struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (s *runStats) summary() *statsSummary {
+	out := &statsSummary{
+		DownloadBytes:    s.downloadBytes,
+		EstimatedBytes:   s.estimatedBytes,
+		ExtractedEntries: s.extractedEntries,
+		Pruned:           s.pruned,
+		MovedFiles:       s.movedFiles,
+	}
+	if len(s.phases) > 0 {
+		out.PhaseMillis = make(map[string]int64, len(s.phases))
+		for _, p := range s.phases {
+			out.PhaseMillis[p.name] = p.duration.Milliseconds()
+		}
+	}
+	out.TotalMillis = s.total.Milliseconds()
+	out.DownloadThroughput = int64(s.downloadThroughput())
+	if len(s.extensions) > 0 {
+		out.Extensions = make(map[string]extensionSummary, len(s.extensions))
+		for ext, es := range s.extensions {
+			out.Extensions[ext] = extensionSummary{Files: es.files, Bytes: es.bytes}
+		}
+	}
+	return out
+}
+
+// newReportRecord describes the outcome of an import. r is nil when the run
+// failed before a runner was created (e.g. invalid configuration).
+func newReportRecord(started time.Time, opts Options, r *runner, runErr error) reportRecord {
+	rec := reportRecord{
+		Timestamp: started.UTC(),
+		ImportID:  opts.ImportID,
+		Artist:    opts.Artist,
+		DryRun:    opts.DryRun,
+		Validate:  opts.Validate,
+		Result:    "success",
+		Build:     version.Get(),
+	}
+	for _, u := range opts.URLs {
+		rec.URLs = append(rec.URLs, redactURL(u))
+	}
+	if len(rec.URLs) > 0 {
+		rec.URL = rec.URLs[0]
+	}
+	if len(rec.URLs) == 1 {
+		rec.URLs = nil
+	}
+	if runErr != nil {
+		rec.Result = "failure"
+		rec.Error = runErr.Error()
+	}
+	if r != nil {
+		if r.artistDir != "" {
+			rec.Destination = r.destinationPath()
+		}
+		rec.Stats = r.stats.summary()
+	}
+	return rec
+}
+
+// appendReport writes rec as a single JSON line at the end of path,
+// creating the file if needed.
+func appendReport(path string, rec reportRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode report: %w", err)
+	}
+	f, err := openAppend(path)
+	if err != nil {
+		return fmt.Errorf("open report file %q: %w", path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write report file %q: %w", path, err)
+	}
+	return f.Close()
+}
+
+// writeSummaryFile replaces path with v as indented JSON. The data goes to
+// a temp file renamed over path, so a reader never sees half a summary.
+func writeSummaryFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode summary: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write summary file %q: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write summary file %q: %w", path, err)
+	}
+	return nil
+}
+
+// openAppend opens path for appending, creating it if needed. When path ends
+// in .gz everything written until Close becomes one more gzip member;
+// gzip readers (zcat, compress/gzip) read concatenated members as a single
+// stream, so the file stays a valid, growing JSON-lines log.
+func openAppend(path string) (io.WriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(path), ".gz") {
+		return f, nil
+	}
+	return gzipAppender{gzip.NewWriter(f), f}, nil
+}
+
+type gzipAppender struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g gzipAppender) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.f.Close()
+		return err
+	}
+	return g.f.Close()
+}
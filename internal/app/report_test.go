@@ -0,0 +1,129 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestAppendReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "imports.jsonl")
+	opts := Options{Artist: "Artist", URLs: []string{"abc123"}}
+
+	r := &runner{cfg: config.Config{NavidromeMusicPath: "/music"}, opts: opts, artistDir: "Artist"}
+	r.stats.movedFiles = 3
+	r.stats.recordExtension("01.flac", 100)
+
+	if err := appendReport(path, newReportRecord(time.Now(), opts, r, nil)); err != nil {
+		t.Fatalf("appendReport returned error: %v", err)
+	}
+	if err := appendReport(path, newReportRecord(time.Now(), opts, nil, errors.New("boom"))); err != nil {
+		t.Fatalf("appendReport returned error: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []reportRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec reportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	ok := records[0]
+	if ok.Result != "success" || ok.Destination != filepath.Join("/music", "Artist") {
+		t.Fatalf("unexpected success record: %+v", ok)
+	}
+	if ok.Stats == nil || ok.Stats.MovedFiles != 3 || ok.Stats.Extensions[".flac"].Files != 1 {
+		t.Fatalf("unexpected stats: %+v", ok.Stats)
+	}
+
+	failed := records[1]
+	if failed.Result != "failure" || failed.Error != "boom" || failed.Stats != nil {
+		t.Fatalf("unexpected failure record: %+v", failed)
+	}
+}
+
+func TestAppendReportGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "imports.jsonl.gz")
+	for _, artist := range []string{"First", "Second"} {
+		opts := Options{Artist: artist, URLs: []string{"abc123"}}
+		if err := appendReport(path, newReportRecord(time.Now(), opts, nil, nil)); err != nil {
+			t.Fatalf("appendReport returned error: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("report is not gzip: %v", err)
+	}
+	var artists []string
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var rec reportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		artists = append(artists, rec.Artist)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(artists) != 2 || artists[0] != "First" || artists[1] != "Second" {
+		t.Fatalf("decompressed records = %v, want First then Second", artists)
+	}
+}
+
+func TestFinishImportSummaryJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.json")
+	opts := Options{Artist: "Artist", URLs: []string{"abc123"}, SummaryJSONFile: path}
+
+	r := &runner{cfg: config.Config{NavidromeMusicPath: "/music"}, opts: opts, artistDir: "Artist"}
+	r.stats.downloadBytes = 2048
+	runErr := errors.New("move failed")
+	if err := finishImport(time.Now(), opts, r, runErr); !errors.Is(err, runErr) {
+		t.Fatalf("finishImport returned %v, want the import error", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("summary file not written on failure: %v", err)
+	}
+	var rec reportRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("summary file is not a JSON object: %v\n%s", err, data)
+	}
+	if rec.Result != "failure" || rec.Error != "move failed" || rec.Stats == nil || rec.Stats.DownloadBytes != 2048 {
+		t.Fatalf("unexpected summary: %+v", rec)
+	}
+
+	if err := finishImport(time.Now(), opts, r, nil); err != nil {
+		t.Fatalf("finishImport returned error: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if err := json.Unmarshal(data, &rec); err != nil || rec.Result != "success" {
+		t.Fatalf("summary not replaced by the latest import: %s", data)
+	}
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// partialRetry is the --retry-partial file written when some files of a
+// Pixeldrain list could not be fetched while the rest were imported. It
+// holds what is needed to fetch just those files into the same destination.
+// A --batch run with failed lines writes one holding just Batch, which
+// re-runs those lines as a batch.
+type partialRetry struct {
+	Artist  string              `json:"artist,omitempty"`
+	Subpath string              `json:"subpath,omitempty"`
+	Host    string              `json:"host,omitempty"`
+	Files   []partialFile       `json:"files,omitempty"`
+	Batch   []partialBatchEntry `json:"batch,omitempty"`
+}
+
+type partialFile struct {
+	List  string `json:"list"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// partialBatchEntry is a failed --batch line. The URL keeps any embedded
+// credentials, so the retry file is only readable by its owner.
+type partialBatchEntry struct {
+	Line   int    `json:"line"`
+	Artist string `json:"artist"`
+	URL    string `json:"url"`
+	Error  string `json:"error"`
+}
+
+// recordPartial notes a list file that failed so the import can go on
+// without it.
+func (r *runner) recordPartial(member archiveSource, err error) {
+	r.log.Printf("warning: %v; continuing with the other files", err)
+	if r.partial == nil {
+		r.partial = &partialRetry{Artist: r.opts.Artist, Subpath: r.opts.Subpath, Host: member.host}
+	}
+	r.partial.Files = append(r.partial.Files, partialFile{List: member.listID, ID: member.id, Name: member.member, Error: err.Error()})
+}
+
+// loadRetryPartial reads the --retry-partial file. Its artist and subpath
+// apply unless --artist or --subpath are given.
+func (r *runner) loadRetryPartial() error {
+	retry, err := readRetryFile(r.opts.RetryPartial)
+	if err != nil {
+		return err
+	}
+	if len(retry.Files) == 0 {
+		return fmt.Errorf("--retry-partial %s lists no files", r.opts.RetryPartial)
+	}
+	if r.opts.Artist == "" {
+		r.opts.Artist = retry.Artist
+	}
+	if r.opts.Subpath == "" {
+		r.opts.Subpath = retry.Subpath
+	}
+	r.retry = &retry
+	return nil
+}
+
+func readRetryFile(path string) (partialRetry, error) {
+	var retry partialRetry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return retry, fmt.Errorf("read --retry-partial: %w", err)
+	}
+	if err := json.Unmarshal(data, &retry); err != nil {
+		return retry, fmt.Errorf("parse --retry-partial %s: %w", path, err)
+	}
+	return retry, nil
+}
+
+// retryBatchEntries returns the failed batch lines of a --retry-partial
+// file, or nil when it records list files instead.
+func retryBatchEntries(path string) ([]batchEntry, error) {
+	retry, err := readRetryFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []batchEntry
+	for _, e := range retry.Batch {
+		entries = append(entries, batchEntry{Line: e.Line, Artist: e.Artist, URL: e.URL})
+	}
+	return entries, nil
+}
+
+// retrySources turns the --retry-partial files back into list members.
+func (r *runner) retrySources() []archiveSource {
+	sources := make([]archiveSource, 0, len(r.retry.Files))
+	for _, f := range r.retry.Files {
+		sources = append(sources, archiveSource{id: f.ID, url: fileDownloadURL(f.ID), host: r.retry.Host, pixeldrain: true, listID: f.List, member: f.Name})
+		r.log.Printf("Retrying file %q of list %s", f.Name, f.List)
+	}
+	return sources
+}
+
+// writePartialRetry saves the failed list files to a retry file in the temp
+// base and returns the error that makes the run fail and names the file.
+func (r *runner) writePartialRetry() error {
+	path, err := writeRetryFile(r.tmpBase(), r.partial)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%d list file(s) failed; re-run just those with --retry-partial %s", len(r.partial.Files), path)
+}
+
+// writeRetryFile saves retry as nd-import-retry-<timestamp>.json in tmpDir
+// (or the system temp dir), numbering the name when a batch line and the
+// batch itself fail within the same second.
+func writeRetryFile(tmpDir string, retry *partialRetry) (string, error) {
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+	data, err := json.MarshalIndent(retry, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	stamp := time.Now().Format("20060102-150405")
+	for n := 1; ; n++ {
+		name := "nd-import-retry-" + stamp + ".json"
+		if n > 1 {
+			name = fmt.Sprintf("nd-import-retry-%s-%d.json", stamp, n)
+		}
+		path := filepath.Join(tmpDir, name)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("write retry file: %w", err)
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			return "", fmt.Errorf("write retry file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return "", fmt.Errorf("write retry file: %w", err)
+		}
+		return path, nil
+	}
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestRetryPartialListFiles(t *testing.T) {
+	origSleep := sleep
+	sleep = func(context.Context, time.Duration) error { return nil }
+	t.Cleanup(func() { sleep = origSleep })
+
+	var f2Broken atomic.Bool
+	f2Broken.Store(true)
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/list/list42/zip":
+			http.Error(w, "zip unavailable", http.StatusInternalServerError)
+		case "/list/list42":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"title":"Album","files":[{"id":"f1","name":"01 Intro.flac","size":5},{"id":"f2","name":"02 Song.flac","size":4}]}`)
+		case "/file/f1":
+			io.WriteString(w, "intro")
+		case "/file/f2":
+			if f2Broken.Load() {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, "song")
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	library := t.TempDir()
+	tmp := t.TempDir()
+	cfg := config.Config{NavidromeMusicPath: library}
+	r := newRunner(cfg, Options{Artist: "Artist", Subpath: "Live", URLs: []string{"https://pixeldrain.com/l/list42"}, TmpDir: tmp, NoCache: true})
+	err := r.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 list file(s) failed; re-run just those with --retry-partial") {
+		t.Fatalf("expected a partial failure naming the retry file, got %v", err)
+	}
+	dest := filepath.Join(library, "Artist", "Live")
+	if names := dirNames(t, dest); strings.Join(names, ",") != "01 Intro.flac" {
+		t.Fatalf("library holds %v, want the files that succeeded", names)
+	}
+	retries, _ := filepath.Glob(filepath.Join(tmp, "nd-import-retry-*.json"))
+	if len(retries) != 1 {
+		t.Fatalf("expected one retry file, got %v", retries)
+	}
+
+	// The retry fetches only the failed file, into the same destination.
+	f2Broken.Store(false)
+	r = newRunner(cfg, Options{RetryPartial: retries[0], TmpDir: t.TempDir()})
+	if err := r.Execute(); err != nil {
+		t.Fatalf("retry returned error: %v", err)
+	}
+	if names := dirNames(t, dest); strings.Join(names, ",") != "01 Intro.flac,02 Song.flac" {
+		t.Fatalf("library holds %v after the retry", names)
+	}
+	if r.stats.movedFiles != 1 {
+		t.Fatalf("retry moved %d files, want only the failed one", r.stats.movedFiles)
+	}
+
+	if err := os.WriteFile(retries[0], []byte(`{"artist":"Artist","files":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newRunner(cfg, Options{RetryPartial: retries[0]}).Execute(); err == nil || !strings.Contains(err.Error(), "lists no files") {
+		t.Fatalf("expected an empty retry file to be rejected, got %v", err)
+	}
+}
+
+func TestRetryPartialBatchLines(t *testing.T) {
+	var badBroken atomic.Bool
+	badBroken.Store(true)
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		id := strings.TrimPrefix(req.URL.Path, "/file/")
+		if id == "bad222" && badBroken.Load() {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, map[string]string{id + "/track.flac": "audio"}))
+	})
+
+	dir := t.TempDir()
+	library := filepath.Join(dir, "library")
+	if err := os.MkdirAll(library, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	batch := filepath.Join(dir, "batch.txt")
+	if err := os.WriteFile(batch, []byte("Good good111\nBad bad222\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{NavidromeMusicPath: library}
+	err := runBatch(cfg, Options{BatchFile: batch, TmpDir: dir}, nil)
+	if err == nil || !strings.Contains(err.Error(), "re-run the failed line(s) with --retry-partial") {
+		t.Fatalf("expected the batch failure to name a retry file, got %v", err)
+	}
+	retries, _ := filepath.Glob(filepath.Join(dir, "nd-import-retry-*.json"))
+	if len(retries) != 1 {
+		t.Fatalf("expected one retry file, got %v", retries)
+	}
+	entries, err := retryBatchEntries(retries[0])
+	if err != nil || len(entries) != 1 || entries[0].Artist != "Bad" || entries[0].URL != "bad222" || entries[0].Line != 2 {
+		t.Fatalf("retry file holds %+v, %v; want only the failed line", entries, err)
+	}
+
+	// Run re-runs just that line as a batch.
+	badBroken.Store(false)
+	if err := Run(Options{RetryPartial: retries[0], Dest: library, TmpDir: t.TempDir()}); err != nil {
+		t.Fatalf("retry returned error: %v", err)
+	}
+	if names := dirNames(t, library); strings.Join(names, ",") != "Bad,Good" {
+		t.Fatalf("library holds %v after the retry", names)
+	}
+}
@@ -2,97 +2,574 @@ package app
 
 import (
 	"archive/zip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
-	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"cli-navidrome-helper/internal/config"
+	"cli-navidrome-helper/internal/version"
 
 	"github.com/bmatcuk/doublestar/v4"
 )
 
 type runner struct {
-	cfg       config.Config
-	opts      Options
-	log       *log.Logger
-	artistDir string
-	stats     runStats
+	cfg             config.Config
+	opts            Options
+	log             *log.Logger
+	artistDir       string
+	subpath         string // sanitized --subpath below artistDir
+	caseInsensitive bool
+	dryRunPruned    map[string]struct{}
+	// collisionSkipped holds extracted files left out of the move by
+	// --quiet-collision because the destination already has them.
+	collisionSkipped map[string]struct{}
+	// collisionReplace maps extracted files chosen by --on-collision
+	// keep-larger to the smaller existing file they overwrite.
+	collisionReplace map[string]string
+	// collisionBackups maps library files replaced by collisionReplace to the
+	// backup of their old content, kept until the move succeeds.
+	collisionBackups map[string]string
+	events           *eventStream
+	sftp             *sftpFS       // the sftp:// library, see sftpLibrary
+	davClient        *http.Client  // shared by davs:// requests, see davHTTPClient
+	runTmp           string        // per-run temp root, see runTempDir
+	linkFailed       bool          // a --hardlink attempt failed; warned once
+	libIndex         *libraryIndex // set by --dedupe-across-library
+	added            []addedFile   // files the move created, for --tree
+	partial          *partialRetry // list files that failed, for --retry-partial
+	retry            *partialRetry // the loaded --retry-partial file
+	stdin            io.Reader     // nil when prompts are impossible
+	shortened        map[string]string
+	extNormalized    map[string]string
+	spaceCleaned     map[string]string // --clean-whitespace renames by name
+	sniffed          map[string]string // --sniff categories by extract-relative path
+	stats            runStats
+	// ctx bounds the import (--timeout); nil means no deadline.
+	ctx context.Context
+	// fsys is where extraction and the move happen; nil means the local disk.
+	fsys FS
+	// runCollisions counts paths extracted by more than one archive of the
+	// run, for --strict-dry-run.
+	runCollisions int
+	// targetFitted records --fix-target-names renames by name.
+	targetFitted map[string]string
 }
 
 type runStats struct {
 	downloadBytes    int64
+	estimatedBytes   int64 // dry-run download size from the info API; -1 when unknown
 	extractedEntries int
 	pruned           int
 	movedFiles       int
+	extensions       map[string]*extensionStats
+	started          time.Time
+	phases           []phaseTiming
+	total            time.Duration
+	units            config.SizeUnits // how byte counts are printed
 }
 
-func newRunner(cfg config.Config, opts Options) *runner {
-	return &runner{
-		cfg:  cfg,
-		opts: opts,
-		log:  log.New(os.Stdout, "nd-import: ", log.LstdFlags),
+type phaseTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// recordPhase adds the wall-clock duration of a phase that began at start.
+// Repeated phases (one download per archive) accumulate into one entry.
+func (s *runStats) recordPhase(name string, start time.Time) {
+	d := time.Since(start)
+	for i := range s.phases {
+		if s.phases[i].name == name {
+			s.phases[i].duration += d
+			return
+		}
+	}
+	s.phases = append(s.phases, phaseTiming{name: name, duration: d})
+}
+
+func (s *runStats) phaseDuration(name string) time.Duration {
+	for _, p := range s.phases {
+		if p.name == name {
+			return p.duration
+		}
+	}
+	return 0
+}
+
+// downloadThroughput is the average download speed in bytes per second.
+func (s *runStats) downloadThroughput() float64 {
+	d := s.phaseDuration("download")
+	if d <= 0 || s.downloadBytes == 0 {
+		return 0
+	}
+	return float64(s.downloadBytes) / d.Seconds()
+}
+
+// timingSummary renders per-phase durations, e.g.
+// "resolve 0s, download 12.3s (8.5 MiB/s), extract 2.1s, prune 10ms, move 4s; total 18.4s".
+func (s *runStats) timingSummary(total time.Duration) string {
+	parts := make([]string, 0, len(s.phases))
+	for _, p := range s.phases {
+		part := fmt.Sprintf("%s %s", p.name, roundDuration(p.duration))
+		if p.name == "download" && s.downloadThroughput() > 0 {
+			part += fmt.Sprintf(" (%s/s)", humanBytes(int64(s.downloadThroughput()), s.units))
+		}
+		parts = append(parts, part)
 	}
+	return fmt.Sprintf("%s; total %s", strings.Join(parts, ", "), roundDuration(total))
 }
 
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
+
+type extensionStats struct {
+	files int
+	bytes int64
+}
+
+// recordExtension adds a moved file to the per-extension breakdown.
+func (s *runStats) recordExtension(name string, size int64) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		ext = "(none)"
+	}
+	if s.extensions == nil {
+		s.extensions = make(map[string]*extensionStats)
+	}
+	es, ok := s.extensions[ext]
+	if !ok {
+		es = &extensionStats{}
+		s.extensions[ext] = es
+	}
+	es.files++
+	es.bytes += size
+}
+
+// extensionSummary renders the breakdown ordered by file count, largest first.
+func (s *runStats) extensionSummary() string {
+	exts := make([]string, 0, len(s.extensions))
+	for ext := range s.extensions {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		a, b := s.extensions[exts[i]], s.extensions[exts[j]]
+		if a.files != b.files {
+			return a.files > b.files
+		}
+		return exts[i] < exts[j]
+	})
+
+	parts := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		es := s.extensions[ext]
+		parts = append(parts, fmt.Sprintf("%d %s (%s)", es.files, ext, humanBytes(es.bytes, s.units)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func newRunner(cfg config.Config, opts Options) *runner {
+	r := &runner{
+		cfg:   cfg,
+		opts:  opts,
+		stdin: interactiveStdin(),
+		fsys:  osFS{},
+	}
+	r.stats.units = sizeUnits(cfg, opts)
+	r.log = log.New(r.console(), logPrefix(opts), log.LstdFlags)
+	return r
+}
+
+// Execute runs the import and emits the final "done" event.
 func (r *runner) Execute() error {
-	r.log.Printf("Importing Pixeldrain archive for artist %q", r.opts.Artist)
+	start := time.Now()
+	defer r.closeLibrary()
+	if r.opts.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.context(), r.opts.Timeout)
+		defer cancel()
+		r.ctx = ctx
+	}
+	err := r.execute()
+	if err != nil && errors.Is(r.context().Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s: %v", ErrTimeout, r.opts.Timeout, err)
+	}
+	r.cleanupRun(err)
+	r.stats.total = time.Since(start)
+	done := map[string]any{"result": "success", "stats": r.stats.summary(), "build": version.Get()}
+	if err != nil {
+		done["result"] = "failure"
+		done["error"] = err.Error()
+	}
+	if r.artistDir != "" {
+		done["destination"] = r.destinationPath()
+	}
+	r.emit("done", done)
+	return err
+}
+
+func (r *runner) execute() error {
+	r.stats.started = time.Now()
+	if r.opts.RetryPartial != "" {
+		if err := r.loadRetryPartial(); err != nil {
+			return err
+		}
+	}
+	if r.opts.ListPreview {
+		return r.listOnly()
+	}
+	r.log.Printf("Importing archive for artist %q", r.opts.Artist)
 
 	if err := r.validateInputs(); err != nil {
 		return err
 	}
-	artistDir, err := sanitizeArtist(r.opts.Artist)
+	if !r.opts.DryRun && !r.opts.Validate {
+		release, err := r.acquireLock()
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	if r.opts.InsecureSkipVerify {
+		r.log.Printf("warning: --insecure-skip-verify disables TLS certificate checks for Pixeldrain and WebDAV requests; use it only with hosts you trust")
+	}
+	artist := r.opts.Artist
+	if r.opts.CanonicalizeArtist {
+		artist = r.canonicalArtist(strings.TrimSpace(artist))
+	}
+	artistDir, err := sanitizeArtist(artist)
 	if err != nil {
 		return err
 	}
-	r.artistDir = artistDir
+	r.artistDir = r.fitTargetFS(artistDir)
+	if r.subpath, err = sanitizeSubpath(r.opts.Subpath); err != nil {
+		return err
+	}
+	r.subpath = r.fitTargetFS(r.subpath)
+
+	var extractDir string
+	if r.opts.ReuseTemp != "" {
+		// A kept extract dir belongs to the user: pruning and renaming work
+		// on a scratch copy, so it can be reused again with other settings.
+		// A dry run changes nothing and reads it directly.
+		r.log.Printf("Reusing extracted files in %s; skipping download and extraction", r.opts.ReuseTemp)
+		extractDir = r.opts.ReuseTemp
+		if !r.opts.DryRun {
+			root, err := r.runTempDir()
+			if err != nil {
+				return err
+			}
+			extractDir = filepath.Join(root, "extract")
+			if err := r.cloneTree(r.opts.ReuseTemp, extractDir); err != nil {
+				return fmt.Errorf("copy reuse-temp %q: %w", r.opts.ReuseTemp, err)
+			}
+		}
+	} else {
+		start := time.Now()
+		var sources []archiveSource
+		if r.retry != nil {
+			sources = r.retrySources()
+		}
+		resolved, err := r.resolveSources()
+		if err != nil {
+			return err
+		}
+		sources = append(sources, resolved...)
+
+		if err := r.checkListOptions(sources); err != nil {
+			return err
+		}
+		if r.opts.Validate {
+			err := r.validateSources(sources)
+			r.stats.recordPhase("resolve", start)
+			return err
+		}
+		if r.opts.DryRun {
+			// The estimate heads the plan; the archive is still downloaded
+			// and extracted below so prune and collisions can be planned.
+			for _, src := range sources {
+				if src.pixeldrain {
+					r.estimateDownload(src)
+				} else {
+					r.stats.estimatedBytes = -1
+					r.log.Printf("dry-run: download size unknown for %s (no size lookup for %s)", src.id, src.host)
+				}
+			}
+			if len(sources) > 1 {
+				if r.stats.estimatedBytes < 0 {
+					r.log.Printf("dry-run: total download size unknown")
+				} else {
+					r.log.Printf("dry-run: total download %s across %d archives", humanBytes(r.stats.estimatedBytes, r.stats.units), len(sources))
+				}
+			}
+		}
+		r.stats.recordPhase("resolve", start)
+		if r.opts.StrictDryRun {
+			r.log.Printf("strict-dry-run: downloading and extracting to check the plan; nothing is written to the library")
+		}
+		if r.opts.StreamExtract {
+			if reason := r.streamBlocker(sources); reason != "" {
+				r.log.Printf("stream-extract: %s; extracting to a temp dir first", reason)
+			} else {
+				return r.streamImport(sources[0])
+			}
+		}
+
+		root, err := r.runTempDir()
+		if err != nil {
+			return err
+		}
+		extractDir = filepath.Join(root, "extract")
+		if err := os.Mkdir(extractDir, 0o700); err != nil && !(r.opts.ResumeTemp != "" && os.IsExist(err)) {
+			return fmt.Errorf("create extract dir: %w", err)
+		}
+
+		// All archives share one extract dir so pruning, collision checks
+		// and the move treat them as a single combined set.
+		extractedFrom := make(map[string]string)
+		for _, src := range sources {
+			if err := r.fetchInto(src, extractDir, extractedFrom); err != nil {
+				if src.member == "" || r.context().Err() != nil {
+					return err
+				}
+				r.recordPartial(src, fmt.Errorf("list %s file %q: %w", src.listID, src.member, err))
+			}
+		}
+		if r.partial != nil {
+			if entries, err := os.ReadDir(extractDir); err == nil && len(entries) == 0 {
+				return r.writePartialRetry()
+			}
+		}
+		start = time.Now()
+		err = r.extractNested(extractDir, 1)
+		r.stats.recordPhase("extract", start)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.opts.PruneReport {
+		return r.reportPrune(extractDir)
+	}
 
-	fileID, downloadURL, err := resolvePixeldrain(r.opts.URL)
+	start := time.Now()
+	err = r.stripJunkExtensions(extractDir)
+	if err == nil {
+		err = r.pruneExtracted(extractDir)
+	}
+	if err == nil {
+		err = r.pruneDupeExtensions(extractDir)
+	}
+	if err == nil {
+		err = r.pruneLowQuality(extractDir)
+	}
+	if err == nil {
+		err = r.selectOnly(extractDir)
+	}
+	if err == nil {
+		err = r.requireAudio(extractDir)
+	}
+	if err == nil {
+		err = r.normalizeDiscFolders(extractDir)
+	}
+	if err == nil {
+		err = r.normalizeYearFolders(extractDir)
+	}
+	if err == nil {
+		err = r.trimCommonPrefixes(extractDir)
+	}
+	if err == nil {
+		err = r.logClassification(extractDir)
+	}
+	if err == nil {
+		err = r.verifyArtistTag(extractDir)
+	}
+	if err == nil {
+		err = r.scanLibraryDupes(extractDir)
+	}
+	if err == nil {
+		err = r.checkTargetFS(extractDir)
+	}
+	r.stats.recordPhase("prune", start)
 	if err != nil {
 		return err
 	}
-	r.log.Printf("Resolved Pixeldrain ID: %s", fileID)
+	r.emit("prune", map[string]any{"pruned": r.stats.pruned})
 
-	archivePath, err := r.downloadArchive(downloadURL, fileID)
+	dest := r.destinationPath()
+	if r.opts.Diff {
+		return r.diffLibrary(extractDir, dest)
+	}
+	// The cover is fetched before the move so a bad --cover-url fails
+	// the import before the library is touched.
+	var cover []byte
+	if r.opts.CoverURL != "" {
+		if cover, err = r.fetchCover(); err != nil {
+			return err
+		}
+	}
+	r.detectCaseInsensitive(r.libraryRoot())
+	start = time.Now()
+	err = r.moveIntoLibrary(extractDir, dest)
+	if err == nil && r.opts.StrictDryRun {
+		err = r.checkStrictCollisions()
+	}
+	if err == nil {
+		r.indexImported(extractDir)
+	}
+	if err == nil && r.opts.WriteNFO {
+		err = r.writeNFOs(extractDir, dest)
+	}
+	if err == nil && r.opts.ReplayGain {
+		err = r.replayGain(extractDir, dest)
+	}
+	if err == nil && cover != nil {
+		err = r.writeCover(extractDir, dest, cover)
+	}
+	r.stats.recordPhase("move", start)
 	if err != nil {
 		return err
 	}
-	defer r.cleanupPath(archivePath)
+	return r.finishImport(dest)
+}
+
+// finishImport logs the summary of an import that reached the library and
+// writes the retry file of a partially fetched list.
+func (r *runner) finishImport(dest string) error {
+	r.log.Printf("Import complete -> %s (downloaded %s, extracted %d entries, pruned %d, moved %d files)", dest, humanBytes(r.stats.downloadBytes, r.stats.units), r.stats.extractedEntries, r.stats.pruned, r.stats.movedFiles)
+	if len(r.stats.extensions) > 0 {
+		r.log.Printf("By extension: %s", r.stats.extensionSummary())
+	}
+	r.log.Printf("Timing: %s", r.stats.timingSummary(time.Since(r.stats.started)))
+	if r.opts.Tree {
+		r.printTree(dest)
+	}
+	if r.partial != nil {
+		return r.writePartialRetry()
+	}
+	return nil
+}
 
-	extractDir, err := r.extractArchive(archivePath)
+// Promote relocates ${STAGING_PATH}/${artist} into ${NAVIDROME_MUSIC_PATH}/${artist}
+// and removes the staged copy once every file has been moved.
+func (r *runner) Promote() error {
+	defer r.closeLibrary()
+	if r.cfg.StagingPath == "" {
+		return fmt.Errorf("STAGING_PATH is required to promote staged imports")
+	}
+	artistDir, err := sanitizeArtist(r.opts.Artist)
 	if err != nil {
 		return err
 	}
-	defer r.cleanupPath(extractDir)
+	r.artistDir = artistDir
 
-	if err := r.pruneExtracted(extractDir); err != nil {
-		return err
+	src := filepath.Join(r.cfg.StagingPath, artistDir)
+	info, err := r.workFS().Stat(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no staged import for artist %q at %s", r.opts.Artist, src)
+		}
+		return fmt.Errorf("staged import %s not accessible: %w", src, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("staged import %s is not a directory", src)
 	}
 
-	dest := r.destinationPath()
-	if err := r.moveIntoLibrary(extractDir, dest); err != nil {
+	dest := filepath.Join(r.cfg.NavidromeMusicPath, artistDir)
+	r.log.Printf("Promoting %s -> %s", src, dest)
+	r.detectCaseInsensitive(r.cfg.NavidromeMusicPath)
+	if err := r.moveIntoLibrary(src, dest); err != nil {
 		return err
 	}
+	if r.opts.DryRun {
+		r.log.Printf("dry-run: would remove staged copy %s", src)
+		return nil
+	}
+	if err := r.workFS().RemoveAll(src); err != nil {
+		return fmt.Errorf("remove staged copy %q: %w", src, err)
+	}
 
-	r.log.Printf("Import complete -> %s (downloaded %s, extracted %d entries, pruned %d, moved %d files)", dest, humanBytes(r.stats.downloadBytes), r.stats.extractedEntries, r.stats.pruned, r.stats.movedFiles)
+	r.log.Printf("Promote complete -> %s (moved %d files)", dest, r.stats.movedFiles)
 	return nil
 }
 
+func (r *runner) detectCaseInsensitive(root string) {
+	// Probing compares file identities, which only works on local disks.
+	_, local := r.library().(osFS)
+	rules, _ := r.targetFS()
+	r.caseInsensitive = r.opts.CaseInsensitive || rules.caseInsensitive || (local && probeCaseInsensitive(root))
+	if r.caseInsensitive {
+		r.log.Printf("Using case-insensitive collision detection for %s", root)
+	}
+}
+
+// resolveSources resolves every --url.
+func (r *runner) resolveSources() ([]archiveSource, error) {
+	var sources []archiveSource
+	for _, raw := range r.opts.URLs {
+		src, err := resolveURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		r.log.Printf("Resolved %s ID: %s", src.host, src.id)
+		r.emit("resolved", map[string]any{"file_id": src.id, "download_url": redactURL(src.url)})
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
 func (r *runner) validateInputs() error {
 	if strings.TrimSpace(r.opts.Artist) == "" {
 		return fmt.Errorf("artist is required")
 	}
-	if strings.TrimSpace(r.opts.URL) == "" {
+	if what := artistLooksLikeSource(r.opts.Artist); what != "" {
+		msg := fmt.Sprintf("artist %q looks like %s; were --artist and --url swapped?", r.opts.Artist, what)
+		if r.opts.Strict {
+			return fmt.Errorf("%s (aborting because of --strict)", msg)
+		}
+		r.log.Printf("warning: %s", msg)
+	}
+	if r.opts.ReuseTemp != "" {
+		if err := checkReuseDir(r.opts.ReuseTemp); err != nil {
+			return err
+		}
+	} else if len(r.opts.URLs) == 0 && r.retry == nil {
 		return fmt.Errorf("url is required")
 	}
+	if r.opts.ResumeTemp != "" {
+		if info, err := os.Stat(r.opts.ResumeTemp); err != nil || !info.IsDir() {
+			return fmt.Errorf("resume-temp %q is not an accessible directory", r.opts.ResumeTemp)
+		}
+	}
+	if r.opts.Stage && r.cfg.StagingPath == "" {
+		return fmt.Errorf("--stage requires STAGING_PATH to be set")
+	}
+	if r.remoteLibrary() {
+		if r.opts.QuietCollision != "" {
+			return fmt.Errorf("--quiet-collision is not supported with an sftp://, s3:// or davs:// NAVIDROME_MUSIC_PATH")
+		}
+		if r.opts.OnCollision == CollisionKeepLarger {
+			return fmt.Errorf("--on-collision keep-larger is not supported with an sftp://, s3:// or davs:// NAVIDROME_MUSIC_PATH")
+		}
+		if r.opts.Hardlink {
+			return fmt.Errorf("--hardlink is not supported with an sftp://, s3:// or davs:// NAVIDROME_MUSIC_PATH")
+		}
+		if r.opts.WriteNFO {
+			return fmt.Errorf("--write-nfo is not supported with an sftp://, s3:// or davs:// NAVIDROME_MUSIC_PATH")
+		}
+	}
 	if r.opts.TmpDir != "" {
 		if !filepath.IsAbs(r.opts.TmpDir) {
 			return fmt.Errorf("tmp-dir must be absolute: %q", r.opts.TmpDir)
@@ -108,31 +585,173 @@ func (r *runner) validateInputs() error {
 	return nil
 }
 
-func (r *runner) downloadArchive(downloadURL, fileID string) (string, error) {
-	if downloadURL == "" {
-		return "", errors.New("download URL is empty")
+// fetchInto downloads one archive and extracts it into extractDir, removing
+// the download as soon as it has been unpacked.
+func (r *runner) fetchInto(src archiveSource, extractDir string, extractedFrom map[string]string) (err error) {
+	if src.list && r.opts.ListItem != "" {
+		return r.fetchListItem(src, extractDir, extractedFrom)
+	}
+	if src.member != "" {
+		return r.fetchListMember(src, src.member, extractDir, extractedFrom)
+	}
+	start := time.Now()
+	archivePath, err := r.downloadArchive(src)
+	r.stats.recordPhase("download", start)
+	if archivePath != "" {
+		defer func() { r.cleanupUnlessFailed(filepath.Dir(archivePath), err) }()
 	}
-	tmpDir, err := os.MkdirTemp(r.tmpBase(), "nd-import-download-")
 	if err != nil {
-		return "", fmt.Errorf("create temp dir: %w", err)
+		if src.list && r.context().Err() == nil {
+			r.log.Printf("warning: zip download of Pixeldrain list %s failed (%v); downloading its files individually", src.id, err)
+			return r.fetchListFiles(src, extractDir, extractedFrom)
+		}
+		return err
+	}
+	if src.list {
+		if err := checkListArchive(src, archivePath); err != nil {
+			return err
+		}
 	}
 
-	req, err := http.NewRequest("GET", downloadURL, nil)
+	start = time.Now()
+	err = r.extractArchive(archivePath, extractDir, extractedFrom)
+	r.stats.recordPhase("extract", start)
+	return err
+}
+
+// checkReuseDir validates a --reuse-temp directory: it must exist, be a
+// directory and contain at least one entry.
+func checkReuseDir(dir string) error {
+	info, err := os.Stat(dir)
 	if err != nil {
-		return "", fmt.Errorf("build download request: %w", err)
+		return fmt.Errorf("reuse-temp %q not accessible: %w", dir, err)
 	}
-	req.Header.Set("User-Agent", "nd-import/0.1")
-	req.Header.Set("Accept", "application/zip")
-	if r.cfg.PixeldrainToken != "" {
-		req.Header.Set("Authorization", "Bearer "+r.cfg.PixeldrainToken)
+	if !info.IsDir() {
+		return fmt.Errorf("reuse-temp %q is not a directory", dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read reuse-temp %q: %w", dir, err)
 	}
+	if len(entries) == 0 {
+		return fmt.Errorf("reuse-temp %q is empty", dir)
+	}
+	return nil
+}
 
-	client := &http.Client{Timeout: 0}
-	r.log.Printf("Downloading Pixeldrain file %s ...", fileID)
-	resp, err := client.Do(req)
+// cloneTree recreates the directory tree src at dst, hardlinking files
+// where the filesystem allows it and copying them otherwise.
+func (r *runner) cloneTree(src, dst string) error {
+	linked, copied := 0, 0
+	err := filepath.WalkDir(src, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if os.Link(path, target) == nil {
+			linked++
+			return nil
+		}
+		if err := copyLocalFile(path, target, info.Mode().Perm()); err != nil {
+			return err
+		}
+		copied++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.log.Printf("Working on a scratch copy in %s (%d file(s) hardlinked, %d copied)", dst, linked, copied)
+	return nil
+}
+
+func copyLocalFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (r *runner) downloadArchive(src archiveSource) (string, error) {
+	return r.download(src, true)
+}
+
+// download fetches src into a new temp dir and returns the file's path.
+// With zipOnly, a Content-Type that cannot be a zip is rejected. On any
+// failure the temp dir and a partial file in it are removed, as the caller
+// only learns the path of a successful download.
+func (r *runner) download(src archiveSource, zipOnly bool) (_ string, err error) {
+	downloadURL, fileID := src.url, src.id
+	if downloadURL == "" {
+		return "", errors.New("download URL is empty")
+	}
+	root, err := r.runTempDir()
+	if err != nil {
+		return "", err
+	}
+	if zipOnly && r.opts.ResumeTemp != "" {
+		if path := keptDownload(root, src); path != "" {
+			r.log.Printf("Reusing complete download %s", path)
+			return path, nil
+		}
+	}
+	tmpDir, err := os.MkdirTemp(root, "download-")
+	if err != nil {
+		return "", fmt.Errorf("create temp dir: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			r.cleanupUnlessFailed(tmpDir, err)
+		}
+	}()
+
+	host := hostDownload
+	if src.pixeldrain {
+		host = hostPixeldrain
+	}
+	client, err := r.apiClient(host, 0)
+	if err != nil {
+		return "", err
+	}
+	r.log.Printf("Downloading %s file %s ...", src.host, fileID)
+	accept := "application/zip"
+	switch {
+	case !zipOnly:
+		accept = "*/*"
+	case src.list:
+		// Mirrors may serve a list's download-all endpoint as a tar; the
+		// archive is sniffed once downloaded, see checkListArchive.
+		accept = "application/zip, application/x-tar;q=0.9"
+	}
+	resp, err := client.get(downloadURL, accept, fileID)
 	if err != nil {
 		return "", fmt.Errorf("download failed: %w", err)
 	}
+	r.logDownloadHost(resp, downloadURL)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
@@ -140,19 +759,25 @@ func (r *runner) downloadArchive(downloadURL, fileID string) (string, error) {
 		return "", fmt.Errorf("download failed: status %d %s: %s", resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	if contentType != "" && !strings.Contains(contentType, "zip") && !strings.Contains(contentType, "octet-stream") {
-		return "", fmt.Errorf("unexpected content-type %q (expected zip) from Pixeldrain", contentType)
+	if contentType := resp.Header.Get("Content-Type"); zipOnly && !zipContentType(contentType) && !(src.list && listContentType(contentType)) {
+		return "", fmt.Errorf("unexpected content-type %q (expected zip) from %s", contentType, src.host)
 	}
 
-	outFile, err := os.CreateTemp(tmpDir, "pixeldrain-*.zip")
+	outFile, err := os.Create(filepath.Join(tmpDir, downloadName(src)))
 	if err != nil {
 		return "", fmt.Errorf("create temp file: %w", err)
 	}
 	defer outFile.Close()
 
-	pw := newProgressWriter(resp.ContentLength, fmt.Sprintf("Downloading %s", fileID))
-	written, err := io.Copy(io.MultiWriter(outFile, pw), resp.Body)
+	r.emit("download-start", map[string]any{"file_id": fileID, "total_bytes": resp.ContentLength})
+	pw := newProgressWriter(resp.ContentLength, fmt.Sprintf("Downloading %s", fileID), r.stats.units)
+	pw.out = r.console()
+	if r.events != nil {
+		pw.onProgress = func(written, total int64) {
+			r.emit("download-progress", map[string]any{"file_id": fileID, "bytes": written, "total_bytes": total})
+		}
+	}
+	written, err := r.copyDownload(client, resp, io.MultiWriter(outFile, pw), fileID)
 	pw.Finish()
 	if err != nil {
 		return "", fmt.Errorf("write download: %w", err)
@@ -160,185 +785,748 @@ func (r *runner) downloadArchive(downloadURL, fileID string) (string, error) {
 	if written == 0 {
 		return "", fmt.Errorf("downloaded file is empty")
 	}
-	r.stats.downloadBytes = written
-	r.log.Printf("Downloaded %s to %s", humanBytes(written), outFile.Name())
+	if err := outFile.Close(); err != nil {
+		return "", fmt.Errorf("write download: %w", err)
+	}
+	r.stats.downloadBytes += written
+	path, err := nameByContent(outFile.Name())
+	if err != nil {
+		return "", err
+	}
+	r.log.Printf("Downloaded %s to %s", humanBytes(written, r.stats.units), path)
 
-	return outFile.Name(), nil
+	return path, nil
 }
 
-func (r *runner) extractArchive(archivePath string) (string, error) {
-	if archivePath == "" {
-		return "", fmt.Errorf("archive path is empty")
+// keptDownload returns a zip download of src left in root by an earlier run
+// (--resume-temp), or "" when there is none. Only a zip whose central
+// directory can be read counts; a truncated download is fetched again.
+func keptDownload(root string, src archiveSource) string {
+	matches, _ := filepath.Glob(filepath.Join(root, "download-*", downloadName(src)+".zip"))
+	for _, path := range matches {
+		if zr, err := zip.OpenReader(path); err == nil {
+			zr.Close()
+			return path
+		}
 	}
+	return ""
+}
 
-	reader, err := zip.OpenReader(archivePath)
+// downloadName is the file a download is written to inside its temp dir:
+// the host and file ID, e.g. "pixeldrain-abc123". The extension is added
+// once the content is known, see nameByContent.
+func downloadName(src archiveSource) string {
+	return strings.Map(func(c rune) rune {
+		if c == '-' || c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+			return c
+		}
+		return '_'
+	}, strings.ToLower(src.host)+"-"+src.id)
+}
+
+// nameByContent gives a downloaded file the extension of the archive format
+// its leading bytes reveal, so kept temp files (--keep-temp) say what they
+// hold. Anything unrecognised keeps its extensionless name. Extraction
+// sniffs the content itself and never relies on the name.
+func nameByContent(path string) (string, error) {
+	format, err := detectArchiveFormat(path)
+	if err != nil {
+		return "", fmt.Errorf("detect archive format: %w", err)
+	}
+	ext, ok := formatExtensions[format]
+	if !ok {
+		return path, nil
+	}
+	if err := os.Rename(path, path+ext); err != nil {
+		return "", fmt.Errorf("name download: %w", err)
+	}
+	return path + ext, nil
+}
+
+// zipContentType reports whether a download's Content-Type may be a zip.
+// Hosts often send application/octet-stream, or nothing at all.
+func zipContentType(contentType string) bool {
+	return contentType == "" || strings.Contains(contentType, "zip") || strings.Contains(contentType, "octet-stream")
+}
+
+// DefaultMaxEntries is the --max-entries cap: far above any real album
+// collection, but low enough that an archive of millions of tiny entries is
+// refused before it exhausts the volume's inodes.
+const DefaultMaxEntries = 200_000
+
+// extractArchive unpacks archivePath into destDir. extractedFrom maps the
+// relative paths already extracted by earlier archives of the same run to
+// their archive's name; an entry reusing one of them is reported as a
+// collision instead of overwriting it. With --extract-only, entries that
+// match none of its patterns are skipped without reading their contents.
+func (r *runner) extractArchive(archivePath, destDir string, extractedFrom map[string]string) error {
+	return r.extractSelected(archivePath, destDir, extractedFrom, r.opts.ExtractOnly)
+}
+
+// extractSelected is extractArchive with an explicit entry selection; an
+// empty only extracts every entry.
+func (r *runner) extractSelected(archivePath, destDir string, extractedFrom map[string]string, only []string) error {
+	if archivePath == "" {
+		return fmt.Errorf("archive path is empty")
+	}
+	reader, err := r.openArchive(archivePath)
 	if err != nil {
-		return "", fmt.Errorf("open zip: %w", err)
+		return err
 	}
 	defer reader.Close()
 
-	if len(reader.File) == 0 {
-		return "", fmt.Errorf("archive %s is empty", archivePath)
+	entries, extracted, err := r.planEntries(reader.File, archivePath, destDir, only, extractedFrom)
+	if err != nil {
+		return err
 	}
+	resumed := 0
+	for _, e := range entries {
+		targetPath := filepath.Join(destDir, e.rel)
+		if e.file.FileInfo().IsDir() {
+			if _, err := r.mkdirAll(r.workFS(), targetPath); err != nil {
+				return fmt.Errorf("create directory %q: %w", targetPath, err)
+			}
+			continue
+		}
 
-	destDir, err := os.MkdirTemp(r.tmpBase(), "nd-import-extract-")
+		if r.opts.ResumeTemp != "" {
+			// A file of the right size was fully written before the
+			// interruption; a shorter one is extracted again.
+			if info, err := r.workFS().Stat(targetPath); err == nil && info.Mode().IsRegular() && uint64(info.Size()) == e.file.UncompressedSize64 {
+				resumed++
+				continue
+			}
+		}
+		if _, err := r.mkdirAll(r.workFS(), filepath.Dir(targetPath)); err != nil {
+			return fmt.Errorf("create parent for %q: %w", targetPath, err)
+		}
+
+		src, err := e.file.Open()
+		if err != nil {
+			return fmt.Errorf("open zip entry %q: %w", e.name, err)
+		}
+		dst, err := r.createFile(r.workFS(), targetPath, e.file.Mode())
+		if err != nil {
+			src.Close()
+			return fmt.Errorf("create file %q: %w", targetPath, err)
+		}
+
+		// Entries are streamed straight to disk, so memory use does not grow
+		// with entry size; zip.Reader handles Zip64 sizes and entry counts.
+		if _, err := io.Copy(dst, ctxReader{r.context(), src}); err != nil {
+			dst.Close()
+			src.Close()
+			return fmt.Errorf("copy entry %q: %w", e.name, err)
+		}
+		src.Close()
+		// A full disk may only surface when the file is closed.
+		if err := dst.Close(); err != nil {
+			return fmt.Errorf("write %q: %w", targetPath, err)
+		}
+	}
+
+	if resumed > 0 {
+		r.log.Printf("Kept %d entries of %s already extracted by an earlier run", resumed, filepath.Base(archivePath))
+	}
+	r.stats.extractedEntries += extracted
+	r.log.Printf("Extracted %d entries into %s", extracted, destDir)
+	r.emit("extract", map[string]any{"entries": extracted, "dir": destDir})
+	return nil
+}
+
+// openArchive opens the zip at archivePath after checking its format
+// (--allow-formats) and refusing empty archives and ones with more than
+// --max-entries entries.
+func (r *runner) openArchive(archivePath string) (*zip.ReadCloser, error) {
+	if err := r.checkArchiveFormat(archivePath); err != nil {
+		return nil, err
+	}
+	reader, err := zip.OpenReader(archivePath)
 	if err != nil {
-		return "", fmt.Errorf("create extract dir: %w", err)
+		return nil, fmt.Errorf("open zip: %w", err)
+	}
+	if len(reader.File) == 0 {
+		reader.Close()
+		return nil, fmt.Errorf("archive %s is empty", archivePath)
 	}
+	maxEntries := r.opts.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	if len(reader.File) > maxEntries {
+		reader.Close()
+		return nil, fmt.Errorf("archive %s has %d entries, more than --max-entries %d; refusing to extract", filepath.Base(archivePath), len(reader.File), maxEntries)
+	}
+	return reader, nil
+}
 
-	for _, f := range reader.File {
-		rel := filepath.Clean(f.Name)
+// zipEntry is an archive entry selected by planEntries. rel is where it
+// goes below the extract root (or the destination, when streamed).
+type zipEntry struct {
+	file *zip.File
+	name string
+	rel  string
+}
+
+// planEntries selects the entries of an archive and names them, without
+// reading their contents. Entry names are decoded and must stay inside the
+// extract root; with only (--extract-only), folder entries and files
+// matching none of its patterns are skipped. Paths are shortened like
+// --max-filename-length. A file that another archive of the run extracted
+// to the same path (per extractedFrom) is resolved by resolveRunCollision
+// against destDir; a duplicate within the archive is renamed or refused
+// (--on-dupe-entry). The second result counts the entries not skipped by
+// only.
+func (r *runner) planEntries(files []*zip.File, archivePath, destDir string, only []string, extractedFrom map[string]string) ([]zipEntry, int, error) {
+	var entries []zipEntry
+	decoded, skipped, masked := 0, 0, 0
+	for _, f := range files {
+		name, wasDecoded := r.entryName(f)
+		if wasDecoded {
+			decoded++
+		}
+		rel := filepath.Clean(name)
 		if rel == "." {
 			continue
 		}
 		if filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
-			return "", fmt.Errorf("zip entry %q uses unsupported path", f.Name)
+			return nil, 0, fmt.Errorf("zip entry %q uses unsupported path", name)
+		}
+		isDir := f.FileInfo().IsDir()
+		if len(only) > 0 {
+			// Folder entries are skipped; the folders of matching files are
+			// created as they are written.
+			selected := false
+			if !isDir {
+				var err error
+				if selected, err = matchesAny(only, filepath.ToSlash(rel)); err != nil {
+					return nil, 0, fmt.Errorf("invalid --extract-only pattern %w", err)
+				}
+			}
+			if !selected {
+				skipped++
+				continue
+			}
+		}
+
+		rel = r.shortenPath(rel)
+		if !isDir {
+			other, ok := extractedFrom[rel]
+			switch {
+			case ok && other != archivePath:
+				overwrite, err := r.resolveRunCollision(destDir, rel, archivePath, other, int64(f.UncompressedSize64), f.CRC32)
+				if err != nil {
+					return nil, 0, err
+				}
+				if !overwrite {
+					continue
+				}
+			case ok:
+				if r.opts.OnDupeEntry == DupeEntryFail {
+					return nil, 0, fmt.Errorf("archive %s contains duplicate entry %q", filepath.Base(archivePath), name)
+				}
+				renamed := dedupeEntryName(rel, extractedFrom)
+				r.log.Printf("warning: archive %s contains duplicate entry %q; extracting it as %q", filepath.Base(archivePath), name, filepath.ToSlash(renamed))
+				rel = renamed
+			}
+			extractedFrom[rel] = archivePath
+			// Group/other write is dropped silently: zips written by most
+			// tools (and on Windows) record 0666 for every file.
+			if f.Mode()&specialModeBits != 0 {
+				masked++
+			}
+		}
+		entries = append(entries, zipEntry{file: f, name: name, rel: rel})
+	}
+
+	if decoded > 0 {
+		enc := r.filenameEncoding()
+		if enc == FilenameEncodingAuto {
+			enc = FilenameEncodingCP437
+		}
+		r.log.Printf("Decoded %d non-UTF-8 entry name(s) in %s as %s", decoded, filepath.Base(archivePath), enc)
+	}
+	if _, explicit := r.fileMode(0); masked > 0 && !explicit && !r.opts.PreserveModes {
+		r.log.Printf("warning: dropping setuid/setgid/sticky bits from %d entries in %s (use --preserve-modes to keep them)", masked, filepath.Base(archivePath))
+	}
+	selected := len(files) - skipped
+	if len(only) > 0 {
+		if selected == 0 {
+			return nil, 0, fmt.Errorf("--extract-only %s matched no entries in %s", strings.Join(only, ", "), filepath.Base(archivePath))
+		}
+		r.log.Printf("Skipped %d entries not matched by --extract-only", skipped)
+	}
+	return entries, selected, nil
+}
+
+// matchesAny reports whether relSlash matches one of patterns, anchored
+// like UNNEEDED_FILES.
+func matchesAny(patterns []string, relSlash string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := matchPrunePattern(pattern, relSlash)
+		if err != nil {
+			return false, fmt.Errorf("%q: %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dedupeEntryName returns rel with the first free " (n)" suffix inserted
+// before its extension, e.g. "CD1/01.flac" -> "CD1/01 (2).flac".
+func dedupeEntryName(rel string, taken map[string]string) string {
+	ext := filepath.Ext(rel)
+	stem := strings.TrimSuffix(rel, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		if _, ok := taken[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// prunePlan records what UNNEEDED_FILES would remove from an extract dir.
+type prunePlan struct {
+	// matchedBy maps each matched path to the first pattern that matched it.
+	matchedBy map[string]string
+	// remove is the set of paths to delete (matchedBy minus files protected
+	// by --prune-keep or cue sheets).
+	remove map[string]struct{}
+	// keptBy maps matched paths taken out of remove to the protection
+	// that kept them, for --prune-debug.
+	keptBy         map[string]string
+	fileCount      int
+	remainingFiles int
+}
+
+// removesAll reports whether applying the plan would leave no files behind.
+func (p *prunePlan) removesAll() bool {
+	return p.fileCount > 0 && p.remainingFiles == 0
+}
+
+// planPrune matches UNNEEDED_FILES and the --prune-smaller-than and
+// --prune-larger-than limits against extractDir without deleting anything.
+// It returns nil when none of them are configured.
+func (r *runner) planPrune(extractDir string) (*prunePlan, error) {
+	if extractDir == "" {
+		return nil, fmt.Errorf("extract directory is empty")
+	}
+	if len(r.pruneRules()) == 0 {
+		return nil, nil
+	}
+
+	plan := &prunePlan{
+		matchedBy: make(map[string]string),
+		remove:    make(map[string]struct{}),
+	}
+
+	err := filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if path == extractDir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		relSlash := filepath.ToSlash(rel)
+
+		if !d.IsDir() {
+			plan.fileCount++
+		}
+
+		for _, pattern := range r.cfg.UnneededPatterns {
+			ok, err := matchPrunePattern(pattern, relSlash)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			if ok {
+				plan.matchedBy[path] = pattern
+				plan.remove[path] = struct{}{}
+				// If a directory matches, skip evaluating deeper because WalkDir will still enter; no need to short-circuit.
+				break
+			}
 		}
+		if _, matched := plan.matchedBy[path]; matched || d.IsDir() {
+			return nil
+		}
+		rule, err := r.sizeRule(d)
+		if err != nil {
+			return err
+		}
+		if rule != "" {
+			plan.matchedBy[path] = rule
+			plan.remove[path] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.applyProtections(extractDir, plan); err != nil {
+		return nil, err
+	}
+
+	// Protect against deleting everything.
+	err = filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if path == extractDir {
+			return nil
+		}
+		if d.IsDir() {
+			if _, ok := plan.remove[path]; ok {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := plan.remove[path]; !ok {
+			plan.remainingFiles++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.opts.PruneDebug {
+		if err := r.logPruneDecisions(extractDir, plan); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func (r *runner) pruneExtracted(extractDir string) error {
+	plan, err := r.planPrune(extractDir)
+	if err != nil || plan == nil {
+		return err
+	}
+	if plan.removesAll() {
+		return fmt.Errorf("prune patterns would remove all %d files; aborting", plan.fileCount)
+	}
+	if len(plan.remove) == 0 {
+		return nil
+	}
+
+	var removed []string
+	for path := range plan.remove {
+		removed = append(removed, path)
+	}
+	sort.Strings(removed)
+
+	if err := r.removePruned(removed); err != nil {
+		return err
+	}
+	r.log.Printf("Pruned %d item(s) matching UNNEEDED_FILES or size limits", len(removed))
+	if r.opts.PruneCascade {
+		return r.pruneCascade(extractDir, removed)
+	}
+	return nil
+}
+
+// pruneCascade removes the folders that the removal of pruned paths left
+// empty, walking up from each one and stopping at extractDir. In dry-run
+// mode a folder counts as empty when all its entries would be pruned.
+func (r *runner) pruneCascade(extractDir string, removed []string) error {
+	candidates := make(map[string]struct{})
+	for _, p := range removed {
+		for dir := filepath.Dir(p); dir != extractDir && strings.HasPrefix(dir, extractDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+			candidates[dir] = struct{}{}
+		}
+	}
+	dirs := make([]string, 0, len(candidates))
+	for dir := range candidates {
+		dirs = append(dirs, dir)
+	}
+	// Reverse lexical order visits every folder before its parent.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	var emptied []string
+	for _, dir := range dirs {
+		if _, gone := r.dryRunPruned[dir]; gone {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		empty := true
+		for _, e := range entries {
+			if _, gone := r.dryRunPruned[filepath.Join(dir, e.Name())]; !gone {
+				empty = false
+				break
+			}
+		}
+		if !empty {
+			continue
+		}
+		if r.opts.DryRun {
+			r.log.Printf("dry-run: would remove empty folder %s", dir)
+			r.dryRunPruned[dir] = struct{}{}
+		} else if err := os.Remove(dir); err != nil {
+			return fmt.Errorf("remove empty folder %q: %w", dir, err)
+		}
+		emptied = append(emptied, dir)
+	}
+	if len(emptied) > 0 {
+		r.log.Printf("Removed %d folder(s) left empty by the prune", len(emptied))
+	}
+	return nil
+}
+
+// pruneRules lists UNNEEDED_FILES followed by labels for the configured
+// size limits, in the order prune-report prints them.
+func (r *runner) pruneRules() []string {
+	rules := append([]string(nil), r.cfg.UnneededPatterns...)
+	if r.opts.PruneSmallerThan > 0 {
+		rules = append(rules, r.smallerThanRule())
+	}
+	if r.opts.PruneLargerThan > 0 {
+		rules = append(rules, r.largerThanRule())
+	}
+	return rules
+}
+
+func (r *runner) smallerThanRule() string {
+	return fmt.Sprintf("--prune-smaller-than %s", humanBytes(r.opts.PruneSmallerThan, r.stats.units))
+}
+
+func (r *runner) largerThanRule() string {
+	return fmt.Sprintf("--prune-larger-than %s", humanBytes(r.opts.PruneLargerThan, r.stats.units))
+}
+
+// sizeRule returns the size limit that prunes file d, or "" if none does.
+// Audio files are never pruned for being large.
+func (r *runner) sizeRule(d os.DirEntry) (string, error) {
+	if r.opts.PruneSmallerThan <= 0 && r.opts.PruneLargerThan <= 0 {
+		return "", nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case r.opts.PruneSmallerThan > 0 && info.Size() < r.opts.PruneSmallerThan:
+		return r.smallerThanRule(), nil
+	case r.opts.PruneLargerThan > 0 && info.Size() > r.opts.PruneLargerThan && !isAudio(d.Name()):
+		return r.largerThanRule(), nil
+	}
+	return "", nil
+}
+
+// reportPrune lists, grouped by pattern, every path UNNEEDED_FILES would
+// remove from extractDir, without deleting anything (--prune-report).
+func (r *runner) reportPrune(extractDir string) error {
+	plan, err := r.planPrune(extractDir)
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		r.log.Printf("prune-report: no UNNEEDED_FILES patterns or size limits configured")
+		return nil
+	}
+
+	// Attribute every file that would go to the pattern that removes it or
+	// its nearest pruned ancestor directory.
+	byPattern := make(map[string][]string)
+	err = filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		for p := path; p != extractDir && p != filepath.Dir(p); p = filepath.Dir(p) {
+			if _, ok := plan.remove[p]; ok {
+				rel, err := filepath.Rel(extractDir, path)
+				if err != nil {
+					return err
+				}
+				pattern := plan.matchedBy[p]
+				byPattern[pattern] = append(byPattern[pattern], filepath.ToSlash(rel))
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.log.Printf("prune-report: %d of %d file(s) matched in %s", plan.fileCount-plan.remainingFiles, plan.fileCount, extractDir)
+	for _, pattern := range r.pruneRules() {
+		paths := byPattern[pattern]
+		sort.Strings(paths)
+		r.log.Printf("prune-report: %q matches %d file(s)", pattern, len(paths))
+		for _, p := range paths {
+			r.log.Printf("  %s", p)
+		}
+	}
+	if plan.removesAll() {
+		r.log.Printf("warning: prune patterns would remove all %d files; a real import would abort", plan.fileCount)
+	}
+	return nil
+}
+
+// matchPrunePattern applies an UNNEEDED_FILES pattern to a slash-separated
+// path relative to the extract root, following .gitignore-style anchoring:
+// a leading "/" anchors the pattern at the extract root, a pattern without
+// any "/" matches the entry name at any depth, and any other pattern is
+// matched against the full relative path.
+func matchPrunePattern(pattern, relSlash string) (bool, error) {
+	if anchored, ok := strings.CutPrefix(pattern, "/"); ok {
+		return doublestar.Match(anchored, relSlash)
+	}
+	if !strings.Contains(pattern, "/") {
+		return doublestar.Match(pattern, path.Base(relSlash))
+	}
+	return doublestar.Match(pattern, relSlash)
+}
 
-		targetPath := filepath.Join(destDir, rel)
-		if f.FileInfo().IsDir() {
-			if err := os.MkdirAll(targetPath, 0o755); err != nil {
-				return "", fmt.Errorf("create directory %q: %w", targetPath, err)
+// removePruned deletes paths selected by a prune step. In dry-run mode the
+// paths are only logged and remembered so later steps treat them as gone.
+func (r *runner) removePruned(paths []string) error {
+	for _, path := range paths {
+		if r.opts.DryRun {
+			r.log.Printf("dry-run: would remove %s", path)
+			if r.dryRunPruned == nil {
+				r.dryRunPruned = make(map[string]struct{})
 			}
+			r.dryRunPruned[path] = struct{}{}
 			continue
 		}
-
-		if err := os.MkdirAll(filepath.Dir(targetPath), 0o755); err != nil {
-			return "", fmt.Errorf("create parent for %q: %w", targetPath, err)
-		}
-
-		src, err := f.Open()
-		if err != nil {
-			return "", fmt.Errorf("open zip entry %q: %w", f.Name, err)
-		}
-
-		mode := f.Mode()
-		if mode == 0 {
-			mode = 0o644
-		}
-		dst, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
-		if err != nil {
-			src.Close()
-			return "", fmt.Errorf("create file %q: %w", targetPath, err)
-		}
-
-		if _, err := io.Copy(dst, src); err != nil {
-			dst.Close()
-			src.Close()
-			return "", fmt.Errorf("copy entry %q: %w", f.Name, err)
+		if err := r.workFS().RemoveAll(path); err != nil {
+			return fmt.Errorf("remove %q: %w", path, err)
 		}
-
-		dst.Close()
-		src.Close()
 	}
-
-	r.stats.extractedEntries = len(reader.File)
-	r.log.Printf("Extracted %d entries into %s", len(reader.File), destDir)
-	return destDir, nil
+	r.stats.pruned += len(paths)
+	return nil
 }
 
-func (r *runner) pruneExtracted(extractDir string) error {
+// pruneDupeExtensions keeps a single copy of tracks that exist in several
+// formats within the same folder (e.g. "01 Intro.flac" and "01 Intro.mp3"),
+// preferring extensions earlier in PreferFormats. Files whose extension is not
+// listed are never considered duplicates.
+func (r *runner) pruneDupeExtensions(extractDir string) error {
+	if !r.opts.PruneDupeExtensions {
+		return nil
+	}
 	if extractDir == "" {
 		return fmt.Errorf("extract directory is empty")
 	}
-	if len(r.cfg.UnneededPatterns) == 0 {
-		return nil
+
+	rank := make(map[string]int, len(r.opts.PreferFormats))
+	for i, ext := range r.opts.PreferFormats {
+		if _, ok := rank[ext]; !ok {
+			rank[ext] = i
+		}
 	}
 
-	var toRemove []string
+	groups := make(map[string][]string)
 	var fileCount int
-
 	err := filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
-		if path == extractDir {
+		if _, gone := r.dryRunPruned[path]; gone {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-
-		rel, err := filepath.Rel(extractDir, path)
-		if err != nil {
-			return err
-		}
-		relSlash := filepath.ToSlash(rel)
-
-		if !d.IsDir() {
-			fileCount++
+		if d.IsDir() {
+			return nil
 		}
+		fileCount++
 
-		for _, pattern := range r.cfg.UnneededPatterns {
-			ok, err := doublestar.Match(pattern, relSlash)
-			if err != nil {
-				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
-			}
-			if ok {
-				toRemove = append(toRemove, path)
-				// If a directory matches, skip evaluating deeper because WalkDir will still enter; no need to short-circuit.
-				break
-			}
+		ext := filepath.Ext(path)
+		if _, ok := rank[formatOf(path)]; !ok {
+			return nil
 		}
+		key := strings.TrimSuffix(path, ext)
+		groups[key] = append(groups[key], path)
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
-	// Protect against deleting everything.
-	unique := make(map[string]struct{})
-	for _, p := range toRemove {
-		unique[p] = struct{}{}
+	var removed []string
+	for _, paths := range groups {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			return rank[formatOf(paths[i])] < rank[formatOf(paths[j])]
+		})
+		for _, path := range paths[1:] {
+			r.log.Printf("Duplicate format: keeping %s over %s", filepath.Base(paths[0]), filepath.Base(path))
+			removed = append(removed, path)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
 	}
+	if fileCount-len(removed) <= 0 {
+		return fmt.Errorf("duplicate-format pruning would remove all %d files; aborting", fileCount)
+	}
+	sort.Strings(removed)
 
-	remainingFiles := 0
-	err = filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
-		if walkErr != nil {
+	if err := r.removePruned(removed); err != nil {
+		return err
+	}
+	r.log.Printf("Pruned %d lower-priority duplicate(s) (prefer %s)", len(removed), strings.Join(r.opts.PreferFormats, ","))
+	return nil
+}
+
+// requireAudio fails the import when nothing left in extractDir after the
+// prune is a recognized audio file (--require-audio), so a mislinked archive
+// of text files or images never lands in the library.
+func (r *runner) requireAudio(extractDir string) error {
+	if !r.opts.RequireAudio && !r.opts.StrictDryRun {
+		return nil
+	}
+	var found bool
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
 			return walkErr
 		}
-		if path == extractDir {
+		if _, gone := r.dryRunPruned[path]; gone {
 			return nil
 		}
-		if d.IsDir() {
-			if _, ok := unique[path]; ok {
-				return filepath.SkipDir
-			}
-			return nil
+		c, err := r.sniffCategory(extractDir, path)
+		if err != nil {
+			return err
 		}
-		if _, ok := unique[path]; !ok {
-			remainingFiles++
+		if isAudio(d.Name()) || c == categoryAudio {
+			found = true
+			return filepath.SkipAll
 		}
 		return nil
 	})
-	if err != nil {
+	if err != nil || found {
 		return err
 	}
+	return fmt.Errorf("no audio files left after extraction and pruning (%s); check that the URL points to a music archive", r.audioCheckFlag())
+}
 
-	if fileCount > 0 && remainingFiles == 0 {
-		return fmt.Errorf("prune patterns would remove all %d files; aborting", fileCount)
-	}
-
-	if len(unique) == 0 {
-		return nil
-	}
-
-	var removed []string
-	for path := range unique {
-		removed = append(removed, path)
-	}
-	sort.Strings(removed)
-
-	for _, path := range removed {
-		if r.opts.DryRun {
-			r.log.Printf("dry-run: would remove %s", path)
-			continue
-		}
-		if err := os.RemoveAll(path); err != nil {
-			return fmt.Errorf("remove %q: %w", path, err)
-		}
+// audioCheckFlag names the option that made requireAudio run.
+func (r *runner) audioCheckFlag() string {
+	if r.opts.RequireAudio {
+		return "--require-audio"
 	}
+	return "--strict-dry-run"
+}
 
-	r.stats.pruned = len(removed)
-	r.log.Printf("Pruned %d item(s) matching UNNEEDED_FILES", len(removed))
-	return nil
+func formatOf(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
 }
 
 func (r *runner) moveIntoLibrary(extractDir, dest string) error {
@@ -349,107 +1537,380 @@ func (r *runner) moveIntoLibrary(extractDir, dest string) error {
 		return fmt.Errorf("destination path is empty")
 	}
 
+	if err := r.resolveNameClashes(extractDir, dest); err != nil {
+		return err
+	}
+	if err := r.skipCollisions(extractDir, dest); err != nil {
+		return err
+	}
+	if err := r.resolveCollisions(extractDir, dest); err != nil {
+		return err
+	}
 	if err := r.ensureNoCollisions(extractDir, dest); err != nil {
 		return err
 	}
+	if err := r.checkFreeSpace(extractDir, dest); err != nil {
+		return err
+	}
 
 	if r.opts.DryRun {
+		if bucket, ok := r.library().(*s3FS); ok {
+			return r.logPlannedObjects(bucket, extractDir, dest)
+		}
+		if dav, ok := r.library().(*davFS); ok {
+			return r.logPlannedDAV(dav, extractDir, dest)
+		}
 		r.log.Printf("dry-run: would merge extracted files into %s", dest)
 		return nil
 	}
 
-	if err := os.MkdirAll(dest, 0o755); err != nil {
+	created, err := r.mkdirAll(r.library(), dest)
+	if err != nil {
 		return fmt.Errorf("create destination %q: %w", dest, err)
 	}
+	var written, replaced []string
+	var total, linked int
+	if r.events != nil {
+		if total, err = countFiles(r.workFS(), extractDir); err != nil {
+			return err
+		}
+	}
 
-	err := filepath.WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+	err = r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
 		if path == extractDir {
 			return nil
 		}
+		if _, skip := r.collisionSkipped[path]; skip {
+			return nil
+		}
 
 		rel, err := filepath.Rel(extractDir, path)
 		if err != nil {
 			return err
 		}
+		rel = r.destRel(rel, d.IsDir())
 		target := filepath.Join(dest, rel)
 
-		if d.IsDir() {
-			return os.MkdirAll(target, 0o755)
+		dir := target
+		if !d.IsDir() {
+			dir = filepath.Dir(target)
 		}
-
-		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		dirs, err := r.mkdirAll(r.library(), dir)
+		if err != nil {
 			return err
 		}
+		created = append(created, dirs...)
+		if d.IsDir() {
+			return nil
+		}
 
 		info, err := d.Info()
 		if err != nil {
 			return err
 		}
+		if existing, ok := r.collisionReplace[path]; ok {
+			// The replaced file pre-dates this run: a rollback restores its
+			// backup instead of removing it.
+			if err := r.replaceFile(path, existing, info.Mode()); err != nil {
+				return fmt.Errorf("replace %q: %w", existing, err)
+			}
+			written = append(written, existing)
+			replaced = append(replaced, existing)
+			r.stats.movedFiles++
+			r.stats.recordExtension(path, info.Size())
+			r.emit("move-progress", map[string]any{"file": existing, "bytes": info.Size(), "moved": r.stats.movedFiles, "total": total})
+			return nil
+		}
 
-		if err := copyFile(path, target, info.Mode()); err != nil {
-			return err
+		// Track the target before copying so a partially written file is
+		// rolled back too.
+		created = append(created, target)
+		if r.opts.Hardlink {
+			if ok, err := r.linkFile(path, target, info.Mode()); err != nil {
+				return fmt.Errorf("link %q: %w", target, err)
+			} else if ok {
+				linked++
+			} else if err := r.copyFile(path, target, info.Mode()); err != nil {
+				return fmt.Errorf("copy %q: %w", target, err)
+			}
+		} else if err := r.copyFile(path, target, info.Mode()); err != nil {
+			return fmt.Errorf("copy %q: %w", target, err)
 		}
+		written = append(written, target)
+		r.added = append(r.added, addedFile{path: target, size: info.Size()})
 		r.stats.movedFiles++
+		r.stats.recordExtension(path, info.Size())
+		r.emit("move-progress", map[string]any{"file": target, "bytes": info.Size(), "moved": r.stats.movedFiles, "total": total})
 		return nil
 	})
+	if err == nil {
+		err = r.chownCreated(append(created[:len(created):len(created)], replaced...))
+	}
 	if err != nil {
-		return err
+		return r.handleMoveFailure(dest, created, written, err)
+	}
+	r.dropCollisionBackups()
+	if r.opts.Hardlink {
+		r.log.Printf("Hardlinked %d of %d file(s); the rest were copied", linked, len(written))
 	}
-
 	return nil
 }
 
+// handleMoveFailure reacts to a move that stopped partway. With
+// --rollback-on-error every path this run created is removed again, deepest
+// first, leaving pre-existing files and directories intact, and files
+// replaced by --on-collision keep-larger are restored from their backups;
+// otherwise the files already written are logged so they can be cleaned up
+// by hand.
+func (r *runner) handleMoveFailure(dest string, created, written []string, moveErr error) error {
+	if !r.opts.RollbackOnError {
+		r.dropCollisionBackups()
+		if len(written) > 0 {
+			r.log.Printf("Move into %s failed after writing %d file(s):", dest, len(written))
+			for _, path := range written {
+				r.log.Printf("  written: %s", path)
+			}
+		}
+		return moveErr
+	}
+
+	fsys := r.library()
+	var failed []string
+	for i := len(created) - 1; i >= 0; i-- {
+		if err := fsys.Remove(created[i]); err != nil && !os.IsNotExist(err) {
+			failed = append(failed, created[i])
+			r.log.Printf("warning: rollback could not remove %s: %v", created[i], err)
+		}
+	}
+	for target, backup := range r.collisionBackups {
+		if err := fsys.Rename(backup, target); err != nil {
+			failed = append(failed, target)
+			r.log.Printf("warning: rollback could not restore %s from %s: %v", target, backup, err)
+		}
+	}
+	restored := len(r.collisionBackups)
+	r.collisionBackups = nil
+	r.stats.movedFiles = 0
+	r.stats.extensions = nil
+	if len(failed) > 0 {
+		return fmt.Errorf("%w (rollback incomplete: %d path(s) left behind)", moveErr, len(failed))
+	}
+	r.log.Printf("Rolled back %d path(s) created in %s", len(created), dest)
+	if restored > 0 {
+		r.log.Printf("Restored %d file(s) replaced by --on-collision keep-larger", restored)
+	}
+	return fmt.Errorf("%w (rolled back)", moveErr)
+}
+
+func countFiles(fsys FS, root string) (int, error) {
+	var n int
+	err := fsys.WalkDir(root, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
 func (r *runner) ensureNoCollisions(srcRoot, destRoot string) error {
-	return filepath.WalkDir(srcRoot, func(path string, d os.DirEntry, walkErr error) error {
+	var existing map[string]bool
+	kinds := make(map[string]bool) // collisionKey -> whether a source folder maps there
+	if r.caseInsensitive {
+		var err error
+		existing, err = foldedTree(r.library(), destRoot)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.workFS().WalkDir(srcRoot, func(path string, d os.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
 		if path == srcRoot {
 			return nil
 		}
+		if _, skip := r.collisionSkipped[path]; skip {
+			return nil
+		}
+		if _, replace := r.collisionReplace[path]; replace {
+			return nil
+		}
 
 		rel, err := filepath.Rel(srcRoot, path)
 		if err != nil {
 			return err
 		}
+		rel = r.destRel(rel, d.IsDir())
 		target := filepath.Join(destRoot, rel)
 
-		info, err := os.Stat(target)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return nil
-			}
+		// Clashing files went through resolveNameClashes and clashing
+		// folders are merged, but a file and a folder cannot share a name.
+		key := r.collisionKey(rel)
+		if isDir, ok := kinds[key]; ok && isDir != d.IsDir() {
+			return fmt.Errorf("destination conflict: a file and a folder would both be written to %s", target)
+		}
+		kinds[key] = d.IsDir()
+
+		var targetIsDir bool
+		info, err := r.library().Stat(target)
+		if err == nil {
+			targetIsDir = info.IsDir()
+		} else if !os.IsNotExist(err) {
 			return err
+		} else if isDir, ok := existing[foldPath(rel)]; ok {
+			targetIsDir = isDir
+		} else {
+			return nil
 		}
 
-		if d.IsDir() && !info.IsDir() {
+		if d.IsDir() && !targetIsDir {
 			return fmt.Errorf("destination conflict: %s exists as a file", target)
 		}
-		if !d.IsDir() && info.IsDir() {
+		if !d.IsDir() && targetIsDir {
 			return fmt.Errorf("destination conflict: %s exists as a directory", target)
 		}
-		if !d.IsDir() && !info.IsDir() {
+		if !d.IsDir() && !targetIsDir {
 			return fmt.Errorf("destination conflict: %s already exists", target)
 		}
 		return nil
 	})
 }
 
+// foldedTree indexes every path under root by its case-folded relative path,
+// recording whether each entry is a directory. A missing root yields an empty index.
+func foldedTree(fsys FS, root string) (map[string]bool, error) {
+	index := make(map[string]bool)
+	err := fsys.WalkDir(root, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if path == root && os.IsNotExist(walkErr) {
+				return filepath.SkipDir
+			}
+			return walkErr
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		index[foldPath(rel)] = d.IsDir()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func foldPath(rel string) string {
+	return strings.ToLower(filepath.ToSlash(rel))
+}
+
+// probeCaseInsensitive reports whether the filesystem holding dir resolves names
+// case-insensitively, by looking up dir under a case-swapped final element.
+// No files are written; directories whose name has no letters report false.
+func probeCaseInsensitive(dir string) bool {
+	base := filepath.Base(dir)
+	swapped := swapCase(base)
+	if swapped == base {
+		return false
+	}
+	orig, err := os.Stat(dir)
+	if err != nil {
+		return false
+	}
+	alt, err := os.Stat(filepath.Join(filepath.Dir(dir), swapped))
+	if err != nil {
+		return false
+	}
+	return os.SameFile(orig, alt)
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
 func (r *runner) cleanupPath(path string) {
 	if path == "" || r.opts.KeepTemp {
 		return
 	}
-	if err := os.RemoveAll(path); err != nil {
+	if err := r.workFS().RemoveAll(path); err != nil {
 		r.log.Printf("warning: failed to clean up %s: %v", path, err)
 		return
 	}
 }
 
+// cleanupUnlessFailed is cleanupPath, except that --keep-temp-on-failure
+// keeps path when failed is non-nil.
+func (r *runner) cleanupUnlessFailed(path string, failed error) {
+	if failed != nil && r.opts.KeepTempOnFailure {
+		return
+	}
+	r.cleanupPath(path)
+}
+
+// cleanupRun removes the run's temp root once the import is over. With
+// --keep-temp-on-failure a failed run keeps it and logs where it is.
+func (r *runner) cleanupRun(err error) {
+	if r.runTmp == "" {
+		return
+	}
+	if err != nil && r.opts.KeepTempOnFailure && !r.opts.KeepTemp {
+		r.log.Printf("Import failed; temp files kept in %s", r.runTmp)
+		return
+	}
+	r.cleanupPath(r.runTmp)
+}
+
 func (r *runner) destinationPath() string {
-	return filepath.Join(r.cfg.NavidromeMusicPath, r.artistDir)
+	return filepath.Join(r.libraryRoot(), r.artistDir, r.subpath)
+}
+
+// libraryRoot is the directory imports are written under: the staging area
+// when --stage is set, otherwise the live Navidrome library.
+func (r *runner) libraryRoot() string {
+	if r.opts.Stage {
+		return r.cfg.StagingPath
+	}
+	return r.cfg.NavidromeMusicPath
+}
+
+// runTempDir returns this run's temp root, nd-import-<timestamp>-<random>
+// under the temp base, creating it on first use. Downloads and the extract
+// dir live inside it, so --keep-temp leaves one self-contained folder per
+// run and cleanup removes everything at once.
+func (r *runner) runTempDir() (string, error) {
+	if r.runTmp != "" {
+		return r.runTmp, nil
+	}
+	if r.opts.ResumeTemp != "" {
+		r.runTmp = r.opts.ResumeTemp
+		r.log.Printf("Resuming in temp files of an earlier run: %s", r.runTmp)
+		return r.runTmp, nil
+	}
+	dir, err := os.MkdirTemp(r.tmpBase(), "nd-import-"+time.Now().Format("20060102-150405")+"-")
+	if err != nil {
+		return "", fmt.Errorf("create temp dir: %w", err)
+	}
+	r.runTmp = dir
+	if r.opts.KeepTemp {
+		r.log.Printf("Temp files for this run: %s", dir)
+	}
+	return dir, nil
 }
 
 func (r *runner) tmpBase() string {
@@ -459,6 +1920,62 @@ func (r *runner) tmpBase() string {
 	return ""
 }
 
+// sanitizeSubpath validates a relative "Live/2019" style path, splitting it
+// on "/" or "\\" and checking each segment like an artist name. Empty,
+// "." and ".." segments are rejected rather than collapsed.
+func sanitizeSubpath(raw string) (string, error) {
+	normalized := strings.TrimRight(strings.ReplaceAll(strings.TrimSpace(raw), "\\", "/"), "/")
+	if normalized == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(normalized, "/") || filepath.IsAbs(normalized) {
+		return "", fmt.Errorf("subpath %q must be relative", raw)
+	}
+	var segments []string
+	for _, part := range strings.Split(normalized, "/") {
+		seg := strings.TrimSpace(part)
+		if seg == "" || seg == "." || seg == ".." {
+			return "", fmt.Errorf("subpath %q contains an invalid segment %q", raw, part)
+		}
+		clean, err := sanitizeArtist(seg)
+		if err != nil {
+			return "", fmt.Errorf("subpath %q: %w", raw, err)
+		}
+		segments = append(segments, clean)
+	}
+	return filepath.Join(segments...), nil
+}
+
+// artistLooksLikeSource describes what an artist name resembles when it
+// is probably a URL or a bare Pixeldrain ID given in the wrong argument,
+// or returns "". The ID check wants eight letters and digits with a digit
+// and an inner capital ("aB3xYz9Q"), which real artist names rarely have.
+func artistLooksLikeSource(name string) string {
+	name = strings.TrimSpace(name)
+	lower := strings.ToLower(name)
+	if strings.Contains(lower, "://") || strings.HasPrefix(lower, "www.") || strings.Contains(lower, "pixeldrain.com/") {
+		return "a URL"
+	}
+	if len(name) != 8 {
+		return ""
+	}
+	var digit, innerUpper bool
+	for i, c := range name {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'A' && c <= 'Z':
+			innerUpper = innerUpper || i > 0
+		case c < 'a' || c > 'z':
+			return ""
+		}
+	}
+	if digit && innerUpper {
+		return "a Pixeldrain ID"
+	}
+	return ""
+}
+
 func sanitizeArtist(name string) (string, error) {
 	trimmed := strings.TrimSpace(name)
 	if trimmed == "" {
@@ -476,85 +1993,97 @@ func sanitizeArtist(name string) (string, error) {
 	return cleaned, nil
 }
 
-var pixeldrainIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,}$`)
-
-func resolvePixeldrain(raw string) (string, string, error) {
-	raw = strings.TrimSpace(raw)
-	if raw == "" {
-		return "", "", fmt.Errorf("url is required")
-	}
-
-	if pixeldrainIDPattern.MatchString(raw) && !strings.Contains(raw, "/") && !strings.Contains(raw, ".") {
-		id := raw
-		return id, fmt.Sprintf("https://pixeldrain.com/api/file/%s?download", url.PathEscape(id)), nil
-	}
-
-	u := raw
-	if !strings.Contains(raw, "://") {
-		u = "https://" + raw
-	}
-
-	parsed, err := url.Parse(u)
-	if err != nil {
-		return "", "", fmt.Errorf("invalid URL %q: %w", raw, err)
-	}
-
-	if parsed.Scheme == "" {
-		parsed.Scheme = "https"
-	}
-	host := strings.ToLower(parsed.Hostname())
-	if host == "" {
-		return "", "", fmt.Errorf("invalid URL %q: missing host", raw)
-	}
-	if !strings.Contains(host, "pixeldrain.com") && !strings.Contains(host, "doubledouble.top") {
-		return "", "", fmt.Errorf("unsupported host %q; expected Pixeldrain", host)
-	}
-
-	segments := strings.FieldsFunc(strings.Trim(parsed.Path, "/"), func(r rune) bool { return r == '/' })
-	if len(segments) == 0 {
-		return "", "", fmt.Errorf("missing Pixeldrain id in URL %q", raw)
+// linkFile hardlinks the extracted file src to dst for --hardlink, so the
+// library shares its bytes instead of holding a copy. It reports false when
+// linking is impossible (e.g. the temp dir is on another filesystem); the
+// reason is logged once and the caller copies instead. An explicit
+// --file-mode/FILE_MODE is applied to the link, which changes src too since
+// both names share one inode.
+func (r *runner) linkFile(src, dst string, srcMode os.FileMode) (bool, error) {
+	err := os.Link(src, dst)
+	if err == nil {
+		if mode, explicit := r.fileMode(srcMode); explicit {
+			if err := os.Chmod(dst, mode); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
 	}
-
-	id := segments[len(segments)-1]
-	id = strings.TrimSpace(id)
-	if !pixeldrainIDPattern.MatchString(id) {
-		return "", "", fmt.Errorf("invalid Pixeldrain id %q", id)
+	if !r.linkFailed {
+		r.linkFailed = true
+		r.log.Printf("warning: cannot hardlink into the library (%v); copying instead", err)
 	}
-
-	return id, fmt.Sprintf("https://pixeldrain.com/api/file/%s?download", url.PathEscape(id)), nil
+	return false, nil
 }
 
-func copyFile(src, dst string, mode os.FileMode) error {
-	in, err := os.Open(src)
+func (r *runner) copyFile(src, dst string, mode os.FileMode) error {
+	in, err := r.workFS().Open(src)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
 
-	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	out, err := r.createFile(r.library(), dst, mode)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	if _, err := io.Copy(out, in); err != nil {
+	if _, err := io.Copy(out, ctxReader{r.context(), in}); err != nil {
 		return err
 	}
 	return nil
 }
 
-func humanBytes(n int64) string {
-	if n < 1024 {
+// humanBytes renders n with one decimal in binary (KiB, 1024) or decimal
+// (KB, 1000) units, moving to the next unit once the rounded value reaches it.
+func humanBytes(n int64, units config.SizeUnits) string {
+	base, names := 1024.0, []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	if units == config.DecimalUnits {
+		base, names = 1000.0, []string{"KB", "MB", "GB", "TB", "PB"}
+	}
+	if float64(n) < base {
 		return fmt.Sprintf("%d B", n)
 	}
-	div, exp := int64(1024), 0
-	for m := n / 1024; m >= 1024 && exp < 4; m /= 1024 {
-		div *= 1024
+	value, exp := float64(n)/base, 0
+	for math.Round(value*10)/10 >= base && exp < len(names)-1 {
+		value /= base
 		exp++
 	}
-	value := float64(n) / float64(div)
-	unit := []string{"KB", "MB", "GB", "TB", "PB"}[exp]
-	return fmt.Sprintf("%.1f %s", value, unit)
+	return fmt.Sprintf("%.1f %s", value, names[exp])
+}
+
+// sizeUnits returns --size-units, falling back to SIZE_UNITS and then binary.
+func sizeUnits(cfg config.Config, opts Options) config.SizeUnits {
+	switch {
+	case opts.SizeUnits != "":
+		return opts.SizeUnits
+	case cfg.SizeUnits != "":
+		return cfg.SizeUnits
+	}
+	return config.BinaryUnits
+}
+
+// context returns the import's context, which is cancelled once --timeout
+// expires.
+func (r *runner) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// ctxReader stops a copy with the context's error once it is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
 }
 
 type progressWriter struct {
@@ -564,15 +2093,21 @@ type progressWriter struct {
 	lastPrint  time.Time
 	written    int64
 	forcePrint time.Duration
+	units      config.SizeUnits
+	out        io.Writer
+	// onProgress, if set, is called alongside each printed progress line.
+	onProgress func(written, total int64)
 }
 
-func newProgressWriter(total int64, label string) *progressWriter {
+func newProgressWriter(total int64, label string, units config.SizeUnits) *progressWriter {
 	return &progressWriter{
 		total:      total,
 		label:      label,
+		units:      units,
 		start:      time.Now(),
 		lastPrint:  time.Now(),
 		forcePrint: 200 * time.Millisecond,
+		out:        os.Stdout,
 	}
 }
 
@@ -585,7 +2120,7 @@ func (p *progressWriter) Write(b []byte) (int, error) {
 
 func (p *progressWriter) Finish() {
 	p.maybePrint(true)
-	fmt.Fprint(os.Stdout, "\n")
+	fmt.Fprint(p.out, "\n")
 }
 
 func (p *progressWriter) maybePrint(force bool) {
@@ -609,12 +2144,15 @@ func (p *progressWriter) maybePrint(force bool) {
 		}
 		eta := humanDuration(remaining, speed)
 		percent := float64(p.written) / float64(p.total) * 100
-		line = fmt.Sprintf("\r%s: %s/%s (%.1f%%, %s/s, eta %s)", p.label, humanBytes(p.written), humanBytes(p.total), percent, humanBytes(int64(speed)), eta)
+		line = fmt.Sprintf("\r%s: %s/%s (%.1f%%, %s/s, eta %s)", p.label, humanBytes(p.written, p.units), humanBytes(p.total, p.units), percent, humanBytes(int64(speed), p.units), eta)
 	} else {
-		line = fmt.Sprintf("\r%s: %s (unknown total, %s/s)", p.label, humanBytes(p.written), humanBytes(int64(speed)))
+		line = fmt.Sprintf("\r%s: %s (unknown total, %s/s)", p.label, humanBytes(p.written, p.units), humanBytes(int64(speed), p.units))
 	}
 
-	fmt.Fprint(os.Stdout, line)
+	fmt.Fprint(p.out, line)
+	if p.onProgress != nil {
+		p.onProgress(p.written, p.total)
+	}
 }
 
 func humanDuration(remaining int64, speed float64) string {
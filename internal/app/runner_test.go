@@ -1,46 +1,25 @@
 package app
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"cli-navidrome-helper/internal/config"
 )
 
-func TestResolvePixeldrain(t *testing.T) {
-	tests := []struct {
-		input   string
-		wantID  string
-		wantURL string
-		ok      bool
-	}{
-		{"abc123", "abc123", "https://pixeldrain.com/api/file/abc123?download", true},
-		{"https://pixeldrain.com/u/xyz", "xyz", "https://pixeldrain.com/api/file/xyz?download", true},
-		{"doubledouble.top/xyz", "xyz", "https://pixeldrain.com/api/file/xyz?download", true},
-		{"", "", "", false},
-		{"https://example.com/file.zip", "", "", false},
-	}
-
-	for _, tt := range tests {
-		id, url, err := resolvePixeldrain(tt.input)
-		if tt.ok && err != nil {
-			t.Fatalf("resolvePixeldrain(%q) returned error: %v", tt.input, err)
-		}
-		if !tt.ok && err == nil {
-			t.Fatalf("resolvePixeldrain(%q) expected error, got nil", tt.input)
-		}
-		if !tt.ok {
-			continue
-		}
-		if id != tt.wantID || url != tt.wantURL {
-			t.Fatalf("resolvePixeldrain(%q) = (%s, %s), want (%s, %s)", tt.input, id, url, tt.wantID, tt.wantURL)
-		}
-	}
-}
-
 func TestSanitizeArtist(t *testing.T) {
 	valid := map[string]string{
 		"Artist Name":           "Artist Name",
@@ -67,6 +46,59 @@ func TestSanitizeArtist(t *testing.T) {
 	}
 }
 
+func TestSanitizeSubpath(t *testing.T) {
+	valid := map[string]string{
+		"":               "",
+		"Live":           "Live",
+		"Live/2019":      filepath.Join("Live", "2019"),
+		` Live \ 2019/ `: filepath.Join("Live", "2019"),
+	}
+	for input, want := range valid {
+		got, err := sanitizeSubpath(input)
+		if err != nil {
+			t.Fatalf("sanitizeSubpath(%q) returned error: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("sanitizeSubpath(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	invalid := []string{"/abs", "../escape", "Live/../..", "Live//2019", "Live/./2019", "\\\\server\\share"}
+	for _, input := range invalid {
+		if _, err := sanitizeSubpath(input); err == nil {
+			t.Fatalf("sanitizeSubpath(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestArtistLooksLikeSource(t *testing.T) {
+	cases := map[string]string{
+		"https://pixeldrain.com/u/aB3xYz9Q": "a URL",
+		"pixeldrain.com/u/aB3xYz9Q":         "a URL",
+		"www.example.com":                   "a URL",
+		"aB3xYz9Q":                          "a Pixeldrain ID",
+		"Blink182":                          "",
+		"deadmau5":                          "",
+		"Metallic":                          "",
+		"AC/DC":                             "",
+	}
+	for input, want := range cases {
+		if got := artistLooksLikeSource(input); got != want {
+			t.Errorf("artistLooksLikeSource(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	var logs bytes.Buffer
+	r := &runner{opts: Options{Artist: "https://pixeldrain.com/u/aB3xYz9Q", URLs: []string{"Artist"}}, log: log.New(&logs, "", 0)}
+	if err := r.validateInputs(); err != nil || !strings.Contains(logs.String(), "were --artist and --url swapped?") {
+		t.Fatalf("validateInputs = %v, logs %q; want a swap warning", err, logs.String())
+	}
+	r.opts.Strict = true
+	if err := r.validateInputs(); err == nil || !strings.Contains(err.Error(), "--strict") {
+		t.Fatalf("validateInputs with --strict = %v, want an abort", err)
+	}
+}
+
 func TestPruneExtracted(t *testing.T) {
 	root := t.TempDir()
 	keep := filepath.Join(root, "keep.mp3")
@@ -129,6 +161,94 @@ func TestPruneExtractedProtectsAllFiles(t *testing.T) {
 	}
 }
 
+func TestPruneCascade(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		root := t.TempDir()
+		for _, name := range []string{"Album/01.flac", "Album/Scans/back.jpg", "Album/Scans/Inlay/inlay.jpg"} {
+			path := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r := &runner{
+			cfg:  config.Config{UnneededPatterns: []string{"*.jpg"}},
+			opts: Options{PruneCascade: true, DryRun: dryRun},
+			log:  log.New(io.Discard, "", 0),
+		}
+		if err := r.pruneExtracted(root); err != nil {
+			t.Fatalf("pruneExtracted(dryRun=%v) returned error: %v", dryRun, err)
+		}
+
+		scans := filepath.Join(root, "Album", "Scans")
+		if dryRun {
+			for _, dir := range []string{scans, filepath.Join(scans, "Inlay")} {
+				if _, ok := r.dryRunPruned[dir]; !ok {
+					t.Fatalf("dry-run should plan removing %s, planned %v", dir, r.dryRunPruned)
+				}
+			}
+			if _, err := os.Stat(scans); err != nil {
+				t.Fatalf("dry-run removed %s: %v", scans, err)
+			}
+		} else if _, err := os.Stat(scans); !os.IsNotExist(err) {
+			t.Fatalf("emptied Scans folder should be removed, got err=%v", err)
+		}
+		if _, ok := r.dryRunPruned[filepath.Join(root, "Album")]; ok {
+			t.Fatalf("Album still holds audio and must be kept")
+		}
+		if _, err := os.Stat(filepath.Join(root, "Album", "01.flac")); err != nil {
+			t.Fatalf("audio missing after prune: %v", err)
+		}
+	}
+}
+
+func TestPruneExtractedBySize(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]int{
+		"01 Song.flac":     4096,
+		".nomedia":         0,
+		"stub.txt":         10,
+		"Extras/video.mkv": 8192,
+		"02 Long.flac":     8192,
+	}
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		opts: Options{PruneSmallerThan: 100, PruneLargerThan: 5000},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.pruneExtracted(root); err != nil {
+		t.Fatalf("pruneExtracted returned error: %v", err)
+	}
+	for name := range files {
+		_, err := os.Stat(filepath.Join(root, name))
+		kept := name == "01 Song.flac" || name == "02 Long.flac"
+		if kept && err != nil {
+			t.Fatalf("%s should be kept: %v", name, err)
+		}
+		if !kept && !os.IsNotExist(err) {
+			t.Fatalf("%s should be pruned, got err=%v", name, err)
+		}
+	}
+
+	// Size limits share the safety check that refuses to prune everything.
+	r.opts.PruneSmallerThan = 1 << 20
+	if err := r.pruneExtracted(root); err == nil {
+		t.Fatalf("expected pruneExtracted to abort when every file is below the limit")
+	}
+}
+
 func TestMoveIntoLibraryCollision(t *testing.T) {
 	src := t.TempDir()
 	dest := filepath.Join(t.TempDir(), "library")
@@ -188,3 +308,1082 @@ func TestMoveIntoLibrarySuccess(t *testing.T) {
 		t.Fatalf("expected movedFiles=1, got %d", r.stats.movedFiles)
 	}
 }
+
+func TestMoveIntoLibraryCaseInsensitive(t *testing.T) {
+	src := t.TempDir()
+	for name, data := range map[string]string{"Album/Song.mp3": "short", "album/song.mp3": "longer"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		cfg:  config.Config{},
+		opts: Options{},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.moveIntoLibrary(src, filepath.Join(t.TempDir(), "library")); err != nil {
+		t.Fatalf("case-sensitive check should allow names differing in case, got %v", err)
+	}
+
+	r.caseInsensitive = true
+	err := r.moveIntoLibrary(src, filepath.Join(t.TempDir(), "library"))
+	if err == nil || !strings.Contains(err.Error(), "differ only in case") {
+		t.Fatalf("expected case-only collision error, got %v", err)
+	}
+
+	// keep-larger resolves the clash like one with an exact name.
+	dest := filepath.Join(t.TempDir(), "library")
+	r.opts.OnCollision = CollisionKeepLarger
+	if err := r.moveIntoLibrary(src, dest); err != nil {
+		t.Fatalf("moveIntoLibrary with keep-larger returned error: %v", err)
+	}
+	// The test filesystem is case-sensitive, so the folders stay apart.
+	if got, err := os.ReadFile(filepath.Join(dest, "album", "song.mp3")); err != nil || string(got) != "longer" {
+		t.Fatalf("album/song.mp3 = %q (err %v), want the larger copy", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Album", "Song.mp3")); !os.IsNotExist(err) {
+		t.Fatalf("the smaller copy Album/Song.mp3 was moved too (err %v)", err)
+	}
+}
+
+func TestEnsureNoCollisionsCaseInsensitiveExisting(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "library")
+
+	if err := os.WriteFile(filepath.Join(src, "Song.mp3"), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "song.mp3"), []byte("existing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &runner{
+		cfg:             config.Config{},
+		opts:            Options{},
+		log:             log.New(io.Discard, "", 0),
+		caseInsensitive: true,
+	}
+	if err := r.ensureNoCollisions(src, dest); err == nil {
+		t.Fatalf("expected collision with existing file differing in case")
+	}
+}
+
+func TestExtensionSummary(t *testing.T) {
+	var s runStats
+	s.recordExtension("01.flac", 2048)
+	s.recordExtension("02.FLAC", 2048)
+	s.recordExtension("album.cue", 10)
+	s.recordExtension("README", 5)
+
+	if got := s.extensions[".flac"]; got == nil || got.files != 2 || got.bytes != 4096 {
+		t.Fatalf("unexpected .flac stats: %+v", got)
+	}
+	want := "2 .flac (4.0 KiB), 1 (none) (5 B), 1 .cue (10 B)"
+	if got := s.extensionSummary(); got != want {
+		t.Fatalf("extensionSummary() = %q, want %q", got, want)
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	cases := []struct {
+		n     int64
+		units config.SizeUnits
+		want  string
+	}{
+		{0, config.BinaryUnits, "0 B"},
+		{1023, config.BinaryUnits, "1023 B"},
+		{1024, config.BinaryUnits, "1.0 KiB"},
+		{1536, config.BinaryUnits, "1.5 KiB"},
+		{1024*1024 - 1, config.BinaryUnits, "1.0 MiB"},
+		{1024 * 1024, config.BinaryUnits, "1.0 MiB"},
+		{5 << 30, config.BinaryUnits, "5.0 GiB"},
+		{999, config.DecimalUnits, "999 B"},
+		{1000, config.DecimalUnits, "1.0 KB"},
+		{1024, config.DecimalUnits, "1.0 KB"},
+		{999_949, config.DecimalUnits, "999.9 KB"},
+		{999_950, config.DecimalUnits, "1.0 MB"},
+		{1_000_000, config.DecimalUnits, "1.0 MB"},
+		{2_500_000_000, config.DecimalUnits, "2.5 GB"},
+		{1024, "", "1.0 KiB"},
+	}
+	for _, c := range cases {
+		if got := humanBytes(c.n, c.units); got != c.want {
+			t.Fatalf("humanBytes(%d, %q) = %q, want %q", c.n, c.units, got, c.want)
+		}
+	}
+}
+
+func TestPruneDupeExtensions(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		filepath.Join(root, "Album", "01 Intro.flac"),
+		filepath.Join(root, "Album", "01 Intro.mp3"),
+		filepath.Join(root, "Album", "02 Outro.mp3"),
+		filepath.Join(root, "Album", "Album.flac"),
+		filepath.Join(root, "Album", "Album.cue"),
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		cfg: config.Config{},
+		opts: Options{
+			PruneDupeExtensions: true,
+			PreferFormats:       []string{"flac", "mp3"},
+		},
+		log: log.New(io.Discard, "", 0),
+	}
+	if err := r.pruneDupeExtensions(root); err != nil {
+		t.Fatalf("pruneDupeExtensions returned error: %v", err)
+	}
+
+	if _, err := os.Stat(files[1]); !os.IsNotExist(err) {
+		t.Fatalf("mp3 duplicate should be removed, got err=%v", err)
+	}
+	for _, keep := range []string{files[0], files[2], files[3], files[4]} {
+		if _, err := os.Stat(keep); err != nil {
+			t.Fatalf("%s should be kept: %v", keep, err)
+		}
+	}
+	if r.stats.pruned != 1 {
+		t.Fatalf("expected pruned=1, got %d", r.stats.pruned)
+	}
+}
+
+func TestPruneDupeExtensionsDryRun(t *testing.T) {
+	root := t.TempDir()
+	flac := filepath.Join(root, "song.flac")
+	mp3 := filepath.Join(root, "song.mp3")
+	for _, f := range []string{flac, mp3} {
+		if err := os.WriteFile(f, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		cfg: config.Config{UnneededPatterns: []string{"*.flac"}},
+		opts: Options{
+			DryRun:              true,
+			PruneDupeExtensions: true,
+			PreferFormats:       []string{"flac", "mp3"},
+		},
+		log: log.New(io.Discard, "", 0),
+	}
+	if err := r.pruneExtracted(root); err != nil {
+		t.Fatalf("pruneExtracted returned error: %v", err)
+	}
+	if err := r.pruneDupeExtensions(root); err != nil {
+		t.Fatalf("pruneDupeExtensions returned error: %v", err)
+	}
+	if _, ok := r.dryRunPruned[mp3]; ok {
+		t.Fatalf("mp3 should survive once the flac is pruned by UNNEEDED_FILES")
+	}
+	for _, f := range []string{flac, mp3} {
+		if _, err := os.Stat(f); err != nil {
+			t.Fatalf("dry-run must not delete %s: %v", f, err)
+		}
+	}
+}
+
+func TestMatchPrunePatternAnchoring(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"cover.jpg", "cover.jpg", true},
+		{"cover.jpg", "Disc 1/cover.jpg", true},
+		{"/cover.jpg", "cover.jpg", true},
+		{"/cover.jpg", "Disc 1/cover.jpg", false},
+		{"**/cover.jpg", "cover.jpg", true},
+		{"**/cover.jpg", "Disc 1/cover.jpg", true},
+		{"*.txt", "Disc 1/notes.txt", true},
+		{"Samples/**", "Samples/kick.wav", true},
+		{"Samples/**", "Bonus/Samples/kick.wav", false},
+		{"/Samples", "Bonus/Samples", false},
+	}
+
+	for _, tt := range tests {
+		got, err := matchPrunePattern(tt.pattern, tt.rel)
+		if err != nil {
+			t.Fatalf("matchPrunePattern(%q, %q) returned error: %v", tt.pattern, tt.rel, err)
+		}
+		if got != tt.want {
+			t.Fatalf("matchPrunePattern(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestPromote(t *testing.T) {
+	staging := t.TempDir()
+	library := t.TempDir()
+
+	staged := filepath.Join(staging, "Artist", "Album", "song.mp3")
+	if err := os.MkdirAll(filepath.Dir(staged), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(staged, []byte("music"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library, StagingPath: staging},
+		opts: Options{Artist: "Artist"},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.Promote(); err != nil {
+		t.Fatalf("Promote returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(library, "Artist", "Album", "song.mp3")); err != nil {
+		t.Fatalf("expected promoted file in library: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(staging, "Artist")); !os.IsNotExist(err) {
+		t.Fatalf("staged copy should be removed, got err=%v", err)
+	}
+}
+
+func TestPromoteRequiresStagedArtist(t *testing.T) {
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: t.TempDir(), StagingPath: t.TempDir()},
+		opts: Options{Artist: "Missing"},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.Promote(); err == nil {
+		t.Fatalf("expected error when nothing is staged")
+	}
+}
+
+func TestMoveIntoLibraryRollbackOnError(t *testing.T) {
+	src := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "library")
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(dest, "existing.flac")
+	if err := os.WriteFile(existing, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "Album", "a.flac"), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A dangling symlink passes the collision check but fails to copy.
+	if err := os.Symlink(filepath.Join(src, "missing"), filepath.Join(src, "Album", "b.flac")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	r := &runner{
+		cfg:  config.Config{},
+		opts: Options{},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.moveIntoLibrary(src, dest); err == nil {
+		t.Fatalf("expected move failure")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Album", "a.flac")); err != nil {
+		t.Fatalf("without rollback written files should remain: %v", err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(dest, "Album")); err != nil {
+		t.Fatal(err)
+	}
+	r.opts.RollbackOnError = true
+	if err := r.moveIntoLibrary(src, dest); err == nil {
+		t.Fatalf("expected move failure")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Album")); !os.IsNotExist(err) {
+		t.Fatalf("rollback should remove created Album folder, got err=%v", err)
+	}
+	if _, err := os.Stat(existing); err != nil {
+		t.Fatalf("rollback must keep pre-existing files: %v", err)
+	}
+}
+
+func TestExecuteReuseTemp(t *testing.T) {
+	kept := t.TempDir()
+	library := t.TempDir()
+	for name, content := range map[string]string{"Album/01.flac": "audio", "Album/info.txt": "text"} {
+		path := filepath.Join(kept, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library, UnneededPatterns: []string{"*.txt"}},
+		opts: Options{Artist: "Artist", ReuseTemp: kept},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(library, "Artist", "Album", "01.flac")); err != nil {
+		t.Fatalf("expected imported file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(library, "Artist", "Album", "info.txt")); !os.IsNotExist(err) {
+		t.Fatalf("pruned file should not be imported, got err=%v", err)
+	}
+	for _, name := range []string{"01.flac", "info.txt"} {
+		if _, err := os.Stat(filepath.Join(kept, "Album", name)); err != nil {
+			t.Fatalf("reused directory must be left as it was: %v", err)
+		}
+	}
+
+	// Pruning worked on a copy, so the kept tree can be imported again
+	// with other patterns.
+	r.cfg = config.Config{NavidromeMusicPath: t.TempDir()}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("second Execute returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(r.cfg.NavidromeMusicPath, "Artist", "Album", "info.txt")); err != nil {
+		t.Fatalf("second import without patterns should keep info.txt: %v", err)
+	}
+
+	r.opts.ReuseTemp = t.TempDir()
+	if err := r.Execute(); err == nil {
+		t.Fatalf("expected error for empty reuse-temp directory")
+	}
+}
+
+func TestExecuteRequireAudio(t *testing.T) {
+	kept := t.TempDir()
+	library := t.TempDir()
+	for name, content := range map[string]string{"Album/readme.txt": "text", "Album/01.flac.txt": "not audio"} {
+		path := filepath.Join(kept, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library},
+		opts: Options{Artist: "Artist", ReuseTemp: kept, RequireAudio: true},
+		log:  log.New(io.Discard, "", 0),
+	}
+	err := r.Execute()
+	if err == nil || !strings.Contains(err.Error(), "no audio files") {
+		t.Fatalf("Execute error = %v, want a missing-audio error", err)
+	}
+	if _, err := os.Stat(filepath.Join(library, "Artist")); !os.IsNotExist(err) {
+		t.Fatalf("nothing should be imported without audio, got err=%v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(kept, "Album", "01.opus"), []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error with audio present: %v", err)
+	}
+}
+
+func TestTimingSummary(t *testing.T) {
+	s := runStats{
+		downloadBytes: 10 << 20,
+		phases: []phaseTiming{
+			{name: "resolve", duration: 3 * time.Millisecond},
+			{name: "download", duration: 2 * time.Second},
+			{name: "move", duration: 1500 * time.Millisecond},
+		},
+	}
+	want := "resolve 3ms, download 2s (5.0 MiB/s), move 1.5s; total 3.5s"
+	if got := s.timingSummary(3503 * time.Millisecond); got != want {
+		t.Fatalf("timingSummary() = %q, want %q", got, want)
+	}
+	if got := s.summary().PhaseMillis["download"]; got != 2000 {
+		t.Fatalf("summary download phase = %dms, want 2000", got)
+	}
+}
+
+func TestReportPrune(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"01.flac", "notes.txt", "Scans/front.jpg", "Scans/back.jpg"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out strings.Builder
+	r := &runner{
+		cfg:  config.Config{UnneededPatterns: []string{"*.txt", "/Scans", "*.log"}},
+		opts: Options{PruneReport: true},
+		log:  log.New(&out, "", 0),
+	}
+	if err := r.reportPrune(root); err != nil {
+		t.Fatalf("reportPrune returned error: %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"3 of 4 file(s) matched",
+		`"*.txt" matches 1 file(s)`,
+		"  notes.txt",
+		`"/Scans" matches 2 file(s)`,
+		"  Scans/back.jpg",
+		"  Scans/front.jpg",
+		`"*.log" matches 0 file(s)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("report missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "would remove all") {
+		t.Fatalf("unexpected all-files warning:\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "notes.txt")); err != nil {
+		t.Fatalf("prune report must not delete files: %v", err)
+	}
+
+	out.Reset()
+	r.cfg.UnneededPatterns = []string{"**"}
+	if err := r.reportPrune(root); err != nil {
+		t.Fatalf("reportPrune returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "would remove all 4 files") {
+		t.Fatalf("expected all-files warning:\n%s", out.String())
+	}
+}
+
+func TestExtractArchiveDuplicateEntries(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "dupes.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, content := range []string{"first", "second", "third"} {
+		w, err := zw.Create("CD1/01.flac")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dest := t.TempDir()
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	if err := r.extractArchive(archive, dest, map[string]string{}); err != nil {
+		t.Fatalf("extractArchive returned error: %v", err)
+	}
+	for name, want := range map[string]string{
+		"CD1/01.flac":     "first",
+		"CD1/01 (2).flac": "second",
+		"CD1/01 (3).flac": "third",
+	} {
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q (err %v), want %q", name, got, err, want)
+		}
+	}
+
+	r.opts.OnDupeEntry = DupeEntryFail
+	err = r.extractArchive(archive, t.TempDir(), map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "duplicate entry") {
+		t.Fatalf("expected duplicate entry error, got %v", err)
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	})
+
+	library := t.TempDir()
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library},
+		opts: Options{Artist: "Slow", URLs: []string{"abc123"}, TmpDir: t.TempDir(), Timeout: 50 * time.Millisecond},
+		log:  log.New(io.Discard, "", 0),
+	}
+	err := r.Execute()
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Execute() error = %v, want ErrTimeout", err)
+	}
+	entries, _ := os.ReadDir(library)
+	if len(entries) != 0 {
+		t.Fatalf("library should be untouched after a timeout, found %d entries", len(entries))
+	}
+}
+
+func TestExecuteRunTempRoot(t *testing.T) {
+	archive := zipBytes(t, map[string]string{"Album/01.flac": "audio"})
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(archive)
+	})
+
+	for _, keep := range []bool{true, false} {
+		base := t.TempDir()
+		r := &runner{
+			cfg:  config.Config{NavidromeMusicPath: t.TempDir()},
+			opts: Options{Artist: "Artist", URLs: []string{"abc123"}, TmpDir: base, KeepTemp: keep},
+			log:  log.New(io.Discard, "", 0),
+		}
+		if err := r.Execute(); err != nil {
+			t.Fatalf("Execute returned error: %v", err)
+		}
+
+		roots, _ := filepath.Glob(filepath.Join(base, "nd-import-*-*"))
+		if !keep {
+			if len(roots) != 0 {
+				t.Fatalf("temp root not cleaned up: %v", roots)
+			}
+			continue
+		}
+		if len(roots) != 1 {
+			t.Fatalf("expected one per-run temp root with --keep-temp, got %v", roots)
+		}
+		if _, err := os.Stat(filepath.Join(roots[0], "extract", "Album", "01.flac")); err != nil {
+			t.Fatalf("extract dir not nested in the run root: %v", err)
+		}
+		if downloads, _ := filepath.Glob(filepath.Join(roots[0], "download-*")); len(downloads) != 1 {
+			t.Fatalf("expected one download dir in the run root, got %v", downloads)
+		}
+	}
+}
+
+func TestExecuteKeepTempOnFailure(t *testing.T) {
+	archive := zipBytes(t, map[string]string{"Album/01.flac": "audio", "Album/02.flac": "audio"})
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(archive)
+	})
+
+	for _, maxEntries := range []int{0, 1} {
+		base := t.TempDir()
+		var logs bytes.Buffer
+		r := &runner{
+			cfg:  config.Config{NavidromeMusicPath: t.TempDir()},
+			opts: Options{Artist: "Artist", URLs: []string{"abc123"}, TmpDir: base, KeepTempOnFailure: true, MaxEntries: maxEntries},
+			log:  log.New(&logs, "", 0),
+		}
+		err := r.Execute()
+		roots, _ := filepath.Glob(filepath.Join(base, "nd-import-*-*"))
+		if maxEntries == 0 {
+			if err != nil {
+				t.Fatalf("Execute returned error: %v", err)
+			}
+			if len(roots) != 0 {
+				t.Fatalf("temp root not cleaned up after success: %v", roots)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("expected the entry cap to fail the import")
+		}
+		if len(roots) != 1 {
+			t.Fatalf("expected the temp root to be kept after a failure, got %v", roots)
+		}
+		if downloads, _ := filepath.Glob(filepath.Join(roots[0], "download-*", "pixeldrain-abc123.zip")); len(downloads) != 1 {
+			t.Fatalf("expected the failed download to be kept, got %v", downloads)
+		}
+		if !strings.Contains(logs.String(), "temp files kept in "+roots[0]) {
+			t.Fatalf("kept temp location not logged:\n%s", logs.String())
+		}
+	}
+}
+
+func TestExecuteHardlink(t *testing.T) {
+	kept := t.TempDir()
+	library := t.TempDir()
+	src := filepath.Join(kept, "Album", "01.flac")
+	if err := os.MkdirAll(filepath.Dir(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library},
+		opts: Options{Artist: "Artist", ReuseTemp: kept, Hardlink: true},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := os.Stat(filepath.Join(library, "Artist", "Album", "01.flac"))
+	if err != nil {
+		t.Fatalf("expected imported file: %v", err)
+	}
+	if !os.SameFile(srcInfo, dstInfo) {
+		t.Fatalf("expected the library file to be a hardlink of the extracted file")
+	}
+}
+
+func TestExecuteHardlinkFileMode(t *testing.T) {
+	kept := t.TempDir()
+	library := t.TempDir()
+	src := filepath.Join(kept, "Album", "01.flac")
+	if err := os.MkdirAll(filepath.Dir(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("audio"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library, FileMode: 0o664},
+		opts: Options{Artist: "Artist", ReuseTemp: kept, Hardlink: true},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(library, "Artist", "Album", "01.flac"))
+	if err != nil {
+		t.Fatalf("expected imported file: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0o664 {
+		t.Fatalf("linked file mode = %o, want FILE_MODE 664", got)
+	}
+}
+
+// zip64Archive hand-builds a stored single-entry archive whose local and
+// central headers carry their sizes in Zip64 extra fields, as writers do for
+// entries over 4 GiB.
+func zip64Archive(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	le := binary.LittleEndian
+	extra := le.AppendUint16(nil, 0x0001)
+	extra = le.AppendUint16(extra, 16)
+	extra = le.AppendUint64(extra, uint64(len(data)))
+	extra = le.AppendUint64(extra, uint64(len(data)))
+	crc := crc32.ChecksumIEEE(data)
+
+	var buf []byte
+	buf = le.AppendUint32(buf, 0x04034b50)
+	buf = le.AppendUint16(buf, 45) // version needed: Zip64
+	buf = append(buf, make([]byte, 8)...)
+	buf = le.AppendUint32(buf, crc)
+	buf = le.AppendUint32(buf, 0xffffffff)
+	buf = le.AppendUint32(buf, 0xffffffff)
+	buf = le.AppendUint16(buf, uint16(len(name)))
+	buf = le.AppendUint16(buf, uint16(len(extra)))
+	buf = append(buf, name...)
+	buf = append(buf, extra...)
+	buf = append(buf, data...)
+
+	cdOffset := len(buf)
+	buf = le.AppendUint32(buf, 0x02014b50)
+	buf = le.AppendUint16(buf, 45)
+	buf = le.AppendUint16(buf, 45)
+	buf = append(buf, make([]byte, 8)...)
+	buf = le.AppendUint32(buf, crc)
+	buf = le.AppendUint32(buf, 0xffffffff)
+	buf = le.AppendUint32(buf, 0xffffffff)
+	buf = le.AppendUint16(buf, uint16(len(name)))
+	buf = le.AppendUint16(buf, uint16(len(extra)))
+	buf = append(buf, make([]byte, 14)...) // comment, disk, attributes, local header offset 0
+	buf = append(buf, name...)
+	buf = append(buf, extra...)
+	cdSize := len(buf) - cdOffset
+
+	buf = le.AppendUint32(buf, 0x06054b50)
+	buf = append(buf, make([]byte, 4)...)
+	buf = le.AppendUint16(buf, 1)
+	buf = le.AppendUint16(buf, 1)
+	buf = le.AppendUint32(buf, uint32(cdSize))
+	buf = le.AppendUint32(buf, uint32(cdOffset))
+	buf = le.AppendUint16(buf, 0)
+
+	path := filepath.Join(t.TempDir(), "zip64.zip")
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractArchiveZip64Entry(t *testing.T) {
+	archive := zip64Archive(t, "Album/01.flac", []byte("lossless audio"))
+	dest := t.TempDir()
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	if err := r.extractArchive(archive, dest, map[string]string{}); err != nil {
+		t.Fatalf("extractArchive returned error: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "Album", "01.flac"))
+	if err != nil || string(got) != "lossless audio" {
+		t.Fatalf("extracted entry = %q, %v", got, err)
+	}
+}
+
+func TestExtractArchiveManyEntries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes more than 65535 files")
+	}
+	// More entries than a classic end of central directory record can count
+	// makes zip.Writer emit a Zip64 one.
+	const entries = 1<<16 + 10
+	archive := filepath.Join(t.TempDir(), "many.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for i := 0; i < entries; i++ {
+		if _, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("Disc %d/%05d.txt", i/1000, i), Method: zip.Store}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if data, err := os.ReadFile(archive); err != nil || !bytes.Contains(data, []byte("PK\x06\x06")) {
+		t.Fatalf("expected a Zip64 end of central directory record (err=%v)", err)
+	}
+
+	dest := t.TempDir()
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	if err := r.extractArchive(archive, dest, map[string]string{}); err != nil {
+		t.Fatalf("extractArchive returned error: %v", err)
+	}
+	if r.stats.extractedEntries != entries {
+		t.Fatalf("extractedEntries = %d, want %d", r.stats.extractedEntries, entries)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Disc 65", fmt.Sprintf("%05d.txt", entries-1))); err != nil {
+		t.Fatalf("last entry missing: %v", err)
+	}
+}
+
+func TestDownloadNamesFileByContent(t *testing.T) {
+	archive := zipBytes(t, map[string]string{"01.flac": "one"})
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/file/abc123":
+			w.Write(archive)
+		case "/file/f1":
+			io.WriteString(w, "fLaC audio")
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	r.opts.TmpDir = t.TempDir()
+	cases := []struct {
+		src     archiveSource
+		zipOnly bool
+		want    string
+	}{
+		{archiveSource{id: "abc123", url: fileDownloadURL("abc123"), host: "Pixeldrain", pixeldrain: true}, true, "pixeldrain-abc123.zip"},
+		{archiveSource{id: "f1", url: fileDownloadURL("f1"), host: "Pixeldrain", pixeldrain: true}, false, "pixeldrain-f1"},
+	}
+	for _, tc := range cases {
+		path, err := r.download(tc.src, tc.zipOnly)
+		if err != nil {
+			t.Fatalf("download(%s) returned error: %v", tc.src.id, err)
+		}
+		if filepath.Base(path) != tc.want {
+			t.Fatalf("download(%s) saved to %s, want %s", tc.src.id, filepath.Base(path), tc.want)
+		}
+	}
+
+	if got := downloadName(archiveSource{id: "../x y", host: "My Mirror"}); got != "my_mirror-___x_y" {
+		t.Fatalf("downloadName = %q, want my_mirror-___x_y", got)
+	}
+}
+
+func TestDownloadFailureRemovesTempDir(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/file/html":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html>captcha</html>")
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	for _, keep := range []bool{false, true} {
+		r := &runner{log: log.New(io.Discard, "", 0)}
+		r.opts.TmpDir = t.TempDir()
+		r.opts.KeepTemp = keep
+		for _, id := range []string{"missing", "html"} {
+			src := archiveSource{id: id, url: fileDownloadURL(id), host: "Pixeldrain", pixeldrain: true}
+			if _, err := r.download(src, true); err == nil {
+				t.Fatalf("download(%s) expected error, got nil", id)
+			}
+		}
+		downloads, _ := filepath.Glob(filepath.Join(r.opts.TmpDir, "nd-import-*-*", "download-*"))
+		if keep && len(downloads) != 2 {
+			t.Fatalf("expected --keep-temp to keep both download dirs, got %v", downloads)
+		}
+		if !keep && len(downloads) != 0 {
+			t.Fatalf("failed downloads left temp dirs behind: %v", downloads)
+		}
+	}
+}
+
+func TestExtractArchiveMaxEntries(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "files.zip")
+	data := zipBytes(t, map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"})
+	if err := os.WriteFile(archive, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	r := &runner{opts: Options{MaxEntries: 2}, log: log.New(io.Discard, "", 0)}
+	err := r.extractArchive(archive, dest, map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "3 entries, more than --max-entries 2") {
+		t.Fatalf("expected the entry cap to refuse the archive, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+		t.Fatalf("nothing should be extracted, found %d entries", len(entries))
+	}
+
+	r.opts.MaxEntries = 3
+	if err := r.extractArchive(archive, dest, map[string]string{}); err != nil {
+		t.Fatalf("extractArchive returned error: %v", err)
+	}
+}
+
+func TestExtractArchiveExtractOnly(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "album.zip")
+	if err := os.WriteFile(archive, zipBytes(t, map[string]string{
+		"Album/Disc 1/01.flac": "one",
+		"Album/Disc 2/01.flac": "two",
+		"Album/cover.jpg":      "art",
+	}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	r := &runner{opts: Options{ExtractOnly: []string{"**/Disc 1/**", "cover.jpg"}}, log: log.New(io.Discard, "", 0)}
+	if err := r.extractArchive(archive, dest, map[string]string{}); err != nil {
+		t.Fatalf("extractArchive returned error: %v", err)
+	}
+	for _, rel := range []string{"Album/Disc 1/01.flac", "Album/cover.jpg"} {
+		if _, err := os.Stat(filepath.Join(dest, rel)); err != nil {
+			t.Fatalf("selected entry %s missing: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Album", "Disc 2")); !os.IsNotExist(err) {
+		t.Fatalf("unselected Disc 2 was extracted (err=%v)", err)
+	}
+	if r.stats.extractedEntries != 2 {
+		t.Fatalf("extractedEntries = %d, want 2", r.stats.extractedEntries)
+	}
+
+	r.opts.ExtractOnly = []string{"*.mp3"}
+	if err := r.extractArchive(archive, t.TempDir(), map[string]string{}); err == nil || !strings.Contains(err.Error(), "matched no entries") {
+		t.Fatalf("expected a selection matching nothing to fail, got %v", err)
+	}
+}
+
+func TestExtractArchiveStreamsLargeEntries(t *testing.T) {
+	const size = 64 << 20
+	archive := filepath.Join(t.TempDir(), "large.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("Album/01.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, 1<<20)
+	for i := 0; i < size/len(chunk); i++ {
+		w.Write(chunk)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dest := t.TempDir()
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err := r.extractArchive(archive, dest, map[string]string{}); err != nil {
+		t.Fatalf("extractArchive returned error: %v", err)
+	}
+	runtime.ReadMemStats(&after)
+
+	info, err := os.Stat(filepath.Join(dest, "Album", "01.wav"))
+	if err != nil || info.Size() != size {
+		t.Fatalf("extracted entry = %v, %v; want %d bytes", info, err, size)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Fatalf("extracting a %d byte entry allocated %d bytes; it should be streamed", size, allocated)
+	}
+}
+
+func TestExecuteResumeTemp(t *testing.T) {
+	archive := zipBytes(t, map[string]string{"Album/01.flac": "first track", "Album/02.flac": "second track"})
+	var downloads int
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		downloads++
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(archive)
+	})
+
+	// An interrupted run left a complete download, a finished 01.flac and
+	// a truncated 02.flac behind.
+	root := filepath.Join(t.TempDir(), "nd-import-20260101-000000-1")
+	for rel, data := range map[string]string{
+		"download-1/pixeldrain-abc123.zip": string(archive),
+		"extract/Album/01.flac":            "first track",
+		"extract/Album/02.flac":            "sec",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	library := t.TempDir()
+	var logs bytes.Buffer
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library},
+		opts: Options{Artist: "Artist", URLs: []string{"abc123"}, ResumeTemp: root},
+		log:  log.New(&logs, "", 0),
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	if downloads != 0 {
+		t.Fatalf("complete download fetched again (%d requests)", downloads)
+	}
+	if !strings.Contains(logs.String(), "Kept 1 entries") {
+		t.Fatalf("expected one entry to be kept from the earlier run:\n%s", logs.String())
+	}
+	got, err := os.ReadFile(filepath.Join(library, "Artist", "Album", "02.flac"))
+	if err != nil || string(got) != "second track" {
+		t.Fatalf("truncated entry not re-extracted: %q, %v", got, err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Fatalf("resumed temp root not cleaned up after success (err=%v)", err)
+	}
+}
+
+func TestExecuteResumeTempNested(t *testing.T) {
+	inner := zipBytes(t, map[string]string{"01.flac": "first track", "02.flac": "second track"})
+	archive := zipBytes(t, map[string]string{"Album/Disc.zip": string(inner), "Album/cover.jpg": "jpeg"})
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(archive)
+	})
+
+	// The interrupted run had already unpacked and removed Disc.zip, but
+	// stopped while writing 02.flac.
+	root := filepath.Join(t.TempDir(), "nd-import-20260101-000000-1")
+	for rel, data := range map[string]string{
+		"download-1/pixeldrain-abc123.zip": string(archive),
+		"extract/Album/cover.jpg":          "jpeg",
+		"extract/Album/Disc/01.flac":       "first track",
+		"extract/Album/Disc/02.flac":       "sec",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	library := t.TempDir()
+	var logs bytes.Buffer
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library},
+		opts: Options{Artist: "Artist", URLs: []string{"abc123"}, ResumeTemp: root, RecurseArchives: true},
+		log:  log.New(&logs, "", 0),
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v\n%s", err, logs.String())
+	}
+	got, err := os.ReadFile(filepath.Join(library, "Artist", "Album", "Disc", "02.flac"))
+	if err != nil || string(got) != "second track" {
+		t.Fatalf("truncated nested entry not re-extracted: %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(library, "Artist", "Album", "Disc.zip")); !os.IsNotExist(err) {
+		t.Fatalf("nested archive imported as a file (err=%v)", err)
+	}
+}
+
+func TestExecuteStrictDryRun(t *testing.T) {
+	archives := map[string][]byte{
+		"clean":   zipBytes(t, map[string]string{"Album/01.flac": "new track"}),
+		"collide": zipBytes(t, map[string]string{"Album/02.flac": "other take"}),
+		"noaudio": zipBytes(t, map[string]string{"Album/cover.jpg": "jpeg"}),
+	}
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		data, ok := archives[strings.TrimPrefix(req.URL.Path, "/file/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(data)
+	})
+
+	library := t.TempDir()
+	existing := filepath.Join(library, "Artist", "Album", "02.flac")
+	if err := os.MkdirAll(filepath.Dir(existing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("library take"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, wantErr := range map[string]string{"clean": "", "collide": "collision", "noaudio": "no audio"} {
+		r := &runner{
+			cfg: config.Config{NavidromeMusicPath: library},
+			// keep-larger would resolve the collision in a real run.
+			opts: Options{Artist: "Artist", URLs: []string{id}, DryRun: true, StrictDryRun: true, OnCollision: CollisionKeepLarger, TmpDir: t.TempDir()},
+			log:  log.New(io.Discard, "", 0),
+		}
+		err := r.Execute()
+		if wantErr == "" && err != nil {
+			t.Fatalf("%s: Execute returned error: %v", id, err)
+		}
+		if wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)) {
+			t.Fatalf("%s: Execute error = %v, want %q", id, err, wantErr)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(library, "Artist", "Album", "01.flac")); !os.IsNotExist(err) {
+		t.Fatalf("strict dry run wrote to the library (err=%v)", err)
+	}
+	if got, _ := os.ReadFile(existing); string(got) != "library take" {
+		t.Fatalf("strict dry run changed an existing file: %q", got)
+	}
+}
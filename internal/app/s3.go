@@ -0,0 +1,435 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// unsignedPayload lets uploads stream without hashing the body first.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// emptySHA256 is the payload hash of requests without a body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Now is the signing clock; tests pin it.
+var s3Now = time.Now
+
+// s3FS writes the library into an S3-compatible bucket. Paths map to keys by
+// dropping the leading "/", so "/prefix/Artist/Album/01.flac" becomes the
+// object "prefix/Artist/Album/01.flac". Directories are implied by keys:
+// MkdirAll does nothing and a directory "exists" while any key lies under it.
+// Modes, times and ownership have no meaning for objects and are ignored.
+type s3FS struct {
+	bucket config.Bucket
+	client *http.Client
+	ctx    context.Context
+	tmpDir string // where uploads are buffered; "" means os.TempDir
+}
+
+func (r *runner) bucketFS() *s3FS {
+	return &s3FS{bucket: *r.cfg.Bucket, client: &http.Client{}, ctx: r.context(), tmpDir: r.tmpBase()}
+}
+
+func (s *s3FS) key(name string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+}
+
+// objectURL renders name as s3://bucket/key for logs.
+func (s *s3FS) objectURL(name string) string {
+	return "s3://" + s.bucket.Name + "/" + s.key(name)
+}
+
+// request builds and signs a path-style request for key ("" addresses the
+// bucket itself).
+func (s *s3FS) request(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	raw := s.bucket.Endpoint + "/" + s3Escape(s.bucket.Name, false)
+	if key != "" {
+		raw += "/" + s3Escape(key, false)
+	}
+	if len(query) > 0 {
+		raw += "?" + s3Query(query)
+	}
+	req, err := http.NewRequestWithContext(s.ctx, method, raw, body)
+	if err != nil {
+		return nil, err
+	}
+	payload := emptySHA256
+	if body != nil {
+		payload = unsignedPayload
+	}
+	signS3(req, s.bucket, payload, s3Now())
+	return req, nil
+}
+
+func (s *s3FS) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fs.ErrNotExist
+	}
+	var apiErr struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+	if apiErr.Code != "" {
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, apiErr.Code, apiErr.Message)
+	}
+	return nil, fmt.Errorf("s3 %s %s: unexpected status %s", req.Method, req.URL.Path, resp.Status)
+}
+
+// Lstat is Stat; objects cannot be symlinks.
+func (s *s3FS) Lstat(name string) (fs.FileInfo, error) { return s.Stat(name) }
+
+// Stat reports an object via HeadObject, or a directory when some key lies
+// under name.
+func (s *s3FS) Stat(name string) (fs.FileInfo, error) {
+	key := s.key(name)
+	if key == "" || key == "." {
+		return remoteInfo{name: "/", dir: true}, nil
+	}
+	req, err := s.request(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err == nil {
+		resp.Body.Close()
+		return remoteInfo{name: path.Base(key), size: resp.ContentLength}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	keys, err := s.list(key+"/", 1)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if len(keys) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return remoteInfo{name: path.Base(key), dir: true}, nil
+}
+
+type listedObject struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+// list returns the objects under prefix via ListObjectsV2, stopping after
+// limit keys when limit is positive.
+func (s *s3FS) list(prefix string, limit int) ([]listedObject, error) {
+	var objects []listedObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if limit > 0 {
+			query.Set("max-keys", fmt.Sprint(limit))
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := s.request(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("bucket %q not found", s.bucket.Name)
+			}
+			return nil, err
+		}
+		var page struct {
+			Contents              []listedObject `xml:"Contents"`
+			IsTruncated           bool           `xml:"IsTruncated"`
+			NextContinuationToken string         `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode bucket listing: %w", err)
+		}
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" || (limit > 0 && len(objects) >= limit) {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (s *s3FS) MkdirAll(name string, perm os.FileMode) error      { return nil }
+func (s *s3FS) Chmod(name string, mode os.FileMode) error         { return nil }
+func (s *s3FS) Chtimes(name string, atime, mtime time.Time) error { return nil }
+
+// Lchown reports ErrUnsupported so --owner logs a warning instead of failing.
+func (s *s3FS) Lchown(name string, uid, gid int) error { return errors.ErrUnsupported }
+
+func (s *s3FS) Rename(oldpath, newpath string) error {
+	return &fs.PathError{Op: "rename", Path: oldpath, Err: errors.ErrUnsupported}
+}
+
+// Create buffers the object in a local temp file and uploads it on Close,
+// since PutObject needs the length up front.
+func (s *s3FS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	tmp, err := os.CreateTemp(s.tmpDir, "nd-import-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(tmp.Name())
+	return &objectWriter{s: s, key: s.key(name), tmp: tmp}, nil
+}
+
+type objectWriter struct {
+	s   *s3FS
+	key string
+	tmp *os.File
+}
+
+func (w *objectWriter) Write(b []byte) (int, error) { return w.tmp.Write(b) }
+
+func (w *objectWriter) Close() error {
+	defer w.tmp.Close()
+	size, err := w.tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := w.s.request(http.MethodPut, w.key, nil, io.NopCloser(w.tmp))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	resp, err := w.s.do(req)
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", w.s.objectURL(w.key), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3FS) Open(name string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, s.key(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return resp.Body, nil
+}
+
+// Remove deletes the object at name. Directories are implied, so removing
+// one is a no-op (S3 treats deleting a missing key as success).
+func (s *s3FS) Remove(name string) error {
+	req, err := s.request(http.MethodDelete, s.key(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (s *s3FS) RemoveAll(name string) error {
+	objects, err := s.list(s.key(name)+"/", 0)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.Remove("/" + obj.Key); err != nil {
+			return err
+		}
+	}
+	return s.Remove(name)
+}
+
+// WalkDir lists every key under root and replays them with the directories
+// their paths imply.
+func (s *s3FS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := s.Stat(root)
+	if err != nil {
+		return skipDirOK(fn(root, nil, err))
+	}
+	if !info.IsDir() {
+		return skipDirOK(fn(root, fs.FileInfoToDirEntry(info), nil))
+	}
+	prefix := s.key(root) + "/"
+	if prefix == "/" {
+		prefix = ""
+	}
+	objects, err := s.list(prefix, 0)
+	if err != nil {
+		return skipDirOK(fn(root, nil, err))
+	}
+
+	base := strings.TrimSuffix(root, "/")
+	dirs := make(map[string]bool)
+	var entries []walkEntry
+	for _, obj := range objects {
+		rel := strings.TrimPrefix(obj.Key, prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue // folder placeholder objects
+		}
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if dirs[dir] {
+				break
+			}
+			dirs[dir] = true
+			entries = append(entries, walkEntry{path: base + "/" + dir, info: remoteInfo{name: path.Base(dir), dir: true}})
+		}
+		entries = append(entries, walkEntry{path: base + "/" + rel, info: remoteInfo{name: path.Base(rel), size: obj.Size}})
+	}
+	return replayWalk(root, info, entries, fn)
+}
+
+// logPlannedObjects lists, for --dry-run, the objects a move from
+// extractDir into dest would create.
+func (r *runner) logPlannedObjects(bucket *s3FS, extractDir, dest string) error {
+	var n int
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, skip := r.collisionSkipped[path]; skip {
+			return nil
+		}
+		if _, gone := r.dryRunPruned[path]; gone {
+			return nil
+		}
+		rel, err := filepath.Rel(extractDir, path)
+		if err != nil {
+			return err
+		}
+		r.log.Printf("dry-run: would upload %s", bucket.objectURL(filepath.Join(dest, r.destRel(rel, false))))
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.log.Printf("dry-run: would create %d object(s) under %s", n, bucket.objectURL(dest))
+	return nil
+}
+
+// signS3 adds AWS Signature Version 4 headers to req, signing the host, every
+// header already set and the x-amz-* headers it adds.
+func signS3(req *http.Request, b config.Bucket, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + b.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + b.SecretAccessKey)
+	for _, part := range []string{day, b.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Query renders query sorted by key with SigV4 escaping.
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything but unreserved characters (and "/"
+// unless escapeSlash), as SigV4 requires.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,437 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// sftpDialTimeout bounds connecting and logging in to an sftp:// host.
+const sftpDialTimeout = 30 * time.Second
+
+// dialSFTP connects to remote and starts its sftp subsystem; tests replace
+// it to talk to an in-process server.
+var dialSFTP = func(ctx context.Context, remote config.Remote) (*sftpClient, io.Closer, error) {
+	hostKeys, err := knownhosts.New(remote.KnownHosts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read known_hosts %q: %w", remote.KnownHosts, err)
+	}
+	auth, closeAgent, err := sftpAuth(remote)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeAgent()
+	cfg := &ssh.ClientConfig{User: remote.User, Auth: auth, HostKeyCallback: hostKeys, Timeout: sftpDialTimeout}
+
+	dialCtx, cancel := context.WithTimeout(ctx, sftpDialTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(dialCtx, "tcp", remote.Address())
+	if err != nil {
+		return nil, nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, remote.Address(), cfg)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	c, err := startSFTP(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return c, client, nil
+}
+
+// startSFTP opens a session on client running the sftp subsystem.
+func startSFTP(client *ssh.Client) (*sftpClient, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return nil, fmt.Errorf("start sftp subsystem: %w", err)
+	}
+	return newSFTPClient(r, w)
+}
+
+// sftpAuth lists the ways to log in to remote, in the order OpenSSH tries
+// them: the key file, the SSH agent, then the password (also offered for
+// keyboard-interactive prompts). The returned func releases the agent.
+func sftpAuth(remote config.Remote) ([]ssh.AuthMethod, func(), error) {
+	var auth []ssh.AuthMethod
+	release := func() {}
+	if remote.KeyFile != "" {
+		pem, err := os.ReadFile(remote.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("SFTP_KEY_FILE: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, nil, fmt.Errorf("SFTP_KEY_FILE %q is passphrase-protected; load it into an SSH agent instead", remote.KeyFile)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("SFTP_KEY_FILE %q: %w", remote.KeyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			release = func() { conn.Close() }
+		}
+	}
+	if remote.Password != "" {
+		auth = append(auth, ssh.Password(remote.Password),
+			ssh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = remote.Password
+				}
+				return answers, nil
+			}))
+	}
+	if len(auth) == 0 {
+		return nil, nil, errors.New("no SFTP login available: set SFTP_KEY_FILE or SFTP_PASSWORD, or start an SSH agent")
+	}
+	return auth, release, nil
+}
+
+// sftpFS writes the library to a host over SFTP (sftp:// NAVIDROME_MUSIC_PATH).
+// The connection is opened on first use and shared by the whole import;
+// close releases it.
+type sftpFS struct {
+	remote config.Remote
+	ctx    context.Context
+
+	once   sync.Once
+	client *sftpClient
+	conn   io.Closer
+	stop   func() bool // unregisters the cancellation hook
+	err    error
+}
+
+// sftpLibrary returns the runner's sftp:// library, creating it once.
+func (r *runner) sftpLibrary() *sftpFS {
+	if r.sftp == nil {
+		r.sftp = &sftpFS{remote: *r.cfg.Remote, ctx: r.context()}
+	}
+	return r.sftp
+}
+
+// closeLibrary ends the sftp:// connection, if one was opened.
+func (r *runner) closeLibrary() {
+	if r.sftp != nil {
+		r.sftp.close()
+		r.sftp = nil
+	}
+}
+
+func (s *sftpFS) connect() (*sftpClient, error) {
+	s.once.Do(func() {
+		s.client, s.conn, s.err = dialSFTP(s.ctx, s.remote)
+		if s.err != nil {
+			s.err = fmt.Errorf("connect to sftp://%s: %w", s.remote.Address(), s.err)
+			return
+		}
+		// A cancelled import (--timeout) drops the connection, which fails
+		// the request in progress.
+		s.stop = context.AfterFunc(s.ctx, func() { s.conn.Close() })
+	})
+	return s.client, s.err
+}
+
+func (s *sftpFS) close() {
+	if s.conn != nil {
+		s.stop()
+		s.client.Close()
+		s.conn.Close()
+	}
+}
+
+// pathErr wraps err with the operation and remote path.
+func (s *sftpFS) pathErr(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: "sftp://" + s.remote.Host + name, Err: err}
+}
+
+func (s *sftpFS) stat(op string, typ byte, name string) (fs.FileInfo, error) {
+	c, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	name = path.Clean(filepath.ToSlash(name))
+	a, err := c.stat(typ, name)
+	if err != nil {
+		return nil, s.pathErr(op, name, err)
+	}
+	return newSFTPInfo(name, a), nil
+}
+
+func (s *sftpFS) Stat(name string) (fs.FileInfo, error) {
+	return s.stat("stat", fxpStat, name)
+}
+
+func (s *sftpFS) Lstat(name string) (fs.FileInfo, error) {
+	return s.stat("lstat", fxpLstat, name)
+}
+
+// MkdirAll creates name and any missing parents. It walks up to the
+// deepest folder that exists, so parents the login cannot write to are
+// never touched.
+func (s *sftpFS) MkdirAll(name string, perm os.FileMode) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	name = path.Clean(filepath.ToSlash(name))
+	var missing []string
+	for dir := name; ; dir = path.Dir(dir) {
+		a, err := c.stat(fxpStat, dir)
+		if err == nil {
+			if !a.mode().IsDir() {
+				return s.pathErr("mkdir", dir, errors.New("not a directory"))
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) || dir == "/" {
+			return s.pathErr("mkdir", dir, err)
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		var b sftpBuf
+		b.attrs(permAttrs(perm))
+		if err := c.pathCall(fxpMkdir, missing[i], b); err != nil {
+			// Another client may have created it meanwhile.
+			if a, statErr := c.stat(fxpStat, missing[i]); statErr != nil || !a.mode().IsDir() {
+				return s.pathErr("mkdir", missing[i], err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *sftpFS) Chmod(name string, mode os.FileMode) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	return s.pathErr("chmod", name, c.setstat(filepath.ToSlash(name), permAttrs(mode)))
+}
+
+func (s *sftpFS) Chtimes(name string, atime, mtime time.Time) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	a := sftpAttrs{flags: attrACModTime, atime: uint32(atime.Unix()), mtime: uint32(mtime.Unix())}
+	return s.pathErr("chtimes", name, c.setstat(filepath.ToSlash(name), a))
+}
+
+// Lchown sets the owner with SETSTAT. SFTP version 3 has no lchown, but
+// imports never create symlinks on the host. An id of -1 keeps the
+// current one.
+func (s *sftpFS) Lchown(name string, uid, gid int) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	name = filepath.ToSlash(name)
+	a := sftpAttrs{flags: attrUIDGID, uid: uint32(uid), gid: uint32(gid)}
+	if uid < 0 || gid < 0 {
+		cur, err := c.stat(fxpLstat, name)
+		if err != nil {
+			return s.pathErr("chown", name, err)
+		}
+		if uid < 0 {
+			a.uid = cur.uid
+		}
+		if gid < 0 {
+			a.gid = cur.gid
+		}
+	}
+	return s.pathErr("chown", name, c.setstat(name, a))
+}
+
+// Create uploads to name, replacing it. perm is set explicitly after the
+// open, so the server's umask does not apply.
+func (s *sftpFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	c, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	name = filepath.ToSlash(name)
+	h, err := c.open(name, fxfWrite|fxfCreat|fxfTrunc, permAttrs(perm))
+	if err != nil {
+		return nil, s.pathErr("create", name, err)
+	}
+	var b sftpBuf
+	b.str(h)
+	b.attrs(permAttrs(perm))
+	reply, err := c.call(fxpFsetstat, b)
+	if err == nil {
+		err = statusErr(reply)
+	}
+	if err != nil {
+		c.closeHandle(h)
+		return nil, s.pathErr("chmod", name, err)
+	}
+	return &sftpWriter{c: c, handle: h}, nil
+}
+
+func (s *sftpFS) Open(name string) (io.ReadCloser, error) {
+	c, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	name = filepath.ToSlash(name)
+	h, err := c.open(name, fxfRead, sftpAttrs{})
+	if err != nil {
+		return nil, s.pathErr("open", name, err)
+	}
+	return &sftpFileReader{c: c, handle: h}, nil
+}
+
+// Rename replaces newpath like os.Rename. Servers without the OpenSSH
+// posix-rename extension refuse to rename over a file, so it is removed
+// first there.
+func (s *sftpFS) Rename(oldpath, newpath string) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	oldpath, newpath = filepath.ToSlash(oldpath), filepath.ToSlash(newpath)
+	err = c.rename(oldpath, newpath)
+	if _, posix := c.exts[posixRename]; err != nil && !posix {
+		if a, statErr := c.stat(fxpLstat, newpath); statErr == nil && !a.mode().IsDir() {
+			if err = c.pathCall(fxpRemove, newpath, nil); err == nil {
+				err = c.rename(oldpath, newpath)
+			}
+		}
+	}
+	return s.pathErr("rename", oldpath, err)
+}
+
+func (s *sftpFS) Remove(name string) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	name = filepath.ToSlash(name)
+	a, err := c.stat(fxpLstat, name)
+	if err != nil {
+		return s.pathErr("remove", name, err)
+	}
+	if a.mode().IsDir() {
+		return s.pathErr("remove", name, c.pathCall(fxpRmdir, name, nil))
+	}
+	return s.pathErr("remove", name, c.pathCall(fxpRemove, name, nil))
+}
+
+// RemoveAll removes name and everything below it; a missing name is not
+// an error.
+func (s *sftpFS) RemoveAll(name string) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	name = path.Clean(filepath.ToSlash(name))
+	a, err := c.stat(fxpLstat, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return s.pathErr("remove", name, err)
+	}
+	return s.removeTree(c, name, a)
+}
+
+func (s *sftpFS) removeTree(c *sftpClient, name string, a sftpAttrs) error {
+	if !a.mode().IsDir() {
+		return s.pathErr("remove", name, c.pathCall(fxpRemove, name, nil))
+	}
+	entries, err := c.readDir(name)
+	if err != nil {
+		return s.pathErr("readdir", name, err)
+	}
+	for _, e := range entries {
+		if err := s.removeTree(c, path.Join(name, e.name), e.attrs); err != nil {
+			return err
+		}
+	}
+	return s.pathErr("remove", name, c.pathCall(fxpRmdir, name, nil))
+}
+
+// WalkDir walks root like filepath.WalkDir, listing one folder per
+// request, in lexical order.
+func (s *sftpFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := s.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = s.walk(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (s *sftpFS) walk(name string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	entries, err := c.readDir(filepath.ToSlash(name))
+	if err != nil {
+		if err = fn(name, d, s.pathErr("readdir", name, err)); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, e := range entries {
+		child := filepath.Join(name, e.name)
+		if err := s.walk(child, fs.FileInfoToDirEntry(newSFTPInfo(child, e.attrs)), fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
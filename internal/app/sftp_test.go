@@ -0,0 +1,488 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// testSFTPServer answers the requests sftpFS sends on the local disk;
+// remote paths are local paths. posix advertises posix-rename; mkdirs
+// records every MKDIR.
+type testSFTPServer struct {
+	posix bool
+
+	mu      sync.Mutex
+	mkdirs  []string
+	handles map[string]any // *os.File, or the []os.DirEntry left to list
+	next    int
+}
+
+func (s *testSFTPServer) serve(r io.Reader, w io.Writer) {
+	if _, err := readPacket(r); err != nil {
+		return
+	}
+	var version sftpBuf
+	version.byte(fxpVersion)
+	version.u32(3)
+	if s.posix {
+		version.str(posixRename)
+		version.str("1")
+	}
+	if writePacket(w, version) != nil {
+		return
+	}
+	for {
+		pkt, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		rd := sftpReader{b: pkt[1:]}
+		id := rd.u32()
+		var out sftpBuf
+		s.handle(pkt[0], &rd, &out)
+		reply := sftpBuf{out[0]}
+		reply.u32(id)
+		if writePacket(w, append(reply, out[1:]...)) != nil {
+			return
+		}
+	}
+}
+
+func (s *testSFTPServer) status(out *sftpBuf, err error) {
+	code, msg := uint32(fxOK), ""
+	switch {
+	case err == nil:
+	case err == io.EOF:
+		code = fxEOF
+	case errors.Is(err, fs.ErrNotExist):
+		code = fxNoSuchFile
+	case errors.Is(err, fs.ErrPermission):
+		code = fxPermissionDenied
+	default:
+		code, msg = 4, err.Error()
+	}
+	out.byte(fxpStatus)
+	out.u32(code)
+	out.str(msg)
+	out.str("")
+}
+
+func (s *testSFTPServer) newHandle(v any) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handles == nil {
+		s.handles = make(map[string]any)
+	}
+	s.next++
+	h := strconv.Itoa(s.next)
+	s.handles[h] = v
+	return h
+}
+
+func (s *testSFTPServer) lookup(h string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handles[h]
+}
+
+func testAttrs(info fs.FileInfo) sftpAttrs {
+	a := permAttrs(info.Mode())
+	a.flags |= attrSize | attrACModTime
+	a.size = uint64(info.Size())
+	a.mtime = uint32(info.ModTime().Unix())
+	if info.IsDir() {
+		a.perm |= sIFDIR
+	} else {
+		a.perm |= 0o100000
+	}
+	return a
+}
+
+func (s *testSFTPServer) handle(typ byte, rd *sftpReader, out *sftpBuf) {
+	attrsReply := func(info fs.FileInfo, err error) {
+		if err != nil {
+			s.status(out, err)
+			return
+		}
+		out.byte(fxpAttrs)
+		out.attrs(testAttrs(info))
+	}
+	setstat := func(name string, a sftpAttrs) error {
+		if a.flags&attrPermissions != 0 {
+			if err := os.Chmod(name, permFromAttrs(a)); err != nil {
+				return err
+			}
+		}
+		if a.flags&attrUIDGID != 0 {
+			if err := os.Lchown(name, int(a.uid), int(a.gid)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch typ {
+	case fxpOpen:
+		name, pflags, a := rd.str(), rd.u32(), rd.attrs()
+		flag := os.O_RDONLY
+		if pflags&fxfWrite != 0 {
+			flag = os.O_WRONLY
+		}
+		if pflags&fxfCreat != 0 {
+			flag |= os.O_CREATE
+		}
+		if pflags&fxfTrunc != 0 {
+			flag |= os.O_TRUNC
+		}
+		f, err := os.OpenFile(name, flag, permFromAttrs(a))
+		if err != nil {
+			s.status(out, err)
+			return
+		}
+		out.byte(fxpHandle)
+		out.str(s.newHandle(f))
+	case fxpClose:
+		h := rd.str()
+		if f, ok := s.lookup(h).(*os.File); ok {
+			f.Close()
+		}
+		s.status(out, nil)
+	case fxpRead:
+		f, off, n := s.lookup(rd.str()).(*os.File), rd.u64(), rd.u32()
+		buf := make([]byte, n)
+		got, err := f.ReadAt(buf, int64(off))
+		if got == 0 {
+			s.status(out, err)
+			return
+		}
+		out.byte(fxpData)
+		out.str(string(buf[:got]))
+	case fxpWrite:
+		f, off, data := s.lookup(rd.str()).(*os.File), rd.u64(), rd.str()
+		_, err := f.WriteAt([]byte(data), int64(off))
+		s.status(out, err)
+	case fxpStat:
+		attrsReply(os.Stat(rd.str()))
+	case fxpLstat:
+		attrsReply(os.Lstat(rd.str()))
+	case fxpSetstat:
+		s.status(out, setstat(rd.str(), rd.attrs()))
+	case fxpFsetstat:
+		f := s.lookup(rd.str()).(*os.File)
+		s.status(out, setstat(f.Name(), rd.attrs()))
+	case fxpOpendir:
+		entries, err := os.ReadDir(rd.str())
+		if err != nil {
+			s.status(out, err)
+			return
+		}
+		out.byte(fxpHandle)
+		out.str(s.newHandle(entries))
+	case fxpReaddir:
+		h := rd.str()
+		entries, _ := s.lookup(h).([]os.DirEntry)
+		if len(entries) == 0 {
+			s.status(out, io.EOF)
+			return
+		}
+		s.mu.Lock()
+		s.handles[h] = []os.DirEntry(nil)
+		s.mu.Unlock()
+		out.byte(fxpName)
+		out.u32(uint32(len(entries) + 1))
+		out.str(".")
+		out.str(".")
+		out.attrs(sftpAttrs{})
+		for _, e := range entries {
+			info, _ := e.Info()
+			out.str(e.Name())
+			out.str(e.Name())
+			out.attrs(testAttrs(info))
+		}
+	case fxpRemove:
+		name := rd.str()
+		if info, err := os.Lstat(name); err == nil && info.IsDir() {
+			s.status(out, errors.New("is a directory"))
+			return
+		}
+		s.status(out, os.Remove(name))
+	case fxpMkdir:
+		name, a := rd.str(), rd.attrs()
+		s.mu.Lock()
+		s.mkdirs = append(s.mkdirs, name)
+		s.mu.Unlock()
+		s.status(out, os.Mkdir(name, permFromAttrs(a)))
+	case fxpRmdir:
+		s.status(out, syscallRmdir(rd.str()))
+	case fxpRename:
+		oldpath, newpath := rd.str(), rd.str()
+		if _, err := os.Lstat(newpath); err == nil {
+			s.status(out, errors.New("target exists"))
+			return
+		}
+		s.status(out, os.Rename(oldpath, newpath))
+	case fxpExtended:
+		if rd.str() != posixRename || !s.posix {
+			s.status(out, errors.New("unsupported"))
+			return
+		}
+		s.status(out, os.Rename(rd.str(), rd.str()))
+	default:
+		s.status(out, errors.New("unsupported"))
+	}
+}
+
+func permFromAttrs(a sftpAttrs) os.FileMode {
+	if a.flags&attrPermissions == 0 {
+		return 0o644
+	}
+	return sftpAttrs{perm: a.perm &^ sIFMT}.mode()
+}
+
+// syscallRmdir removes an empty directory only, like SSH_FXP_RMDIR.
+func syscallRmdir(name string) error {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+	return os.Remove(name)
+}
+
+// fakeSFTP makes sftp:// libraries talk to srv over in-memory pipes.
+func fakeSFTP(t *testing.T, srv *testSFTPServer) {
+	t.Helper()
+	orig := dialSFTP
+	dialSFTP = func(ctx context.Context, remote config.Remote) (*sftpClient, io.Closer, error) {
+		clientR, serverW := io.Pipe()
+		serverR, clientW := io.Pipe()
+		go func() {
+			srv.serve(serverR, serverW)
+			serverW.Close()
+		}()
+		c, err := newSFTPClient(clientR, clientW)
+		return c, clientW, err
+	}
+	t.Cleanup(func() { dialSFTP = orig })
+}
+
+func TestMoveIntoRemoteLibrary(t *testing.T) {
+	for _, posix := range []bool{true, false} {
+		srv := &testSFTPServer{posix: posix}
+		fakeSFTP(t, srv)
+		src := t.TempDir()
+		root := t.TempDir()
+		dest := filepath.Join(root, "Artist's Band")
+
+		// Names that would trip up a shell or a line-based listing.
+		names := []string{"01 $Song.mp3", "02 new\nline.mp3"}
+		if err := os.MkdirAll(filepath.Join(src, "Album (2020)"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(src, "Album (2020)", name), []byte("data "+name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r := &runner{
+			cfg: config.Config{Remote: &config.Remote{Host: "nas"}},
+			log: log.New(io.Discard, "", 0),
+		}
+		if _, ok := r.library().(*sftpFS); !ok {
+			t.Fatalf("library() = %T, want *sftpFS", r.library())
+		}
+		if err := r.moveIntoLibrary(src, dest); err != nil {
+			t.Fatalf("moveIntoLibrary returned error: %v", err)
+		}
+		for _, name := range names {
+			got, err := os.ReadFile(filepath.Join(dest, "Album (2020)", name))
+			if err != nil || string(got) != "data "+name {
+				t.Fatalf("remote copy of %q = %q, %v", name, got, err)
+			}
+		}
+		// More than sftpWindow chunks are in flight and settle in order.
+		big := bytes.Repeat([]byte("0123456789abcdef"), sftpChunk*sftpWindow/8)
+		w, err := r.library().Create(filepath.Join(dest, "big.flac"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(big); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		rc, err := r.library().Open(filepath.Join(dest, "big.flac"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, big) {
+			t.Fatalf("download of %d bytes = %d bytes, %v", len(big), len(got), err)
+		}
+		// Only folders below the existing library root are created.
+		want := []string{dest, filepath.Join(dest, "Album (2020)")}
+		if strings.Join(srv.mkdirs, "|") != strings.Join(want, "|") {
+			t.Fatalf("MKDIR requests = %q, want %q", srv.mkdirs, want)
+		}
+
+		// A second import of the same files must hit the collision check.
+		if err := os.WriteFile(filepath.Join(src, "Album (2020)", names[0]), []byte("again"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err = r.moveIntoLibrary(src, dest)
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Fatalf("expected collision error, got %v", err)
+		}
+
+		// Rename replaces an existing file with or without posix-rename.
+		fsys := r.library()
+		tmp := filepath.Join(dest, "tmp.mp3")
+		w, err = fsys.Create(tmp, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, "replaced")
+		if err := w.Close(); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		target := filepath.Join(dest, "Album (2020)", names[0])
+		if err := fsys.Rename(tmp, target); err != nil {
+			t.Fatalf("Rename over a file (posix-rename %v): %v", posix, err)
+		}
+		if got, _ := os.ReadFile(target); string(got) != "replaced" {
+			t.Fatalf("renamed file = %q, want %q", got, "replaced")
+		}
+
+		if err := fsys.RemoveAll(dest); err != nil {
+			t.Fatalf("RemoveAll: %v", err)
+		}
+		if _, err := fsys.Stat(dest); !os.IsNotExist(err) {
+			t.Fatalf("Stat after RemoveAll = %v, want not exist", err)
+		}
+		r.closeLibrary()
+	}
+}
+
+func TestDialSFTP(t *testing.T) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pw []byte) (*ssh.Permissions, error) {
+			if c.User() == "media" && string(pw) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go serveSSH(ln, cfg, &testSFTPServer{posix: true})
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSH_AUTH_SOCK", "")
+	port := ln.Addr().(*net.TCPAddr).Port
+	remote := config.Remote{User: "media", Host: "127.0.0.1", Port: port, Password: "secret", KnownHosts: knownHosts}
+
+	c, conn, err := dialSFTP(context.Background(), remote)
+	if err != nil {
+		t.Fatalf("dialSFTP returned error: %v", err)
+	}
+	dir := t.TempDir()
+	if a, err := c.stat(fxpStat, dir); err != nil || !a.mode().IsDir() {
+		t.Fatalf("stat %s over sftp = %v, %v; want a directory", dir, a.mode(), err)
+	}
+	c.Close()
+	conn.Close()
+
+	bad := remote
+	bad.Password = "wrong"
+	if _, _, err := dialSFTP(context.Background(), bad); err == nil {
+		t.Fatalf("dialSFTP with a wrong password succeeded")
+	}
+	unknown := remote
+	unknown.KnownHosts = filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(unknown.KnownHosts, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dialSFTP(context.Background(), unknown); err == nil || !strings.Contains(err.Error(), "key is unknown") {
+		t.Fatalf("dialSFTP with an unknown host key = %v, want a host key error", err)
+	}
+}
+
+// serveSSH accepts SSH connections on ln and runs srv for every "sftp"
+// subsystem request.
+func serveSSH(ln net.Listener, cfg *ssh.ServerConfig, srv *testSFTPServer) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			for newCh := range chans {
+				if newCh.ChannelType() != "session" {
+					newCh.Reject(ssh.UnknownChannelType, "session only")
+					continue
+				}
+				ch, chReqs, err := newCh.Accept()
+				if err != nil {
+					continue
+				}
+				go func() {
+					for req := range chReqs {
+						ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+						req.Reply(ok, nil)
+						if ok {
+							go func() {
+								srv.serve(ch, ch)
+								ch.Close()
+							}()
+						}
+					}
+				}()
+			}
+		}()
+	}
+}
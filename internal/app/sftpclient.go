@@ -0,0 +1,692 @@
+package app
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SFTP version 3 (draft-ietf-secsh-filexfer-02), the version OpenSSH and
+// most NAS firmware speak. Only the requests sftpFS needs are implemented.
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+	fxpExtended = 200
+)
+
+// Status codes of SSH_FXP_STATUS.
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+)
+
+// Open flags (pflags) of SSH_FXP_OPEN.
+const (
+	fxfRead  = 0x01
+	fxfWrite = 0x02
+	fxfCreat = 0x08
+	fxfTrunc = 0x10
+)
+
+// Attribute flags.
+const (
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+)
+
+// posixRename is the OpenSSH extension that renames over an existing file,
+// which plain SSH_FXP_RENAME refuses to do.
+const posixRename = "posix-rename@openssh.com"
+
+// sftpChunk is the largest read or write sent in one request; every server
+// accepts 32 KiB. sftpWindow writes are kept in flight so uploads are not
+// bound by the round trip time.
+const (
+	sftpChunk  = 32 * 1024
+	sftpWindow = 16
+)
+
+// sftpClient speaks the SFTP protocol over a pair of streams, usually the
+// stdin and stdout of an SSH "sftp" subsystem. Requests may be issued from
+// several goroutines; replies are matched to them by id.
+type sftpClient struct {
+	w    io.WriteCloser
+	wmu  sync.Mutex // keeps packets whole when goroutines race
+	exts map[string]string
+
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan sftpReply
+	err     error // set once the connection is gone
+}
+
+type sftpReply struct {
+	typ  byte
+	data []byte
+}
+
+// newSFTPClient negotiates version 3 over r and w and starts reading
+// replies.
+func newSFTPClient(r io.Reader, w io.WriteCloser) (*sftpClient, error) {
+	c := &sftpClient{w: w, exts: make(map[string]string), pending: make(map[uint32]chan sftpReply)}
+	var init sftpBuf
+	init.byte(fxpInit)
+	init.u32(3)
+	if err := writePacket(w, init); err != nil {
+		return nil, fmt.Errorf("sftp handshake: %w", err)
+	}
+	pkt, err := readPacket(r)
+	if err != nil {
+		return nil, fmt.Errorf("sftp handshake: %w", err)
+	}
+	if len(pkt) < 5 || pkt[0] != fxpVersion {
+		return nil, errors.New("sftp handshake: unexpected reply; is the sftp subsystem enabled?")
+	}
+	if v := binary.BigEndian.Uint32(pkt[1:5]); v < 3 {
+		return nil, fmt.Errorf("sftp handshake: server speaks version %d, need 3", v)
+	}
+	rd := sftpReader{b: pkt[5:]}
+	for len(rd.b) > 0 {
+		name, data := rd.str(), rd.str()
+		if rd.err != nil {
+			break
+		}
+		c.exts[name] = data
+	}
+	go c.recv(r)
+	return c, nil
+}
+
+// recv dispatches replies until the stream ends, then fails every request
+// still waiting.
+func (c *sftpClient) recv(r io.Reader) {
+	for {
+		pkt, err := readPacket(r)
+		if err == nil && len(pkt) < 5 {
+			err = errors.New("short sftp packet")
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("sftp connection closed")
+			}
+			c.mu.Lock()
+			c.err = err
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+		id := binary.BigEndian.Uint32(pkt[1:5])
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			ch <- sftpReply{typ: pkt[0], data: pkt[5:]}
+		}
+	}
+}
+
+// send issues a request whose payload follows the id and returns the
+// channel its reply arrives on.
+func (c *sftpClient) send(typ byte, payload sftpBuf) (chan sftpReply, error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan sftpReply, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	var pkt sftpBuf
+	pkt.byte(typ)
+	pkt.u32(id)
+	pkt = append(pkt, payload...)
+	// recv must not wait on this lock: a server that stops reading until
+	// its replies are consumed would otherwise stall both directions.
+	c.wmu.Lock()
+	err := writePacket(c.w, pkt)
+	c.wmu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// wait returns the reply arriving on ch.
+func (c *sftpClient) wait(ch chan sftpReply) (sftpReply, error) {
+	reply, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return reply, c.err
+	}
+	return reply, nil
+}
+
+func (c *sftpClient) call(typ byte, payload sftpBuf) (sftpReply, error) {
+	ch, err := c.send(typ, payload)
+	if err != nil {
+		return sftpReply{}, err
+	}
+	return c.wait(ch)
+}
+
+// Close ends the session; requests still waiting fail.
+func (c *sftpClient) Close() error {
+	return c.w.Close()
+}
+
+// sftpStatusError is a failure status other than "no such file" and
+// "permission denied", which map to fs.ErrNotExist and fs.ErrPermission.
+type sftpStatusError struct {
+	code uint32
+	msg  string
+}
+
+func (e *sftpStatusError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return fmt.Sprintf("sftp status %d", e.code)
+}
+
+// statusErr converts a reply that should have been SSH_FXP_STATUS OK into
+// an error: nil for OK, io.EOF for end of file.
+func statusErr(reply sftpReply) error {
+	if reply.typ != fxpStatus {
+		return fmt.Errorf("unexpected sftp reply type %d", reply.typ)
+	}
+	rd := sftpReader{b: reply.data}
+	code := rd.u32()
+	msg := rd.str()
+	switch code {
+	case fxOK:
+		return nil
+	case fxEOF:
+		return io.EOF
+	case fxNoSuchFile:
+		return fs.ErrNotExist
+	case fxPermissionDenied:
+		return fs.ErrPermission
+	}
+	return &sftpStatusError{code: code, msg: msg}
+}
+
+// expect returns the payload of reply when it has type typ, otherwise the
+// error its status carries.
+func expect(reply sftpReply, typ byte) ([]byte, error) {
+	if reply.typ == typ {
+		return reply.data, nil
+	}
+	if err := statusErr(reply); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("unexpected sftp reply type %d", reply.typ)
+}
+
+// pathCall sends a request naming p plus extra fields and reports its
+// status.
+func (c *sftpClient) pathCall(typ byte, p string, extra sftpBuf) error {
+	var b sftpBuf
+	b.str(p)
+	b = append(b, extra...)
+	reply, err := c.call(typ, b)
+	if err != nil {
+		return err
+	}
+	return statusErr(reply)
+}
+
+func (c *sftpClient) stat(typ byte, p string) (sftpAttrs, error) {
+	var b sftpBuf
+	b.str(p)
+	reply, err := c.call(typ, b)
+	if err != nil {
+		return sftpAttrs{}, err
+	}
+	data, err := expect(reply, fxpAttrs)
+	if err != nil {
+		return sftpAttrs{}, err
+	}
+	rd := sftpReader{b: data}
+	a := rd.attrs()
+	return a, rd.err
+}
+
+func (c *sftpClient) setstat(p string, a sftpAttrs) error {
+	var b sftpBuf
+	b.attrs(a)
+	return c.pathCall(fxpSetstat, p, b)
+}
+
+// open returns a handle for p.
+func (c *sftpClient) open(p string, pflags uint32, a sftpAttrs) (string, error) {
+	var b sftpBuf
+	b.str(p)
+	b.u32(pflags)
+	b.attrs(a)
+	reply, err := c.call(fxpOpen, b)
+	if err != nil {
+		return "", err
+	}
+	return handleOf(reply)
+}
+
+func handleOf(reply sftpReply) (string, error) {
+	data, err := expect(reply, fxpHandle)
+	if err != nil {
+		return "", err
+	}
+	rd := sftpReader{b: data}
+	h := rd.str()
+	return h, rd.err
+}
+
+func (c *sftpClient) closeHandle(h string) error {
+	var b sftpBuf
+	b.str(h)
+	reply, err := c.call(fxpClose, b)
+	if err != nil {
+		return err
+	}
+	return statusErr(reply)
+}
+
+func (c *sftpClient) rename(oldpath, newpath string) error {
+	var b sftpBuf
+	if _, ok := c.exts[posixRename]; ok {
+		b.str(posixRename)
+		b.str(oldpath)
+		b.str(newpath)
+		reply, err := c.call(fxpExtended, b)
+		if err != nil {
+			return err
+		}
+		return statusErr(reply)
+	}
+	b.str(newpath)
+	return c.pathCall(fxpRename, oldpath, b)
+}
+
+// sftpDirEntry is one name listed by readDir.
+type sftpDirEntry struct {
+	name  string
+	attrs sftpAttrs
+}
+
+// readDir lists dir, without "." and "..", sorted by name.
+func (c *sftpClient) readDir(dir string) ([]sftpDirEntry, error) {
+	var b sftpBuf
+	b.str(dir)
+	reply, err := c.call(fxpOpendir, b)
+	if err != nil {
+		return nil, err
+	}
+	h, err := handleOf(reply)
+	if err != nil {
+		return nil, err
+	}
+	var entries []sftpDirEntry
+	for {
+		var b sftpBuf
+		b.str(h)
+		reply, err := c.call(fxpReaddir, b)
+		if err != nil {
+			return nil, err
+		}
+		data, err := expect(reply, fxpName)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.closeHandle(h)
+			return nil, err
+		}
+		rd := sftpReader{b: data}
+		for n := rd.u32(); n > 0 && rd.err == nil; n-- {
+			name := rd.str()
+			rd.str() // longname, for display only
+			a := rd.attrs()
+			if name != "." && name != ".." {
+				entries = append(entries, sftpDirEntry{name: name, attrs: a})
+			}
+		}
+		if rd.err != nil {
+			c.closeHandle(h)
+			return nil, rd.err
+		}
+	}
+	if err := c.closeHandle(h); err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// sftpWriter uploads to an open handle, keeping up to sftpWindow writes in
+// flight. The first failure is reported by every later call.
+type sftpWriter struct {
+	c        *sftpClient
+	handle   string
+	off      uint64
+	inflight []chan sftpReply
+	err      error
+}
+
+func (f *sftpWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 && f.err == nil {
+		n := min(len(p), sftpChunk)
+		var b sftpBuf
+		b.str(f.handle)
+		b.u64(f.off)
+		b.str(string(p[:n]))
+		ch, err := f.c.send(fxpWrite, b)
+		if err != nil {
+			f.err = err
+			break
+		}
+		f.inflight = append(f.inflight, ch)
+		f.off += uint64(n)
+		written += n
+		p = p[n:]
+		if len(f.inflight) >= sftpWindow {
+			f.settle(1)
+		}
+	}
+	return written, f.err
+}
+
+// settle waits for the oldest n writes in flight.
+func (f *sftpWriter) settle(n int) {
+	for _, ch := range f.inflight[:n] {
+		reply, err := f.c.wait(ch)
+		if err == nil {
+			err = statusErr(reply)
+		}
+		if err != nil && f.err == nil {
+			f.err = err
+		}
+	}
+	f.inflight = f.inflight[n:]
+}
+
+// Close waits for every write and closes the handle; an upload is only
+// complete when it returns nil.
+func (f *sftpWriter) Close() error {
+	f.settle(len(f.inflight))
+	if err := f.c.closeHandle(f.handle); err != nil && f.err == nil {
+		f.err = err
+	}
+	return f.err
+}
+
+// sftpFileReader downloads from an open handle.
+type sftpFileReader struct {
+	c      *sftpClient
+	handle string
+	off    uint64
+}
+
+func (f *sftpFileReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var b sftpBuf
+	b.str(f.handle)
+	b.u64(f.off)
+	b.u32(uint32(min(len(p), sftpChunk)))
+	reply, err := f.c.call(fxpRead, b)
+	if err != nil {
+		return 0, err
+	}
+	data, err := expect(reply, fxpData)
+	if err != nil {
+		return 0, err
+	}
+	rd := sftpReader{b: data}
+	chunk := rd.str()
+	if rd.err != nil {
+		return 0, rd.err
+	}
+	n := copy(p, chunk)
+	f.off += uint64(n)
+	return n, nil
+}
+
+func (f *sftpFileReader) Close() error {
+	return f.c.closeHandle(f.handle)
+}
+
+// sftpAttrs are the attributes of SFTP version 3. flags says which are
+// set.
+type sftpAttrs struct {
+	flags        uint32
+	size         uint64
+	uid, gid     uint32
+	perm         uint32
+	atime, mtime uint32
+}
+
+// Unix file type bits as carried in the permissions attribute.
+const (
+	sIFMT   = 0o170000
+	sIFDIR  = 0o040000
+	sIFLNK  = 0o120000
+	sIFIFO  = 0o010000
+	sIFSOCK = 0o140000
+	sIFCHR  = 0o020000
+	sIFBLK  = 0o060000
+)
+
+func (a sftpAttrs) mode() fs.FileMode {
+	m := fs.FileMode(a.perm & 0o777)
+	switch a.perm & sIFMT {
+	case sIFDIR:
+		m |= fs.ModeDir
+	case sIFLNK:
+		m |= fs.ModeSymlink
+	case sIFIFO:
+		m |= fs.ModeNamedPipe
+	case sIFSOCK:
+		m |= fs.ModeSocket
+	case sIFCHR:
+		m |= fs.ModeDevice | fs.ModeCharDevice
+	case sIFBLK:
+		m |= fs.ModeDevice
+	}
+	if a.perm&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if a.perm&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if a.perm&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+// permAttrs sets the permission bits of mode, including setuid, setgid and
+// sticky.
+func permAttrs(mode os.FileMode) sftpAttrs {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return sftpAttrs{flags: attrPermissions, perm: perm}
+}
+
+// sftpInfo is the fs.FileInfo of a stat or directory listing.
+type sftpInfo struct {
+	name  string
+	attrs sftpAttrs
+}
+
+func (i sftpInfo) Name() string       { return i.name }
+func (i sftpInfo) Size() int64        { return int64(i.attrs.size) }
+func (i sftpInfo) Mode() fs.FileMode  { return i.attrs.mode() }
+func (i sftpInfo) ModTime() time.Time { return time.Unix(int64(i.attrs.mtime), 0) }
+func (i sftpInfo) IsDir() bool        { return i.Mode().IsDir() }
+func (i sftpInfo) Sys() any           { return nil }
+
+func newSFTPInfo(p string, a sftpAttrs) sftpInfo {
+	return sftpInfo{name: path.Base(p), attrs: a}
+}
+
+// sftpBuf builds a packet.
+type sftpBuf []byte
+
+func (b *sftpBuf) byte(v byte)  { *b = append(*b, v) }
+func (b *sftpBuf) u32(v uint32) { *b = binary.BigEndian.AppendUint32(*b, v) }
+func (b *sftpBuf) u64(v uint64) { *b = binary.BigEndian.AppendUint64(*b, v) }
+func (b *sftpBuf) str(s string) {
+	b.u32(uint32(len(s)))
+	*b = append(*b, s...)
+}
+
+func (b *sftpBuf) attrs(a sftpAttrs) {
+	b.u32(a.flags &^ attrExtended)
+	if a.flags&attrSize != 0 {
+		b.u64(a.size)
+	}
+	if a.flags&attrUIDGID != 0 {
+		b.u32(a.uid)
+		b.u32(a.gid)
+	}
+	if a.flags&attrPermissions != 0 {
+		b.u32(a.perm)
+	}
+	if a.flags&attrACModTime != 0 {
+		b.u32(a.atime)
+		b.u32(a.mtime)
+	}
+}
+
+// sftpReader decodes a packet; reading past its end sets err.
+type sftpReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sftpReader) take(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errors.New("short sftp packet")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *sftpReader) u32() uint32 {
+	if v := r.take(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (r *sftpReader) u64() uint64 {
+	if v := r.take(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (r *sftpReader) str() string {
+	return string(r.take(int(r.u32())))
+}
+
+func (r *sftpReader) attrs() sftpAttrs {
+	a := sftpAttrs{flags: r.u32()}
+	if a.flags&attrSize != 0 {
+		a.size = r.u64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		a.uid, a.gid = r.u32(), r.u32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.perm = r.u32()
+	}
+	if a.flags&attrACModTime != 0 {
+		a.atime, a.mtime = r.u32(), r.u32()
+	}
+	if a.flags&attrExtended != 0 {
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			r.str()
+			r.str()
+		}
+	}
+	return a
+}
+
+// maxSFTPPacket bounds the packets accepted from the server.
+const maxSFTPPacket = 256 * 1024
+
+func writePacket(w io.Writer, pkt []byte) error {
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(pkt)), uint32(len(pkt)))
+	_, err := w.Write(append(buf, pkt...))
+	return err
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n == 0 || n > maxSFTPPacket {
+		return nil, fmt.Errorf("bad sftp packet length %d", n)
+	}
+	pkt := make([]byte, n)
+	if _, err := io.ReadFull(r, pkt); err != nil {
+		return nil, err
+	}
+	return pkt, nil
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how much of a file http.DetectContentType considers.
+const sniffLen = 512
+
+// sniffType returns the MIME type of the file at path judged by its first
+// bytes. Audio formats http.DetectContentType does not know (FLAC, M4A,
+// MP3 without an ID3 tag) are recognised by their own signatures.
+func sniffType(fsys FS, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "audio/flac", nil
+	case len(head) >= 11 && string(head[4:11]) == "ftypM4A":
+		return "audio/mp4", nil
+	}
+	if _, ok := parseMP3Frame(head); ok {
+		return "audio/mpeg", nil
+	}
+	return http.DetectContentType(head), nil
+}
+
+// mimeCategory maps a sniffed MIME type to a --classify category, or ""
+// when the type says nothing useful (e.g. application/octet-stream).
+func mimeCategory(mime string) string {
+	switch {
+	case strings.HasPrefix(mime, "audio/"), mime == "application/ogg":
+		return categoryAudio
+	case strings.HasPrefix(mime, "image/"):
+		return categoryArtwork
+	case mime == "application/pdf", strings.HasPrefix(mime, "text/plain"):
+		return categoryDocs
+	}
+	return ""
+}
+
+// sniffCategory implements --sniff: a file whose extension is unknown (it
+// would be classified as misc) is categorised by its content instead. The
+// answer is cached by extract-relative path; "" means --sniff is off, the
+// extension is known, or the content was not recognised.
+func (r *runner) sniffCategory(extractDir, path string) (string, error) {
+	if !r.opts.Sniff || r.category(filepath.Base(path)) != categoryMisc {
+		return "", nil
+	}
+	rel, err := filepath.Rel(extractDir, path)
+	if err != nil {
+		return "", err
+	}
+	if c, ok := r.sniffed[rel]; ok {
+		return c, nil
+	}
+	mime, err := sniffType(r.workFS(), path)
+	if err != nil {
+		return "", err
+	}
+	c := mimeCategory(mime)
+	if r.sniffed == nil {
+		r.sniffed = make(map[string]string)
+	}
+	r.sniffed[rel] = c
+	if c != "" {
+		r.log.Printf("Sniffed %s as %s (%s)", filepath.ToSlash(rel), mime, c)
+	}
+	return c, nil
+}
+
+// protectSniffedAudio keeps files that the prune rules would remove by name
+// but whose content is audio, e.g. a track saved with a ".dat" extension.
+func (r *runner) protectSniffedAudio(extractDir string, plan *prunePlan) error {
+	if !r.opts.Sniff {
+		return nil
+	}
+	var audio []string
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		c, err := r.sniffCategory(extractDir, path)
+		if err == nil && c == categoryAudio {
+			audio = append(audio, path)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, path := range audio {
+		protected, err := plan.protect(r.workFS(), extractDir, path)
+		if err != nil {
+			return err
+		}
+		if protected {
+			r.log.Printf("Keeping %s: content is audio despite its name (--sniff)", path)
+		}
+	}
+	return nil
+}
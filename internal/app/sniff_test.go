@@ -0,0 +1,82 @@
+package app
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestSniffType(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"a.dat": flacData(44100, 44100, 100),
+		"b.dat": mp3Data(9, 2),
+		"c.dat": append([]byte{0xff, 0xd8, 0xff, 0xe0, 0, 0x10}, "JFIF"...),
+		"d.dat": []byte("ripped with EAC\n"),
+		"e.dat": {0x00, 0x01, 0x02, 0x03},
+	}
+	want := map[string]string{"a.dat": categoryAudio, "b.dat": categoryAudio, "c.dat": categoryArtwork, "d.dat": categoryDocs, "e.dat": ""}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mime, err := sniffType(osFS{}, path)
+		if err != nil {
+			t.Fatalf("sniffType(%s) returned error: %v", name, err)
+		}
+		if got := mimeCategory(mime); got != want[name] {
+			t.Fatalf("%s sniffed as %s (%q), want %q", name, mime, got, want[name])
+		}
+	}
+}
+
+func TestSniffKeepsAndClassifiesMisnamedFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string][]byte{
+		"Album/01.flac":   flacData(44100, 44100, 100),
+		"Album/02.dat":    flacData(44100, 44100, 100),
+		"Album/junk.dat":  []byte("padding\n"),
+		"Album/cover.bin": append([]byte{0xff, 0xd8, 0xff, 0xe0, 0, 0x10}, "JFIF"...),
+	}
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &runner{
+		cfg:  config.Config{UnneededPatterns: []string{"*.dat"}},
+		opts: Options{Sniff: true, Classify: true},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.pruneExtracted(root); err != nil {
+		t.Fatalf("pruneExtracted returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Album", "02.dat")); err != nil {
+		t.Fatalf("misnamed audio should be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Album", "junk.dat")); !os.IsNotExist(err) {
+		t.Fatalf("junk.dat should be pruned, got err=%v", err)
+	}
+
+	if err := r.logClassification(root); err != nil {
+		t.Fatalf("logClassification returned error: %v", err)
+	}
+	for rel, want := range map[string]string{
+		"Album/02.dat":    "Album/audio/02.dat",
+		"Album/cover.bin": "Album/artwork/cover.bin",
+	} {
+		if got := r.destRel(filepath.FromSlash(rel), false); got != filepath.FromSlash(want) {
+			t.Fatalf("destRel(%q) = %q, want %q", rel, got, want)
+		}
+	}
+}
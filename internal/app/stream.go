@@ -0,0 +1,324 @@
+package app
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// streamBlocker returns why --stream-extract cannot write this import
+// straight into the library, or "" when it can. Anything that has to see
+// the whole extracted tree before deciding what goes where needs the
+// staged extract dir.
+func (r *runner) streamBlocker(sources []archiveSource) string {
+	if len(sources) != 1 {
+		return "several archives are merged"
+	}
+	if src := sources[0]; src.list || src.member != "" {
+		return "Pixeldrain lists are imported file by file"
+	}
+	if r.retry != nil {
+		return "--retry-partial fetches list files"
+	}
+	if _, local := r.library().(osFS); !local {
+		return "the library is remote"
+	}
+	for _, opt := range []struct {
+		set  bool
+		flag string
+	}{
+		{r.opts.DryRun, "--dry-run"},
+		{r.opts.PruneReport, "--prune-report"},
+		{r.opts.ResumeTemp != "", "--resume-temp"},
+		{r.opts.RecurseArchives, "--recurse-archives"},
+		{r.opts.Hardlink, "--hardlink"},
+		{r.opts.Sniff, "--sniff"},
+		{len(r.opts.PruneKeep) > 0, "--prune-keep"},
+		{r.opts.RespectCue, "--respect-cue"},
+		{r.opts.PruneCascade, "--prune-cascade"},
+		{r.opts.PruneDebug, "--prune-debug"},
+		{r.opts.PruneSmallerThan > 0 || r.opts.PruneLargerThan > 0, "a size limit"},
+		{r.opts.PruneDupeExtensions, "--prune-dupe-extensions"},
+		{r.opts.MinBitrate > 0 || r.opts.MinSampleRate > 0 || r.opts.DropLossyIfLossless, "a quality filter"},
+		{r.opts.StripExtensions, "--strip-extensions"},
+		{len(r.opts.Only) > 0, "--only"},
+		{r.opts.RequireAudio, "--require-audio"},
+		{r.opts.NormalizeDiscs, "--normalize-discs"},
+		{r.opts.NormalizeYear, "--normalize-year"},
+		{r.opts.TrimCommonPrefix, "--trim-common-prefix"},
+		{r.opts.Classify, "--classify"},
+		{r.opts.VerifyArtistTag, "--verify-artist-tag"},
+		{r.opts.DedupeLibrary || r.opts.SkipLibraryDupes, "library dedupe"},
+		{r.opts.QuietCollision != "" || (r.opts.OnCollision != "" && r.opts.OnCollision != CollisionAbort), "collision handling"},
+		{r.opts.WriteNFO, "--write-nfo"},
+		{r.opts.ReplayGain, "--replaygain"},
+		{r.opts.CoverURL != "", "--cover-url"},
+	} {
+		if opt.set {
+			return opt.flag + " needs the extracted tree"
+		}
+	}
+	return ""
+}
+
+// streamImport implements --stream-extract: the archive is downloaded as
+// usual, then its entries are written straight to their place in the
+// library instead of being extracted to a temp dir and copied.
+func (r *runner) streamImport(src archiveSource) (err error) {
+	start := time.Now()
+	archivePath, err := r.downloadArchive(src)
+	r.stats.recordPhase("download", start)
+	if archivePath != "" {
+		defer func() { r.cleanupUnlessFailed(filepath.Dir(archivePath), err) }()
+	}
+	if err != nil {
+		return err
+	}
+
+	dest := r.destinationPath()
+	r.detectCaseInsensitive(r.libraryRoot())
+	start = time.Now()
+	err = r.streamArchive(archivePath, dest)
+	r.stats.recordPhase("move", start)
+	if err != nil {
+		return err
+	}
+	return r.finishImport(dest)
+}
+
+// streamEntry is one zip entry planned by streamArchive, with its path in
+// the library.
+type streamEntry struct {
+	zipEntry
+	target string
+}
+
+// streamArchive writes the entries of archivePath into dest. Every entry
+// is planned first: --extract-only and UNNEEDED_FILES (on the entry or a
+// folder above it) filter it, and its destination is checked for
+// collisions with the library, with another entry and, with --target-fs,
+// for names the filesystem cannot store. Nothing is written unless the
+// whole plan passes; a write that fails partway is handled like a failed
+// move (--rollback-on-error).
+func (r *runner) streamArchive(archivePath, dest string) error {
+	reader, err := r.openArchive(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	entries, err := r.planStream(reader.File, archivePath, dest)
+	if err != nil {
+		return err
+	}
+	var need int64
+	var total int
+	for _, e := range entries {
+		if !e.file.FileInfo().IsDir() {
+			need += int64(e.file.UncompressedSize64)
+			total++
+		}
+	}
+	if err := r.checkFreeSpaceFor(need, dest); err != nil {
+		return err
+	}
+
+	created, err := r.mkdirAll(r.library(), dest)
+	if err != nil {
+		return fmt.Errorf("create destination %q: %w", dest, err)
+	}
+	var written []string
+	for _, e := range entries {
+		dir := e.target
+		if !e.file.FileInfo().IsDir() {
+			dir = filepath.Dir(e.target)
+		}
+		dirs, err := r.mkdirAll(r.library(), dir)
+		if err != nil {
+			return r.handleMoveFailure(dest, created, written, err)
+		}
+		created = append(created, dirs...)
+		if e.file.FileInfo().IsDir() {
+			continue
+		}
+
+		// Track the target before writing so a partial file is rolled back.
+		created = append(created, e.target)
+		size, err := r.writeStreamEntry(e)
+		if err != nil {
+			return r.handleMoveFailure(dest, created, written, err)
+		}
+		written = append(written, e.target)
+		r.added = append(r.added, addedFile{path: e.target, size: size})
+		r.stats.movedFiles++
+		r.stats.recordExtension(e.target, size)
+		r.emit("move-progress", map[string]any{"file": e.target, "bytes": size, "moved": r.stats.movedFiles, "total": total})
+	}
+	if err := r.chownCreated(created); err != nil {
+		return r.handleMoveFailure(dest, created, written, err)
+	}
+
+	r.stats.extractedEntries += len(entries)
+	r.log.Printf("Streamed %d entries of %s into %s", len(entries), filepath.Base(archivePath), dest)
+	r.emit("extract", map[string]any{"entries": len(entries), "dir": dest})
+	r.emit("prune", map[string]any{"pruned": r.stats.pruned})
+	return nil
+}
+
+// planStream selects the entries of files with planEntries, drops the
+// ones UNNEEDED_FILES matches and maps the rest to their library path,
+// failing on the first collision.
+func (r *runner) planStream(files []*zip.File, archivePath, dest string) ([]streamEntry, error) {
+	var existing map[string]bool
+	if r.caseInsensitive {
+		var err error
+		if existing, err = foldedTree(r.library(), dest); err != nil {
+			return nil, err
+		}
+	}
+	selected, _, err := r.planEntries(files, archivePath, dest, r.opts.ExtractOnly, make(map[string]string))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []streamEntry
+	targets := make(map[string]string)
+	folded := make(map[string]string)
+	fileCount := 0
+	for _, e := range selected {
+		isDir := e.file.FileInfo().IsDir()
+		if !isDir {
+			fileCount++
+		}
+		pattern, err := r.unneededMatch(filepath.ToSlash(e.rel))
+		if err != nil {
+			return nil, err
+		}
+		if pattern != "" {
+			if !isDir {
+				r.stats.pruned++
+			}
+			continue
+		}
+
+		destRel := r.destRel(e.rel, isDir)
+		target := filepath.Join(dest, destRel)
+		if err := r.checkStreamTarget(target, destRel, isDir, e.name, targets, folded, existing); err != nil {
+			return nil, err
+		}
+		entries = append(entries, streamEntry{zipEntry: e, target: target})
+	}
+
+	if r.stats.pruned > 0 {
+		if r.stats.pruned == fileCount {
+			return nil, fmt.Errorf("prune patterns would remove all %d files; aborting", fileCount)
+		}
+		r.log.Printf("Pruned %d item(s) matching UNNEEDED_FILES", r.stats.pruned)
+	}
+	if err := r.checkStreamTargetFS(entries, dest); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// unneededMatch returns the UNNEEDED_FILES pattern matching relSlash or a
+// folder above it, or "" when none does.
+func (r *runner) unneededMatch(relSlash string) (string, error) {
+	for p := relSlash; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range r.cfg.UnneededPatterns {
+			ok, err := matchPrunePattern(pattern, p)
+			if err != nil {
+				return "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			if ok {
+				return pattern, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// checkStreamTarget applies the checks of ensureNoCollisions to one
+// planned entry: two entries may not land on one file, names may not
+// differ only in case on a case-insensitive library, and a file may not
+// replace anything already there.
+func (r *runner) checkStreamTarget(target, destRel string, isDir bool, name string, targets, folded map[string]string, existing map[string]bool) error {
+	if !isDir {
+		if other, ok := targets[destRel]; ok {
+			return fmt.Errorf("destination conflict: entries %q and %q would both be written to %s", other, name, target)
+		}
+		targets[destRel] = name
+	}
+	if r.caseInsensitive {
+		key := foldPath(destRel)
+		if other, ok := folded[key]; ok && other != destRel {
+			return fmt.Errorf("destination conflict: %s and %s differ only in case", other, target)
+		}
+		folded[key] = destRel
+	}
+
+	var targetIsDir bool
+	info, err := r.library().Stat(target)
+	if err == nil {
+		targetIsDir = info.IsDir()
+	} else if !os.IsNotExist(err) {
+		return err
+	} else if isDirEntry, ok := existing[foldPath(destRel)]; ok {
+		targetIsDir = isDirEntry
+	} else {
+		return nil
+	}
+	switch {
+	case isDir && !targetIsDir:
+		return fmt.Errorf("destination conflict: %s exists as a file", target)
+	case !isDir && targetIsDir:
+		return fmt.Errorf("destination conflict: %s exists as a directory", target)
+	case !isDir:
+		return fmt.Errorf("destination conflict: %s already exists", target)
+	}
+	return nil
+}
+
+// checkStreamTargetFS is checkTargetFS for planned entries.
+func (r *runner) checkStreamTargetFS(entries []streamEntry, dest string) error {
+	rules, ok := r.targetFS()
+	if !ok {
+		return nil
+	}
+	rels := []string{filepath.Join(r.artistDir, r.subpath)}
+	for _, e := range entries {
+		rel, err := filepath.Rel(dest, e.target)
+		if err != nil {
+			return err
+		}
+		rels = append(rels, rel)
+	}
+	return r.reportTargetFS(rules, rels)
+}
+
+// writeStreamEntry copies one planned file entry to its target.
+func (r *runner) writeStreamEntry(e streamEntry) (int64, error) {
+	src, err := e.file.Open()
+	if err != nil {
+		return 0, fmt.Errorf("open zip entry %q: %w", e.name, err)
+	}
+	defer src.Close()
+	dst, err := r.createFile(r.library(), e.target, e.file.Mode())
+	if err != nil {
+		return 0, fmt.Errorf("create %q: %w", e.target, err)
+	}
+	n, err := io.Copy(dst, ctxReader{r.context(), src})
+	if err != nil {
+		dst.Close()
+		return n, fmt.Errorf("copy entry %q: %w", e.name, err)
+	}
+	// A full disk may only surface when the file is closed.
+	if err := dst.Close(); err != nil {
+		return n, fmt.Errorf("write %q: %w", e.target, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestStreamExtract(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/file/abc123" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, map[string]string{
+			"Album/01.flac":         "audio",
+			"Album/cover.jpg":       "jpeg",
+			"Album/info.txt":        "text",
+			"Album/Scans/front.jpg": "scan",
+		}))
+	})
+	run := func(library string, opts Options) (string, error) {
+		var logs bytes.Buffer
+		opts.Artist, opts.URLs, opts.TmpDir, opts.StreamExtract = "Artist", []string{"abc123"}, t.TempDir(), true
+		r := &runner{
+			cfg:  config.Config{NavidromeMusicPath: library, UnneededPatterns: []string{"*.txt", "Scans"}},
+			opts: opts,
+			log:  log.New(&logs, "", 0),
+		}
+		err := r.Execute()
+		return logs.String(), err
+	}
+	exists := func(library, rel string) bool {
+		_, err := os.Stat(filepath.Join(library, "Artist", filepath.FromSlash(rel)))
+		return err == nil
+	}
+
+	library := t.TempDir()
+	logs, err := run(library, Options{})
+	if err != nil {
+		t.Fatalf("Execute returned error: %v\n%s", err, logs)
+	}
+	if !strings.Contains(logs, "Streamed 2 entries") {
+		t.Fatalf("import was not streamed:\n%s", logs)
+	}
+	for rel, want := range map[string]bool{"Album/01.flac": true, "Album/cover.jpg": true, "Album/info.txt": false, "Album/Scans": false} {
+		if got := exists(library, rel); got != want {
+			t.Errorf("%s exists = %v, want %v", rel, got, want)
+		}
+	}
+
+	// A collision is found before anything is written.
+	library = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(library, "Artist", "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(library, "Artist", "Album", "cover.jpg"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(library, Options{}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("Execute error = %v, want a destination conflict", err)
+	}
+	if exists(library, "Album/01.flac") {
+		t.Fatalf("01.flac written despite the collision")
+	}
+
+	// Options that need the extracted tree fall back to staging.
+	library = t.TempDir()
+	logs, err = run(library, Options{NormalizeDiscs: true})
+	if err != nil {
+		t.Fatalf("Execute returned error: %v\n%s", err, logs)
+	}
+	if !strings.Contains(logs, "stream-extract: --normalize-discs needs the extracted tree") || strings.Contains(logs, "Streamed") {
+		t.Fatalf("expected a staged fallback:\n%s", logs)
+	}
+	if !exists(library, "Album/01.flac") {
+		t.Fatalf("staged fallback did not import 01.flac")
+	}
+}
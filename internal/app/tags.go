@@ -0,0 +1,371 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// errNoTags is returned when a file carries no artist tag the reader knows.
+var errNoTags = errors.New("no artist tag found")
+
+// maxTagBytes bounds how much of a file is read while looking for tags.
+const maxTagBytes = 1 << 20
+
+// readArtistTags returns the artist and album artist values tagged in an
+// audio file: ID3v2/ID3v1 for MP3, Vorbis comments for FLAC and Ogg
+// (Vorbis/Opus). Other formats yield errNoTags.
+func readArtistTags(fsys FS, path string) ([]string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, maxTagBytes)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	var artists []string
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		artists = flacArtists(head[4:])
+	case bytes.HasPrefix(head, []byte("OggS")):
+		artists = oggArtists(head)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		artists = id3v2Artists(head)
+	}
+	if ra, ok := f.(io.ReaderAt); ok && len(artists) == 0 && strings.EqualFold(filepath.Ext(path), ".mp3") {
+		if info, err := fsys.Stat(path); err == nil {
+			artists = id3v1Artist(ra, info.Size())
+		}
+	}
+	if len(artists) == 0 {
+		return nil, errNoTags
+	}
+	return artists, nil
+}
+
+// id3v2Artists reads the TPE1/TPE2 (TP1/TP2 in v2.2) frames of an ID3v2 tag.
+func id3v2Artists(data []byte) []string {
+	if len(data) < 10 {
+		return nil
+	}
+	major, flags := data[3], data[5]
+	size := int(syncsafe(data[6:10]))
+	tag := data[10:]
+	if size < len(tag) {
+		tag = tag[:size]
+	}
+	if flags&0x40 != 0 && major >= 3 && len(tag) >= 4 {
+		ext := int(binary.BigEndian.Uint32(tag[:4])) + 4
+		if major == 4 {
+			ext = int(syncsafe(tag[:4]))
+		}
+		if ext > len(tag) {
+			return nil
+		}
+		tag = tag[ext:]
+	}
+
+	idLen, headerLen := 4, 10
+	wanted := map[string]bool{"TPE1": true, "TPE2": true}
+	if major == 2 {
+		idLen, headerLen = 3, 6
+		wanted = map[string]bool{"TP1": true, "TP2": true}
+	}
+
+	var artists []string
+	for len(tag) >= headerLen && tag[0] != 0 {
+		id := string(tag[:idLen])
+		var frameSize int
+		switch major {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 4:
+			frameSize = int(syncsafe(tag[4:8]))
+		default:
+			frameSize = int(binary.BigEndian.Uint32(tag[4:8]))
+		}
+		if frameSize <= 0 || headerLen+frameSize > len(tag) {
+			break
+		}
+		if wanted[id] {
+			artists = append(artists, decodeID3Text(tag[headerLen:headerLen+frameSize])...)
+		}
+		tag = tag[headerLen+frameSize:]
+	}
+	return artists
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// decodeID3Text decodes a text frame body (encoding byte + text), splitting
+// the NUL-separated values ID3v2.4 allows.
+func decodeID3Text(body []byte) []string {
+	if len(body) < 2 {
+		return nil
+	}
+	enc, raw := body[0], body[1:]
+	var text string
+	switch enc {
+	case 1, 2:
+		bigEndian := enc == 2
+		if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+			bigEndian, raw = true, raw[2:]
+		} else if len(raw) >= 2 && raw[0] == 0xff && raw[1] == 0xfe {
+			bigEndian, raw = false, raw[2:]
+		}
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 0; i+1 < len(raw); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(raw[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(raw[i:]))
+			}
+		}
+		text = string(utf16.Decode(units))
+	case 3:
+		text = string(raw)
+	default:
+		runes := make([]rune, len(raw))
+		for i, b := range raw {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	var values []string
+	for _, v := range strings.Split(text, "\x00") {
+		if v = strings.TrimSpace(strings.TrimPrefix(v, "\ufeff")); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// id3v1Artist reads the artist field of a trailing 128-byte ID3v1 tag.
+func id3v1Artist(f io.ReaderAt, size int64) []string {
+	if size < 128 {
+		return nil
+	}
+	tag := make([]byte, 128)
+	if _, err := f.ReadAt(tag, size-128); err != nil || !bytes.HasPrefix(tag, []byte("TAG")) {
+		return nil
+	}
+	artist := strings.TrimSpace(strings.TrimRight(string(tag[33:63]), "\x00"))
+	if artist == "" {
+		return nil
+	}
+	return []string{artist}
+}
+
+// flacArtists walks FLAC metadata blocks to the VORBIS_COMMENT block.
+func flacArtists(data []byte) []string {
+	for len(data) >= 4 {
+		last := data[0]&0x80 != 0
+		blockType := data[0] & 0x7f
+		size := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		if 4+size > len(data) {
+			return nil
+		}
+		if blockType == 4 {
+			return vorbisCommentArtists(data[4 : 4+size])
+		}
+		if last {
+			return nil
+		}
+		data = data[4+size:]
+	}
+	return nil
+}
+
+// oggArtists reassembles the packets of the first Ogg pages and parses the
+// Vorbis ("\x03vorbis") or Opus ("OpusTags") comment header.
+func oggArtists(data []byte) []string {
+	var packets bytes.Buffer
+	for len(data) >= 27 && bytes.HasPrefix(data, []byte("OggS")) {
+		segments := int(data[26])
+		if len(data) < 27+segments {
+			break
+		}
+		bodyLen := 0
+		for _, l := range data[27 : 27+segments] {
+			bodyLen += int(l)
+		}
+		start := 27 + segments
+		if start+bodyLen > len(data) {
+			bodyLen = len(data) - start
+		}
+		packets.Write(data[start : start+bodyLen])
+		data = data[start+bodyLen:]
+	}
+
+	stream := packets.Bytes()
+	for _, marker := range [][]byte{[]byte("\x03vorbis"), []byte("OpusTags")} {
+		if i := bytes.Index(stream, marker); i >= 0 {
+			return vorbisCommentArtists(stream[i+len(marker):])
+		}
+	}
+	return nil
+}
+
+// vorbisCommentArtists extracts ARTIST and ALBUMARTIST from a Vorbis comment
+// structure (little-endian lengths: vendor, count, then KEY=value entries).
+func vorbisCommentArtists(data []byte) []string {
+	read := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		if n < 0 || 4+n > len(data) {
+			return nil, false
+		}
+		field := data[4 : 4+n]
+		data = data[4+n:]
+		return field, true
+	}
+	if _, ok := read(); !ok {
+		return nil
+	}
+	if len(data) < 4 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+
+	var artists []string
+	for i := 0; i < count; i++ {
+		field, ok := read()
+		if !ok {
+			break
+		}
+		key, value, ok := strings.Cut(string(field), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(key) {
+		case "ARTIST", "ALBUMARTIST", "ALBUM ARTIST":
+			if value = strings.TrimSpace(value); value != "" {
+				artists = append(artists, value)
+			}
+		}
+	}
+	return artists
+}
+
+// artistSeparators split credits such as "A feat. B", "A & B" or "A, B".
+var artistSeparators = regexp.MustCompile(`(?i)\s*(?:\b(?:feat|ft|featuring|with|vs|and)\b\.?|&|,|;|/|\sx\s)\s*`)
+
+// normalizeArtist lowercases name, drops a leading "The " and collapses
+// whitespace so tags compare leniently.
+func normalizeArtist(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	name = strings.TrimPrefix(name, "the ")
+	return strings.Trim(name, " .")
+}
+
+// artistMatches reports whether a tag value credits artist, either as the
+// whole value or as one of the artists it lists (e.g. "Artist feat. Guest").
+func artistMatches(artist, tag string) bool {
+	want := normalizeArtist(artist)
+	if want == "" {
+		return false
+	}
+	if normalizeArtist(tag) == want {
+		return true
+	}
+	for _, part := range artistSeparators.Split(tag, -1) {
+		if normalizeArtist(part) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// maxTagSamples is how many tracks --verify-artist-tag inspects.
+const maxTagSamples = 5
+
+// verifyArtistTag samples audio files in extractDir and compares their
+// artist tags with the destination artist (--verify-artist-tag). A sample in
+// which no track credits the artist is logged as a warning, or returned as an
+// error with --strict.
+func (r *runner) verifyArtistTag(extractDir string) error {
+	if !r.opts.VerifyArtistTag {
+		return nil
+	}
+
+	var tracks []string
+	err := r.workFS().WalkDir(extractDir, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		if _, gone := r.dryRunPruned[path]; !gone && isAudio(d.Name()) {
+			tracks = append(tracks, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(tracks)
+	if len(tracks) > maxTagSamples {
+		// Spread the sample across the archive rather than the first album.
+		sample := make([]string, 0, maxTagSamples)
+		for i := 0; i < maxTagSamples; i++ {
+			sample = append(sample, tracks[i*len(tracks)/maxTagSamples])
+		}
+		tracks = sample
+	}
+
+	var tagged, matched int
+	var seen []string
+	for _, path := range tracks {
+		artists, err := readArtistTags(r.workFS(), path)
+		if err != nil {
+			continue
+		}
+		tagged++
+		ok := false
+		for _, a := range artists {
+			if artistMatches(r.artistDir, a) {
+				ok = true
+				break
+			}
+		}
+		if ok {
+			matched++
+			continue
+		}
+		seen = append(seen, artists[0])
+		r.log.Printf("Artist tag %q in %s does not match %q", artists[0], filepath.Base(path), r.artistDir)
+	}
+
+	switch {
+	case tagged == 0:
+		r.log.Printf("warning: --verify-artist-tag found no readable artist tags in %d sampled track(s)", len(tracks))
+		return nil
+	case matched > 0:
+		r.log.Printf("Artist tags match %q in %d of %d sampled track(s)", r.artistDir, matched, tagged)
+		return nil
+	}
+	msg := fmt.Sprintf("artist tags in the archive (%s) do not match %q", strings.Join(seen, ", "), r.artistDir)
+	if r.opts.Strict {
+		return errors.New(msg)
+	}
+	r.log.Printf("warning: %s; was the wrong URL used?", msg)
+	return nil
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func vorbisComment(comments ...string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(len("vendor")))
+	b.WriteString("vendor")
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+func id3v23(frames map[string][]byte) []byte {
+	var body bytes.Buffer
+	for id, data := range frames {
+		body.WriteString(id)
+		binary.Write(&body, binary.BigEndian, uint32(len(data)))
+		body.Write([]byte{0, 0})
+		body.Write(data)
+	}
+	size := body.Len()
+	header := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, body.Bytes()...)
+}
+
+func TestReadArtistTags(t *testing.T) {
+	dir := t.TempDir()
+
+	comment := vorbisComment("TITLE=Intro", "artist=Daft Punk")
+	flac := append([]byte("fLaC"), 0x00, 0, 0, 4)
+	flac = append(flac, make([]byte, 4)...)
+	flac = append(flac, 0x84, byte(len(comment)>>16), byte(len(comment)>>8), byte(len(comment)))
+	flac = append(flac, comment...)
+
+	utf16Artist := []byte{1, 0xff, 0xfe, 'D', 0, 'a', 0, 'f', 0, 't', 0, ' ', 0, 'P', 0, 'u', 0, 'n', 0, 'k', 0}
+	mp3 := append(id3v23(map[string][]byte{"TPE1": utf16Artist}), 0xff, 0xfb, 0, 0)
+
+	v1 := make([]byte, 128)
+	copy(v1, "TAG")
+	copy(v1[33:], "Justice")
+	mp3v1 := append([]byte{0xff, 0xfb, 0, 0}, v1...)
+
+	packet := append([]byte("\x03vorbis"), vorbisComment("ARTIST=Air")...)
+	ogg := append([]byte("OggS"), make([]byte, 22)...)
+	ogg = append(ogg, 1, byte(len(packet)))
+	ogg = append(ogg, packet...)
+
+	tests := map[string]struct {
+		data []byte
+		want string
+	}{
+		"a.flac": {flac, "Daft Punk"},
+		"b.mp3":  {mp3, "Daft Punk"},
+		"c.mp3":  {mp3v1, "Justice"},
+		"d.ogg":  {ogg, "Air"},
+	}
+	for name, tt := range tests {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readArtistTags(osFS{}, path)
+		if err != nil || len(got) == 0 || got[0] != tt.want {
+			t.Fatalf("readArtistTags(%s) = %q, %v; want %q", name, got, err, tt.want)
+		}
+	}
+
+	untagged := filepath.Join(dir, "e.wav")
+	if err := os.WriteFile(untagged, []byte("RIFF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readArtistTags(osFS{}, untagged); err != errNoTags {
+		t.Fatalf("expected errNoTags, got %v", err)
+	}
+}
+
+func TestArtistMatches(t *testing.T) {
+	tests := []struct {
+		artist, tag string
+		want        bool
+	}{
+		{"Daft Punk", "daft punk", true},
+		{"Beatles", "The Beatles", true},
+		{"Daft Punk", "Daft Punk feat. Pharrell Williams", true},
+		{"Pharrell Williams", "Daft Punk ft. Pharrell Williams", true},
+		{"Simon & Garfunkel", "Simon & Garfunkel", true},
+		{"Justice", "Daft Punk", false},
+		{"Daft", "Daft Punk", false},
+	}
+	for _, tt := range tests {
+		if got := artistMatches(tt.artist, tt.tag); got != tt.want {
+			t.Fatalf("artistMatches(%q, %q) = %v, want %v", tt.artist, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyArtistTag(t *testing.T) {
+	dir := t.TempDir()
+	mp3 := append(id3v23(map[string][]byte{"TPE1": append([]byte{3}, "Justice"...)}), 0xff, 0xfb)
+	if err := os.WriteFile(filepath.Join(dir, "01.mp3"), mp3, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	r := &runner{log: log.New(&logs, "", 0), artistDir: "Daft Punk"}
+	r.opts.VerifyArtistTag = true
+	if err := r.verifyArtistTag(dir); err != nil {
+		t.Fatalf("mismatch without --strict should only warn, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "warning: artist tags") {
+		t.Fatalf("expected mismatch warning, got:\n%s", logs.String())
+	}
+
+	r.opts.Strict = true
+	if err := r.verifyArtistTag(dir); err == nil {
+		t.Fatalf("expected --strict to abort on mismatch")
+	}
+
+	r.log = log.New(io.Discard, "", 0)
+	r.artistDir = "Justice"
+	if err := r.verifyArtistTag(dir); err != nil {
+		t.Fatalf("matching tag returned error: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// addedFile is a file the move created in the library.
+type addedFile struct {
+	path string
+	size int64
+}
+
+// treeNode is a folder of the --tree output; files are leaves.
+type treeNode struct {
+	dirs  map[string]*treeNode
+	files []addedFile // path holds the base name
+	size  int64
+	count int
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{dirs: make(map[string]*treeNode)}
+}
+
+// printTree writes the files this run added below dest (--tree).
+func (r *runner) printTree(dest string) {
+	if r.opts.DryRun {
+		r.log.Printf("dry-run: --tree has nothing to show; no files were added")
+		return
+	}
+	if err := writeTree(r.console(), dest, r.added, r.stats.units); err != nil {
+		r.log.Printf("warning: cannot print tree: %v", err)
+	}
+}
+
+// writeTree renders files, which live below root, as an indented tree:
+// folders first, then files, each sorted by name, with sizes and per-folder
+// totals.
+func writeTree(w io.Writer, root string, files []addedFile, units config.SizeUnits) error {
+	top := newTreeNode()
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f.path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			rel = f.path
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		node := top
+		node.size += f.size
+		node.count++
+		for _, dir := range parts[:len(parts)-1] {
+			child, ok := node.dirs[dir]
+			if !ok {
+				child = newTreeNode()
+				node.dirs[dir] = child
+			}
+			node = child
+			node.size += f.size
+			node.count++
+		}
+		node.files = append(node.files, addedFile{path: parts[len(parts)-1], size: f.size})
+	}
+
+	if _, err := fmt.Fprintf(w, "%s (%d new file(s), %s)\n", root, top.count, humanBytes(top.size, units)); err != nil {
+		return err
+	}
+	return top.write(w, "", units)
+}
+
+func (n *treeNode) write(w io.Writer, indent string, units config.SizeUnits) error {
+	names := make([]string, 0, len(n.dirs))
+	for name := range n.dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Slice(n.files, func(i, j int) bool { return n.files[i].path < n.files[j].path })
+
+	for _, name := range names {
+		child := n.dirs[name]
+		if _, err := fmt.Fprintf(w, "%s%s/ (%s)\n", indent, name, humanBytes(child.size, units)); err != nil {
+			return err
+		}
+		if err := child.write(w, indent+"  ", units); err != nil {
+			return err
+		}
+	}
+	for _, f := range n.files {
+		if _, err := fmt.Fprintf(w, "%s%s  %s\n", indent, f.path, humanBytes(f.size, units)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
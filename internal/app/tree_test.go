@@ -0,0 +1,60 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestExecuteTree(t *testing.T) {
+	kept := t.TempDir()
+	library := t.TempDir()
+	write := func(root, name string, size int) {
+		t.Helper()
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(library, "Artist/Older/01.flac", 10)
+	write(kept, "Album/CD2/01.flac", 2048)
+	write(kept, "Album/CD1/01.flac", 1024)
+	write(kept, "Album/cover.jpg", 100)
+
+	dest := filepath.Join(library, "Artist")
+	r := &runner{
+		cfg:  config.Config{NavidromeMusicPath: library},
+		opts: Options{Artist: "Artist", ReuseTemp: kept},
+		log:  log.New(io.Discard, "", 0),
+	}
+	if err := r.Execute(); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	if len(r.added) != 3 {
+		t.Fatalf("expected 3 added files, got %+v", r.added)
+	}
+
+	var out bytes.Buffer
+	if err := writeTree(&out, dest, r.added, config.BinaryUnits); err != nil {
+		t.Fatalf("writeTree returned error: %v", err)
+	}
+	want := dest + ` (3 new file(s), 3.1 KiB)
+Album/ (3.1 KiB)
+  CD1/ (1.0 KiB)
+    01.flac  1.0 KiB
+  CD2/ (2.0 KiB)
+    01.flac  2.0 KiB
+  cover.jpg  100 B
+`
+	if out.String() != want {
+		t.Fatalf("unexpected tree:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
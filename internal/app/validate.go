@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// validateSources checks, for --validate, that every resolved archive can
+// be downloaded and looks like a zip, without fetching any archive body.
+// Each source is checked even after a failure so one run reports them all.
+func (r *runner) validateSources(sources []archiveSource) error {
+	failed := 0
+	for _, src := range sources {
+		size, err := r.validateSource(src)
+		if err != nil {
+			failed++
+			r.log.Printf("validate: FAIL %s file %s: %v", src.host, src.id, err)
+			r.emit("validated", map[string]any{"file_id": src.id, "ok": false, "error": err.Error()})
+			continue
+		}
+		if size < 0 {
+			r.stats.estimatedBytes = -1
+			r.log.Printf("validate: OK %s file %s (size unknown)", src.host, src.id)
+		} else {
+			if r.stats.estimatedBytes >= 0 {
+				r.stats.estimatedBytes += size
+			}
+			r.log.Printf("validate: OK %s file %s (%s)", src.host, src.id, humanBytes(size, r.stats.units))
+		}
+		r.emit("validated", map[string]any{"file_id": src.id, "ok": true, "total_bytes": size})
+	}
+	if failed > 0 {
+		return fmt.Errorf("validate: %d of %d URL(s) not downloadable", failed, len(sources))
+	}
+	r.log.Printf("validate: all %d URL(s) downloadable; nothing was downloaded or written", len(sources))
+	return nil
+}
+
+// validateSource returns the archive size of src, or -1 when the host does
+// not report one. Pixeldrain files are checked through the info API and
+// lists through the list API (the combined size of their files); other
+// hosts get a HEAD request, or a GET whose body is left unread when HEAD is
+// not allowed.
+func (r *runner) validateSource(src archiveSource) (int64, error) {
+	if src.list {
+		list, err := r.fetchListInfo(src.id)
+		if err != nil {
+			return 0, err
+		}
+		return listSize(list), nil
+	}
+	if src.pixeldrain {
+		info, err := r.fetchFileInfo(src.id)
+		if err != nil {
+			return 0, err
+		}
+		if !zipContentType(info.MimeType) {
+			return 0, fmt.Errorf("unexpected type %q (expected zip)", info.MimeType)
+		}
+		if info.Size == 0 {
+			return 0, fmt.Errorf("file is empty")
+		}
+		return info.Size, nil
+	}
+
+	client, err := r.apiClient(hostDownload, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.head(src.url, "application/zip", src.id)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = client.get(src.url, "application/zip", src.id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %s", resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !zipContentType(contentType) {
+		return 0, fmt.Errorf("unexpected content-type %q (expected zip)", contentType)
+	}
+	if resp.ContentLength == 0 {
+		return 0, fmt.Errorf("file is empty")
+	}
+	return resp.ContentLength, nil
+}
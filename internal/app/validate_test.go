@@ -0,0 +1,90 @@
+package app
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateSourcesPixeldrain(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.Contains(req.URL.Path, "/good/info"):
+			io.WriteString(w, `{"name":"album.zip","size":2048,"mime_type":"application/zip"}`)
+		case strings.Contains(req.URL.Path, "/video/info"):
+			io.WriteString(w, `{"name":"clip.mp4","size":2048,"mime_type":"video/mp4"}`)
+		case strings.Contains(req.URL.Path, "/info"):
+			http.Error(w, `{"success":false}`, http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s %s; --validate must not download", req.Method, req.URL)
+		}
+	})
+
+	r := &runner{log: log.New(io.Discard, "", 0)}
+	sources := []archiveSource{
+		{id: "good", host: "Pixeldrain", pixeldrain: true},
+		{id: "video", host: "Pixeldrain", pixeldrain: true},
+		{id: "missing", host: "Pixeldrain", pixeldrain: true},
+	}
+	err := r.validateSources(sources)
+	if err == nil || !strings.Contains(err.Error(), "2 of 3") {
+		t.Fatalf("validateSources error = %v, want 2 of 3 failed", err)
+	}
+	if r.stats.estimatedBytes != 2048 {
+		t.Fatalf("estimatedBytes = %d, want 2048", r.stats.estimatedBytes)
+	}
+}
+
+func TestValidateSourceHead(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		methods = append(methods, req.Method)
+		switch req.URL.Path {
+		case "/zip":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Length", "4096")
+		case "/nohead":
+			if req.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			io.WriteString(w, "PK")
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		path    string
+		size    int64
+		methods string
+		wantErr string
+	}{
+		{"/zip", 4096, "HEAD", ""},
+		{"/nohead", 2, "HEAD,GET", ""},
+		{"/page", 0, "HEAD", "content-type"},
+		{"/gone", 0, "HEAD", "404"},
+	}
+	for _, tt := range tests {
+		methods = nil
+		r := &runner{log: log.New(io.Discard, "", 0)}
+		size, err := r.validateSource(archiveSource{id: tt.path, url: srv.URL + tt.path, host: "example"})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("%s: error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+		} else if err != nil || size != tt.size {
+			t.Fatalf("%s: size %d, err %v; want %d", tt.path, size, err, tt.size)
+		}
+		if got := strings.Join(methods, ","); got != tt.methods {
+			t.Fatalf("%s: methods %s, want %s", tt.path, got, tt.methods)
+		}
+	}
+}
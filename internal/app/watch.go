@@ -0,0 +1,241 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// DefaultWatchInterval is how often --watch polls for new job files.
+const DefaultWatchInterval = 5 * time.Second
+
+// watchJob is one job file dropped into the --watch directory. Options
+// override the command-line flags for this import only.
+type watchJob struct {
+	Artist  string          `json:"artist"`
+	URL     string          `json:"url"`
+	URLs    []string        `json:"urls"`
+	Options watchJobOptions `json:"options"`
+}
+
+// watchJobOptions are the per-job overrides; unset fields keep the flag
+// values the daemon was started with.
+type watchJobOptions struct {
+	Subpath             *string  `json:"subpath"`
+	CoverURL            *string  `json:"cover_url"`
+	Stage               *bool    `json:"stage"`
+	DryRun              *bool    `json:"dry_run"`
+	CanonicalizeArtist  *bool    `json:"canonicalize_artist"`
+	NormalizeDiscs      *bool    `json:"normalize_discs"`
+	NormalizeYear       *bool    `json:"normalize_year"`
+	PruneDupeExtensions *bool    `json:"prune_dupe_extensions"`
+	Only                []string `json:"only"`
+	ExtractOnly         []string `json:"extract_only"`
+	PruneKeep           []string `json:"prune_keep"`
+}
+
+// parseWatchJob reads a job file. Unknown fields are rejected so a typo
+// fails the job instead of being silently ignored.
+func parseWatchJob(path string) (watchJob, error) {
+	var job watchJob
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return job, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&job); err != nil {
+		return job, fmt.Errorf("parse job: %w", err)
+	}
+	job.Artist = strings.TrimSpace(job.Artist)
+	if job.Artist == "" {
+		return job, fmt.Errorf("job has no artist")
+	}
+	if job.URL != "" {
+		job.URLs = append([]string{job.URL}, job.URLs...)
+	}
+	if len(job.URLs) == 0 {
+		return job, fmt.Errorf("job has no url")
+	}
+	return job, nil
+}
+
+// apply returns base with the job's artist, URLs and overrides.
+func (job watchJob) apply(base Options) Options {
+	opts := base
+	opts.Artist = job.Artist
+	opts.URLs = job.URLs
+	o := job.Options
+	for _, b := range []struct {
+		src *bool
+		dst *bool
+	}{
+		{o.Stage, &opts.Stage},
+		{o.DryRun, &opts.DryRun},
+		{o.CanonicalizeArtist, &opts.CanonicalizeArtist},
+		{o.NormalizeDiscs, &opts.NormalizeDiscs},
+		{o.NormalizeYear, &opts.NormalizeYear},
+		{o.PruneDupeExtensions, &opts.PruneDupeExtensions},
+	} {
+		if b.src != nil {
+			*b.dst = *b.src
+		}
+	}
+	if o.Subpath != nil {
+		opts.Subpath = *o.Subpath
+	}
+	if o.CoverURL != nil {
+		opts.CoverURL = *o.CoverURL
+	}
+	if o.Only != nil {
+		opts.Only = o.Only
+	}
+	if o.ExtractOnly != nil {
+		opts.ExtractOnly = o.ExtractOnly
+	}
+	if o.PruneKeep != nil {
+		opts.PruneKeep = o.PruneKeep
+	}
+	return opts
+}
+
+// watcher processes job files from opts.WatchDir one at a time, moving
+// each to the done or failed subfolder once its import has finished.
+type watcher struct {
+	cfg    config.Config
+	opts   Options
+	events *eventStream
+	log    *log.Logger
+	// jobs counts the jobs started, numbering their import IDs.
+	jobs int
+}
+
+// runWatch polls opts.WatchDir until SIGINT or SIGTERM. The signal lets
+// the current job finish; a second one aborts as usual.
+func runWatch(cfg config.Config, opts Options, events *eventStream) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := &watcher{cfg: cfg, opts: opts, events: events, log: log.New(consoleFor(opts), logPrefix(opts), log.LstdFlags)}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+			w.log.Printf("watch: shutdown requested; finishing the current job (interrupt again to abort)")
+		case <-done:
+		}
+	}()
+	return w.run(ctx)
+}
+
+func (w *watcher) run(ctx context.Context) error {
+	for _, sub := range []string{"done", "failed"} {
+		if err := os.MkdirAll(filepath.Join(w.opts.WatchDir, sub), 0o755); err != nil {
+			return fmt.Errorf("watch: %w", err)
+		}
+	}
+	interval := w.opts.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	w.log.Printf("watch: waiting for *.json jobs in %s (every %s)", w.opts.WatchDir, interval)
+
+	for {
+		if err := w.scan(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			w.log.Printf("watch: stopped")
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// scan processes the job files currently in the watch directory in name
+// order, stopping early once ctx is cancelled.
+func (w *watcher) scan(ctx context.Context) error {
+	jobs, err := filepath.Glob(filepath.Join(w.opts.WatchDir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	sort.Strings(jobs)
+	for _, path := range jobs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if strings.HasPrefix(filepath.Base(path), ".") {
+			continue
+		}
+		if err := w.process(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// process runs one job and files it under done/ or failed/. Import errors
+// are logged and recorded next to the failed job; only errors moving the
+// job file itself stop the watcher.
+func (w *watcher) process(path string) error {
+	name := filepath.Base(path)
+	w.log.Printf("watch: starting job %s", name)
+
+	job, err := parseWatchJob(path)
+	if err == nil {
+		opts := job.apply(w.opts)
+		w.jobs++
+		opts.ImportID = subImportID(w.opts.ImportID, w.jobs)
+		started := time.Now()
+		r := newRunner(w.cfg, opts)
+		r.events = w.events
+		err = finishImport(started, opts, r, r.Execute())
+	}
+
+	if err != nil {
+		w.log.Printf("watch: job %s failed: %v", name, err)
+		dest, moveErr := w.file(path, "failed")
+		if moveErr != nil {
+			return moveErr
+		}
+		if err := os.WriteFile(dest+".error", []byte(err.Error()+"\n"), 0o644); err != nil {
+			w.log.Printf("warning: could not record error for %s: %v", name, err)
+		}
+		return nil
+	}
+	w.log.Printf("watch: job %s succeeded", name)
+	_, err = w.file(path, "done")
+	return err
+}
+
+// file moves a finished job into sub, numbering it when a job of the same
+// name was filed before, and returns its new path.
+func (w *watcher) file(path, sub string) (string, error) {
+	name := filepath.Base(path)
+	dest := filepath.Join(w.opts.WatchDir, sub, name)
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			break
+		}
+		dest = filepath.Join(w.opts.WatchDir, sub, strings.TrimSuffix(name, ".json")+"."+strconv.Itoa(n)+".json")
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return "", fmt.Errorf("watch: move job %s to %s: %w", name, sub, err)
+	}
+	return dest, nil
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+func TestParseWatchJob(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		wantErr string
+	}{
+		{`{"artist":"A","url":"abc123","options":{"subpath":"Live","dry_run":true}}`, ""},
+		{`{"artist":"A","urls":["abc123","def456"]}`, ""},
+		{`{"artist":"A"}`, "no url"},
+		{`{"url":"abc123"}`, "no artist"},
+		{`{"artist":"A","url":"abc123","options":{"dryrun":true}}`, "unknown field"},
+		{`not json`, "parse job"},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, "job.json")
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		job, err := parseWatchJob(path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("case %d: error = %v, want %q", i, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if job.Artist != "A" || len(job.URLs) == 0 {
+			t.Fatalf("case %d: job = %+v", i, job)
+		}
+	}
+
+	job, _ := parseWatchJob(writeJob(t, dir, "o.json", `{"artist":"A","url":"x","options":{"subpath":"Live","dry_run":true}}`))
+	opts := job.apply(Options{TmpDir: "/tmp", Stage: true})
+	if opts.Subpath != "Live" || !opts.DryRun || !opts.Stage || opts.TmpDir != "/tmp" || opts.URLs[0] != "x" {
+		t.Fatalf("apply = %+v", opts)
+	}
+}
+
+func writeJob(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWatcherScan(t *testing.T) {
+	withPixeldrainAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "missing") {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(zipBytes(t, map[string]string{"Album/01.flac": "audio"}))
+	})
+
+	dir := t.TempDir()
+	library := filepath.Join(dir, "library")
+	queue := filepath.Join(dir, "queue")
+	for _, d := range []string{library, queue} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeJob(t, queue, "1-good.json", `{"artist":"Good","url":"abc123"}`)
+	writeJob(t, queue, "2-bad.json", `{"artist":"Bad","url":"missing"}`)
+	writeJob(t, queue, ".3-partial.json", `{"artist":`)
+
+	w := &watcher{
+		cfg:  config.Config{NavidromeMusicPath: library},
+		opts: Options{WatchDir: queue, TmpDir: dir},
+		log:  log.New(io.Discard, "", 0),
+	}
+	// After a shutdown signal no new job is started.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.run(ctx); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(queue, "1-good.json")); err != nil {
+		t.Fatalf("job started after shutdown: %v", err)
+	}
+
+	if err := w.scan(context.Background()); err != nil {
+		t.Fatalf("scan returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(library, "Good", "Album", "01.flac")); err != nil {
+		t.Fatalf("good job not imported: %v", err)
+	}
+	for _, path := range []string{
+		filepath.Join(queue, "done", "1-good.json"),
+		filepath.Join(queue, "failed", "2-bad.json"),
+		filepath.Join(queue, "failed", "2-bad.json.error"),
+		filepath.Join(queue, ".3-partial.json"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected %s: %v", path, err)
+		}
+	}
+
+	// A job with a name already filed is numbered instead of overwritten.
+	writeJob(t, queue, "1-good.json", `{"artist":"Other","url":"abc123","options":{"dry_run":true}}`)
+	if err := w.scan(context.Background()); err != nil {
+		t.Fatalf("scan returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(queue, "done", "1-good.2.json")); err != nil {
+		t.Fatalf("expected numbered done job: %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+package app
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// davTimeout bounds the wait for a WebDAV server to answer a request once
+// it has been sent; uploads and downloads themselves may take longer.
+const davTimeout = 2 * time.Minute
+
+// davFS writes the library to a WebDAV server (davs:// NAVIDROME_MUSIC_PATH)
+// with basic auth. Paths are the server's URL paths; collections are
+// created with MKCOL and looked up with PROPFIND. Modes, times and ownership
+// cannot be set over WebDAV and are ignored.
+type davFS struct {
+	dav    config.DAV
+	client *http.Client
+	err    error // set when the client could not be built; every request fails with it
+	ctx    context.Context
+	tmpDir string // where uploads are buffered; "" means os.TempDir
+}
+
+func (r *runner) davFS() *davFS {
+	d := &davFS{dav: *r.cfg.DAV, ctx: r.context(), tmpDir: r.tmpBase()}
+	d.client, d.err = r.davHTTPClient()
+	return d
+}
+
+// davHTTPClient returns the client shared by the run's WebDAV requests. It
+// honours --ca-cert and --insecure-skip-verify like Pixeldrain downloads,
+// since a NAS often serves a self-signed certificate.
+func (r *runner) davHTTPClient() (*http.Client, error) {
+	if r.davClient != nil {
+		return r.davClient, nil
+	}
+	transport, err := r.trustTransport()
+	if err != nil {
+		return nil, err
+	}
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	transport.ResponseHeaderTimeout = davTimeout
+	r.davClient = &http.Client{Transport: transport}
+	return r.davClient, nil
+}
+
+// remoteURL renders name as the https URL it lives at, for requests and logs.
+func (d *davFS) remoteURL(name string) string {
+	return d.dav.BaseURL + (&url.URL{Path: path.Clean(filepath.ToSlash(name))}).EscapedPath()
+}
+
+func (d *davFS) request(method, name string, body io.Reader) (*http.Request, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	req, err := http.NewRequestWithContext(d.ctx, method, d.remoteURL(name), body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(d.dav.User, d.dav.Password)
+	return req, nil
+}
+
+// do sends req and returns the response for 2xx statuses; a 404 becomes
+// fs.ErrNotExist. okStatus lists further statuses treated as success.
+func (d *davFS) do(req *http.Request, okStatus ...int) (*http.Response, error) {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	for _, code := range okStatus {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("webdav %s %s: %s (check the user and DAV_PASSWORD)", req.Method, req.URL.Path, resp.Status)
+	}
+	return nil, fmt.Errorf("webdav %s %s: unexpected status %s", req.Method, req.URL.Path, resp.Status)
+}
+
+// send issues a request without a body of interest and closes the response.
+func (d *davFS) send(method, name string, header http.Header, okStatus ...int) error {
+	req, err := d.request(method, name, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := d.do(req, okStatus...)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/></d:prop></d:propfind>`
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength int64 `xml:"DAV: getcontentlength"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind lists name (depth "0") or name and its children (depth "1"),
+// keyed by decoded path without a trailing slash.
+func (d *davFS) propfind(name, depth string) ([]walkEntry, error) {
+	req, err := d.request("PROPFIND", name, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := d.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("webdav PROPFIND %s: unexpected status %s", req.URL.Path, resp.Status)
+	}
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("decode PROPFIND %s: %w", req.URL.Path, err)
+	}
+
+	var entries []walkEntry
+	for _, r := range ms.Responses {
+		u, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, fmt.Errorf("PROPFIND %s: bad href %q", req.URL.Path, r.Href)
+		}
+		p := path.Clean("/" + u.Path)
+		info := remoteInfo{name: path.Base(p)}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			info.dir = ps.Prop.ResourceType.Collection != nil
+			info.size = ps.Prop.ContentLength
+		}
+		entries = append(entries, walkEntry{path: p, info: info})
+	}
+	return entries, nil
+}
+
+// Lstat is Stat; WebDAV does not expose symlinks.
+func (d *davFS) Lstat(name string) (fs.FileInfo, error) { return d.Stat(name) }
+
+// Stat looks name up with a depth-0 PROPFIND.
+func (d *davFS) Stat(name string) (fs.FileInfo, error) {
+	entries, err := d.propfind(name, "0")
+	if err == nil && len(entries) == 0 {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return entries[0].info, nil
+}
+
+// MkdirAll creates name and any missing parents with MKCOL, one level at a
+// time as WebDAV requires. It looks for the deepest existing ancestor with
+// PROPFIND first, so no MKCOL reaches parents the user may not write to,
+// such as /remote.php/dav/ on Nextcloud.
+func (d *davFS) MkdirAll(name string, perm os.FileMode) error {
+	var missing []string
+	for dir := path.Clean(filepath.ToSlash(name)); ; dir = path.Dir(dir) {
+		info, err := d.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) || dir == "/" || dir == "." {
+			return err
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		// 405 Method Not Allowed: another client created it meanwhile.
+		if err := d.send("MKCOL", missing[i]+"/", nil, http.StatusMethodNotAllowed); err != nil {
+			return &fs.PathError{Op: "mkdir", Path: missing[i], Err: err}
+		}
+	}
+	return nil
+}
+
+func (d *davFS) Chmod(name string, mode os.FileMode) error         { return nil }
+func (d *davFS) Chtimes(name string, atime, mtime time.Time) error { return nil }
+
+// Lchown reports ErrUnsupported so --owner logs a warning instead of failing.
+func (d *davFS) Lchown(name string, uid, gid int) error { return errors.ErrUnsupported }
+
+// Create buffers the file in a local temp file and uploads it with one PUT
+// on Close, since many servers reject chunked uploads.
+func (d *davFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	tmp, err := os.CreateTemp(d.tmpDir, "nd-import-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(tmp.Name())
+	return &davWriter{d: d, name: name, tmp: tmp}, nil
+}
+
+type davWriter struct {
+	d    *davFS
+	name string
+	tmp  *os.File
+}
+
+func (w *davWriter) Write(b []byte) (int, error) { return w.tmp.Write(b) }
+
+func (w *davWriter) Close() error {
+	defer w.tmp.Close()
+	size, err := w.tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := w.d.request(http.MethodPut, w.name, io.NopCloser(w.tmp))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	resp, err := w.d.do(req)
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", w.d.remoteURL(w.name), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (d *davFS) Open(name string) (io.ReadCloser, error) {
+	req, err := d.request(http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return resp.Body, nil
+}
+
+func (d *davFS) Rename(oldpath, newpath string) error {
+	header := http.Header{"Destination": {d.remoteURL(newpath)}, "Overwrite": {"T"}}
+	if err := d.send("MOVE", oldpath, header); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: err}
+	}
+	return nil
+}
+
+// Remove deletes a file or an empty collection. WebDAV DELETE is recursive,
+// so collections are checked for children first, like rmdir(2).
+func (d *davFS) Remove(name string) error {
+	entries, err := d.propfind(name, "1")
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if len(entries) > 1 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+	if err := d.send(http.MethodDelete, name, nil); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (d *davFS) RemoveAll(name string) error {
+	err := d.send(http.MethodDelete, name, nil)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// WalkDir lists root one collection at a time with depth-1 PROPFINDs
+// (servers commonly refuse Depth: infinity) and replays the entries.
+func (d *davFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := d.Stat(root)
+	if err != nil {
+		return skipDirOK(fn(root, nil, err))
+	}
+	if !info.IsDir() {
+		return skipDirOK(fn(root, fs.FileInfoToDirEntry(info), nil))
+	}
+
+	var entries []walkEntry
+	pending := []string{path.Clean(filepath.ToSlash(root))}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		listed, err := d.propfind(dir, "1")
+		if err != nil {
+			return skipDirOK(fn(dir, nil, err))
+		}
+		for _, e := range listed {
+			if e.path == dir {
+				continue
+			}
+			entries = append(entries, e)
+			if e.info.IsDir() {
+				pending = append(pending, e.path)
+			}
+		}
+	}
+	return replayWalk(root, info, entries, fn)
+}
+
+// logPlannedDAV lists, for --dry-run, the collections and files a move from
+// extractDir into dest would create on the server.
+func (r *runner) logPlannedDAV(dav *davFS, extractDir, dest string) error {
+	exists := make(map[string]bool)
+	var dirs, files int
+	planDir := func(dir string) error {
+		var missing []string
+		for p := dir; p != "/" && p != "."; p = path.Dir(p) {
+			if known, ok := exists[p]; ok {
+				if known {
+					break
+				}
+				continue
+			}
+			_, err := dav.Stat(p)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			exists[p] = err == nil
+			if err == nil {
+				break
+			}
+			missing = append([]string{p}, missing...)
+		}
+		for _, p := range missing {
+			r.log.Printf("dry-run: would create folder %s/", dav.remoteURL(p))
+			dirs++
+		}
+		return nil
+	}
+
+	err := r.workFS().WalkDir(extractDir, func(p string, e os.DirEntry, walkErr error) error {
+		if walkErr != nil || e.IsDir() {
+			return walkErr
+		}
+		if _, skip := r.collisionSkipped[p]; skip {
+			return nil
+		}
+		if _, gone := r.dryRunPruned[p]; gone {
+			return nil
+		}
+		rel, err := filepath.Rel(extractDir, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.ToSlash(filepath.Join(dest, r.destRel(rel, false)))
+		if err := planDir(path.Dir(target)); err != nil {
+			return err
+		}
+		r.log.Printf("dry-run: would upload %s", dav.remoteURL(target))
+		files++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.log.Printf("dry-run: would create %d folder(s) and %d file(s) under %s", dirs, files, dav.remoteURL(dest))
+	return nil
+}
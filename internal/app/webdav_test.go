@@ -0,0 +1,239 @@
+package app
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"cli-navidrome-helper/internal/config"
+)
+
+// fakeDAV is a minimal WebDAV server holding files and collections in memory.
+// Like Nextcloud, it refuses MKCOL outside the user's folder, /library.
+type fakeDAV struct {
+	mu     sync.Mutex
+	dirs   map[string]bool
+	files  map[string][]byte
+	mkcols []string
+}
+
+func newFakeDAV(t *testing.T) (*fakeDAV, *httptest.Server) {
+	f := &fakeDAV{dirs: map[string]bool{"/": true, "/library": true}, files: make(map[string][]byte)}
+	srv := httptest.NewUnstartedServer(f)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeDAV) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, pass, ok := req.BasicAuth(); !ok || user != "media" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	p := path.Clean(req.URL.Path)
+	switch req.Method {
+	case "PROPFIND":
+		if !f.dirs[p] && f.files[p] == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:">`)
+		f.writeProp(w, p)
+		if req.Header.Get("Depth") == "1" && f.dirs[p] {
+			for _, child := range f.children(p) {
+				f.writeProp(w, child)
+			}
+		}
+		fmt.Fprint(w, `</D:multistatus>`)
+	case "MKCOL":
+		f.mkcols = append(f.mkcols, p)
+		if !strings.HasPrefix(p, "/library/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if f.dirs[p] || f.files[p] != nil {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !f.dirs[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.dirs[p] = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		if !f.dirs[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		data, _ := io.ReadAll(req.Body)
+		if data == nil {
+			data = []byte{}
+		}
+		f.files[p] = data
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		data, ok := f.files[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		for name := range f.files {
+			if name == p || strings.HasPrefix(name, p+"/") {
+				delete(f.files, name)
+			}
+		}
+		for name := range f.dirs {
+			if name == p || strings.HasPrefix(name, p+"/") {
+				delete(f.dirs, name)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeDAV) children(dir string) []string {
+	var out []string
+	for name := range f.dirs {
+		if name != dir && path.Dir(name) == dir {
+			out = append(out, name)
+		}
+	}
+	for name := range f.files {
+		if path.Dir(name) == dir {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (f *fakeDAV) writeProp(w io.Writer, p string) {
+	href := (&url.URL{Path: p}).EscapedPath()
+	if f.dirs[p] {
+		fmt.Fprintf(w, `<D:response><D:href>%s/</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`, href)
+		return
+	}
+	fmt.Fprintf(w, `<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype/><D:getcontentlength>%d</D:getcontentlength></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`, href, len(f.files[p]))
+}
+
+// davRunner returns a runner writing to srv, whose certificate it trusts
+// through --ca-cert.
+func davRunner(t *testing.T, srv *httptest.Server) (*runner, *bytes.Buffer) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	return &runner{
+		cfg: config.Config{
+			NavidromeMusicPath: "/library",
+			DAV:                &config.DAV{BaseURL: srv.URL, User: "media", Password: "secret"},
+		},
+		opts: Options{TmpDir: t.TempDir(), CACert: caFile},
+		log:  log.New(&logs, "", 0),
+	}, &logs
+}
+
+func TestMoveIntoDAV(t *testing.T) {
+	server, srv := newFakeDAV(t)
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "Album (2020)"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "Album (2020)", "01 Song.flac"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "Album (2020)", "empty.cue"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := davRunner(t, srv)
+	if !r.remoteLibrary() {
+		t.Fatalf("a davs:// library should count as remote")
+	}
+	if err := r.moveIntoLibrary(src, "/library/Artist"); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	if got := string(server.files["/library/Artist/Album (2020)/01 Song.flac"]); got != "data" {
+		t.Fatalf("uploaded file = %q, want %q (files: %v)", got, "data", server.files)
+	}
+	if _, ok := server.files["/library/Artist/Album (2020)/empty.cue"]; !ok {
+		t.Fatalf("empty file not uploaded")
+	}
+	if want := []string{"/library/Artist", "/library/Artist/Album (2020)"}; !slices.Equal(server.mkcols, want) {
+		t.Fatalf("MKCOL sent for %q, want only the missing folders %q", server.mkcols, want)
+	}
+
+	// The second import collides with the files of the first.
+	err := r.moveIntoLibrary(src, "/library/Artist")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected collision error, got %v", err)
+	}
+
+	r.davClient = nil
+	r.opts.CACert = ""
+	if _, err := r.library().Stat("/library"); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("expected a certificate error without --ca-cert, got %v", err)
+	}
+
+	r.davClient = nil
+	r.opts.InsecureSkipVerify = true
+	r.cfg.DAV.Password = "wrong"
+	if _, err := r.library().Stat("/library"); err == nil || !strings.Contains(err.Error(), "DAV_PASSWORD") {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+	if err := r.library().MkdirAll("/library/Other", 0o755); err == nil || !strings.Contains(err.Error(), "DAV_PASSWORD") {
+		t.Fatalf("expected MkdirAll to report the authentication error, got %v", err)
+	}
+}
+
+func TestMoveIntoDAVDryRun(t *testing.T) {
+	server, srv := newFakeDAV(t)
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "Album", "01.flac"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, logs := davRunner(t, srv)
+	r.opts.DryRun = true
+	if err := r.moveIntoLibrary(src, "/library/Artist"); err != nil {
+		t.Fatalf("moveIntoLibrary returned error: %v", err)
+	}
+	if len(server.files) != 0 || server.dirs["/library/Artist"] {
+		t.Fatalf("dry-run wrote to the server: %v %v", server.dirs, server.files)
+	}
+	for _, want := range []string{
+		"would create folder " + srv.URL + "/library/Artist/",
+		"would create folder " + srv.URL + "/library/Artist/Album/",
+		"would upload " + srv.URL + "/library/Artist/Album/01.flac",
+		"would create 2 folder(s) and 1 file(s)",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Fatalf("dry-run log missing %q:\n%s", want, logs.String())
+		}
+	}
+}
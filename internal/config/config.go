@@ -3,8 +3,12 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
@@ -15,15 +19,145 @@ type Config struct {
 	NavidromeMusicPath string
 	UnneededPatterns   []string
 	PixeldrainToken    string
+	// PixeldrainAPIBase points Pixeldrain requests at a self-hosted or
+	// mirror instance (PIXELDRAIN_API_BASE); empty means pixeldrain.com.
+	PixeldrainAPIBase string
+	// StagingPath optionally holds imports for review before they are
+	// promoted into NavidromeMusicPath.
+	StagingPath string
+	// DirMode and FileMode override permissions of created directories and
+	// files; zero means use the defaults.
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	// Owner, when set, is applied to directories and files created in the library.
+	Owner *Owner
+	// SizeUnits selects how byte counts are printed; empty means binary.
+	SizeUnits SizeUnits
+	// MinFreeSpace is the free space, in bytes, an import must leave on the
+	// library volume (MIN_FREE_SPACE); zero disables the check.
+	MinFreeSpace int64
+	// ClassifyExtensions maps lowercase extensions (".mkv") to the --classify
+	// category folder they go to, overriding the built-in map
+	// (CLASSIFY_EXTENSIONS).
+	ClassifyExtensions map[string]string
+	// Remote is set when NAVIDROME_MUSIC_PATH is an sftp:// URL; the
+	// library then lives on that host and NavidromeMusicPath holds the
+	// remote path.
+	Remote *Remote
+	// Bucket is set when NAVIDROME_MUSIC_PATH is an s3:// URL; imports are
+	// then uploaded as objects and NavidromeMusicPath holds "/" plus the
+	// key prefix.
+	Bucket *Bucket
+	// DAV is set when NAVIDROME_MUSIC_PATH is a davs:// URL; imports are
+	// then written over WebDAV and NavidromeMusicPath holds the path on the
+	// server.
+	DAV *DAV
 }
 
-// Load reads .env (if present) and validates required settings.
-func Load() (Config, error) {
-	_ = godotenv.Load()
+// DAV describes a WebDAV library reached over HTTPS with basic auth.
+type DAV struct {
+	// BaseURL is the server origin, e.g. "https://nas.local:8443".
+	BaseURL  string
+	User     string
+	Password string
+}
+
+// Bucket describes an S3-compatible object storage destination.
+type Bucket struct {
+	Name string
+	// Endpoint is the service base URL (S3_ENDPOINT, e.g. a MinIO server);
+	// it defaults to AWS for Region.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Remote describes a library host reached over SFTP.
+type Remote struct {
+	User string
+	Host string
+	Port int // 0 means 22
+	// KeyFile is a private key to log in with (SFTP_KEY_FILE).
+	KeyFile string
+	// Password is the login password (SFTP_PASSWORD).
+	Password string
+	// KnownHosts is the known_hosts file the host key must be listed in
+	// (SFTP_KNOWN_HOSTS, default ~/.ssh/known_hosts).
+	KnownHosts string
+}
+
+// Address returns "host:port" for dialing.
+func (r Remote) Address() string {
+	port := r.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(r.Host, strconv.Itoa(port))
+}
+
+// SizeUnits is either BinaryUnits (KiB, MiB; powers of 1024) or
+// DecimalUnits (KB, MB; powers of 1000).
+type SizeUnits string
+
+const (
+	BinaryUnits  SizeUnits = "binary"
+	DecimalUnits SizeUnits = "decimal"
+)
+
+// Owner is a numeric uid/gid pair; -1 leaves that id unchanged.
+type Owner struct {
+	UID int
+	GID int
+}
+
+func (o Owner) String() string {
+	return fmt.Sprintf("%d:%d", o.UID, o.GID)
+}
+
+// Load reads envFile, or .env in the working directory when envFile is
+// empty, and validates required settings. A missing default .env is
+// ignored; an explicit envFile that cannot be read is an error. Variables
+// already set in the environment always win over either file.
+func Load(envFile string) (Config, error) {
+	return LoadWithLibrary(envFile, "")
+}
+
+// LoadWithLibrary is Load with library, when non-empty, used as the local
+// music root instead of NAVIDROME_MUSIC_PATH, which then need not be set.
+// It must be an absolute path to an existing directory.
+func LoadWithLibrary(envFile, library string) (Config, error) {
+	return load(envFile, library, true)
+}
+
+// LoadSettings is Load for commands that never touch the library:
+// NAVIDROME_MUSIC_PATH and STAGING_PATH are neither required nor checked.
+func LoadSettings(envFile string) (Config, error) {
+	return load(envFile, "", false)
+}
+
+func load(envFile, library string, needLibrary bool) (Config, error) {
+	if envFile == "" {
+		_ = godotenv.Load()
+	} else if err := godotenv.Load(envFile); err != nil {
+		return Config{}, fmt.Errorf("load env file %q: %w", envFile, err)
+	}
 
 	cfg := Config{
 		NavidromeMusicPath: strings.TrimSpace(os.Getenv("NAVIDROME_MUSIC_PATH")),
-		PixeldrainToken:    strings.TrimSpace(os.Getenv("PIXELDRAIN_TOKEN")),
+		StagingPath:        strings.TrimSpace(os.Getenv("STAGING_PATH")),
+	}
+
+	token, err := secretEnv("PIXELDRAIN_TOKEN")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.PixeldrainToken = token
+	if raw := strings.TrimSpace(os.Getenv("PIXELDRAIN_API_BASE")); raw != "" {
+		if cfg.PixeldrainAPIBase, err = ParseAPIBase(raw); err != nil {
+			return cfg, fmt.Errorf("PIXELDRAIN_API_BASE: %w", err)
+		}
 	}
 
 	rawPatterns := strings.TrimSpace(os.Getenv("UNNEEDED_FILES"))
@@ -35,20 +169,447 @@ func Load() (Config, error) {
 			}
 		}
 	}
+	if path := strings.TrimSpace(os.Getenv("UNNEEDED_FILES_FILE")); path != "" {
+		patterns, err := ReadPatternFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("UNNEEDED_FILES_FILE: %w", err)
+		}
+		cfg.UnneededPatterns = append(cfg.UnneededPatterns, patterns...)
+	}
+
+	for _, m := range []struct {
+		env  string
+		dest *os.FileMode
+	}{
+		{"DIR_MODE", &cfg.DirMode},
+		{"FILE_MODE", &cfg.FileMode},
+	} {
+		raw := strings.TrimSpace(os.Getenv(m.env))
+		if raw == "" {
+			continue
+		}
+		mode, err := ParseMode(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", m.env, err)
+		}
+		*m.dest = mode
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("MIN_FREE_SPACE")); raw != "" {
+		size, err := ParseSize(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("MIN_FREE_SPACE: %w", err)
+		}
+		cfg.MinFreeSpace = size
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("CLASSIFY_EXTENSIONS")); raw != "" {
+		classes, err := ParseClassifyExtensions(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("CLASSIFY_EXTENSIONS: %w", err)
+		}
+		cfg.ClassifyExtensions = classes
+	}
 
-	if cfg.NavidromeMusicPath == "" {
+	if raw := strings.TrimSpace(os.Getenv("OWNER")); raw != "" {
+		owner, err := ParseOwner(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("OWNER: %w", err)
+		}
+		cfg.Owner = &owner
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("SIZE_UNITS")); raw != "" {
+		units, err := ParseSizeUnits(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("SIZE_UNITS: %w", err)
+		}
+		cfg.SizeUnits = units
+	}
+
+	if !needLibrary {
+		return cfg, nil
+	}
+	if library != "" {
+		cfg.NavidromeMusicPath = library
+		if err := checkDir("--dest", library); err != nil {
+			return cfg, err
+		}
+	} else if cfg.NavidromeMusicPath == "" {
 		return cfg, errors.New("NAVIDROME_MUSIC_PATH is required (absolute path to Navidrome music root)")
+	} else if strings.HasPrefix(cfg.NavidromeMusicPath, "sftp://") {
+		remote, path, err := ParseRemote(cfg.NavidromeMusicPath)
+		if err != nil {
+			return cfg, fmt.Errorf("NAVIDROME_MUSIC_PATH: %w", err)
+		}
+		if err := loadRemoteEnv(&remote); err != nil {
+			return cfg, err
+		}
+		cfg.Remote = &remote
+		cfg.NavidromeMusicPath = path
+	} else if strings.HasPrefix(cfg.NavidromeMusicPath, "s3://") {
+		bucket, prefix, err := ParseBucket(cfg.NavidromeMusicPath)
+		if err != nil {
+			return cfg, fmt.Errorf("NAVIDROME_MUSIC_PATH: %w", err)
+		}
+		if err := loadBucketEnv(&bucket); err != nil {
+			return cfg, err
+		}
+		cfg.Bucket = &bucket
+		cfg.NavidromeMusicPath = "/" + prefix
+	} else if strings.HasPrefix(cfg.NavidromeMusicPath, "davs://") {
+		dav, path, err := ParseDAV(cfg.NavidromeMusicPath)
+		if err != nil {
+			return cfg, fmt.Errorf("NAVIDROME_MUSIC_PATH: %w", err)
+		}
+		if err := loadDAVEnv(&dav); err != nil {
+			return cfg, err
+		}
+		cfg.DAV = &dav
+		cfg.NavidromeMusicPath = path
+	} else if err := checkDir("NAVIDROME_MUSIC_PATH", cfg.NavidromeMusicPath); err != nil {
+		return cfg, err
+	}
+	if cfg.StagingPath != "" {
+		if err := checkDir("STAGING_PATH", cfg.StagingPath); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// secretEnv returns the credential in env var name. When name+"_FILE" is set
+// it wins and the file's trimmed contents are used instead, so secrets can be
+// mounted (Docker/Kubernetes) rather than kept in .env.
+func secretEnv(name string) (string, error) {
+	if path := strings.TrimSpace(os.Getenv(name + "_FILE")); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s_FILE: read %q: %w", name, path, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return strings.TrimSpace(os.Getenv(name)), nil
+}
+
+// ReadPatternFile reads one doublestar pattern per line from path. Lines
+// are trimmed; blank lines and lines starting with "#" are skipped.
+func ReadPatternFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", path, err)
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
+}
+
+// ParseRemote splits "sftp://[user@]host[:port]/abs/path" into the remote
+// host and the library path on it.
+func ParseRemote(raw string) (Remote, string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return Remote{}, "", fmt.Errorf("invalid sftp URL %q: %w", raw, err)
+	}
+	if u.Scheme != "sftp" || u.Hostname() == "" || u.RawQuery != "" || u.Fragment != "" {
+		return Remote{}, "", fmt.Errorf("invalid sftp URL %q: expected sftp://user@host/path", raw)
+	}
+	if _, ok := u.User.Password(); ok {
+		return Remote{}, "", fmt.Errorf("invalid sftp URL %q: put the password in SFTP_PASSWORD instead", raw)
+	}
+	remote := Remote{User: u.User.Username(), Host: u.Hostname()}
+	if p := u.Port(); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return Remote{}, "", fmt.Errorf("invalid sftp URL %q: bad port %q", raw, p)
+		}
+		remote.Port = port
+	}
+	path := filepath.Clean(u.Path)
+	if !filepath.IsAbs(path) || path == "/" {
+		return Remote{}, "", fmt.Errorf("invalid sftp URL %q: expected an absolute library path", raw)
+	}
+	return remote, path, nil
+}
+
+// ParseBucket splits "s3://bucket[/prefix]" into the bucket and the key
+// prefix (without leading or trailing slashes) imports are written under.
+func ParseBucket(raw string) (Bucket, string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return Bucket{}, "", fmt.Errorf("invalid s3 URL %q: %w", raw, err)
+	}
+	if u.Scheme != "s3" || u.Host == "" || u.User != nil || u.Port() != "" {
+		return Bucket{}, "", fmt.Errorf("invalid s3 URL %q: expected s3://bucket/prefix", raw)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" && path.Clean(prefix) != prefix {
+		return Bucket{}, "", fmt.Errorf("invalid s3 URL %q: prefix must not contain empty, . or .. segments", raw)
+	}
+	return Bucket{Name: u.Host}, prefix, nil
+}
+
+// ParseAPIBase validates an http(s) API base URL such as
+// "https://pd.example.com/api" and returns it without a trailing slash.
+func ParseAPIBase(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid API base URL %q: %w", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid API base URL %q: expected http(s)://host[/path]", raw)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid API base URL %q: credentials, query and fragment are not allowed", raw)
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// ParseDAV splits "davs://[user@]host[:port]/path" into the HTTPS server and
+// the library path on it.
+func ParseDAV(raw string) (DAV, string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return DAV{}, "", fmt.Errorf("invalid davs URL %q: %w", raw, err)
+	}
+	if u.Scheme != "davs" || u.Hostname() == "" || u.RawQuery != "" || u.Fragment != "" {
+		return DAV{}, "", fmt.Errorf("invalid davs URL %q: expected davs://user@host/path", raw)
+	}
+	if _, ok := u.User.Password(); ok {
+		return DAV{}, "", fmt.Errorf("invalid davs URL %q: put the password in DAV_PASSWORD instead", raw)
+	}
+	if p := u.Port(); p != "" {
+		if port, err := strconv.Atoi(p); err != nil || port <= 0 || port > 65535 {
+			return DAV{}, "", fmt.Errorf("invalid davs URL %q: bad port %q", raw, p)
+		}
+	}
+	p := path.Clean("/" + u.Path)
+	if p == "/" {
+		return DAV{}, "", fmt.Errorf("invalid davs URL %q: expected a library path", raw)
+	}
+	return DAV{BaseURL: "https://" + u.Host, User: u.User.Username()}, p, nil
+}
+
+// loadRemoteEnv fills in the login for an sftp:// library: SFTP_USER unless
+// the URL names the user, SFTP_KEY_FILE and SFTP_PASSWORD, and the
+// known_hosts file. At least one way to log in is required; a running SSH
+// agent (SSH_AUTH_SOCK) counts.
+func loadRemoteEnv(r *Remote) error {
+	if r.User == "" {
+		r.User = strings.TrimSpace(os.Getenv("SFTP_USER"))
+	}
+	if r.User == "" {
+		return errors.New("a user (in the URL or SFTP_USER) is required for an sftp:// NAVIDROME_MUSIC_PATH")
+	}
+	r.KeyFile = strings.TrimSpace(os.Getenv("SFTP_KEY_FILE"))
+	if r.KeyFile != "" {
+		if _, err := os.Stat(r.KeyFile); err != nil {
+			return fmt.Errorf("SFTP_KEY_FILE %q is not accessible: %w", r.KeyFile, err)
+		}
+	}
+	var err error
+	if r.Password, err = secretEnv("SFTP_PASSWORD"); err != nil {
+		return err
+	}
+	if r.KeyFile == "" && r.Password == "" && os.Getenv("SSH_AUTH_SOCK") == "" {
+		return errors.New("an sftp:// NAVIDROME_MUSIC_PATH needs SFTP_KEY_FILE, SFTP_PASSWORD or a running SSH agent")
+	}
+	r.KnownHosts = strings.TrimSpace(os.Getenv("SFTP_KNOWN_HOSTS"))
+	if r.KnownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("SFTP_KNOWN_HOSTS is not set and the home directory is unknown: %w", err)
+		}
+		r.KnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	if _, err := os.Stat(r.KnownHosts); err != nil {
+		return fmt.Errorf("known_hosts file %q is not accessible (set SFTP_KNOWN_HOSTS): %w", r.KnownHosts, err)
+	}
+	return nil
+}
+
+// loadDAVEnv fills in the basic auth credentials: DAV_USER unless the URL
+// names the user, and DAV_PASSWORD.
+func loadDAVEnv(d *DAV) error {
+	if d.User == "" {
+		d.User = strings.TrimSpace(os.Getenv("DAV_USER"))
+	}
+	var err error
+	if d.Password, err = secretEnv("DAV_PASSWORD"); err != nil {
+		return err
+	}
+	if d.User == "" || d.Password == "" {
+		return errors.New("a user (in the URL or DAV_USER) and DAV_PASSWORD are required for a davs:// NAVIDROME_MUSIC_PATH")
+	}
+	return nil
+}
+
+// loadBucketEnv fills in credentials, region and endpoint from the usual
+// AWS variables plus S3_ENDPOINT for S3-compatible services.
+func loadBucketEnv(b *Bucket) error {
+	var err error
+	if b.AccessKeyID, err = secretEnv("AWS_ACCESS_KEY_ID"); err != nil {
+		return err
+	}
+	if b.SecretAccessKey, err = secretEnv("AWS_SECRET_ACCESS_KEY"); err != nil {
+		return err
+	}
+	if b.SessionToken, err = secretEnv("AWS_SESSION_TOKEN"); err != nil {
+		return err
+	}
+	if b.AccessKeyID == "" || b.SecretAccessKey == "" {
+		return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for an s3:// NAVIDROME_MUSIC_PATH")
 	}
-	if !filepath.IsAbs(cfg.NavidromeMusicPath) {
-		return cfg, fmt.Errorf("NAVIDROME_MUSIC_PATH must be an absolute path: %q", cfg.NavidromeMusicPath)
+
+	b.Region = strings.TrimSpace(os.Getenv("AWS_REGION"))
+	if b.Region == "" {
+		b.Region = strings.TrimSpace(os.Getenv("AWS_DEFAULT_REGION"))
+	}
+	if b.Region == "" {
+		b.Region = "us-east-1"
+	}
+
+	b.Endpoint = strings.TrimRight(strings.TrimSpace(os.Getenv("S3_ENDPOINT")), "/")
+	if b.Endpoint == "" {
+		b.Endpoint = "https://s3." + b.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(b.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("S3_ENDPOINT %q must be an http(s) URL", b.Endpoint)
 	}
-	info, err := os.Stat(cfg.NavidromeMusicPath)
+	return nil
+}
+
+// checkDir ensures the setting named name is an absolute path to an existing directory.
+func checkDir(name, path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%s must be an absolute path: %q", name, path)
+	}
+	info, err := os.Stat(path)
 	if err != nil {
-		return cfg, fmt.Errorf("NAVIDROME_MUSIC_PATH %q is not accessible: %w", cfg.NavidromeMusicPath, err)
+		return fmt.Errorf("%s %q is not accessible: %w", name, path, err)
 	}
 	if !info.IsDir() {
-		return cfg, fmt.Errorf("NAVIDROME_MUSIC_PATH %q is not a directory", cfg.NavidromeMusicPath)
+		return fmt.Errorf("%s %q is not a directory", name, path)
 	}
+	return nil
+}
 
-	return cfg, nil
+// ParseMode parses an octal permission string such as "775", "0664" or "0o2775".
+func ParseMode(raw string) (os.FileMode, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(raw), "0o"), "0O")
+	if digits == "" {
+		return 0, fmt.Errorf("invalid mode %q: expected octal digits", raw)
+	}
+	v, err := strconv.ParseUint(digits, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q: expected octal digits", raw)
+	}
+	if v == 0 || v > 0o7777 {
+		return 0, fmt.Errorf("invalid mode %q: must be between 0001 and 7777", raw)
+	}
+
+	mode := os.FileMode(v & 0o777)
+	if v&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if v&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if v&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// ParseOwner parses "uid:gid", "uid" or ":gid" into an Owner; omitted ids are -1.
+func ParseOwner(raw string) (Owner, error) {
+	owner := Owner{UID: -1, GID: -1}
+	uidPart, gidPart, _ := strings.Cut(strings.TrimSpace(raw), ":")
+	if uidPart == "" && gidPart == "" {
+		return owner, fmt.Errorf("invalid owner %q: expected uid:gid", raw)
+	}
+	for _, p := range []struct {
+		text string
+		dest *int
+	}{
+		{uidPart, &owner.UID},
+		{gidPart, &owner.GID},
+	} {
+		if p.text == "" {
+			continue
+		}
+		id, err := strconv.Atoi(p.text)
+		if err != nil || id < 0 {
+			return owner, fmt.Errorf("invalid owner %q: ids must be non-negative integers", raw)
+		}
+		*p.dest = id
+	}
+	return owner, nil
+}
+
+// ParseSizeUnits accepts "binary" or "decimal" (case-insensitive).
+func ParseSizeUnits(raw string) (SizeUnits, error) {
+	switch units := SizeUnits(strings.ToLower(strings.TrimSpace(raw))); units {
+	case BinaryUnits, DecimalUnits:
+		return units, nil
+	}
+	return "", fmt.Errorf("invalid size units %q: expected binary or decimal", raw)
+}
+
+// ParseClassifyExtensions parses comma-separated ext=category pairs such as
+// "mkv=video, .log=docs". Extensions are lowercased and get a leading dot;
+// a category must be a plain folder name.
+func ParseClassifyExtensions(raw string) (map[string]string, error) {
+	classes := make(map[string]string)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		ext, category, ok := strings.Cut(part, "=")
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		category = strings.TrimSpace(category)
+		if !ok || ext == "" || category == "" {
+			return nil, fmt.Errorf("invalid entry %q: expected ext=category", part)
+		}
+		if category == "." || category == ".." || strings.ContainsAny(category, `/\`) {
+			return nil, fmt.Errorf("invalid category %q: must be a single folder name", category)
+		}
+		classes["."+ext] = category
+	}
+	return classes, nil
+}
+
+// sizeSuffixes maps size suffixes (lowercase) to their multiplier: KB, MB
+// and GB are decimal, KiB, MiB and GiB binary.
+var sizeSuffixes = map[string]float64{
+	"": 1, "b": 1,
+	"kb": 1e3, "mb": 1e6, "gb": 1e9,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30,
+}
+
+// ParseSize parses a byte count such as "512", "10KB", "1.5 MiB" or "2GB".
+func ParseSize(raw string) (int64, error) {
+	s := strings.TrimSpace(raw)
+	i := strings.IndexFunc(s, func(c rune) bool { return (c < '0' || c > '9') && c != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	mult, ok := sizeSuffixes[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q (use B, KB, MB, GB, KiB, MiB or GiB)", raw, strings.TrimSpace(s[i:]))
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: expected a number with an optional unit", raw)
+	}
+	return int64(n * mult), nil
 }
@@ -0,0 +1,66 @@
+// Package version reports which build of nd-import is running. Release
+// builds inject the values with -ldflags, e.g.
+//
+//	go build -ldflags "-X cli-navidrome-helper/internal/version.Version=v1.4.0 \
+//	  -X cli-navidrome-helper/internal/version.Commit=$(git rev-parse --short HEAD)" ./cmd/nd-import
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Version and Commit are set at link time; see the package comment.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info. Without an injected Commit it falls back to
+// the VCS revision the Go toolchain embeds, then to "unknown".
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, GoVersion: runtime.Version()}
+	if info.Commit == "" {
+		info.Commit = vcsRevision()
+	}
+	return info
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("nd-import %s (commit %s, %s)", i.Version, i.Commit, i.GoVersion)
+}
+
+func vcsRevision() string {
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	var revision string
+	var dirty bool
+	for _, s := range build.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if dirty {
+		revision += "-dirty"
+	}
+	return revision
+}
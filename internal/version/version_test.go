@@ -0,0 +1,25 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	origVersion, origCommit := Version, Commit
+	t.Cleanup(func() { Version, Commit = origVersion, origCommit })
+
+	Version, Commit = "v1.2.3", "abc1234"
+	info := Get()
+	if info.Version != "v1.2.3" || info.Commit != "abc1234" || info.GoVersion != runtime.Version() {
+		t.Fatalf("Get() = %+v", info)
+	}
+	if want := "nd-import v1.2.3 (commit abc1234, " + runtime.Version() + ")"; info.String() != want {
+		t.Fatalf("String() = %q, want %q", info.String(), want)
+	}
+
+	Commit = ""
+	if Get().Commit == "" {
+		t.Fatalf("Get() without an injected commit should fall back to a revision or \"unknown\"")
+	}
+}